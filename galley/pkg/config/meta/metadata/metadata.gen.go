@@ -610,6 +610,10 @@ snapshots:
   - name: "localAnalysis"
     strategy: immediate
     collections:
+      - "istio/authentication/v1alpha1/meshpolicies"
+      - "istio/authentication/v1alpha1/policies"
+      - "istio/rbac/v1alpha1/clusterrbacconfigs"
+      - "istio/rbac/v1alpha1/rbacconfigs"
       - "istio/rbac/v1alpha1/servicerolebindings"
       - "istio/rbac/v1alpha1/serviceroles"
       - "istio/mesh/v1alpha1/MeshConfig"
@@ -619,11 +623,45 @@ snapshots:
       - "istio/networking/v1alpha3/serviceentries"
       - "istio/networking/v1alpha3/sidecars"
       - "istio/networking/v1alpha3/virtualservices"
+      - "istio/security/v1beta1/authorizationpolicies"
       - "istio/networking/v1alpha3/synthetic/serviceentries"
       - "k8s/core/v1/namespaces"
       - "k8s/core/v1/services"
       - "k8s/core/v1/pods"
 
+      # Legacy Mixer CRDs, reported by the upgrade pre-check
+      - "istio/config/v1alpha2/legacy/apikeys"
+      - "istio/config/v1alpha2/legacy/authorizations"
+      - "istio/config/v1alpha2/legacy/bypasses"
+      - "istio/config/v1alpha2/legacy/checknothings"
+      - "istio/config/v1alpha2/legacy/circonuses"
+      - "istio/config/v1alpha2/legacy/cloudwatches"
+      - "istio/config/v1alpha2/legacy/deniers"
+      - "istio/config/v1alpha2/legacy/dogstatsds"
+      - "istio/config/v1alpha2/legacy/edges"
+      - "istio/config/v1alpha2/legacy/fluentds"
+      - "istio/config/v1alpha2/legacy/kuberneteses"
+      - "istio/config/v1alpha2/legacy/kubernetesenvs"
+      - "istio/config/v1alpha2/legacy/listcheckers"
+      - "istio/config/v1alpha2/legacy/listentries"
+      - "istio/config/v1alpha2/legacy/logentries"
+      - "istio/config/v1alpha2/legacy/memquotas"
+      - "istio/config/v1alpha2/legacy/metrics"
+      - "istio/config/v1alpha2/legacy/noops"
+      - "istio/config/v1alpha2/legacy/opas"
+      - "istio/config/v1alpha2/legacy/prometheuses"
+      - "istio/config/v1alpha2/legacy/quotas"
+      - "istio/config/v1alpha2/legacy/rbacs"
+      - "istio/config/v1alpha2/legacy/redisquotas"
+      - "istio/config/v1alpha2/legacy/reportnothings"
+      - "istio/config/v1alpha2/legacy/signalfxs"
+      - "istio/config/v1alpha2/legacy/solarwindses"
+      - "istio/config/v1alpha2/legacy/stackdrivers"
+      - "istio/config/v1alpha2/legacy/statsds"
+      - "istio/config/v1alpha2/legacy/stdios"
+      - "istio/config/v1alpha2/legacy/tracespans"
+      - "istio/config/v1alpha2/legacy/zipkins"
+
 # Configuration for input sources
 sources:
   # Kubernetes specific configuration.
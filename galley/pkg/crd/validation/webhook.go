@@ -38,11 +38,22 @@ import (
 	mixerCrd "istio.io/istio/mixer/pkg/config/crd"
 	"istio.io/istio/mixer/pkg/config/store"
 	"istio.io/istio/pilot/pkg/config/kube/crd"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/core/v1alpha3"
+	"istio.io/istio/pilot/pkg/networking/core/v1alpha3/route/retry"
+	"istio.io/istio/pilot/pkg/rollout"
 	"istio.io/istio/pkg/config/constants"
 	"istio.io/istio/pkg/config/schema"
+	"istio.io/istio/pkg/config/schemas"
 )
 
 var (
+	// annotationValidators validate the annotations pilot reads from the configuration of a type, keyed by type.
+	annotationValidators = map[string]func(*model.Config) error{
+		schemas.VirtualService.Type:  validateVirtualServiceAnnotations,
+		schemas.DestinationRule.Type: v1alpha3.ValidateDestinationRuleAnnotations,
+	}
+
 	runtimeScheme = runtime.NewScheme()
 	codecs        = serializer.NewCodecFactory(runtimeScheme)
 	deserializer  = codecs.UniversalDeserializer()
@@ -365,6 +376,14 @@ func (wh *Webhook) admitPilot(request *admissionv1beta1.AdmissionRequest) *admis
 		return toAdmissionResponse(fmt.Errorf("configuration is invalid: %v", err))
 	}
 
+	if validate, ok := annotationValidators[s.Type]; ok {
+		if err := validate(out); err != nil {
+			scope.Infof("configuration is invalid: %v", err)
+			reportValidationFailed(request, reasonInvalidConfig)
+			return toAdmissionResponse(fmt.Errorf("configuration is invalid: %v", err))
+		}
+	}
+
 	if reason, err := checkFields(request.Object.Raw, request.Kind.Kind, request.Namespace, obj.Name); err != nil {
 		reportValidationFailed(request, reason)
 		return toAdmissionResponse(err)
@@ -374,6 +393,23 @@ func (wh *Webhook) admitPilot(request *admissionv1beta1.AdmissionRequest) *admis
 	return &admissionv1beta1.AdmissionResponse{Allowed: true}
 }
 
+// validateVirtualServiceAnnotations validates the delegation, retry options and rollout annotations of a
+// virtual service.
+func validateVirtualServiceAnnotations(config *model.Config) error {
+	if err := model.ValidateDelegateAnnotations(*config); err != nil {
+		return err
+	}
+	if _, err := retry.ParseOptions(config.Annotations); err != nil {
+		return err
+	}
+	if value, f := config.Annotations[rollout.Annotation]; f {
+		if _, err := rollout.ParseSpec(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (wh *Webhook) admitMixer(request *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
 	ev := &store.BackendEvent{
 		Key: store.Key{
@@ -40,9 +40,13 @@ import (
 	"k8s.io/client-go/tools/cache"
 	fcache "k8s.io/client-go/tools/cache/testing"
 
+	networking "istio.io/api/networking/v1alpha3"
+
 	"istio.io/istio/mixer/pkg/config/store"
 	"istio.io/istio/pilot/pkg/config/kube/crd"
 	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/core/v1alpha3/route/retry"
+	"istio.io/istio/pilot/pkg/rollout"
 	"istio.io/istio/pilot/test/mock"
 	"istio.io/istio/pkg/config/schemas"
 	"istio.io/istio/pkg/mcp/testing/testcerts"
@@ -347,6 +351,93 @@ func TestAdmitPilot(t *testing.T) {
 	}
 }
 
+func makeVirtualService(t *testing.T, annotations map[string]string) []byte {
+	t.Helper()
+
+	config := model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Type:        schemas.VirtualService.Type,
+			Name:        "reviews",
+			Annotations: annotations,
+		},
+		Spec: &networking.VirtualService{
+			Hosts: []string{"reviews"},
+			Http: []*networking.HTTPRoute{{
+				Name:  "default",
+				Route: []*networking.HTTPRouteDestination{{Destination: &networking.Destination{Host: "reviews"}}},
+			}},
+		},
+	}
+	obj, err := crd.ConvertConfig(schemas.VirtualService, config)
+	if err != nil {
+		t.Fatalf("ConvertConfig(%v) failed: %v", config.Name, err)
+	}
+	raw, err := json.Marshal(&obj)
+	if err != nil {
+		t.Fatalf("Marshal(%v) failed: %v", config.Name, err)
+	}
+	return raw
+}
+
+func TestAdmitPilotAnnotations(t *testing.T) {
+	wh, cancel := createTestWebhook(t, dummyClient, createFakeEndpointsSource(), dummyConfig)
+	defer cancel()
+	wh.descriptor = schemas.Istio
+
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		allowed     bool
+	}{
+		{
+			name:        "valid delegation",
+			annotations: map[string]string{model.DelegateRouteAnnotationPrefix + "default": "team-a/reviews"},
+			allowed:     true,
+		},
+		{
+			name:        "delegation of an unknown route",
+			annotations: map[string]string{model.DelegateRouteAnnotationPrefix + "other": "team-a/reviews"},
+		},
+		{
+			name:        "invalid delegate namespaces",
+			annotations: map[string]string{model.DelegateAnnotation: "team a"},
+		},
+		{
+			name:        "valid retry options",
+			annotations: map[string]string{retry.OptionsAnnotation: `{"baseInterval": "25ms", "maxInterval": "1s"}`},
+			allowed:     true,
+		},
+		{
+			name:        "invalid retry options",
+			annotations: map[string]string{retry.OptionsAnnotation: `{"maxInterval": "1s"}`},
+		},
+		{
+			name: "valid rollout",
+			annotations: map[string]string{rollout.Annotation: `{"destinationRule": "reviews", "stableSubset": "v1", ` +
+				`"canarySubset": "v2", "steps": [10, 50, 100]}`},
+			allowed: true,
+		},
+		{
+			name: "invalid rollout",
+			annotations: map[string]string{rollout.Annotation: `{"destinationRule": "reviews", "stableSubset": "v1", ` +
+				`"canarySubset": "v2", "steps": [50, 10]}`},
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("[%d] %s", i, c.name), func(t *testing.T) {
+			got := wh.admitPilot(&admissionv1beta1.AdmissionRequest{
+				Kind:      metav1.GroupVersionKind{Kind: "VirtualService"},
+				Object:    runtime.RawExtension{Raw: makeVirtualService(t, c.annotations)},
+				Operation: admissionv1beta1.Create,
+			})
+			if got.Allowed != c.allowed {
+				t.Fatalf("got %v want %v: %v", got.Allowed, c.allowed, got.Result)
+			}
+		})
+	}
+}
+
 func makeMixerConfig(t *testing.T, i int, includeBogusKey bool) []byte {
 	t.Helper()
 	uns := &unstructured.Unstructured{}
@@ -70,46 +70,8 @@ istioctl experimental analyze -k -d false
 
 			sa := local.NewSourceAnalyzer(metadata.MustGet(), analyzers.AllCombined(), nil, sd)
 
-			// We use the "namespace" arg that's provided as part of root istioctl as a flag for specifying what namespace to use
-			// for file resources that don't have one specified.
-			// Note that the current implementation (in root.go) doesn't correctly default this value based on --context, so we do that ourselves
-			// below since for the time being we want to keep changes isolated to experimental code. When we merge this into
-			// istioctl validate (see https://github.com/istio/istio/issues/16777) we should look into fixing getDefaultNamespace in root
-			// so it properly handles the --context option.
-			selectedNamespace := namespace
-
-			// If we're using kube, use that as a base source.
-			if useKube {
-				// Set up the kube client
-				config := kube.BuildClientCmd(kubeconfig, configContext)
-				restConfig, err := config.ClientConfig()
-				if err != nil {
-					return err
-				}
-				k := cfgKube.NewInterfaces(restConfig)
-
-				// If a default namespace to inject in files hasn't been explicitly defined already, use whatever is specified in the kube context
-				if selectedNamespace == "" {
-					ns, _, err := config.Namespace()
-					if err != nil {
-						return err
-					}
-					selectedNamespace = ns
-				}
-
-				sa.AddRunningKubeSource(k)
-			}
-
-			// If files are provided, treat them (collectively) as a source.
-			if len(files) > 0 {
-				// // If default namespace to inject wasn't specified by the user or derived from the k8s context, just use the default.
-				if selectedNamespace == "" {
-					selectedNamespace = defaultNamespace
-				}
-
-				if err = sa.AddFileKubeSource(files, selectedNamespace); err != nil {
-					return err
-				}
+			if err = addAnalyzerSources(sa, files); err != nil {
+				return err
 			}
 
 			messages, err := sa.Analyze(cancel)
@@ -135,6 +97,52 @@ istioctl experimental analyze -k -d false
 	return analysisCmd
 }
 
+// addAnalyzerSources adds the live cluster (if --use-kube is set) and the given files as config sources
+// of the analyzer. It is shared by the commands that load config the same way as analyze.
+func addAnalyzerSources(sa *local.SourceAnalyzer, files []string) error {
+	// We use the "namespace" arg that's provided as part of root istioctl as a flag for specifying what namespace to use
+	// for file resources that don't have one specified.
+	// Note that the current implementation (in root.go) doesn't correctly default this value based on --context, so we do that ourselves
+	// below since for the time being we want to keep changes isolated to experimental code. When we merge this into
+	// istioctl validate (see https://github.com/istio/istio/issues/16777) we should look into fixing getDefaultNamespace in root
+	// so it properly handles the --context option.
+	selectedNamespace := namespace
+
+	// If we're using kube, use that as a base source.
+	if useKube {
+		// Set up the kube client
+		config := kube.BuildClientCmd(kubeconfig, configContext)
+		restConfig, err := config.ClientConfig()
+		if err != nil {
+			return err
+		}
+		k := cfgKube.NewInterfaces(restConfig)
+
+		// If a default namespace to inject in files hasn't been explicitly defined already, use whatever is specified in the kube context
+		if selectedNamespace == "" {
+			ns, _, err := config.Namespace()
+			if err != nil {
+				return err
+			}
+			selectedNamespace = ns
+		}
+
+		sa.AddRunningKubeSource(k)
+	}
+
+	// If files are provided, treat them (collectively) as a source.
+	if len(files) > 0 {
+		// // If default namespace to inject wasn't specified by the user or derived from the k8s context, just use the default.
+		if selectedNamespace == "" {
+			selectedNamespace = defaultNamespace
+		}
+
+		return sa.AddFileKubeSource(files, selectedNamespace)
+	}
+
+	return nil
+}
+
 func gatherFiles(args []string) ([]string, error) {
 	var result []string
 	for _, a := range args {
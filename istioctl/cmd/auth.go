@@ -18,8 +18,11 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8s_labels "k8s.io/apimachinery/pkg/labels"
 	kubernetes2 "k8s.io/client-go/kubernetes"
 
 	"istio.io/pkg/log"
@@ -28,8 +31,12 @@ import (
 	"istio.io/istio/istioctl/pkg/kubernetes"
 	"istio.io/istio/istioctl/pkg/util/configdump"
 	"istio.io/istio/istioctl/pkg/util/handlers"
+	"istio.io/istio/pilot/pkg/config/kube/crd"
 	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/schemas"
 	"istio.io/istio/pkg/kube"
+	"istio.io/istio/pkg/spiffe"
 )
 
 var (
@@ -37,6 +44,12 @@ var (
 	configDumpFile string
 	policyFiles    []string
 	serviceFiles   []string
+
+	simulateFiles   []string
+	simulateLabels  map[string]string
+	simulateService string
+	simulateClaims  []string
+	simulateRequest = auth.SimulatedRequest{}
 )
 
 var (
@@ -135,6 +148,68 @@ THIS COMMAND IS STILL UNDER ACTIVE DEVELOPMENT AND NOT READY FOR PRODUCTION USE.
 		},
 	}
 
+	simulateCmd = &cobra.Command{
+		Use:   "simulate [<pod-name>[.<pod-namespace>]]",
+		Short: "Evaluate authorization policies for a simulated request to a workload",
+		Long: `Simulate evaluates the authorization policies that apply to a target workload against a request
+from a given source identity, and reports whether the request is allowed or denied together with the
+policy, rule and condition that decided it.
+
+The RBAC config is generated with the same logic pilot uses for the RBAC filter of the workload. Policies
+are read from the files given with --file, or from the current Kubernetes cluster otherwise. The target
+workload is either a pod in the cluster, or described by --labels and --service.
+
+THIS COMMAND IS STILL UNDER ACTIVE DEVELOPMENT AND NOT READY FOR PRODUCTION USE.
+`,
+		Example: `  # Check if the sleep service account in namespace foo can GET /headers on pod httpbin-88ddbcfdd-nt5jb:
+  istioctl experimental auth simulate httpbin-88ddbcfdd-nt5jb.foo \
+    --principal cluster.local/ns/foo/sa/sleep --method GET --path /headers --port 8000
+
+  # Evaluate policies from local files for a workload with JWT claims:
+  istioctl experimental auth simulate -f policy.yaml --labels app=httpbin --service httpbin.foo.svc.cluster.local \
+    --request-principal issuer.example.com/alice --claim groups=admin --method POST --path /admin`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 1 {
+				cmd.Println(cmd.UsageString())
+				return fmt.Errorf("simulate requires at most one pod name")
+			}
+			if len(args) == 0 && simulateService == "" {
+				cmd.Println(cmd.UsageString())
+				return fmt.Errorf("expecting pod name or --service")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			defer cleanupSimulateForTest()
+
+			configs, err := getSimulationPolicies(simulateFiles)
+			if err != nil {
+				return err
+			}
+			simulator, err := auth.NewSimulator(configs, istioNamespace)
+			if err != nil {
+				return err
+			}
+
+			var instance *model.ServiceInstance
+			if len(args) == 1 {
+				podName, podNamespace := handlers.InferPodInfo(args[0], handlers.HandleNamespace(namespace, defaultNamespace))
+				if instance, err = getSimulationTargetFromPod(podName, podNamespace); err != nil {
+					return err
+				}
+			} else if instance, err = newSimulationTarget(simulateService, simulateLabels, ""); err != nil {
+				return err
+			}
+
+			req := simulateRequest
+			if req.Claims, err = parseClaims(simulateClaims); err != nil {
+				return err
+			}
+			simulator.Simulate(instance, instance.Labels, &req).Print(cmd.OutOrStdout())
+			return nil
+		},
+	}
+
 	validatorCmd = &cobra.Command{
 		Use:   "validate <policy-file1,policy-file2,...>",
 		Short: "Validate authentication and authorization policy",
@@ -212,6 +287,100 @@ func getConfigDumpFromPod(podName, podNamespace string) (*configdump.Wrapper, er
 	return envoyConfig, nil
 }
 
+// getSimulationPolicies reads the authorization configs from files, or from the cluster if no file is given.
+func getSimulationPolicies(files []string) ([]model.Config, error) {
+	if len(files) > 0 {
+		var configs []model.Config
+		for _, f := range files {
+			data, err := ioutil.ReadFile(f)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read file %s: %v", f, err)
+			}
+			c, _, err := crd.ParseInputs(string(data))
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse file %s: %v", f, err)
+			}
+			configs = append(configs, c...)
+		}
+		return configs, nil
+	}
+
+	configClient, err := clientFactory()
+	if err != nil {
+		return nil, err
+	}
+	var configs []model.Config
+	for _, typ := range []string{schemas.AuthorizationPolicy.Type, schemas.ServiceRole.Type, schemas.ServiceRoleBinding.Type,
+		schemas.RbacConfig.Type, schemas.ClusterRbacConfig.Type} {
+		c, err := configClient.List(typ, model.NamespaceAll)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %v", typ, err)
+		}
+		configs = append(configs, c...)
+	}
+	return configs, nil
+}
+
+// getSimulationTargetFromPod builds the service instance of a pod, using the first Kubernetes service
+// that selects it.
+func getSimulationTargetFromPod(podName, podNamespace string) (*model.ServiceInstance, error) {
+	client, err := interfaceFactory(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	pod, err := client.CoreV1().Pods(podNamespace).Get(podName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	svcs, err := client.CoreV1().Services(podNamespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	hostname := ""
+	for _, svc := range svcs.Items {
+		if len(svc.Spec.Selector) > 0 && k8s_labels.SelectorFromSet(svc.Spec.Selector).Matches(k8s_labels.Set(pod.Labels)) {
+			hostname = fmt.Sprintf("%s.%s%s", svc.Name, svc.Namespace, k8sSuffix)
+			break
+		}
+	}
+	if hostname == "" {
+		return nil, fmt.Errorf("no Kubernetes service selects pod %s.%s", podName, podNamespace)
+	}
+	return newSimulationTarget(hostname, pod.Labels, spiffe.MustGenSpiffeURI(podNamespace, pod.Spec.ServiceAccountName))
+}
+
+// newSimulationTarget builds a service instance from a service hostname of the form <name>.<namespace>[.<suffix>].
+func newSimulationTarget(hostname string, workloadLabels map[string]string, serviceAccount string) (*model.ServiceInstance, error) {
+	parts := strings.Split(hostname, ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid service %q, expecting <name>.<namespace>[.svc.cluster.local]", hostname)
+	}
+	return &model.ServiceInstance{
+		Service: &model.Service{
+			Attributes: model.ServiceAttributes{
+				Name:      parts[0],
+				Namespace: parts[1],
+			},
+			Hostname: host.Name(hostname),
+		},
+		Labels:         workloadLabels,
+		ServiceAccount: serviceAccount,
+	}, nil
+}
+
+// parseClaims parses JWT claims given as <claim>=<value>. A claim can be repeated for list values.
+func parseClaims(claims []string) (map[string][]string, error) {
+	out := map[string][]string{}
+	for _, c := range claims {
+		kv := strings.SplitN(c, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid claim %q, expecting <claim>=<value>", c)
+		}
+		out[kv[0]] = append(out[kv[0]], kv[1])
+	}
+	return out, nil
+}
+
 func newUpgrader(v1PolicyFiles, serviceFiles []string) (*auth.Upgrader, error) {
 	if len(v1PolicyFiles) == 0 {
 		return nil, fmt.Errorf("no input file provided")
@@ -246,6 +415,7 @@ func Auth() *cobra.Command {
 		Long: `Commands to inspect and interact with the authentication (TLS, JWT) and authorization (RBAC) policies in the mesh
   check - check the TLS/JWT/RBAC settings based on the Envoy config
 	validate - check for potential incorrect usage in authorization policy files.
+	simulate - evaluate authorization policies for a simulated request.
 `,
 		Example: `  # Check the TLS/JWT/RBAC settings for pod httpbin-88ddbcfdd-nt5jb:
   istioctl experimental auth check httpbin-88ddbcfdd-nt5jb`,
@@ -254,6 +424,7 @@ func Auth() *cobra.Command {
 	cmd.AddCommand(checkCmd)
 	cmd.AddCommand(validatorCmd)
 	cmd.AddCommand(upgradeCmd)
+	cmd.AddCommand(simulateCmd)
 	return cmd
 }
 
@@ -268,6 +439,29 @@ func init() {
 		"Authorization policy files")
 	upgradeCmd.PersistentFlags().StringSliceVarP(&serviceFiles, "service", "s", []string{},
 		"Kubernetes Service resource that provides the mapping relationship between service name and pod labels")
+
+	flags := simulateCmd.PersistentFlags()
+	flags.StringSliceVarP(&simulateFiles, "file", "f", []string{},
+		"Authorization policy files, the policies are read from the cluster if not set")
+	flags.StringToStringVar(&simulateLabels, "labels", nil, "Labels of the target workload if no pod is given")
+	flags.StringVar(&simulateService, "service", "",
+		"Service of the target workload if no pod is given, e.g. httpbin.foo.svc.cluster.local")
+	flags.StringVar(&simulateRequest.Principal, "principal", "",
+		"mTLS identity of the source, e.g. cluster.local/ns/foo/sa/sleep; empty for plain text traffic")
+	flags.StringVar(&simulateRequest.SourceIP, "source-ip", "", "IP address of the source")
+	flags.StringVar(&simulateRequest.RequestPrincipal, "request-principal", "",
+		"JWT principal of the request in the form <issuer>/<subject>")
+	flags.StringVar(&simulateRequest.Audiences, "audiences", "", "JWT audiences of the request")
+	flags.StringVar(&simulateRequest.Presenter, "presenter", "", "JWT authorized presenter of the request")
+	flags.StringArrayVar(&simulateClaims, "claim", nil, "JWT claim of the request in the form <claim>=<value>, may be repeated")
+	flags.StringVar(&simulateRequest.Method, "method", "GET", "HTTP method of the request")
+	flags.StringVar(&simulateRequest.Path, "path", "/", "HTTP path of the request")
+	flags.StringVar(&simulateRequest.Host, "host", "", "HTTP host of the request")
+	flags.StringToStringVar(&simulateRequest.Headers, "header", nil, "HTTP headers of the request")
+	flags.StringVar(&simulateRequest.DestinationIP, "destination-ip", "", "IP address of the target workload")
+	flags.Uint32Var(&simulateRequest.Port, "port", 0, "Port of the target workload")
+	flags.StringVar(&simulateRequest.SNI, "sni", "", "SNI of the connection")
+	flags.BoolVar(&simulateRequest.TCP, "tcp", false, "Simulate a TCP connection instead of an HTTP request")
 }
 
 // cleanupForTest clean the values of policyFiles and serviceFiles. Otherwise, the variables will be
@@ -276,3 +470,16 @@ func cleanupForTest() {
 	policyFiles = nil
 	serviceFiles = nil
 }
+
+// cleanupSimulateForTest resets the flags of the simulate command, which are otherwise kept between runs.
+func cleanupSimulateForTest() {
+	simulateFiles = nil
+	simulateLabels = map[string]string{}
+	simulateService = ""
+	simulateClaims = nil
+	simulateRequest = auth.SimulatedRequest{
+		Method:  "GET",
+		Path:    "/",
+		Headers: map[string]string{},
+	}
+}
@@ -155,3 +155,51 @@ func TestAuthUpgrade(t *testing.T) {
 		}
 	}
 }
+
+func TestAuthSimulate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		args     string
+		expected []string
+	}{
+		{
+			name:     "allowed by policy",
+			args:     "--labels app=httpbin --principal cluster.local/ns/foo/sa/sleep --method GET --path /ip",
+			expected: []string{"ALLOW\n", "matched by policy ns[foo]-policy[httpbin]-rule[0]"},
+		},
+		{
+			name:     "denied by path",
+			args:     "--labels app=httpbin --principal cluster.local/ns/foo/sa/sleep --method GET --path /status",
+			expected: []string{"DENY\n", "no policy matched the request", `header :path == "/headers"`},
+		},
+		{
+			name:     "denied by principal",
+			args:     "--labels app=httpbin --principal cluster.local/ns/bar/sa/sleep --method GET --path /ip",
+			expected: []string{"DENY\n", `source.principal == "cluster.local/ns/foo/sa/sleep"`},
+		},
+		{
+			name:     "no policy for workload",
+			args:     "--labels app=productpage --method GET --path /",
+			expected: []string{"ALLOW\n", "no authorization policy applies to the workload"},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			command := fmt.Sprintf("experimental auth simulate -f testdata/auth/simulate-policy.yaml "+
+				"--service httpbin.foo.svc.cluster.local %s", c.args)
+			out, err := runCommand(c.name, command, t)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(out.String(), c.expected[0]) {
+				t.Errorf("expected decision %q, got:\n%s", c.expected[0], out.String())
+			}
+			for _, e := range c.expected[1:] {
+				if !strings.Contains(out.String(), e) {
+					t.Errorf("expected output to contain %q, got:\n%s", e, out.String())
+				}
+			}
+		})
+	}
+}
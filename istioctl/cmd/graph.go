@@ -0,0 +1,90 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"istio.io/istio/galley/pkg/config/analysis/local"
+	"istio.io/istio/galley/pkg/config/meta/metadata"
+	"istio.io/istio/istioctl/pkg/graph"
+)
+
+var (
+	graphOutput       string
+	graphDomainSuffix string
+)
+
+// Graph command
+func Graph() *cobra.Command {
+	graphCmd := &cobra.Command{
+		Use:   "graph [<file>...]",
+		Short: "Export the service dependency graph of the mesh computed from Istio configuration",
+		Long: `Computes a static service dependency graph from configuration, without using telemetry.
+
+Services, gateways and Sidecar resources are nodes. Edges are derived from VirtualService routes and
+mirrors, and from Sidecar egress hosts. Each edge carries the client TLS mode from the DestinationRule,
+the mTLS mode accepted by the destination, and the authorization resources that may apply to it.
+Configuration is loaded the same way as 'istioctl experimental analyze'.`,
+		Example: `
+# Render the graph of the current live cluster with Graphviz
+istioctl experimental graph -k | dot -Tsvg > mesh.svg
+
+# Export the graph of local files as JSON
+istioctl experimental graph -o json a.yaml b.yaml
+
+# Export the graph of the live cluster, including the effect of additional files, as a Mermaid chart
+istioctl experimental graph -k -o mermaid a.yaml
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			files, err := gatherFiles(args)
+			if err != nil {
+				return err
+			}
+
+			sd, err := serviceDiscovery()
+			if err != nil {
+				return err
+			}
+
+			b := graph.NewBuilder(istioNamespace, graphDomainSuffix)
+			sa := local.NewSourceAnalyzer(metadata.MustGet(), b.Analyzers(), nil, sd)
+			if err = addAnalyzerSources(sa, files); err != nil {
+				return err
+			}
+
+			if _, err = sa.Analyze(make(chan struct{})); err != nil {
+				return err
+			}
+
+			return graph.Write(cmd.OutOrStdout(), b.Build(), graphOutput)
+		},
+	}
+
+	graphCmd.PersistentFlags().BoolVarP(&useKube, "use-kube", "k", false,
+		"Use live Kubernetes cluster to compute the graph")
+	graphCmd.PersistentFlags().StringVarP(&useDiscovery, "discovery", "d", "",
+		"'true' to enable service discovery, 'false' to disable it. "+
+			"Defaults to true if --use-kube is set, false otherwise. "+
+			"Without service discovery only services referenced by Istio configuration appear in the graph.")
+	graphCmd.PersistentFlags().StringVarP(&graphOutput, "output", "o", graph.DotFormat,
+		"Output format: one of "+strings.Join(graph.Formats, "|"))
+	graphCmd.PersistentFlags().StringVar(&graphDomainSuffix, "domain", "cluster.local",
+		"DNS domain suffix of the Kubernetes services")
+
+	return graphCmd
+}
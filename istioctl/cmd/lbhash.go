@@ -0,0 +1,198 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"text/tabwriter"
+
+	adminapi "github.com/envoyproxy/go-control-plane/envoy/admin/v2alpha"
+	apiv2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/spf13/cobra"
+
+	"istio.io/istio/istioctl/pkg/lbhash"
+	"istio.io/istio/istioctl/pkg/util/clusters"
+	"istio.io/istio/istioctl/pkg/util/configdump"
+	"istio.io/istio/istioctl/pkg/util/handlers"
+)
+
+var lbHashCluster string
+
+// keyEndpoint is the endpoint the requests with a hash key are sent to.
+type keyEndpoint struct {
+	key      string
+	hash     uint64
+	endpoint string
+}
+
+func lbHash() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "lb-hash <pod-name[.namespace]> <key>...",
+		Short: "Shows the endpoints the consistent hash load balancer of a proxy picks for hash keys [kube-only]",
+		Long: `Shows the endpoints the consistent hash load balancer of a cluster of the Envoy in the specified pod
+sends the requests with the given hash keys to.
+
+The keys are the values hashed by the consistentHash load balancer of the DestinationRule of the cluster:
+the value of the header or of the cookie, or the source IP. The ring hash or Maglev table of the cluster is
+built from its configuration and its healthy endpoints, as reported by the proxy, the same way as Envoy.
+The locality weights and the priorities of the endpoints are not taken into account.`,
+		Example: `
+# Show the endpoint of the reviews service the ingress gateway sends the session abc123 to
+istioctl experimental lb-hash istio-ingressgateway-5d5b6d8c6c-8xk2v.istio-system abc123 \
+  --cluster "outbound|9080||reviews.default.svc.cluster.local"
+`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 2 {
+				cmd.Println(cmd.UsageString())
+				return fmt.Errorf("lb-hash requires a pod name and at least one key")
+			}
+			if lbHashCluster == "" {
+				cmd.Println(cmd.UsageString())
+				return fmt.Errorf("lb-hash requires a cluster")
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			podName, ns := handlers.InferPodInfo(args[0], handlers.HandleNamespace(namespace, defaultNamespace))
+			kubeClient, err := clientExecFactory(kubeconfig, configContext)
+			if err != nil {
+				return fmt.Errorf("failed to create k8s client: %v", err)
+			}
+			configDump, err := kubeClient.EnvoyDo(podName, ns, "GET", "config_dump", nil)
+			if err != nil {
+				return fmt.Errorf("failed to execute command on envoy: %v", err)
+			}
+			clusterStatuses, err := kubeClient.EnvoyDo(podName, ns, "GET", "clusters?format=json", nil)
+			if err != nil {
+				return fmt.Errorf("failed to execute command on envoy: %v", err)
+			}
+
+			cluster, err := findClusterConfig(configDump, lbHashCluster)
+			if err != nil {
+				return err
+			}
+			status, err := findClusterStatus(clusterStatuses, lbHashCluster)
+			if err != nil {
+				return err
+			}
+			endpoints, err := hashEndpoints(cluster, status, args[1:])
+			if err != nil {
+				return err
+			}
+			printKeyEndpoints(c.OutOrStdout(), endpoints)
+			return nil
+		},
+	}
+	cmd.PersistentFlags().StringVar(&lbHashCluster, "cluster", "", "The name of the cluster, e.g. outbound|9080||reviews.default.svc.cluster.local")
+	return cmd
+}
+
+func findClusterConfig(dump []byte, name string) (*apiv2.Cluster, error) {
+	cd := configdump.Wrapper{}
+	if err := json.Unmarshal(dump, &cd); err != nil {
+		return nil, fmt.Errorf("error unmarshalling config dump response from Envoy: %v", err)
+	}
+	clusterDump, err := cd.GetClusterConfigDump()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range clusterDump.GetDynamicActiveClusters() {
+		if c.GetCluster().GetName() == name {
+			return c.GetCluster(), nil
+		}
+	}
+	for _, c := range clusterDump.GetStaticClusters() {
+		if c.GetCluster().GetName() == name {
+			return c.GetCluster(), nil
+		}
+	}
+	return nil, fmt.Errorf("cluster %q not found", name)
+}
+
+func findClusterStatus(statuses []byte, name string) (*adminapi.ClusterStatus, error) {
+	cw := clusters.Wrapper{}
+	if err := json.Unmarshal(statuses, &cw); err != nil {
+		return nil, fmt.Errorf("error unmarshalling clusters response from Envoy: %v", err)
+	}
+	for _, status := range cw.GetClusterStatuses() {
+		if status.Name == name {
+			return status, nil
+		}
+	}
+	return nil, fmt.Errorf("endpoints of cluster %q not found", name)
+}
+
+// hashEndpoints returns the endpoints of the cluster the requests with the keys are sent to.
+func hashEndpoints(cluster *apiv2.Cluster, status *adminapi.ClusterStatus, keys []string) ([]keyEndpoint, error) {
+	var hosts []lbhash.Host
+	for _, host := range status.HostStatuses {
+		switch host.GetHealthStatus().GetEdsHealthStatus() {
+		case core.HealthStatus_HEALTHY, core.HealthStatus_UNKNOWN:
+		default:
+			continue
+		}
+		if host.GetHealthStatus().GetFailedOutlierCheck() {
+			continue
+		}
+		addr := host.GetAddress().GetSocketAddress()
+		if addr == nil {
+			continue
+		}
+		hosts = append(hosts, lbhash.Host{
+			Address: net.JoinHostPort(addr.Address, strconv.Itoa(int(addr.GetPortValue()))),
+			Weight:  host.Weight,
+		})
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("cluster %q has no healthy endpoints", cluster.Name)
+	}
+
+	var table lbhash.Table
+	var err error
+	switch cluster.LbPolicy {
+	case apiv2.Cluster_RING_HASH:
+		cfg := cluster.GetRingHashLbConfig()
+		table, err = lbhash.NewRing(hosts, cfg.GetMinimumRingSize().GetValue(), cfg.GetMaximumRingSize().GetValue(),
+			cfg.GetHashFunction() == apiv2.Cluster_RingHashLbConfig_MURMUR_HASH_2)
+	case apiv2.Cluster_MAGLEV:
+		table, err = lbhash.NewMaglev(hosts)
+	default:
+		return nil, fmt.Errorf("cluster %q does not use a consistent hash load balancer but %v", cluster.Name, cluster.LbPolicy)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]keyEndpoint, 0, len(keys))
+	for _, key := range keys {
+		hash := lbhash.KeyHash(key)
+		out = append(out, keyEndpoint{key: key, hash: hash, endpoint: hosts[table.Pick(hash)].Address})
+	}
+	return out, nil
+}
+
+func printKeyEndpoints(writer io.Writer, endpoints []keyEndpoint) {
+	w := tabwriter.NewWriter(writer, 0, 8, 1, ' ', 0)
+	fmt.Fprintln(w, "KEY\tHASH\tENDPOINT")
+	for _, e := range endpoints {
+		fmt.Fprintf(w, "%s\t%016x\t%s\n", e.key, e.hash, e.endpoint)
+	}
+	_ = w.Flush()
+}
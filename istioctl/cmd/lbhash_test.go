@@ -0,0 +1,78 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	adminapi "github.com/envoyproxy/go-control-plane/envoy/admin/v2alpha"
+	apiv2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+)
+
+func hostStatus(ip string, health core.HealthStatus) *adminapi.HostStatus {
+	return &adminapi.HostStatus{
+		Address: &core.Address{Address: &core.Address_SocketAddress{SocketAddress: &core.SocketAddress{
+			Address:       ip,
+			PortSpecifier: &core.SocketAddress_PortValue{PortValue: 9080},
+		}}},
+		HealthStatus: &adminapi.HostHealthStatus{EdsHealthStatus: health},
+		Weight:       1,
+	}
+}
+
+func TestHashEndpoints(t *testing.T) {
+	status := &adminapi.ClusterStatus{
+		Name: "outbound|9080||reviews.default.svc.cluster.local",
+		HostStatuses: []*adminapi.HostStatus{
+			hostStatus("10.0.0.1", core.HealthStatus_HEALTHY),
+			hostStatus("10.0.0.2", core.HealthStatus_UNHEALTHY),
+			hostStatus("fd00::3", core.HealthStatus_HEALTHY),
+		},
+	}
+	keys := []string{"a", "b", "c", "d", "e", "f"}
+
+	for _, cluster := range []*apiv2.Cluster{
+		{Name: status.Name, LbPolicy: apiv2.Cluster_RING_HASH},
+		{Name: status.Name, LbPolicy: apiv2.Cluster_MAGLEV},
+	} {
+		t.Run(cluster.LbPolicy.String(), func(t *testing.T) {
+			endpoints, err := hashEndpoints(cluster, status, keys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(endpoints) != len(keys) {
+				t.Fatalf("got %d endpoints, want %d", len(endpoints), len(keys))
+			}
+			for _, e := range endpoints {
+				if e.endpoint != "10.0.0.1:9080" && e.endpoint != "[fd00::3]:9080" {
+					t.Errorf("key %s got endpoint %s", e.key, e.endpoint)
+				}
+			}
+
+			out := &bytes.Buffer{}
+			printKeyEndpoints(out, endpoints)
+			if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != len(keys)+1 {
+				t.Errorf("got output %q", out.String())
+			}
+		})
+	}
+
+	if _, err := hashEndpoints(&apiv2.Cluster{Name: status.Name, LbPolicy: apiv2.Cluster_ROUND_ROBIN}, status, keys); err == nil {
+		t.Error("got no error for a round robin cluster")
+	}
+}
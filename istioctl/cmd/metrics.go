@@ -88,6 +88,24 @@ type workloadMetrics struct {
 func run(c *cobra.Command, args []string) error {
 	log.Debugf("metrics command invoked for workload(s): %v", args)
 
+	return withPrometheus(func(promAPI promv1.API) error {
+		printHeader(c.OutOrStdout())
+
+		workloads := args
+		for _, workload := range workloads {
+			sm, err := metrics(promAPI, workload)
+			if err != nil {
+				return fmt.Errorf("could not build metrics for workload '%s': %v", workload, err)
+			}
+
+			printMetrics(c.OutOrStdout(), sm)
+		}
+		return nil
+	})
+}
+
+// withPrometheus port-forwards to the Prometheus pod of the Istio namespace, and calls fn with its API.
+func withPrometheus(fn func(promAPI promv1.API) error) error {
 	client, err := clientExecFactory(kubeconfig, configContext)
 	if err != nil {
 		return fmt.Errorf("failed to create k8s client: %v", err)
@@ -117,16 +135,8 @@ func run(c *cobra.Command, args []string) error {
 			return err
 		}
 
-		printHeader(c.OutOrStdout())
-
-		workloads := args
-		for _, workload := range workloads {
-			sm, err := metrics(promAPI, workload)
-			if err != nil {
-				return fmt.Errorf("could not build metrics for workload '%s': %v", workload, err)
-			}
-
-			printMetrics(c.OutOrStdout(), sm)
+		if err := fn(promAPI); err != nil {
+			return err
 		}
 		close(fw.StopChannel)
 		return nil
@@ -17,14 +17,11 @@ package cmd
 import (
 	"fmt"
 	"io"
-	"regexp"
 	"strings"
 
 	"github.com/ghodss/yaml"
 	"github.com/spf13/cobra"
 
-	"istio.io/pkg/log"
-
 	"istio.io/istio/istioctl/pkg/util/handlers"
 	"istio.io/istio/istioctl/pkg/writer/envoy/clusters"
 	"istio.io/istio/istioctl/pkg/writer/envoy/configdump"
@@ -327,9 +324,11 @@ func proxyConfig() *cobra.Command {
 	listenerConfigCmd.PersistentFlags().IntVar(&port, "port", 0, "Filter listeners by Port field")
 
 	logCmd := &cobra.Command{
-		Use:   "log <pod-name[.namespace]>",
-		Short: "(experimental) Retrieves logging levels of the Envoy in the specified pod",
-		Long:  "(experimental) Retrieve information about logging levels of the Envoy instance in the specified pod, and update optionally",
+		Use:   "log [<pod-name[.namespace]>|deploy/<deployment-name[.namespace]>]",
+		Short: "(experimental) Retrieves logging levels of the Envoy in the specified pods",
+		Long: "(experimental) Retrieve information about logging levels of the Envoy instances in the specified pod, " +
+			"the pods of a deployment or the pods matching a label selector, and update optionally. " +
+			"The pods are updated in parallel, and their previous levels can be restored automatically after --duration.",
 		Example: `  # Retrieve information about logging levels for a given pod from Envoy.
   istioctl proxy-config log <pod-name[.namespace]>
 
@@ -338,78 +337,48 @@ func proxyConfig() *cobra.Command {
 
   # Reset levels of all the loggers to default value (warning) and retrieve all the information about logging levels.
   istioctl proxy-config log <pod-name[.namespace]> -r
+
+  # Update the levels of all the pods of a deployment, and restore their previous levels after 5 minutes.
+  istioctl proxy-config log deploy/<deployment-name[.namespace]> --level http:debug --duration 5m
+
+  # Update the levels of all the pods matching a label selector.
+  istioctl proxy-config log -l app=productpage --level debug
 `,
 		Aliases: []string{"o"},
 		Args: func(cmd *cobra.Command, args []string) error {
-			if len(args) < 1 {
+			if len(args) < 1 && logSelector == "" {
 				cmd.Println(cmd.UsageString())
 				return fmt.Errorf("log requires pod name")
 			}
+			if len(args) > 0 && logSelector != "" {
+				cmd.Println(cmd.UsageString())
+				return fmt.Errorf("log accepts either a pod or deployment name or --selector, not both")
+			}
 			return nil
 		},
 		RunE: func(c *cobra.Command, args []string) error {
-			podName, ns := handlers.InferPodInfo(args[0], handlers.HandleNamespace(namespace, defaultNamespace))
-			loggerNames, err := setupEnvoyLogConfig("", podName, ns)
+			targets, err := logTargets(args)
 			if err != nil {
 				return err
 			}
-
-			destLoggerLevels := map[string]Level{}
-			if reset {
-				// reset logging level to `defaultOutputLevel`, and ignore the `level` option
-				levelString, _ := getLogLevelFromConfigMap()
-				level, ok := stringToLevel[levelString]
-				if ok {
-					destLoggerLevels[defaultLoggerName] = level
-				} else {
-					log.Warnf("unable to get logLevel from ConfigMap istio-sidecar-injector, using default value: %v",
-						levelToString[defaultOutputLevel])
-					destLoggerLevels[defaultLoggerName] = defaultOutputLevel
-				}
-			} else if loggerLevelString != "" {
-				levels := strings.Split(loggerLevelString, ",")
-				for _, ol := range levels {
-					if !strings.Contains(ol, ":") && !strings.Contains(ol, "=") {
-						level, ok := stringToLevel[ol]
-						if ok {
-							destLoggerLevels = map[string]Level{
-								defaultLoggerName: level,
-							}
-						} else {
-							return fmt.Errorf("unrecognized logging level: %v", ol)
-						}
-					} else {
-						loggerLevel := regexp.MustCompile(`[:=]`).Split(ol, 2)
-						if !strings.Contains(loggerNames, loggerLevel[0]) {
-							return fmt.Errorf("unrecognized logger name: %v", loggerLevel[0])
-						}
-						level, ok := stringToLevel[loggerLevel[1]]
-						if !ok {
-							return fmt.Errorf("unrecognized logging level: %v", loggerLevel[1])
-						}
-						destLoggerLevels[loggerLevel[0]] = level
-					}
-				}
-			}
-
-			var resp string
-			if len(destLoggerLevels) == 0 {
-				resp, err = setupEnvoyLogConfig("", podName, ns)
-			} else {
-				if ll, ok := destLoggerLevels[defaultLoggerName]; ok {
-					// update levels of all loggers first
-					resp, err = setupEnvoyLogConfig(defaultLoggerName+"="+levelToString[ll], podName, ns)
-					delete(destLoggerLevels, defaultLoggerName)
-				}
-				for lg, ll := range destLoggerLevels {
-					resp, err = setupEnvoyLogConfig(lg+"="+levelToString[ll], podName, ns)
-				}
+			loggerNames, err := setupEnvoyLogConfig("", targets[0].name, targets[0].namespace)
+			if err != nil {
+				return err
 			}
+			destLoggerLevels, err := parseLoggerLevels(loggerNames)
 			if err != nil {
 				return err
 			}
-			_, _ = fmt.Fprint(c.OutOrStdout(), resp)
-			return nil
+
+			if len(targets) == 1 && logDuration == 0 {
+				resp, err := updateEnvoyLogLevels(targets[0], destLoggerLevels)
+				if err != nil {
+					return err
+				}
+				_, _ = fmt.Fprint(c.OutOrStdout(), resp)
+				return nil
+			}
+			return updateEnvoyLogLevelsForAll(targets, destLoggerLevels, c.OutOrStdout())
 		},
 	}
 
@@ -423,6 +392,10 @@ func proxyConfig() *cobra.Command {
 		levelToString[OffLevel])
 	s := strings.Join(activeLoggers, ", ")
 	logCmd.PersistentFlags().BoolVarP(&reset, "reset", "r", reset, "Specify if the reset log level to default value (warning).")
+	logCmd.PersistentFlags().StringVarP(&logSelector, "selector", "l", "",
+		"Label selector of the pods to update, instead of a pod or deployment name")
+	logCmd.PersistentFlags().DurationVar(&logDuration, "duration", 0,
+		"Restore the previous logging levels after this duration. Zero keeps the new levels")
 	logCmd.PersistentFlags().StringVar(&loggerLevelString, "level", loggerLevelString,
 		fmt.Sprintf("Comma-separated minimum per-logger level of messages to output, in the form of"+
 			" <logger>:<level>,<logger>:<level>,... where logger can be one of %s and level can be one of %s",
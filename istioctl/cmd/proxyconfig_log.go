@@ -0,0 +1,335 @@
+// Copyright 2019 Istio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	multierror "github.com/hashicorp/go-multierror"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"istio.io/pkg/log"
+
+	"istio.io/istio/istioctl/pkg/util/handlers"
+)
+
+var (
+	logSelector string
+	logDuration time.Duration
+
+	// logRestoreSignal is notified when the wait for --duration is interrupted. Replaced in tests.
+	logRestoreSignal = func(c chan<- os.Signal) func() {
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+		return func() { signal.Stop(c) }
+	}
+)
+
+// logTarget is a pod whose Envoy logging levels are managed.
+type logTarget struct {
+	name      string
+	namespace string
+}
+
+func (t logTarget) String() string {
+	return t.name + "." + t.namespace
+}
+
+// logTargets returns the pods designated by the arguments of the log command: a pod name,
+// deploy/<name> or the pods matching --selector.
+func logTargets(args []string) ([]logTarget, error) {
+	ns := handlers.HandleNamespace(namespace, defaultNamespace)
+	if logSelector != "" {
+		return runningPodsForSelector(ns, logSelector)
+	}
+
+	for _, prefix := range []string{"deploy/", "deployment/", "deployments/"} {
+		if !strings.HasPrefix(args[0], prefix) {
+			continue
+		}
+		name, ns := handlers.InferPodInfo(strings.TrimPrefix(args[0], prefix), ns)
+		client, err := interfaceFactory(kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+		deployment, err := client.AppsV1().Deployments(ns).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector of deployment %s.%s: %v", name, ns, err)
+		}
+		return runningPodsForSelector(ns, selector.String())
+	}
+
+	podName, ns := handlers.InferPodInfo(args[0], ns)
+	return []logTarget{{name: podName, namespace: ns}}, nil
+}
+
+func runningPodsForSelector(ns, selector string) ([]logTarget, error) {
+	client, err := interfaceFactory(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := client.CoreV1().Pods(ns).List(metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	var targets []logTarget
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == v1.PodRunning {
+			targets = append(targets, logTarget{name: pod.Name, namespace: pod.Namespace})
+		}
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no running pods match %q in namespace %s", selector, ns)
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].name < targets[j].name })
+	return targets, nil
+}
+
+// parseLoggerLevels returns the logging levels requested by the --reset and --level flags,
+// checking the logger names against the loggers of Envoy.
+func parseLoggerLevels(loggerNames string) (map[string]Level, error) {
+	destLoggerLevels := map[string]Level{}
+	if reset {
+		// reset logging level to `defaultOutputLevel`, and ignore the `level` option
+		levelString, _ := getLogLevelFromConfigMap()
+		level, ok := stringToLevel[levelString]
+		if ok {
+			destLoggerLevels[defaultLoggerName] = level
+		} else {
+			log.Warnf("unable to get logLevel from ConfigMap istio-sidecar-injector, using default value: %v",
+				levelToString[defaultOutputLevel])
+			destLoggerLevels[defaultLoggerName] = defaultOutputLevel
+		}
+	} else if loggerLevelString != "" {
+		levels := strings.Split(loggerLevelString, ",")
+		for _, ol := range levels {
+			if !strings.Contains(ol, ":") && !strings.Contains(ol, "=") {
+				level, ok := stringToLevel[ol]
+				if ok {
+					destLoggerLevels = map[string]Level{
+						defaultLoggerName: level,
+					}
+				} else {
+					return nil, fmt.Errorf("unrecognized logging level: %v", ol)
+				}
+			} else {
+				loggerLevel := regexp.MustCompile(`[:=]`).Split(ol, 2)
+				if !strings.Contains(loggerNames, loggerLevel[0]) {
+					return nil, fmt.Errorf("unrecognized logger name: %v", loggerLevel[0])
+				}
+				level, ok := stringToLevel[loggerLevel[1]]
+				if !ok {
+					return nil, fmt.Errorf("unrecognized logging level: %v", loggerLevel[1])
+				}
+				destLoggerLevels[loggerLevel[0]] = level
+			}
+		}
+	}
+	return destLoggerLevels, nil
+}
+
+// updateEnvoyLogLevels sets the logging levels of the Envoy in the pod, and returns its resulting levels.
+func updateEnvoyLogLevels(t logTarget, destLoggerLevels map[string]Level) (string, error) {
+	if len(destLoggerLevels) == 0 {
+		return setupEnvoyLogConfig("", t.name, t.namespace)
+	}
+
+	var resp string
+	var err error
+	if ll, ok := destLoggerLevels[defaultLoggerName]; ok {
+		// update levels of all loggers first
+		if resp, err = setupEnvoyLogConfig(defaultLoggerName+"="+levelToString[ll], t.name, t.namespace); err != nil {
+			return "", err
+		}
+	}
+	for lg, ll := range destLoggerLevels {
+		if lg == defaultLoggerName {
+			continue
+		}
+		if resp, err = setupEnvoyLogConfig(lg+"="+levelToString[ll], t.name, t.namespace); err != nil {
+			return "", err
+		}
+	}
+	return resp, nil
+}
+
+// getEnvoyLogLevels returns the current level of each logger of the Envoy in the pod.
+func getEnvoyLogLevels(t logTarget) (map[string]Level, error) {
+	resp, err := setupEnvoyLogConfig("", t.name, t.namespace)
+	if err != nil {
+		return nil, err
+	}
+	return parseEnvoyLogLevels(resp)
+}
+
+// parseEnvoyLogLevels parses the "active loggers" output of the Envoy logging endpoint.
+func parseEnvoyLogLevels(resp string) (map[string]Level, error) {
+	levels := map[string]Level{}
+	scanner := bufio.NewScanner(strings.NewReader(resp))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasSuffix(line, ":") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("unexpected logging output: %q", line)
+		}
+		level, ok := stringToLevel[strings.TrimSpace(parts[1])]
+		if !ok {
+			return nil, fmt.Errorf("unrecognized logging level: %v", parts[1])
+		}
+		levels[strings.TrimSpace(parts[0])] = level
+	}
+	if len(levels) == 0 {
+		return nil, fmt.Errorf("no loggers found in logging output: %q", resp)
+	}
+	return levels, nil
+}
+
+// restoreLevels returns the levels to set to go back to the given levels with as few requests as possible:
+// the most common level for all the loggers, then the loggers with a different level.
+func restoreLevels(previous map[string]Level) map[string]Level {
+	counts := map[Level]int{}
+	for _, l := range previous {
+		counts[l]++
+	}
+	common := defaultOutputLevel
+	for l, n := range counts {
+		if n > counts[common] || (n == counts[common] && l < common) {
+			common = l
+		}
+	}
+	out := map[string]Level{defaultLoggerName: common}
+	for lg, l := range previous {
+		if l != common {
+			out[lg] = l
+		}
+	}
+	return out
+}
+
+type logResult struct {
+	target logTarget
+	output string
+	err    error
+}
+
+// forEachLogTarget calls f for each of the pods in parallel, and returns the results in the order of the pods.
+func forEachLogTarget(targets []logTarget, f func(t logTarget) (string, error)) []logResult {
+	results := make([]logResult, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t logTarget) {
+			defer wg.Done()
+			output, err := f(t)
+			results[i] = logResult{target: t, output: output, err: err}
+		}(i, t)
+	}
+	wg.Wait()
+	return results
+}
+
+// updateEnvoyLogLevelsForAll sets the logging levels of the Envoys in all the pods and reports the result of each pod.
+// If --duration is set, the previous levels are restored once it elapses, or when interrupted, and if the levels of
+// a pod can not be set, the previous levels of all the pods that may have been changed are restored right away.
+// Without --duration the changes are permanent and are left as they are on error.
+func updateEnvoyLogLevelsForAll(targets []logTarget, destLoggerLevels map[string]Level, out io.Writer) error {
+	update := len(destLoggerLevels) > 0
+	restore := update && logDuration > 0
+
+	// previous holds the levels of the pods whose levels may have been changed, even partially, by a change
+	// bound to --duration.
+	previous := map[logTarget]map[string]Level{}
+	var mu sync.Mutex
+	results := forEachLogTarget(targets, func(t logTarget) (string, error) {
+		if restore {
+			levels, err := getEnvoyLogLevels(t)
+			if err != nil {
+				return "", fmt.Errorf("failed to get the current levels: %v", err)
+			}
+			mu.Lock()
+			previous[t] = levels
+			mu.Unlock()
+		}
+		return updateEnvoyLogLevels(t, destLoggerLevels)
+	})
+
+	var errs error
+	for _, r := range results {
+		switch {
+		case r.err != nil:
+			errs = multierror.Append(errs, fmt.Errorf("%v: %v", r.target, r.err))
+			_, _ = fmt.Fprintf(out, "%v: error: %v\n", r.target, r.err)
+		case !update:
+			_, _ = fmt.Fprintf(out, "%v:\n%v", r.target, r.output)
+		default:
+			_, _ = fmt.Fprintf(out, "%v: logging levels updated\n", r.target)
+		}
+	}
+	if len(previous) == 0 {
+		return errs
+	}
+	if errs != nil {
+		_, _ = fmt.Fprintln(out, "Restoring the previous logging levels...")
+		return restoreEnvoyLogLevels(targets, previous, errs, out)
+	}
+
+	_, _ = fmt.Fprintf(out, "Restoring the previous logging levels in %v, interrupt to restore them now...\n", logDuration)
+	interrupted := make(chan os.Signal, 1)
+	stop := logRestoreSignal(interrupted)
+	select {
+	case <-time.After(logDuration):
+	case <-interrupted:
+	}
+	stop()
+	return restoreEnvoyLogLevels(targets, previous, nil, out)
+}
+
+// restoreEnvoyLogLevels restores the previous logging levels of the pods, and adds the errors to errs.
+func restoreEnvoyLogLevels(targets []logTarget, previous map[logTarget]map[string]Level, errs error, out io.Writer) error {
+	var restored []logTarget
+	for _, t := range targets {
+		if _, ok := previous[t]; ok {
+			restored = append(restored, t)
+		}
+	}
+	for _, r := range forEachLogTarget(restored, func(t logTarget) (string, error) {
+		return updateEnvoyLogLevels(t, restoreLevels(previous[t]))
+	}) {
+		if r.err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("%v: failed to restore logging levels: %v", r.target, r.err))
+			_, _ = fmt.Fprintf(out, "%v: error: failed to restore logging levels: %v\n", r.target, r.err)
+			continue
+		}
+		_, _ = fmt.Fprintf(out, "%v: logging levels restored\n", r.target)
+	}
+	return errs
+}
@@ -0,0 +1,213 @@
+// Copyright 2019 Istio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"istio.io/istio/istioctl/pkg/kubernetes"
+	"istio.io/istio/pilot/test/util"
+)
+
+func TestProxyConfigLogMultiplePods(t *testing.T) {
+	logging := util.ReadFile("../pkg/writer/envoy/logging/testdata/logging.txt", t)
+	loggingConfig := map[string][]byte{
+		"productpage-v1-a": logging,
+		"productpage-v1-b": logging,
+	}
+	labels := map[string]string{"app": "productpage"}
+	k8sConfigs := []runtime.Object{
+		logTestPod("productpage-v1-a", labels, v1.PodRunning),
+		logTestPod("productpage-v1-b", labels, v1.PodRunning),
+		logTestPod("productpage-v1-c", labels, v1.PodPending),
+		logTestPod("details-v1-a", map[string]string{"app": "details"}, v1.PodRunning),
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "productpage-v1", Namespace: "default"},
+			Spec: appsv1.DeploymentSpec{
+				Selector: &metav1.LabelSelector{MatchLabels: labels},
+			},
+		},
+	}
+
+	cases := []execTestCase{
+		{ // read the levels of the pods matching the selector
+			execClientConfig: loggingConfig,
+			args:             strings.Split("proxy-config log -l app=productpage -n default", " "),
+			expectedString:   "productpage-v1-b.default:\nactive loggers:",
+		},
+		{ // update the pods of a deployment and restore them
+			execClientConfig: loggingConfig,
+			args:             strings.Split("proxy-config log deploy/productpage-v1.default --level debug --duration 10ms", " "),
+			expectedOutput: "productpage-v1-a.default: logging levels updated\n" +
+				"productpage-v1-b.default: logging levels updated\n" +
+				"Restoring the previous logging levels in 10ms, interrupt to restore them now...\n" +
+				"productpage-v1-a.default: logging levels restored\n" +
+				"productpage-v1-b.default: logging levels restored\n",
+		},
+		{ // unknown logger name
+			execClientConfig: loggingConfig,
+			args:             strings.Split("proxy-config log -l app=productpage -n default --level xxx:debug", " "),
+			expectedString:   "Error: unrecognized logger name: xxx",
+			wantException:    true,
+		},
+		{ // a pod and a selector
+			execClientConfig: loggingConfig,
+			args:             strings.Split("proxy-config log productpage-v1-a -l app=productpage", " "),
+			expectedString:   "Error: log accepts either a pod or deployment name or --selector, not both",
+			wantException:    true,
+		},
+		{ // no running pod matches
+			execClientConfig: loggingConfig,
+			args:             strings.Split("proxy-config log -l app=reviews -n default", " "),
+			expectedString:   `Error: no running pods match "app=reviews" in namespace default`,
+			wantException:    true,
+		},
+		{ // unknown deployment
+			execClientConfig: loggingConfig,
+			args:             strings.Split("proxy-config log deploy/reviews-v1.default", " "),
+			expectedString:   `Error: deployments.apps "reviews-v1" not found`,
+			wantException:    true,
+		},
+	}
+
+	interfaceFactory = mockInterfaceFactoryGenerator(k8sConfigs)
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("case %d %s", i, strings.Join(c.args, " ")), func(t *testing.T) {
+			verifyExecTestOutput(t, c)
+		})
+	}
+}
+
+// failingLogExecConfig fails to set the level of the http logger of a pod.
+type failingLogExecConfig struct {
+	mockExecConfig
+	failPod string
+}
+
+func (client failingLogExecConfig) EnvoyDo(podName, podNamespace, method, path string, body []byte) ([]byte, error) {
+	if podName == client.failPod && strings.Contains(path, "http=") {
+		return nil, fmt.Errorf("connection reset")
+	}
+	return client.mockExecConfig.EnvoyDo(podName, podNamespace, method, path, body)
+}
+
+func TestUpdateEnvoyLogLevelsForAllRestoresOnError(t *testing.T) {
+	logging := util.ReadFile("../pkg/writer/envoy/logging/testdata/logging.txt", t)
+	defer func(f func(kubeconfig, configContext string) (kubernetes.ExecClient, error)) {
+		clientExecFactory = f
+	}(clientExecFactory)
+	clientExecFactory = func(kubeconfig, configContext string) (kubernetes.ExecClient, error) {
+		return failingLogExecConfig{
+			mockExecConfig: mockExecConfig{results: map[string][]byte{"productpage-v1-a": logging, "productpage-v1-b": logging}},
+			failPod:        "productpage-v1-b",
+		}, nil
+	}
+	defer func(d time.Duration) { logDuration = d }(logDuration)
+
+	updated := "productpage-v1-a.default: logging levels updated\n" +
+		"productpage-v1-b.default: error: failed to execute command on Envoy: connection reset\n"
+	cases := []struct {
+		name     string
+		duration time.Duration
+		want     string
+	}{
+		{
+			// The level of all the loggers of productpage-v1-b was changed before the http logger failed.
+			name:     "with duration",
+			duration: time.Hour,
+			want: updated +
+				"Restoring the previous logging levels...\n" +
+				"productpage-v1-a.default: logging levels restored\n" +
+				"productpage-v1-b.default: logging levels restored\n",
+		},
+		{
+			// Permanent changes are not undone.
+			name: "without duration",
+			want: updated,
+		},
+	}
+	targets := []logTarget{{name: "productpage-v1-a", namespace: "default"}, {name: "productpage-v1-b", namespace: "default"}}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			logDuration = c.duration
+			var out bytes.Buffer
+			err := updateEnvoyLogLevelsForAll(targets, map[string]Level{defaultLoggerName: DebugLevel, "http": TraceLevel}, &out)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if out.String() != c.want {
+				t.Errorf("got output\n%s\nwant\n%s", out.String(), c.want)
+			}
+		})
+	}
+}
+
+func TestRestoreLevels(t *testing.T) {
+	cases := []struct {
+		name     string
+		previous map[string]Level
+		want     map[string]Level
+	}{
+		{
+			name:     "same level",
+			previous: map[string]Level{"http": WarningLevel, "upstream": WarningLevel, "admin": WarningLevel},
+			want:     map[string]Level{defaultLoggerName: WarningLevel},
+		},
+		{
+			name:     "overrides",
+			previous: map[string]Level{"http": DebugLevel, "upstream": InfoLevel, "admin": InfoLevel},
+			want:     map[string]Level{defaultLoggerName: InfoLevel, "http": DebugLevel},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := restoreLevels(c.previous); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("restoreLevels() got %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestParseEnvoyLogLevels(t *testing.T) {
+	got, err := parseEnvoyLogLevels("active loggers:\n  admin: warning\n  http: debug\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Level{"admin": WarningLevel, "http": DebugLevel}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseEnvoyLogLevels() got %v, want %v", got, want)
+	}
+
+	if _, err := parseEnvoyLogLevels("active loggers:\n  admin: loud\n"); err == nil {
+		t.Errorf("parseEnvoyLogLevels() expected an error for an unknown level")
+	}
+}
+
+func logTestPod(name string, labels map[string]string, phase v1.PodPhase) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: labels},
+		Status:     v1.PodStatus{Phase: phase},
+	}
+}
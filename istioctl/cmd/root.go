@@ -140,6 +140,10 @@ debug and diagnose their Istio mesh.
 	experimentalCmd.AddCommand(addToMeshCmd())
 	experimentalCmd.AddCommand(removeFromMeshCmd())
 	experimentalCmd.AddCommand(Analyze())
+	experimentalCmd.AddCommand(Graph())
+	experimentalCmd.AddCommand(Sidecar())
+	experimentalCmd.AddCommand(lbHash())
+	experimentalCmd.AddCommand(install.NewPrecheckCommand())
 
 	postInstallCmd.AddCommand(Webhook())
 	experimentalCmd.AddCommand(postInstallCmd)
@@ -153,6 +157,7 @@ debug and diagnose their Istio mesh.
 	experimentalCmd.AddCommand(profileCmd)
 
 	experimentalCmd.AddCommand(multicluster.NewCreateRemoteSecretCommand(&kubeconfig, &configContext, &istioNamespace))
+	experimentalCmd.AddCommand(multicluster.NewMulticlusterCommand(&kubeconfig, &istioNamespace))
 
 	rootCmd.AddCommand(collateral.CobraCommand(rootCmd, &doc.GenManHeader{
 		Title:   "Istio Control",
@@ -0,0 +1,224 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	prommodel "github.com/prometheus/common/model"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"istio.io/istio/istioctl/pkg/sidecar"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/serviceregistry/external"
+	kube_registry "istio.io/istio/pilot/pkg/serviceregistry/kube"
+	"istio.io/istio/pkg/config/schemas"
+)
+
+var (
+	sidecarFromPrometheus      bool
+	sidecarPrometheusWindow    time.Duration
+	sidecarFromFile            string
+	sidecarFromVirtualServices bool
+	sidecarScope               string
+	sidecarPrintQuery          bool
+	sidecarDomainSuffix        string
+)
+
+// Sidecar command
+func Sidecar() *cobra.Command {
+	sidecarCmd := &cobra.Command{
+		Use:   "sidecar",
+		Short: "Manage the Sidecar resources of the mesh",
+	}
+	sidecarCmd.AddCommand(sidecarGenerate())
+	return sidecarCmd
+}
+
+func sidecarGenerate() *cobra.Command {
+	generateCmd := &cobra.Command{
+		Use:   "generate",
+		Short: "Generate Sidecar resources limiting the proxies to the hosts they depend on [kube-only]",
+		Long: `Generates the Sidecar resources importing only the hosts the workloads depend on, so that their proxies
+do not receive the configuration of the whole mesh.
+
+The dependencies are the hosts called by the workloads, observed in the istio_requests_total and
+istio_tcp_connections_opened_total metrics of Prometheus, or of a local export of them, and the hosts of
+the VirtualServices declared in each namespace. They are completed with the destinations of the
+VirtualServices of the hosts, and the Sidecars always import the services of the Istio namespace.
+
+The Sidecars are written as YAML to the standard output, and a report of the number of services and
+outbound clusters of the proxies, with the default scope and with the generated Sidecar, is written to
+the standard error.`,
+		Example: `
+# Generate a Sidecar per namespace from the requests of the last 7 days
+istioctl experimental sidecar generate --prometheus --window 168h > sidecars.yaml
+
+# Generate a Sidecar per workload of the default namespace, from an export of the query of Prometheus
+istioctl experimental sidecar generate --scope workload -n default --prometheus-export requests.json
+
+# Print the query to export from Prometheus
+istioctl experimental sidecar generate --print-query
+`,
+		RunE: func(c *cobra.Command, args []string) error {
+			if sidecarPrintQuery {
+				fmt.Fprintln(c.OutOrStdout(), sidecar.PrometheusQuery(sidecarPrometheusWindow))
+				return nil
+			}
+			if !sidecarFromPrometheus && sidecarFromFile == "" && !sidecarFromVirtualServices {
+				c.Println(c.UsageString())
+				return errors.New("at least one of --prometheus, --prometheus-export and --virtual-services is required")
+			}
+
+			configClient, err := clientFactory()
+			if err != nil {
+				return err
+			}
+			services, configs, err := meshServicesAndConfigs(configClient)
+			if err != nil {
+				return err
+			}
+			gen, err := sidecar.NewGenerator(services, configs, istioNamespace, sidecarDomainSuffix)
+			if err != nil {
+				return err
+			}
+
+			var deps []sidecar.Dependency
+			if sidecarFromVirtualServices {
+				deps = append(deps, gen.VirtualServiceDependencies()...)
+			}
+			if sidecarFromFile != "" {
+				f, err := os.Open(sidecarFromFile)
+				if err != nil {
+					return err
+				}
+				fileDeps, err := sidecar.ReadPrometheusExport(f)
+				_ = f.Close()
+				if err != nil {
+					return fmt.Errorf("%s: %v", sidecarFromFile, err)
+				}
+				deps = append(deps, fileDeps...)
+			}
+			if sidecarFromPrometheus {
+				if err := withPrometheus(func(promAPI promv1.API) error {
+					promDeps, err := prometheusDependencies(promAPI)
+					deps = append(deps, promDeps...)
+					return err
+				}); err != nil {
+					return err
+				}
+			}
+
+			if namespace != "" {
+				filtered := deps[:0]
+				for _, dep := range deps {
+					if dep.Namespace == namespace {
+						filtered = append(filtered, dep)
+					}
+				}
+				deps = filtered
+			}
+
+			sidecars, reports, err := gen.Generate(deps, sidecarScope)
+			if err != nil {
+				return err
+			}
+			printYamlOutput(c.OutOrStdout(), configClient, sidecars)
+			printSidecarReports(c.ErrOrStderr(), reports)
+			return nil
+		},
+	}
+
+	generateCmd.PersistentFlags().BoolVar(&sidecarFromPrometheus, "prometheus", false,
+		"Use the hosts called by the workloads, queried from the Prometheus of the Istio namespace")
+	generateCmd.PersistentFlags().DurationVar(&sidecarPrometheusWindow, "window", 24*time.Hour,
+		"Duration of the window of the Prometheus query")
+	generateCmd.PersistentFlags().StringVar(&sidecarFromFile, "prometheus-export", "",
+		"Use the hosts called by the workloads, read from a JSON export of the Prometheus query, "+
+			"as returned by the /api/v1/query endpoint of Prometheus")
+	generateCmd.PersistentFlags().BoolVar(&sidecarFromVirtualServices, "virtual-services", false,
+		"Use the hosts of the VirtualServices of each namespace")
+	generateCmd.PersistentFlags().StringVar(&sidecarScope, "scope", sidecar.NamespaceScope,
+		"Generate a Sidecar per: "+strings.Join(sidecar.Scopes, "|"))
+	generateCmd.PersistentFlags().BoolVar(&sidecarPrintQuery, "print-query", false,
+		"Print the Prometheus query of the dependencies over the window, and exit")
+	generateCmd.PersistentFlags().StringVar(&sidecarDomainSuffix, "domain", "cluster.local",
+		"DNS domain suffix of the Kubernetes services")
+
+	return generateCmd
+}
+
+// meshServicesAndConfigs returns the Kubernetes services and ServiceEntries of the mesh, and its Istio configs.
+func meshServicesAndConfigs(configClient model.ConfigStore) ([]*model.Service, []model.Config, error) {
+	client, err := interfaceFactory(kubeconfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	kubeServices, err := client.CoreV1().Services(metav1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list services: %v", err)
+	}
+	var services []*model.Service
+	for _, svc := range kubeServices.Items {
+		services = append(services, kube_registry.ConvertService(svc, sidecarDomainSuffix, ""))
+	}
+
+	var configs []model.Config
+	for _, typ := range []string{schemas.VirtualService.Type, schemas.ServiceEntry.Type} {
+		list, err := configClient.List(typ, metav1.NamespaceAll)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list %s: %v", typ, err)
+		}
+		configs = append(configs, list...)
+	}
+	for _, cfg := range configs {
+		if cfg.Type == schemas.ServiceEntry.Type {
+			services = append(services, external.ConvertServices(cfg)...)
+		}
+	}
+	return services, configs, nil
+}
+
+func prometheusDependencies(promAPI promv1.API) ([]sidecar.Dependency, error) {
+	query := sidecar.PrometheusQuery(sidecarPrometheusWindow)
+	val, err := promAPI.Query(context.Background(), query, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("query() failure for '%s': %v", query, err)
+	}
+	samples, ok := val.(prommodel.Vector)
+	if !ok {
+		return nil, errors.New("bad metric value type returned for query")
+	}
+	return sidecar.DependenciesFromSamples(samples), nil
+}
+
+func printSidecarReports(writer io.Writer, reports []sidecar.Report) {
+	w := tabwriter.NewWriter(writer, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tSIDECAR\tHOSTS\tSERVICES\tCLUSTERS")
+	for _, r := range reports {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d -> %d\t%d -> %d\n", r.Namespace, r.Name, r.Hosts,
+			r.ServicesBefore, r.ServicesAfter, r.ClustersBefore, r.ClustersAfter)
+	}
+	_ = w.Flush()
+}
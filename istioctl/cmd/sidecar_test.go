@@ -0,0 +1,106 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/schemas"
+)
+
+func sidecarTestService(name, namespace string) *v1.Service {
+	return &v1.Service{
+		ObjectMeta: meta_v1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec: v1.ServiceSpec{
+			ClusterIP: "10.0.0.1",
+			Ports:     []v1.ServicePort{{Name: "http", Port: 9080}},
+		},
+	}
+}
+
+func TestSidecarGenerate(t *testing.T) {
+	interfaceFactory = mockInterfaceFactoryGenerator([]runtime.Object{
+		sidecarTestService("productpage", "default"),
+		sidecarTestService("reviews", "default"),
+		sidecarTestService("ratings", "default"),
+		sidecarTestService("istio-telemetry", "istio-system"),
+	})
+	reviews := model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Name:      "reviews",
+			Namespace: "default",
+			Type:      schemas.VirtualService.Type,
+			Group:     schemas.VirtualService.Group,
+			Version:   schemas.VirtualService.Version,
+		},
+		Spec: &networking.VirtualService{
+			Hosts: []string{"reviews"},
+			Http: []*networking.HTTPRoute{{
+				Route:  []*networking.HTTPRouteDestination{{Destination: &networking.Destination{Host: "reviews"}}},
+				Mirror: &networking.Destination{Host: "ratings"},
+			}},
+		},
+	}
+
+	cases := []testCase{
+		{ // case 0
+			args:           strings.Split("experimental sidecar generate", " "),
+			expectedRegexp: regexp.MustCompile("Error: at least one of --prometheus, --prometheus-export and --virtual-services is required"),
+			wantException:  true,
+		},
+		{ // case 1
+			args: strings.Split("experimental sidecar generate --print-query --window 1h", " "),
+			expectedOutput: `sum(rate(istio_requests_total{reporter="source"}[1h])) ` +
+				`by (source_workload_namespace, source_workload, source_app, destination_service) or ` +
+				`sum(rate(istio_tcp_connections_opened_total{reporter="source"}[1h])) ` +
+				`by (source_workload_namespace, source_workload, source_app, destination_service)` + "\n",
+		},
+		{ // case 2
+			configs: []model.Config{reviews},
+			args:    strings.Split("experimental sidecar generate --virtual-services", " "),
+			expectedRegexp: regexp.MustCompile(`(?s)kind: Sidecar.*name: default.*namespace: default.*` +
+				`- default/ratings.default.svc.cluster.local\n\s*- default/reviews.default.svc.cluster.local\n\s*- istio-system/\*\n.*` +
+				`default\s+default\s+3\s+4 -> 3\s+4 -> 3`),
+		},
+		{ // case 3
+			configs:       []model.Config{reviews},
+			args:          strings.Split("experimental sidecar generate --virtual-services --scope cluster", " "),
+			wantException: true,
+		},
+		{ // case 4
+			configs: []model.Config{reviews},
+			args:    strings.Split("experimental sidecar generate --virtual-services --domain example.org", " "),
+			expectedRegexp: regexp.MustCompile(`(?s)kind: Sidecar.*name: default.*namespace: default.*` +
+				`- default/ratings.default.svc.example.org\n\s*- default/reviews.default.svc.example.org\n\s*- istio-system/\*\n.*` +
+				`default\s+default\s+3\s+4 -> 3\s+4 -> 3`),
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("case %d %s", i, strings.Join(c.args, " ")), func(t *testing.T) {
+			verifyOutput(t, c)
+		})
+	}
+}
@@ -0,0 +1,469 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	route "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	envoy_rbac "github.com/envoyproxy/go-control-plane/envoy/config/rbac/v2"
+	envoy_matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher"
+
+	meshconfig "istio.io/api/mesh/v1alpha1"
+
+	"istio.io/istio/pilot/pkg/config/memory"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/security/authz/builder"
+	authn_model "istio.io/istio/pilot/pkg/security/model"
+	"istio.io/istio/pkg/config/labels"
+	"istio.io/istio/pkg/config/schemas"
+	"istio.io/istio/pkg/spiffe"
+)
+
+// Keys of the authentication filter metadata used by the generated RBAC policies.
+const (
+	metadataSourcePrincipal  = "source.principal"
+	metadataSourceUser       = "source.user"
+	metadataRequestPrincipal = "request.auth.principal"
+	metadataRequestAudiences = "request.auth.audiences"
+	metadataRequestPresenter = "request.auth.presenter"
+	metadataRequestClaims    = "request.auth.claims"
+)
+
+// SimulatedRequest is a request from a source identity to the target workload.
+type SimulatedRequest struct {
+	// Principal is the mTLS identity of the source, e.g. cluster.local/ns/default/sa/sleep. It is
+	// empty for plain text traffic.
+	Principal string
+	SourceIP  string
+
+	// RequestPrincipal is the JWT identity of the request in the form <iss>/<sub>.
+	RequestPrincipal string
+	Audiences        string
+	Presenter        string
+	Claims           map[string][]string
+
+	Method  string
+	Path    string
+	Host    string
+	Headers map[string]string
+
+	DestinationIP string
+	Port          uint32
+	SNI           string
+
+	// TCP simulates a connection checked by the RBAC network filter instead of the HTTP filter.
+	TCP bool
+}
+
+// PolicyEvaluation is the result of evaluating a single generated RBAC policy.
+type PolicyEvaluation struct {
+	// Policy is the name of the generated policy, in the form ns[<namespace>]-policy[<name>]-rule[<index>]
+	// for AuthorizationPolicy or the ServiceRole name for v1alpha1 RBAC.
+	Policy  string
+	Matched bool
+	// Condition is the condition that matched the request if Matched is true, or the first condition
+	// that did not match otherwise.
+	Condition string
+}
+
+// Decision is the outcome of a simulation.
+type Decision struct {
+	Allowed bool
+	// Policy is the generated policy that decided the request, empty if no policy matched.
+	Policy string
+	Reason string
+	// Evaluations holds the result of every generated policy, sorted by name.
+	Evaluations []PolicyEvaluation
+}
+
+// Simulator evaluates the authorization policies of the mesh against simulated requests.
+type Simulator struct {
+	policies *model.AuthorizationPolicies
+}
+
+// NewSimulator creates a Simulator for the given authorization configs. Policies in rootNamespace apply
+// to workloads in all namespaces.
+func NewSimulator(configs []model.Config, rootNamespace string) (*Simulator, error) {
+	store := model.MakeIstioStore(memory.Make(schemas.Istio))
+	for _, c := range configs {
+		switch c.Type {
+		case schemas.AuthorizationPolicy.Type, schemas.ServiceRole.Type, schemas.ServiceRoleBinding.Type,
+			schemas.RbacConfig.Type, schemas.ClusterRbacConfig.Type:
+		default:
+			continue
+		}
+		if _, err := store.Create(c); err != nil {
+			return nil, fmt.Errorf("failed to initialize authz policies: %s", err)
+		}
+	}
+	policies, err := model.GetAuthorizationPolicies(&model.Environment{
+		IstioConfigStore: store,
+		Mesh:             &meshconfig.MeshConfig{RootNamespace: rootNamespace},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create authz policies: %s", err)
+	}
+	return &Simulator{policies: policies}, nil
+}
+
+// Simulate evaluates the request against the RBAC config pilot generates for the workload described by
+// instance and workloadLabels.
+func (s *Simulator) Simulate(instance *model.ServiceInstance, workloadLabels labels.Instance,
+	req *SimulatedRequest) *Decision {
+	namespace := ""
+	if instance.Service != nil {
+		namespace = instance.Service.Attributes.Namespace
+	}
+	b := builder.NewBuilder(instance, labels.Collection{workloadLabels}, namespace, s.policies, false)
+	rbac := b.Generate(req.TCP).GetRules()
+	if rbac == nil {
+		return &Decision{
+			Allowed: true,
+			Reason:  "no authorization policy applies to the workload",
+		}
+	}
+
+	e := newEvaluator(req)
+	d := &Decision{}
+	var names []string
+	for name := range rbac.Policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		matched, condition := e.policy(rbac.Policies[name])
+		d.Evaluations = append(d.Evaluations, PolicyEvaluation{
+			Policy:    name,
+			Matched:   matched,
+			Condition: condition,
+		})
+		if matched && d.Policy == "" {
+			d.Policy = name
+		}
+	}
+
+	// The RBAC filter allows (or denies, depending on the action) the request if any policy matches.
+	deny := rbac.Action == envoy_rbac.RBAC_DENY
+	switch {
+	case d.Policy != "":
+		d.Allowed = !deny
+		d.Reason = fmt.Sprintf("matched by policy %s", d.Policy)
+	case len(names) == 0:
+		d.Allowed = deny
+		d.Reason = "no rules are defined for the workload"
+	default:
+		d.Allowed = deny
+		d.Reason = "no policy matched the request"
+	}
+	return d
+}
+
+// Print writes the decision in human readable form.
+func (d *Decision) Print(w io.Writer) {
+	if d.Allowed {
+		fmt.Fprintln(w, "ALLOW")
+	} else {
+		fmt.Fprintln(w, "DENY")
+	}
+	fmt.Fprintf(w, "  reason: %s\n", d.Reason)
+	for _, e := range d.Evaluations {
+		if e.Matched {
+			fmt.Fprintf(w, "  policy %s: matched, condition: %s\n", e.Policy, e.Condition)
+		} else {
+			fmt.Fprintf(w, "  policy %s: not matched, failed condition: %s\n", e.Policy, e.Condition)
+		}
+	}
+}
+
+type evaluator struct {
+	req     *SimulatedRequest
+	headers map[string]string
+}
+
+func newEvaluator(req *SimulatedRequest) *evaluator {
+	headers := map[string]string{}
+	for k, v := range req.Headers {
+		headers[strings.ToLower(k)] = v
+	}
+	if req.Method != "" {
+		headers[":method"] = req.Method
+	}
+	if req.Path != "" {
+		headers[":path"] = req.Path
+	}
+	if req.Host != "" {
+		headers[":authority"] = req.Host
+	}
+	return &evaluator{req: req, headers: headers}
+}
+
+// policy returns true if at least one permission and one principal of the policy match the request.
+func (e *evaluator) policy(p *envoy_rbac.Policy) (bool, string) {
+	var failed []string
+	permission, matched := "", false
+	for _, perm := range p.Permissions {
+		ok, c := e.permission(perm)
+		if ok {
+			permission, matched = c, true
+			break
+		}
+		failed = append(failed, c)
+	}
+	if !matched {
+		return false, oneOf(failed)
+	}
+
+	failed = nil
+	for _, id := range p.Principals {
+		ok, c := e.principal(id)
+		if ok {
+			return true, fmt.Sprintf("%s from %s", permission, c)
+		}
+		failed = append(failed, c)
+	}
+	return false, oneOf(failed)
+}
+
+func (e *evaluator) permission(p *envoy_rbac.Permission) (bool, string) {
+	switch r := p.Rule.(type) {
+	case *envoy_rbac.Permission_AndRules:
+		var matched []string
+		for _, rule := range r.AndRules.Rules {
+			ok, c := e.permission(rule)
+			if !ok {
+				return false, c
+			}
+			matched = append(matched, c)
+		}
+		return true, strings.Join(matched, " and ")
+	case *envoy_rbac.Permission_OrRules:
+		var failed []string
+		for _, rule := range r.OrRules.Rules {
+			ok, c := e.permission(rule)
+			if ok {
+				return true, c
+			}
+			failed = append(failed, c)
+		}
+		return false, oneOf(failed)
+	case *envoy_rbac.Permission_Any:
+		return r.Any, "any request"
+	case *envoy_rbac.Permission_NotRule:
+		ok, c := e.permission(r.NotRule)
+		return !ok, "not(" + c + ")"
+	case *envoy_rbac.Permission_Header:
+		return e.header(r.Header)
+	case *envoy_rbac.Permission_DestinationIp:
+		return cidrMatch(r.DestinationIp, e.req.DestinationIP), "destination.ip in " + describeCidr(r.DestinationIp)
+	case *envoy_rbac.Permission_DestinationPort:
+		return e.req.Port == r.DestinationPort, fmt.Sprintf("destination.port == %d", r.DestinationPort)
+	case *envoy_rbac.Permission_RequestedServerName:
+		return stringMatch(r.RequestedServerName, e.req.SNI), "connection.sni " + describeString(r.RequestedServerName)
+	case *envoy_rbac.Permission_Metadata:
+		return e.metadata(r.Metadata)
+	default:
+		return false, fmt.Sprintf("unsupported permission %T", r)
+	}
+}
+
+func (e *evaluator) principal(p *envoy_rbac.Principal) (bool, string) {
+	switch id := p.Identifier.(type) {
+	case *envoy_rbac.Principal_AndIds:
+		var matched []string
+		for _, i := range id.AndIds.Ids {
+			ok, c := e.principal(i)
+			if !ok {
+				return false, c
+			}
+			matched = append(matched, c)
+		}
+		return true, strings.Join(matched, " and ")
+	case *envoy_rbac.Principal_OrIds:
+		var failed []string
+		for _, i := range id.OrIds.Ids {
+			ok, c := e.principal(i)
+			if ok {
+				return true, c
+			}
+			failed = append(failed, c)
+		}
+		return false, oneOf(failed)
+	case *envoy_rbac.Principal_Any:
+		return id.Any, "any source"
+	case *envoy_rbac.Principal_NotId:
+		ok, c := e.principal(id.NotId)
+		return !ok, "not(" + c + ")"
+	case *envoy_rbac.Principal_Authenticated_:
+		m := id.Authenticated.GetPrincipalName()
+		if e.req.Principal == "" {
+			return false, "authenticated principal " + describeString(m)
+		}
+		return stringMatch(m, spiffe.URIPrefix+e.req.Principal), "authenticated principal " + describeString(m)
+	case *envoy_rbac.Principal_SourceIp:
+		return cidrMatch(id.SourceIp, e.req.SourceIP), "source.ip in " + describeCidr(id.SourceIp)
+	case *envoy_rbac.Principal_Header:
+		return e.header(id.Header)
+	case *envoy_rbac.Principal_Metadata:
+		return e.metadata(id.Metadata)
+	default:
+		return false, fmt.Sprintf("unsupported principal %T", id)
+	}
+}
+
+func (e *evaluator) header(h *route.HeaderMatcher) (bool, string) {
+	value, present := e.headers[strings.ToLower(h.Name)]
+	var matched bool
+	var desc string
+	switch m := h.HeaderMatchSpecifier.(type) {
+	case *route.HeaderMatcher_ExactMatch:
+		matched, desc = present && value == m.ExactMatch, fmt.Sprintf("== %q", m.ExactMatch)
+	case *route.HeaderMatcher_PrefixMatch:
+		matched, desc = present && strings.HasPrefix(value, m.PrefixMatch), fmt.Sprintf("has prefix %q", m.PrefixMatch)
+	case *route.HeaderMatcher_SuffixMatch:
+		matched, desc = present && strings.HasSuffix(value, m.SuffixMatch), fmt.Sprintf("has suffix %q", m.SuffixMatch)
+	case *route.HeaderMatcher_PresentMatch:
+		matched, desc = present == m.PresentMatch, "is present"
+	case *route.HeaderMatcher_RegexMatch:
+		matched, desc = present && regexMatch(m.RegexMatch, value), fmt.Sprintf("matches %q", m.RegexMatch)
+	default:
+		return false, fmt.Sprintf("header %s: unsupported matcher %T", h.Name, m)
+	}
+	if h.InvertMatch {
+		matched, desc = !matched, "not "+desc
+	}
+	return matched, fmt.Sprintf("header %s %s", h.Name, desc)
+}
+
+// metadata evaluates matchers on the dynamic metadata the Istio authentication filter sets for the request.
+func (e *evaluator) metadata(m *envoy_matcher.MetadataMatcher) (bool, string) {
+	var path []string
+	for _, segment := range m.Path {
+		path = append(path, segment.GetKey())
+	}
+	key := strings.Join(path, ".")
+	if len(path) == 2 && path[0] == metadataRequestClaims {
+		key = fmt.Sprintf("%s[%s]", path[0], path[1])
+	}
+
+	var values []string
+	if m.Filter == authn_model.AuthnFilterName && len(path) > 0 {
+		switch path[0] {
+		case metadataSourcePrincipal, metadataSourceUser:
+			values = nonEmpty(e.req.Principal)
+		case metadataRequestPrincipal:
+			values = nonEmpty(e.req.RequestPrincipal)
+		case metadataRequestAudiences:
+			values = nonEmpty(e.req.Audiences)
+		case metadataRequestPresenter:
+			values = nonEmpty(e.req.Presenter)
+		case metadataRequestClaims:
+			if len(path) == 2 {
+				values = e.req.Claims[path[1]]
+			}
+		}
+	}
+
+	if list := m.Value.GetListMatch(); list != nil {
+		sm := list.GetOneOf().GetStringMatch()
+		for _, v := range values {
+			if stringMatch(sm, v) {
+				return true, fmt.Sprintf("%s contains %s", key, describeString(sm))
+			}
+		}
+		return false, fmt.Sprintf("%s contains %s", key, describeString(sm))
+	}
+	sm := m.Value.GetStringMatch()
+	return len(values) == 1 && stringMatch(sm, values[0]), fmt.Sprintf("%s %s", key, describeString(sm))
+}
+
+func nonEmpty(v string) []string {
+	if v == "" {
+		return nil
+	}
+	return []string{v}
+}
+
+func stringMatch(m *envoy_matcher.StringMatcher, v string) bool {
+	switch p := m.GetMatchPattern().(type) {
+	case *envoy_matcher.StringMatcher_Exact:
+		return v == p.Exact
+	case *envoy_matcher.StringMatcher_Prefix:
+		return strings.HasPrefix(v, p.Prefix)
+	case *envoy_matcher.StringMatcher_Suffix:
+		return strings.HasSuffix(v, p.Suffix)
+	case *envoy_matcher.StringMatcher_Regex:
+		return regexMatch(p.Regex, v)
+	default:
+		return false
+	}
+}
+
+func describeString(m *envoy_matcher.StringMatcher) string {
+	switch p := m.GetMatchPattern().(type) {
+	case *envoy_matcher.StringMatcher_Exact:
+		return fmt.Sprintf("== %q", p.Exact)
+	case *envoy_matcher.StringMatcher_Prefix:
+		return fmt.Sprintf("has prefix %q", p.Prefix)
+	case *envoy_matcher.StringMatcher_Suffix:
+		return fmt.Sprintf("has suffix %q", p.Suffix)
+	case *envoy_matcher.StringMatcher_Regex:
+		return fmt.Sprintf("matches %q", p.Regex)
+	default:
+		return fmt.Sprintf("unsupported matcher %T", p)
+	}
+}
+
+// regexMatch matches the whole value against the regex, as Envoy does.
+func regexMatch(regex, v string) bool {
+	re, err := regexp.Compile("^(?:" + regex + ")$")
+	if err != nil {
+		return false
+	}
+	return re.MatchString(v)
+}
+
+func cidrMatch(cidr *core.CidrRange, ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	_, ipNet, err := net.ParseCIDR(describeCidr(cidr))
+	if err != nil {
+		return false
+	}
+	return ipNet.Contains(parsed)
+}
+
+func describeCidr(cidr *core.CidrRange) string {
+	return fmt.Sprintf("%s/%d", cidr.AddressPrefix, cidr.PrefixLen.GetValue())
+}
+
+func oneOf(conditions []string) string {
+	switch len(conditions) {
+	case 0:
+		return "no conditions"
+	case 1:
+		return conditions[0]
+	default:
+		return "one of [" + strings.Join(conditions, ", ") + "]"
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"testing"
+
+	security "istio.io/api/security/v1beta1"
+	selectorpb "istio.io/api/type/v1beta1"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/labels"
+	"istio.io/istio/pkg/config/schemas"
+)
+
+func authorizationPolicy(name string, selector map[string]string, rules ...*security.Rule) model.Config {
+	return model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Type:      schemas.AuthorizationPolicy.Type,
+			Version:   schemas.AuthorizationPolicy.Version,
+			Name:      name,
+			Namespace: "foo",
+		},
+		Spec: &security.AuthorizationPolicy{
+			Selector: &selectorpb.WorkloadSelector{MatchLabels: selector},
+			Rules:    rules,
+		},
+	}
+}
+
+func from(source *security.Source) *security.Rule {
+	return &security.Rule{From: []*security.Rule_From{{Source: source}}}
+}
+
+func to(operation *security.Operation) *security.Rule {
+	return &security.Rule{To: []*security.Rule_To{{Operation: operation}}}
+}
+
+func when(key string, values ...string) *security.Rule {
+	return &security.Rule{When: []*security.Condition{{Key: key, Values: values}}}
+}
+
+func TestSimulate(t *testing.T) {
+	httpbin := map[string]string{"app": "httpbin"}
+	request := SimulatedRequest{
+		Principal:        "cluster.local/ns/foo/sa/sleep",
+		SourceIP:         "10.0.0.1",
+		RequestPrincipal: "issuer/subject",
+		Audiences:        "httpbin",
+		Presenter:        "sleep",
+		Claims:           map[string][]string{"groups": {"admin", "dev"}},
+		Method:           "GET",
+		Path:             "/headers",
+		Host:             "httpbin.foo",
+		Headers:          map[string]string{"X-Token": "secret"},
+		DestinationIP:    "10.0.0.2",
+		Port:             8000,
+		SNI:              "httpbin.foo.svc.cluster.local",
+	}
+
+	cases := []struct {
+		name     string
+		policies []model.Config
+		request  func(*SimulatedRequest)
+		tcp      bool
+		allowed  bool
+		policy   string
+	}{
+		{
+			name:    "no policy",
+			allowed: true,
+		},
+		{
+			name:     "policy of another workload",
+			policies: []model.Config{authorizationPolicy("other", map[string]string{"app": "other"})},
+			allowed:  true,
+		},
+		{
+			name:     "policy without rules",
+			policies: []model.Config{authorizationPolicy("deny-all", httpbin)},
+		},
+		{
+			name:     "allow all",
+			policies: []model.Config{authorizationPolicy("allow-all", httpbin, &security.Rule{})},
+			allowed:  true,
+			policy:   "ns[foo]-policy[allow-all]-rule[0]",
+		},
+		{
+			name: "no matching rule",
+			policies: []model.Config{
+				authorizationPolicy("post", httpbin, to(&security.Operation{Methods: []string{"POST"}})),
+			},
+		},
+		{
+			name: "principal",
+			policies: []model.Config{
+				authorizationPolicy("sleep", httpbin, from(&security.Source{Principals: []string{"cluster.local/ns/foo/sa/sleep"}})),
+			},
+			allowed: true,
+			policy:  "ns[foo]-policy[sleep]-rule[0]",
+		},
+		{
+			name: "principal over TCP",
+			policies: []model.Config{
+				authorizationPolicy("sleep", httpbin, from(&security.Source{Principals: []string{"cluster.local/ns/foo/sa/sleep"}})),
+			},
+			tcp:     true,
+			allowed: true,
+			policy:  "ns[foo]-policy[sleep]-rule[0]",
+		},
+		{
+			name: "plain text principal",
+			policies: []model.Config{
+				authorizationPolicy("sleep", httpbin, from(&security.Source{Principals: []string{"cluster.local/ns/foo/sa/sleep"}})),
+			},
+			request: func(r *SimulatedRequest) { r.Principal = "" },
+		},
+		{
+			name: "request principal",
+			policies: []model.Config{
+				authorizationPolicy("jwt", httpbin, from(&security.Source{RequestPrincipals: []string{"issuer/*"}})),
+			},
+			allowed: true,
+			policy:  "ns[foo]-policy[jwt]-rule[0]",
+		},
+		{
+			name: "namespace",
+			policies: []model.Config{
+				authorizationPolicy("bar", httpbin, from(&security.Source{Namespaces: []string{"bar"}})),
+			},
+		},
+		{
+			name: "ip block",
+			policies: []model.Config{
+				authorizationPolicy("ip", httpbin, from(&security.Source{IpBlocks: []string{"10.0.0.0/24"}})),
+			},
+			allowed: true,
+			policy:  "ns[foo]-policy[ip]-rule[0]",
+		},
+		{
+			name: "host",
+			policies: []model.Config{
+				authorizationPolicy("host", httpbin, to(&security.Operation{Hosts: []string{"httpbin.*"}})),
+			},
+			allowed: true,
+			policy:  "ns[foo]-policy[host]-rule[0]",
+		},
+		{
+			name: "port",
+			policies: []model.Config{
+				authorizationPolicy("port", httpbin, to(&security.Operation{Ports: []string{"9000"}})),
+			},
+		},
+		{
+			name: "method and path",
+			policies: []model.Config{
+				authorizationPolicy("get", httpbin, to(&security.Operation{Methods: []string{"GET"}, Paths: []string{"/status/*"}})),
+			},
+		},
+		{
+			name: "path",
+			policies: []model.Config{
+				authorizationPolicy("headers", httpbin, to(&security.Operation{Paths: []string{"/headers"}})),
+			},
+			allowed: true,
+			policy:  "ns[foo]-policy[headers]-rule[0]",
+		},
+		{
+			name:     "request header",
+			policies: []model.Config{authorizationPolicy("token", httpbin, when("request.headers[x-token]", "secret"))},
+			allowed:  true,
+			policy:   "ns[foo]-policy[token]-rule[0]",
+		},
+		{
+			name:     "claim",
+			policies: []model.Config{authorizationPolicy("admin", httpbin, when("request.auth.claims[groups]", "admin"))},
+			allowed:  true,
+			policy:   "ns[foo]-policy[admin]-rule[0]",
+		},
+		{
+			name:     "audiences",
+			policies: []model.Config{authorizationPolicy("audiences", httpbin, when("request.auth.audiences", "other"))},
+		},
+		{
+			name:     "presenter",
+			policies: []model.Config{authorizationPolicy("presenter", httpbin, when("request.auth.presenter", "sleep"))},
+			allowed:  true,
+			policy:   "ns[foo]-policy[presenter]-rule[0]",
+		},
+		{
+			name:     "destination ip",
+			policies: []model.Config{authorizationPolicy("destination", httpbin, when("destination.ip", "10.0.1.0/24"))},
+		},
+		{
+			name:     "sni",
+			policies: []model.Config{authorizationPolicy("sni", httpbin, when("connection.sni", "*.svc.cluster.local"))},
+			tcp:      true,
+			allowed:  true,
+			policy:   "ns[foo]-policy[sni]-rule[0]",
+		},
+		{
+			name: "first matching rule",
+			policies: []model.Config{
+				authorizationPolicy("rules", httpbin,
+					to(&security.Operation{Methods: []string{"POST"}}),
+					to(&security.Operation{Methods: []string{"GET"}})),
+			},
+			allowed: true,
+			policy:  "ns[foo]-policy[rules]-rule[1]",
+		},
+	}
+
+	instance := &model.ServiceInstance{
+		Service: &model.Service{
+			Hostname:   host.Name("httpbin.foo.svc.cluster.local"),
+			Attributes: model.ServiceAttributes{Name: "httpbin", Namespace: "foo"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s, err := NewSimulator(c.policies, "istio-system")
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := request
+			req.TCP = c.tcp
+			if c.request != nil {
+				c.request(&req)
+			}
+			d := s.Simulate(instance, labels.Instance(httpbin), &req)
+			if d.Allowed != c.allowed || d.Policy != c.policy {
+				t.Errorf("got allowed %v by policy %q (%s), want allowed %v by policy %q",
+					d.Allowed, d.Policy, d.Reason, c.allowed, c.policy)
+			}
+		})
+	}
+}
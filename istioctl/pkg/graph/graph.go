@@ -0,0 +1,651 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package graph computes a static service dependency graph of the mesh from Istio configuration.
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	authn "istio.io/api/authentication/v1alpha1"
+	"istio.io/api/networking/v1alpha3"
+	rbac "istio.io/api/rbac/v1alpha1"
+	authpb "istio.io/api/security/v1beta1"
+	v1 "k8s.io/api/core/v1"
+
+	"istio.io/istio/galley/pkg/config/analysis"
+	"istio.io/istio/galley/pkg/config/analysis/analyzers/util"
+	"istio.io/istio/galley/pkg/config/meta/metadata"
+	"istio.io/istio/galley/pkg/config/meta/schema/collection"
+	"istio.io/istio/galley/pkg/config/resource"
+	"istio.io/istio/pkg/config/constants"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/labels"
+)
+
+// NodeKind describes what a Node in the graph represents.
+type NodeKind string
+
+const (
+	// ServiceNode is a service inside the mesh, discovered from the platform or declared by a ServiceEntry.
+	ServiceNode NodeKind = "service"
+	// ExternalNode is a ServiceEntry host located outside of the mesh.
+	ExternalNode NodeKind = "external"
+	// GatewayNode is an Istio Gateway.
+	GatewayNode NodeKind = "gateway"
+	// WorkloadNode is the set of workloads a Sidecar resource applies to.
+	WorkloadNode NodeKind = "workload"
+)
+
+// EdgeKind describes the configuration an Edge was derived from.
+type EdgeKind string
+
+const (
+	// RouteEdge is a VirtualService route destination.
+	RouteEdge EdgeKind = "route"
+	// MirrorEdge is a VirtualService mirror destination.
+	MirrorEdge EdgeKind = "mirror"
+	// EgressEdge is a host imported by a Sidecar egress listener.
+	EgressEdge EdgeKind = "egress"
+)
+
+// Node is a vertex of the mesh topology.
+type Node struct {
+	ID        string   `json:"id"`
+	Kind      NodeKind `json:"kind"`
+	Namespace string   `json:"namespace,omitempty"`
+	Name      string   `json:"name"`
+	Host      string   `json:"host,omitempty"`
+}
+
+// Security summarizes the transport security and authorization configuration that applies to an Edge.
+type Security struct {
+	// ClientTLS is the TLS mode the source uses, taken from the DestinationRule of the destination.
+	ClientTLS string `json:"clientTLS,omitempty"`
+	// PeerAuthentication is the mTLS mode the destination accepts, taken from authentication policies.
+	PeerAuthentication string `json:"peerAuthentication,omitempty"`
+	// Authorization lists the authorization resources that may apply to requests on the edge.
+	Authorization []string `json:"authorization,omitempty"`
+}
+
+// Edge is a directed dependency between two nodes.
+type Edge struct {
+	From     string   `json:"from"`
+	To       string   `json:"to"`
+	Kind     EdgeKind `json:"kind"`
+	Origin   string   `json:"origin"`
+	Subset   string   `json:"subset,omitempty"`
+	Port     uint32   `json:"port,omitempty"`
+	Weight   int32    `json:"weight,omitempty"`
+	Security Security `json:"security"`
+}
+
+// Graph is a static service dependency graph of the mesh.
+type Graph struct {
+	Nodes []*Node `json:"nodes"`
+	Edges []*Edge `json:"edges"`
+}
+
+// Node returns the node with the given id, or nil if there is no such node.
+func (g *Graph) Node(id string) *Node {
+	for _, n := range g.Nodes {
+		if n.ID == id {
+			return n
+		}
+	}
+	return nil
+}
+
+// Builder collects mesh configuration through the analysis framework and computes a Graph from it.
+// This lets the graph use exactly the same config loading as `istioctl analyze`.
+type Builder struct {
+	rootNamespace string
+	domainSuffix  string
+
+	mu       sync.Mutex
+	services []*resource.Entry
+	entries  map[collection.Name][]*resource.Entry
+	// kubeServices and pods are the Kubernetes services and pods, used to find the labels of the workloads
+	// of a service.
+	kubeServices []*resource.Entry
+	pods         []*resource.Entry
+}
+
+// NewBuilder returns a Builder. Mesh-wide policies are looked up in rootNamespace, and the hosts of the
+// Kubernetes services are qualified with domainSuffix.
+func NewBuilder(rootNamespace, domainSuffix string) *Builder {
+	if rootNamespace == "" {
+		rootNamespace = constants.IstioSystemNamespace
+	}
+	return &Builder{
+		rootNamespace: rootNamespace,
+		domainSuffix:  domainSuffix,
+		entries:       make(map[collection.Name][]*resource.Entry),
+	}
+}
+
+// configInputs are the collections the topology is computed from.
+var configInputs = collection.Names{
+	metadata.IstioAuthenticationV1Alpha1Meshpolicies,
+	metadata.IstioAuthenticationV1Alpha1Policies,
+	metadata.IstioNetworkingV1Alpha3Destinationrules,
+	metadata.IstioNetworkingV1Alpha3Gateways,
+	metadata.IstioNetworkingV1Alpha3Serviceentries,
+	metadata.IstioNetworkingV1Alpha3Sidecars,
+	metadata.IstioNetworkingV1Alpha3Virtualservices,
+	metadata.IstioRbacV1Alpha1Serviceroles,
+	metadata.IstioSecurityV1Beta1Authorizationpolicies,
+}
+
+// Analyzers returns the analyzers that feed the Builder. Platform services are collected by a separate
+// analyzer so that the graph can still be computed when service discovery is disabled.
+func (b *Builder) Analyzers() *analysis.CombinedAnalyzer {
+	return analysis.Combine("graph", &configCollector{b}, &serviceCollector{b}, &workloadCollector{b})
+}
+
+type configCollector struct{ b *Builder }
+
+var _ analysis.Analyzer = &configCollector{}
+
+// Metadata implements Analyzer
+func (c *configCollector) Metadata() analysis.Metadata {
+	return analysis.Metadata{
+		Name:   "graph.ConfigCollector",
+		Inputs: configInputs,
+	}
+}
+
+// Analyze implements Analyzer
+func (c *configCollector) Analyze(ctx analysis.Context) {
+	entries := make(map[collection.Name][]*resource.Entry)
+	for _, col := range configInputs {
+		ctx.ForEach(col, func(r *resource.Entry) bool {
+			entries[col] = append(entries[col], r)
+			return true
+		})
+	}
+
+	c.b.mu.Lock()
+	c.b.entries = entries
+	c.b.mu.Unlock()
+}
+
+type serviceCollector struct{ b *Builder }
+
+var _ analysis.Analyzer = &serviceCollector{}
+
+// Metadata implements Analyzer
+func (c *serviceCollector) Metadata() analysis.Metadata {
+	return analysis.Metadata{
+		Name: "graph.ServiceCollector",
+		Inputs: collection.Names{
+			metadata.IstioNetworkingV1Alpha3SyntheticServiceentries,
+		},
+	}
+}
+
+// Analyze implements Analyzer
+func (c *serviceCollector) Analyze(ctx analysis.Context) {
+	var services []*resource.Entry
+	ctx.ForEach(metadata.IstioNetworkingV1Alpha3SyntheticServiceentries, func(r *resource.Entry) bool {
+		services = append(services, r)
+		return true
+	})
+
+	c.b.mu.Lock()
+	c.b.services = services
+	c.b.mu.Unlock()
+}
+
+type workloadCollector struct{ b *Builder }
+
+var _ analysis.Analyzer = &workloadCollector{}
+
+// Metadata implements Analyzer
+func (c *workloadCollector) Metadata() analysis.Metadata {
+	return analysis.Metadata{
+		Name: "graph.WorkloadCollector",
+		Inputs: collection.Names{
+			metadata.K8SCoreV1Pods,
+			metadata.K8SCoreV1Services,
+		},
+	}
+}
+
+// Analyze implements Analyzer
+func (c *workloadCollector) Analyze(ctx analysis.Context) {
+	var services, pods []*resource.Entry
+	ctx.ForEach(metadata.K8SCoreV1Services, func(r *resource.Entry) bool {
+		services = append(services, r)
+		return true
+	})
+	ctx.ForEach(metadata.K8SCoreV1Pods, func(r *resource.Entry) bool {
+		pods = append(pods, r)
+		return true
+	})
+
+	c.b.mu.Lock()
+	c.b.kubeServices = services
+	c.b.pods = pods
+	c.b.mu.Unlock()
+}
+
+// Build computes the graph from the configuration collected so far.
+func (b *Builder) Build() *Graph {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := &state{
+		Builder: b,
+		nodes:   make(map[string]*Node),
+		edges:   make(map[string]*Edge),
+	}
+
+	for _, r := range b.services {
+		ns, name := r.Metadata.Name.InterpretAsNamespaceAndName()
+		s.addService(resource.NewName(ns, name), ServiceNode)
+	}
+	for _, r := range b.entries[metadata.IstioNetworkingV1Alpha3Serviceentries] {
+		se := r.Item.(*v1alpha3.ServiceEntry)
+		ns, _ := r.Metadata.Name.InterpretAsNamespaceAndName()
+		kind := ServiceNode
+		if se.GetLocation() == v1alpha3.ServiceEntry_MESH_EXTERNAL {
+			kind = ExternalNode
+		}
+		for _, h := range se.GetHosts() {
+			s.addService(util.GetResourceNameFromHost(ns, h), kind)
+		}
+	}
+	for _, r := range b.entries[metadata.IstioNetworkingV1Alpha3Gateways] {
+		s.addNode(GatewayNode, r.Metadata.Name, "")
+	}
+
+	for _, r := range b.entries[metadata.IstioNetworkingV1Alpha3Virtualservices] {
+		s.addVirtualService(r)
+	}
+	for _, r := range b.entries[metadata.IstioNetworkingV1Alpha3Sidecars] {
+		s.addSidecar(r)
+	}
+
+	g := &Graph{}
+	for _, n := range s.nodes {
+		g.Nodes = append(g.Nodes, n)
+	}
+	for _, e := range s.edges {
+		g.Edges = append(g.Edges, e)
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i].ID < g.Nodes[j].ID })
+	sort.Slice(g.Edges, func(i, j int) bool { return edgeKey(g.Edges[i]) < edgeKey(g.Edges[j]) })
+	return g
+}
+
+// state holds the intermediate results of a single Build.
+type state struct {
+	*Builder
+	nodes map[string]*Node
+	edges map[string]*Edge
+}
+
+func nodeID(kind NodeKind, name resource.Name) string {
+	if kind == ExternalNode {
+		kind = ServiceNode
+	}
+	return string(kind) + "/" + name.String()
+}
+
+func edgeKey(e *Edge) string {
+	return fmt.Sprintf("%s|%s|%s|%s|%s|%d", e.From, e.To, e.Kind, e.Origin, e.Subset, e.Port)
+}
+
+func (s *state) addNode(kind NodeKind, name resource.Name, hostname string) *Node {
+	id := nodeID(kind, name)
+	if n, ok := s.nodes[id]; ok {
+		return n
+	}
+	ns, local := name.InterpretAsNamespaceAndName()
+	n := &Node{
+		ID:        id,
+		Kind:      kind,
+		Namespace: ns,
+		Name:      local,
+		Host:      hostname,
+	}
+	s.nodes[id] = n
+	return n
+}
+
+// addService adds a service node, using the same naming scheme as the analyzers so that
+// short names, FQDNs and ServiceEntry hosts referring to the same service are merged.
+func (s *state) addService(name resource.Name, kind NodeKind) *Node {
+	ns, local := name.InterpretAsNamespaceAndName()
+	hostname := local
+	if !strings.Contains(local, ".") {
+		hostname = fmt.Sprintf("%s.%s.svc.%s", local, ns, s.domainSuffix)
+	}
+	return s.addNode(kind, name, hostname)
+}
+
+func (s *state) addEdge(e *Edge) {
+	if e.From == e.To {
+		return
+	}
+	s.edges[edgeKey(e)] = e
+}
+
+func (s *state) addVirtualService(r *resource.Entry) {
+	vs := r.Item.(*v1alpha3.VirtualService)
+	ns, _ := r.Metadata.Name.InterpretAsNamespaceAndName()
+	origin := "VirtualService/" + r.Metadata.Name.String()
+
+	gateways := vs.GetGateways()
+	if len(gateways) == 0 {
+		gateways = []string{constants.IstioMeshGateway}
+	}
+
+	var sources []*Node
+	for _, gw := range gateways {
+		if gw == constants.IstioMeshGateway {
+			for _, h := range vs.GetHosts() {
+				sources = append(sources, s.addService(util.GetResourceNameFromHost(ns, h), ServiceNode))
+			}
+			continue
+		}
+		sources = append(sources, s.addNode(GatewayNode, gatewayName(ns, gw), ""))
+	}
+
+	for _, src := range sources {
+		for _, route := range vs.GetHttp() {
+			for _, rd := range route.GetRoute() {
+				s.addDestination(src, ns, rd.GetDestination(), RouteEdge, rd.GetWeight(), origin)
+			}
+			if route.GetMirror() != nil {
+				s.addDestination(src, ns, route.GetMirror(), MirrorEdge, 0, origin)
+			}
+		}
+		for _, route := range vs.GetTls() {
+			for _, rd := range route.GetRoute() {
+				s.addDestination(src, ns, rd.GetDestination(), RouteEdge, rd.GetWeight(), origin)
+			}
+		}
+		for _, route := range vs.GetTcp() {
+			for _, rd := range route.GetRoute() {
+				s.addDestination(src, ns, rd.GetDestination(), RouteEdge, rd.GetWeight(), origin)
+			}
+		}
+	}
+}
+
+func (s *state) addDestination(src *Node, ns string, d *v1alpha3.Destination, kind EdgeKind, weight int32, origin string) {
+	if d == nil {
+		return
+	}
+	dst, ok := s.nodes[nodeID(ServiceNode, util.GetResourceNameFromHost(ns, d.GetHost()))]
+	if !ok {
+		dst = s.addService(util.GetResourceNameFromHost(ns, d.GetHost()), ServiceNode)
+	}
+	s.addEdge(&Edge{
+		From:     src.ID,
+		To:       dst.ID,
+		Kind:     kind,
+		Origin:   origin,
+		Subset:   d.GetSubset(),
+		Port:     d.GetPort().GetNumber(),
+		Weight:   weight,
+		Security: s.security(dst),
+	})
+}
+
+// gatewayName resolves a VirtualService gateway reference, which is either <namespace>/<name> or a
+// name relative to the VirtualService namespace.
+func gatewayName(ns, gw string) resource.Name {
+	if parts := strings.SplitN(gw, "/", 2); len(parts) == 2 {
+		return resource.NewName(parts[0], parts[1])
+	}
+	return resource.NewName(ns, gw)
+}
+
+func (s *state) addSidecar(r *resource.Entry) {
+	sc := r.Item.(*v1alpha3.Sidecar)
+	ns, _ := r.Metadata.Name.InterpretAsNamespaceAndName()
+	src := s.addNode(WorkloadNode, r.Metadata.Name, "")
+	origin := "Sidecar/" + r.Metadata.Name.String()
+
+	// Snapshot the service nodes first, since resolving egress hosts does not create new nodes.
+	var services []*Node
+	for _, n := range s.nodes {
+		if n.Kind == ServiceNode || n.Kind == ExternalNode {
+			services = append(services, n)
+		}
+	}
+
+	for _, l := range sc.GetEgress() {
+		for _, h := range l.GetHosts() {
+			parts := strings.SplitN(h, "/", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			hostNs, dnsName := parts[0], host.Name(parts[1])
+			for _, n := range services {
+				switch hostNs {
+				case "*":
+				case ".":
+					if n.Namespace != ns {
+						continue
+					}
+				case "~":
+					continue
+				default:
+					if n.Namespace != hostNs {
+						continue
+					}
+				}
+				if !dnsName.Matches(host.Name(n.Host)) {
+					continue
+				}
+				s.addEdge(&Edge{
+					From:     src.ID,
+					To:       n.ID,
+					Kind:     EgressEdge,
+					Origin:   origin,
+					Port:     l.GetPort().GetNumber(),
+					Security: s.security(n),
+				})
+			}
+		}
+	}
+}
+
+// security computes the transport security and authorization settings for traffic to dst.
+func (s *state) security(dst *Node) Security {
+	sec := Security{
+		ClientTLS: s.clientTLS(dst),
+	}
+	if dst.Kind == ExternalNode {
+		return sec
+	}
+	sec.PeerAuthentication = s.peerAuthentication(dst)
+	sec.Authorization = s.authorization(dst)
+	return sec
+}
+
+// clientTLS returns the TLS mode of the most specific DestinationRule for dst, preferring rules in the
+// destination namespace over those in the root namespace.
+func (s *state) clientTLS(dst *Node) string {
+	var (
+		mode  string
+		score int
+	)
+	for _, r := range s.entries[metadata.IstioNetworkingV1Alpha3Destinationrules] {
+		dr := r.Item.(*v1alpha3.DestinationRule)
+		ns, _ := r.Metadata.Name.InterpretAsNamespaceAndName()
+		tls := dr.GetTrafficPolicy().GetTls()
+		if tls == nil {
+			continue
+		}
+
+		current := 0
+		if nodeID(ServiceNode, util.GetResourceNameFromHost(ns, dr.GetHost())) == dst.ID {
+			current = 4
+		} else if host.Name(dr.GetHost()).Matches(host.Name(dst.Host)) {
+			current = 1
+		}
+		if current == 0 {
+			continue
+		}
+		if ns == dst.Namespace {
+			current++
+		} else if ns != s.rootNamespace {
+			continue
+		}
+		if current > score {
+			score = current
+			mode = tls.GetMode().String()
+		}
+	}
+	return mode
+}
+
+// peerAuthentication returns the mTLS mode of the authentication policy that applies to dst. Service
+// specific policies take precedence over the namespace and mesh wide defaults.
+func (s *state) peerAuthentication(dst *Node) string {
+	var namespaceDefault, meshDefault *authn.Policy
+	for _, r := range s.entries[metadata.IstioAuthenticationV1Alpha1Policies] {
+		p := r.Item.(*authn.Policy)
+		ns, name := r.Metadata.Name.InterpretAsNamespaceAndName()
+		if ns != dst.Namespace {
+			continue
+		}
+		for _, t := range p.GetTargets() {
+			if t.GetName() == dst.Name {
+				return peerMode(p)
+			}
+		}
+		if len(p.GetTargets()) == 0 && name == constants.DefaultAuthenticationPolicyName {
+			namespaceDefault = p
+		}
+	}
+	if namespaceDefault != nil {
+		return peerMode(namespaceDefault)
+	}
+
+	for _, r := range s.entries[metadata.IstioAuthenticationV1Alpha1Meshpolicies] {
+		_, name := r.Metadata.Name.InterpretAsNamespaceAndName()
+		if name == constants.DefaultAuthenticationPolicyName {
+			meshDefault = r.Item.(*authn.Policy)
+		}
+	}
+	if meshDefault != nil {
+		return peerMode(meshDefault)
+	}
+	return ""
+}
+
+func peerMode(p *authn.Policy) string {
+	for _, peer := range p.GetPeers() {
+		if mtls := peer.GetMtls(); mtls != nil {
+			return mtls.GetMode().String()
+		}
+	}
+	return "DISABLE"
+}
+
+// authorization lists the AuthorizationPolicies in the destination and root namespaces whose selector may
+// select the workloads of the destination, as well as the ServiceRoles that grant access to the destination host.
+func (s *state) authorization(dst *Node) []string {
+	var out []string
+	for _, r := range s.entries[metadata.IstioSecurityV1Beta1Authorizationpolicies] {
+		ns, _ := r.Metadata.Name.InterpretAsNamespaceAndName()
+		if ns != dst.Namespace && ns != s.rootNamespace {
+			continue
+		}
+		policy := r.Item.(*authpb.AuthorizationPolicy)
+		if selector := policy.GetSelector().GetMatchLabels(); len(selector) > 0 && !s.selects(dst, selector) {
+			continue
+		}
+		out = append(out, "AuthorizationPolicy/"+r.Metadata.Name.String())
+	}
+	for _, r := range s.entries[metadata.IstioRbacV1Alpha1Serviceroles] {
+		ns, _ := r.Metadata.Name.InterpretAsNamespaceAndName()
+		if ns != dst.Namespace {
+			continue
+		}
+		role := r.Item.(*rbac.ServiceRole)
+	rules:
+		for _, rule := range role.GetRules() {
+			for _, svc := range rule.GetServices() {
+				if stringMatch(svc, dst.Host) {
+					out = append(out, "ServiceRole/"+r.Metadata.Name.String())
+					break rules
+				}
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// selects returns whether the workload selector may select workloads of dst. The workloads of a Kubernetes
+// service are its pods, or only its selector when the pods are unknown, in which case the selector may select
+// them unless a label contradicts the selector of the service. The workloads of other services are unknown.
+func (s *state) selects(dst *Node, selector map[string]string) bool {
+	var serviceSelector map[string]string
+	for _, r := range s.kubeServices {
+		if r.Metadata.Name == resource.NewName(dst.Namespace, dst.Name) {
+			serviceSelector = r.Item.(*v1.ServiceSpec).Selector
+			break
+		}
+	}
+	if len(serviceSelector) == 0 {
+		return true
+	}
+
+	found := false
+	for _, r := range s.pods {
+		pod := r.Item.(*v1.Pod)
+		if pod.Namespace != dst.Namespace || !labels.Instance(serviceSelector).SubsetOf(pod.Labels) {
+			continue
+		}
+		if labels.Instance(selector).SubsetOf(pod.Labels) {
+			return true
+		}
+		found = true
+	}
+	if found {
+		return false
+	}
+	for k, v := range selector {
+		if value, ok := serviceSelector[k]; ok && value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// stringMatch matches s against an RBAC service pattern, which may be "*" or contain a single
+// leading or trailing wildcard.
+func stringMatch(pattern, s string) bool {
+	switch {
+	case pattern == "*":
+		return true
+	case strings.HasPrefix(pattern, "*"):
+		return strings.HasSuffix(s, strings.TrimPrefix(pattern, "*"))
+	case strings.HasSuffix(pattern, "*"):
+		return strings.HasPrefix(s, strings.TrimSuffix(pattern, "*"))
+	default:
+		return pattern == s
+	}
+}
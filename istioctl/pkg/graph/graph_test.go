@@ -0,0 +1,163 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"istio.io/istio/galley/pkg/config/analysis/local"
+	"istio.io/istio/galley/pkg/config/meta/metadata"
+)
+
+func buildTestGraph(t *testing.T, domainSuffix string) *Graph {
+	t.Helper()
+	b := NewBuilder("istio-system", domainSuffix)
+	sa := local.NewSourceAnalyzer(metadata.MustGet(), b.Analyzers(), nil, true)
+	if err := sa.AddFileKubeSource([]string{"testdata/mesh.yaml"}, "default"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sa.Analyze(make(chan struct{})); err != nil {
+		t.Fatal(err)
+	}
+	return b.Build()
+}
+
+type edgeSummary struct {
+	from, to string
+	kind     EdgeKind
+	subset   string
+}
+
+func TestBuild(t *testing.T) {
+	g := NewGomegaWithT(t)
+	graph := buildTestGraph(t, "cluster.local")
+
+	g.Expect(graph.Node("gateway/default/bookinfo-gateway")).NotTo(BeNil())
+	g.Expect(graph.Node("workload/default/default")).NotTo(BeNil())
+	g.Expect(graph.Node("service/default/reviews").Host).To(Equal("reviews.default.svc.cluster.local"))
+	g.Expect(graph.Node("service/default/api.payments.com").Kind).To(Equal(ExternalNode))
+
+	var edges []edgeSummary
+	for _, e := range graph.Edges {
+		edges = append(edges, edgeSummary{e.From, e.To, e.Kind, e.Subset})
+	}
+	g.Expect(edges).To(ConsistOf(
+		edgeSummary{"gateway/default/bookinfo-gateway", "service/default/productpage", RouteEdge, ""},
+		edgeSummary{"service/default/productpage", "service/default/reviews", RouteEdge, "v1"},
+		edgeSummary{"service/default/productpage", "service/default/reviews", RouteEdge, "v2"},
+		edgeSummary{"service/default/productpage", "service/default/ratings", MirrorEdge, ""},
+		edgeSummary{"workload/default/default", "service/default/ratings", EgressEdge, ""},
+		edgeSummary{"workload/default/default", "service/default/api.payments.com", EgressEdge, ""},
+	))
+}
+
+func TestBuildSecurity(t *testing.T) {
+	g := NewGomegaWithT(t)
+	graph := buildTestGraph(t, "cluster.local")
+
+	for _, e := range graph.Edges {
+		switch e.To {
+		case "service/default/reviews":
+			g.Expect(e.Security).To(Equal(Security{
+				ClientTLS:          "ISTIO_MUTUAL",
+				PeerAuthentication: "PERMISSIVE",
+				Authorization:      []string{"AuthorizationPolicy/default/reviews-viewer"},
+			}))
+		case "service/default/ratings":
+			// The selector of ratings-v2-viewer matches no pod of ratings, and the one of reviews-viewer
+			// contradicts the selector of ratings.
+			g.Expect(e.Security.Authorization).To(BeEmpty())
+		case "service/default/api.payments.com":
+			g.Expect(e.Security).To(Equal(Security{}))
+		}
+	}
+}
+
+func TestBuildDomainSuffix(t *testing.T) {
+	g := NewGomegaWithT(t)
+	graph := buildTestGraph(t, "example.org")
+
+	g.Expect(graph.Node("service/default/reviews").Host).To(Equal("reviews.default.svc.example.org"))
+}
+
+func TestWrite(t *testing.T) {
+	graph := &Graph{
+		Nodes: []*Node{
+			{ID: "gateway/default/gw", Kind: GatewayNode, Namespace: "default", Name: "gw"},
+			{ID: "service/default/a", Kind: ServiceNode, Namespace: "default", Name: "a"},
+		},
+		Edges: []*Edge{
+			{From: "gateway/default/gw", To: "service/default/a", Kind: RouteEdge, Weight: 100,
+				Security: Security{ClientTLS: "ISTIO_MUTUAL"}},
+		},
+	}
+
+	cases := []struct {
+		format   string
+		expected string
+	}{
+		{
+			format: DotFormat,
+			expected: `digraph mesh {
+  rankdir=LR;
+  "gateway/default/gw" [label="gateway default/gw" shape=hexagon];
+  "service/default/a" [label="a.default" shape=box];
+  "gateway/default/gw" -> "service/default/a" [label="route weight=100 tls=ISTIO_MUTUAL" style=solid];
+}
+`,
+		},
+		{
+			format: MermaidFormat,
+			expected: `graph LR
+  n0{{"gateway default/gw"}}
+  n1["a.default"]
+  n0 -->|"route weight=100 tls=ISTIO_MUTUAL"| n1
+`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.format, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := Write(&out, graph, c.format); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != c.expected {
+				t.Errorf("got:\n%s\nwant:\n%s", out.String(), c.expected)
+			}
+		})
+	}
+
+	t.Run(JSONFormat, func(t *testing.T) {
+		var out bytes.Buffer
+		if err := Write(&out, graph, JSONFormat); err != nil {
+			t.Fatal(err)
+		}
+		var got Graph
+		if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if len(got.Nodes) != 2 || len(got.Edges) != 1 || got.Edges[0].Weight != 100 {
+			t.Errorf("unexpected JSON output: %s", out.String())
+		}
+	})
+
+	if err := Write(&bytes.Buffer{}, graph, "svg"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
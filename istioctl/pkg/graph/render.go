@@ -0,0 +1,156 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Supported output formats
+const (
+	DotFormat     = "dot"
+	JSONFormat    = "json"
+	MermaidFormat = "mermaid"
+)
+
+// Formats lists the supported output formats.
+var Formats = []string{DotFormat, JSONFormat, MermaidFormat}
+
+// Write renders the graph to w in the given format.
+func Write(w io.Writer, g *Graph, format string) error {
+	switch strings.ToLower(format) {
+	case DotFormat:
+		return WriteDot(w, g)
+	case JSONFormat:
+		return WriteJSON(w, g)
+	case MermaidFormat:
+		return WriteMermaid(w, g)
+	default:
+		return fmt.Errorf("unknown output format %q, must be one of %s", format, strings.Join(Formats, "|"))
+	}
+}
+
+// WriteJSON renders the graph as indented JSON.
+func WriteJSON(w io.Writer, g *Graph) error {
+	out, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(out))
+	return err
+}
+
+var dotShapes = map[NodeKind]string{
+	ServiceNode:  "box",
+	ExternalNode: "box3d",
+	GatewayNode:  "hexagon",
+	WorkloadNode: "ellipse",
+}
+
+// WriteDot renders the graph in the Graphviz DOT language.
+func WriteDot(w io.Writer, g *Graph) error {
+	var b strings.Builder
+	b.WriteString("digraph mesh {\n  rankdir=LR;\n")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(&b, "  %q [label=%q shape=%s];\n", n.ID, nodeLabel(n), dotShapes[n.Kind])
+	}
+	for _, e := range g.Edges {
+		style := "solid"
+		if e.Kind == MirrorEdge {
+			style = "dashed"
+		} else if e.Kind == EgressEdge {
+			style = "dotted"
+		}
+		fmt.Fprintf(&b, "  %q -> %q [label=%q style=%s];\n", e.From, e.To, edgeLabel(e), style)
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteMermaid renders the graph as a Mermaid flowchart.
+func WriteMermaid(w io.Writer, g *Graph) error {
+	ids := make(map[string]string, len(g.Nodes))
+	var b strings.Builder
+	b.WriteString("graph LR\n")
+	for i, n := range g.Nodes {
+		id := fmt.Sprintf("n%d", i)
+		ids[n.ID] = id
+		label := mermaidEscape(nodeLabel(n))
+		switch n.Kind {
+		case ExternalNode:
+			fmt.Fprintf(&b, "  %s[/\"%s\"/]\n", id, label)
+		case GatewayNode:
+			fmt.Fprintf(&b, "  %s{{\"%s\"}}\n", id, label)
+		case WorkloadNode:
+			fmt.Fprintf(&b, "  %s([\"%s\"])\n", id, label)
+		default:
+			fmt.Fprintf(&b, "  %s[\"%s\"]\n", id, label)
+		}
+	}
+	for _, e := range g.Edges {
+		arrow := "-->"
+		if e.Kind != RouteEdge {
+			arrow = "-.->"
+		}
+		fmt.Fprintf(&b, "  %s %s|\"%s\"| %s\n", ids[e.From], arrow, mermaidEscape(edgeLabel(e)), ids[e.To])
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func nodeLabel(n *Node) string {
+	switch n.Kind {
+	case GatewayNode:
+		return "gateway " + n.Namespace + "/" + n.Name
+	case WorkloadNode:
+		return "sidecar " + n.Namespace + "/" + n.Name
+	default:
+		if strings.Contains(n.Name, ".") {
+			return n.Name
+		}
+		return n.Name + "." + n.Namespace
+	}
+}
+
+func edgeLabel(e *Edge) string {
+	parts := []string{string(e.Kind)}
+	if e.Subset != "" {
+		parts = append(parts, "subset="+e.Subset)
+	}
+	if e.Port != 0 {
+		parts = append(parts, fmt.Sprintf("port=%d", e.Port))
+	}
+	if e.Weight != 0 {
+		parts = append(parts, fmt.Sprintf("weight=%d", e.Weight))
+	}
+	if e.Security.ClientTLS != "" {
+		parts = append(parts, "tls="+e.Security.ClientTLS)
+	}
+	if e.Security.PeerAuthentication != "" {
+		parts = append(parts, "mtls="+e.Security.PeerAuthentication)
+	}
+	if len(e.Security.Authorization) > 0 {
+		parts = append(parts, fmt.Sprintf("authz=%d", len(e.Security.Authorization)))
+	}
+	return strings.Join(parts, " ")
+}
+
+func mermaidEscape(s string) string {
+	return strings.Replace(s, `"`, "#quot;", -1)
+}
@@ -23,12 +23,16 @@ import (
 	"strings"
 
 	multierror "github.com/hashicorp/go-multierror"
+	"github.com/spf13/cobra"
 	authorizationapi "k8s.io/api/authorization/v1beta1"
 	v1 "k8s.io/api/core/v1"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/version"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/client-go/kubernetes"
+
+	"istio.io/istio/pilot/pkg/serviceregistry/kube/controller"
+	istioVersion "istio.io/pkg/version"
 )
 
 const (
@@ -299,3 +303,57 @@ func (c *preCheckClient) checkMutatingWebhook() error {
 	_, err := c.client.AdmissionregistrationV1beta1().MutatingWebhookConfigurations().List(meta_v1.ListOptions{})
 	return err
 }
+
+// NewPrecheckCommand creates a new command for checking a cluster before installing or upgrading Istio
+func NewPrecheckCommand() *cobra.Command {
+	var (
+		kubeConfigFlags = &genericclioptions.ConfigFlags{
+			Context:    strPtr(""),
+			Namespace:  strPtr(""),
+			KubeConfig: strPtr(""),
+		}
+		istioNamespace string
+		upgrade        bool
+		targetVersion  string
+	)
+	precheckCmd := &cobra.Command{
+		Use:   "precheck",
+		Short: "Checks that a cluster is ready for an Istio installation or upgrade",
+		Long: `
+		precheck inspects a Kubernetes cluster for Istio install requirements.
+
+		With --upgrade it checks that a cluster already running Istio is ready for an upgrade
+		to the target version instead. It lists the versions of the running proxies in each
+		namespace, reports deprecated fields in the live configuration and the resources of
+		kinds the target version no longer supports, such as v1alpha1 RBAC and authentication
+		policies and adapter specific Mixer kinds.
+`,
+		Example: `
+		# Verify that Istio can be freshly installed
+		istioctl experimental precheck
+
+		# Verify that the cluster can be upgraded to this version of istioctl
+		istioctl experimental precheck --upgrade
+
+		# Verify that the cluster can be upgraded to Istio 1.5
+		istioctl experimental precheck --upgrade --target-version 1.5
+`,
+		Args: cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			if upgrade {
+				return upgradePreCheck(targetVersion, kubeConfigFlags, c.OutOrStderr())
+			}
+			return installPreCheck(istioNamespace, kubeConfigFlags, c.OutOrStderr())
+		},
+	}
+
+	flags := precheckCmd.PersistentFlags()
+	flags.StringVarP(&istioNamespace, "istioNamespace", "i", controller.IstioNamespace,
+		"Istio system namespace")
+	kubeConfigFlags.AddFlags(flags)
+	precheckCmd.Flags().BoolVar(&upgrade, "upgrade", false,
+		"Check that the cluster is ready for an upgrade instead of a fresh installation")
+	precheckCmd.Flags().StringVar(&targetVersion, "target-version", istioVersion.Info.Version,
+		"Istio version to check an upgrade against. Defaults to the version of istioctl")
+	return precheckCmd
+}
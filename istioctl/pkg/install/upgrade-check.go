@@ -0,0 +1,313 @@
+// Copyright 2019 Istio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package install
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	multierror "github.com/hashicorp/go-multierror"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+
+	"istio.io/istio/galley/pkg/config/analysis"
+	"istio.io/istio/galley/pkg/config/analysis/analyzers/deprecation"
+	"istio.io/istio/galley/pkg/config/analysis/analyzers/injection"
+	"istio.io/istio/galley/pkg/config/analysis/local"
+	"istio.io/istio/galley/pkg/config/meta/metadata"
+	"istio.io/istio/galley/pkg/config/meta/schema/collection"
+	"istio.io/istio/galley/pkg/config/resource"
+	cfgKube "istio.io/istio/galley/pkg/config/source/kube"
+)
+
+const istioProxyContainerName = "istio-proxy"
+
+var (
+	upgradeCheckSourceFactory = addRunningKubeSource
+
+	minorVersionRE = regexp.MustCompile(`^v?([0-9]+)\.([0-9]+)`)
+)
+
+// removedAPI describes an Istio configuration kind that is deprecated and eventually no longer served.
+type removedAPI struct {
+	collection   collection.Name
+	kind         string
+	deprecatedIn string
+	removedIn    string
+	replacement  string
+}
+
+const (
+	mixerAdapterReplacement  = "handler (config.istio.io/v1alpha2) with compiledAdapter"
+	mixerTemplateReplacement = "instance (config.istio.io/v1alpha2) with compiledTemplate"
+)
+
+// removedAPIs lists the kinds an upgrade may stop supporting, in the order they are reported.
+var removedAPIs = []removedAPI{
+	{metadata.IstioRbacV1Alpha1Serviceroles, "ServiceRole (rbac.istio.io/v1alpha1)", "1.4", "1.6",
+		"AuthorizationPolicy (security.istio.io/v1beta1)"},
+	{metadata.IstioRbacV1Alpha1Servicerolebindings, "ServiceRoleBinding (rbac.istio.io/v1alpha1)", "1.4", "1.6",
+		"AuthorizationPolicy (security.istio.io/v1beta1)"},
+	{metadata.IstioRbacV1Alpha1Rbacconfigs, "RbacConfig (rbac.istio.io/v1alpha1)", "1.4", "1.6",
+		"AuthorizationPolicy (security.istio.io/v1beta1)"},
+	{metadata.IstioRbacV1Alpha1Clusterrbacconfigs, "ClusterRbacConfig (rbac.istio.io/v1alpha1)", "1.4", "1.6",
+		"AuthorizationPolicy (security.istio.io/v1beta1)"},
+	{metadata.IstioAuthenticationV1Alpha1Policies, "Policy (authentication.istio.io/v1alpha1)", "1.5", "1.6",
+		"PeerAuthentication and RequestAuthentication (security.istio.io/v1beta1)"},
+	{metadata.IstioAuthenticationV1Alpha1Meshpolicies, "MeshPolicy (authentication.istio.io/v1alpha1)", "1.5", "1.6",
+		"PeerAuthentication (security.istio.io/v1beta1) in the root namespace"},
+
+	// Adapter and template specific Mixer kinds, deprecated in 1.4 in favor of the compiled handler and instance kinds.
+	{metadata.IstioConfigV1Alpha2LegacyCirconuses, "circonus (config.istio.io/v1alpha2)", "1.4", "1.5", mixerAdapterReplacement},
+	{metadata.IstioConfigV1Alpha2LegacyCloudwatches, "cloudwatch (config.istio.io/v1alpha2)", "1.4", "1.5", mixerAdapterReplacement},
+	{metadata.IstioConfigV1Alpha2LegacyDeniers, "denier (config.istio.io/v1alpha2)", "1.4", "1.5", mixerAdapterReplacement},
+	{metadata.IstioConfigV1Alpha2LegacyDogstatsds, "dogstatsd (config.istio.io/v1alpha2)", "1.4", "1.5", mixerAdapterReplacement},
+	{metadata.IstioConfigV1Alpha2LegacyFluentds, "fluentd (config.istio.io/v1alpha2)", "1.4", "1.5", mixerAdapterReplacement},
+	{metadata.IstioConfigV1Alpha2LegacyKubernetesenvs, "kubernetesenv (config.istio.io/v1alpha2)", "1.4", "1.5", mixerAdapterReplacement},
+	{metadata.IstioConfigV1Alpha2LegacyListcheckers, "listchecker (config.istio.io/v1alpha2)", "1.4", "1.5", mixerAdapterReplacement},
+	{metadata.IstioConfigV1Alpha2LegacyMemquotas, "memquota (config.istio.io/v1alpha2)", "1.4", "1.5", mixerAdapterReplacement},
+	{metadata.IstioConfigV1Alpha2LegacyNoops, "noop (config.istio.io/v1alpha2)", "1.4", "1.5", mixerAdapterReplacement},
+	{metadata.IstioConfigV1Alpha2LegacyOpas, "opa (config.istio.io/v1alpha2)", "1.4", "1.5", mixerAdapterReplacement},
+	{metadata.IstioConfigV1Alpha2LegacyPrometheuses, "prometheus (config.istio.io/v1alpha2)", "1.4", "1.5", mixerAdapterReplacement},
+	{metadata.IstioConfigV1Alpha2LegacyRbacs, "rbac (config.istio.io/v1alpha2)", "1.4", "1.5", mixerAdapterReplacement},
+	{metadata.IstioConfigV1Alpha2LegacyRedisquotas, "redisquota (config.istio.io/v1alpha2)", "1.4", "1.5", mixerAdapterReplacement},
+	{metadata.IstioConfigV1Alpha2LegacySignalfxs, "signalfx (config.istio.io/v1alpha2)", "1.4", "1.5", mixerAdapterReplacement},
+	{metadata.IstioConfigV1Alpha2LegacySolarwindses, "solarwinds (config.istio.io/v1alpha2)", "1.4", "1.5", mixerAdapterReplacement},
+	{metadata.IstioConfigV1Alpha2LegacyStackdrivers, "stackdriver (config.istio.io/v1alpha2)", "1.4", "1.5", mixerAdapterReplacement},
+	{metadata.IstioConfigV1Alpha2LegacyStatsds, "statsd (config.istio.io/v1alpha2)", "1.4", "1.5", mixerAdapterReplacement},
+	{metadata.IstioConfigV1Alpha2LegacyStdios, "stdio (config.istio.io/v1alpha2)", "1.4", "1.5", mixerAdapterReplacement},
+	{metadata.IstioConfigV1Alpha2LegacyZipkins, "zipkin (config.istio.io/v1alpha2)", "1.4", "1.5", mixerAdapterReplacement},
+	{metadata.IstioConfigV1Alpha2LegacyApikeys, "apikey (config.istio.io/v1alpha2)", "1.4", "1.5", mixerTemplateReplacement},
+	{metadata.IstioConfigV1Alpha2LegacyAuthorizations, "authorization (config.istio.io/v1alpha2)", "1.4", "1.5", mixerTemplateReplacement},
+	{metadata.IstioConfigV1Alpha2LegacyBypasses, "bypass (config.istio.io/v1alpha2)", "1.4", "1.5", mixerAdapterReplacement},
+	{metadata.IstioConfigV1Alpha2LegacyChecknothings, "checknothing (config.istio.io/v1alpha2)", "1.4", "1.5", mixerTemplateReplacement},
+	{metadata.IstioConfigV1Alpha2LegacyEdges, "edge (config.istio.io/v1alpha2)", "1.4", "1.5", mixerTemplateReplacement},
+	{metadata.IstioConfigV1Alpha2LegacyKuberneteses, "kubernetes (config.istio.io/v1alpha2)", "1.4", "1.5", mixerTemplateReplacement},
+	{metadata.IstioConfigV1Alpha2LegacyListentries, "listentry (config.istio.io/v1alpha2)", "1.4", "1.5", mixerTemplateReplacement},
+	{metadata.IstioConfigV1Alpha2LegacyLogentries, "logentry (config.istio.io/v1alpha2)", "1.4", "1.5", mixerTemplateReplacement},
+	{metadata.IstioConfigV1Alpha2LegacyMetrics, "metric (config.istio.io/v1alpha2)", "1.4", "1.5", mixerTemplateReplacement},
+	{metadata.IstioConfigV1Alpha2LegacyQuotas, "quota (config.istio.io/v1alpha2)", "1.4", "1.5", mixerTemplateReplacement},
+	{metadata.IstioConfigV1Alpha2LegacyReportnothings, "reportnothing (config.istio.io/v1alpha2)", "1.4", "1.5", mixerTemplateReplacement},
+	{metadata.IstioConfigV1Alpha2LegacyTracespans, "tracespan (config.istio.io/v1alpha2)", "1.4", "1.5", mixerTemplateReplacement},
+}
+
+// upgradeInventory is the state of the cluster relevant to an upgrade, collected during analysis.
+type upgradeInventory struct {
+	// proxies counts the istio-proxy containers by namespace and version.
+	proxies map[string]map[string]int
+	// resources holds the names of the existing resources of each kind in removedAPIs.
+	resources map[collection.Name][]string
+}
+
+// inventoryAnalyzer fills an upgradeInventory. It never reports messages.
+type inventoryAnalyzer struct {
+	inventory *upgradeInventory
+}
+
+var _ analysis.Analyzer = &inventoryAnalyzer{}
+
+// Metadata implements Analyzer.
+func (a *inventoryAnalyzer) Metadata() analysis.Metadata {
+	inputs := collection.Names{metadata.K8SCoreV1Pods}
+	for _, r := range removedAPIs {
+		inputs = append(inputs, r.collection)
+	}
+	return analysis.Metadata{
+		Name:   "install.UpgradeInventoryAnalyzer",
+		Inputs: inputs,
+	}
+}
+
+// Analyze implements Analyzer.
+func (a *inventoryAnalyzer) Analyze(c analysis.Context) {
+	a.inventory.proxies = make(map[string]map[string]int)
+	a.inventory.resources = make(map[collection.Name][]string)
+
+	c.ForEach(metadata.K8SCoreV1Pods, func(r *resource.Entry) bool {
+		pod := r.Item.(*v1.Pod)
+		for _, container := range pod.Spec.Containers {
+			if container.Name != istioProxyContainerName {
+				continue
+			}
+			ns := pod.GetNamespace()
+			if a.inventory.proxies[ns] == nil {
+				a.inventory.proxies[ns] = make(map[string]int)
+			}
+			a.inventory.proxies[ns][imageVersion(container.Image)]++
+		}
+		return true
+	})
+
+	for _, api := range removedAPIs {
+		col := api.collection
+		c.ForEach(col, func(r *resource.Entry) bool {
+			a.inventory.resources[col] = append(a.inventory.resources[col], r.Metadata.Name.String())
+			return true
+		})
+	}
+}
+
+// upgradePreCheck checks whether the configuration and the proxies of the cluster are compatible
+// with the given target Istio version.
+func upgradePreCheck(targetVersion string, restClientGetter genericclioptions.RESTClientGetter, writer io.Writer) error {
+	target, err := minorVersion(targetVersion)
+	if err != nil {
+		return fmt.Errorf("invalid target version %q, use --target-version to set it: %v", targetVersion, err)
+	}
+
+	fmt.Fprintf(writer, "\n")
+	fmt.Fprintf(writer, "Checking the cluster to make sure it is ready for an upgrade to Istio %v...\n", target)
+
+	inventory := &upgradeInventory{}
+	combined := analysis.Combine("upgrade",
+		&deprecation.FieldAnalyzer{},
+		&injection.VersionAnalyzer{},
+		&inventoryAnalyzer{inventory: inventory})
+	sa := local.NewSourceAnalyzer(metadata.MustGet(), combined, nil, true)
+	if err = upgradeCheckSourceFactory(sa, restClientGetter); err != nil {
+		return fmt.Errorf("failed to read the cluster configuration: %v", err)
+	}
+	messages, err := sa.Analyze(make(chan struct{}))
+	if err != nil {
+		return fmt.Errorf("failed to analyze the cluster configuration: %v", err)
+	}
+
+	var errs error
+
+	fmt.Fprintf(writer, "\n")
+	fmt.Fprintf(writer, "#1. Proxy-versions\n")
+	fmt.Fprintf(writer, "-----------------------\n")
+	if len(inventory.proxies) == 0 {
+		fmt.Fprintf(writer, "No Istio proxies found.\n")
+	}
+	namespaces := make([]string, 0, len(inventory.proxies))
+	for ns := range inventory.proxies {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	for _, ns := range namespaces {
+		versions := inventory.proxies[ns]
+		for _, v := range sortedVersions(versions) {
+			fmt.Fprintf(writer, "%v: %d proxies at version %v", ns, versions[v], v)
+			if err := checkProxyVersion(v, target); err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("namespace %v: %v", ns, err))
+				fmt.Fprintf(writer, " - %v", err)
+			}
+			fmt.Fprintf(writer, "\n")
+		}
+	}
+
+	fmt.Fprintf(writer, "\n")
+	fmt.Fprintf(writer, "#2. Deprecated-configuration\n")
+	fmt.Fprintf(writer, "-----------------------\n")
+	if len(messages) == 0 {
+		fmt.Fprintf(writer, "No deprecated configuration found.\n")
+	}
+	for _, m := range messages {
+		fmt.Fprintf(writer, "%v\n", m.String())
+	}
+
+	fmt.Fprintf(writer, "\n")
+	fmt.Fprintf(writer, "#3. Removed-APIs\n")
+	fmt.Fprintf(writer, "-----------------------\n")
+	found := false
+	for _, api := range removedAPIs {
+		names := inventory.resources[api.collection]
+		if len(names) == 0 {
+			continue
+		}
+		sort.Strings(names)
+		switch {
+		case parseVersion(api.removedIn, 4) <= parseVersion(target, 4):
+			found = true
+			msg := fmt.Sprintf("%v is not supported by Istio %v (removed in %v), migrate to %v: %v",
+				api.kind, target, api.removedIn, api.replacement, strings.Join(names, ", "))
+			errs = multierror.Append(errs, errors.New(msg))
+			fmt.Fprintf(writer, "%v\n", msg)
+		case parseVersion(api.deprecatedIn, 4) <= parseVersion(target, 4):
+			found = true
+			fmt.Fprintf(writer, "%v is deprecated since %v and will be removed in %v, migrate to %v: %v\n",
+				api.kind, api.deprecatedIn, api.removedIn, api.replacement, strings.Join(names, ", "))
+		}
+	}
+	if !found {
+		fmt.Fprintf(writer, "No removed or deprecated APIs in use.\n")
+	}
+
+	fmt.Fprintf(writer, "\n")
+	fmt.Fprintf(writer, "-----------------------\n")
+	if errs == nil {
+		fmt.Fprintf(writer, "Upgrade Pre-Check passed! The cluster is ready for an upgrade to Istio %v.\n", target)
+	}
+	fmt.Fprintf(writer, "\n")
+	return errs
+}
+
+// checkProxyVersion returns an error if proxies at version v cannot be connected to a control plane
+// at the target version. Proxies may lag the control plane by at most one minor version.
+func checkProxyVersion(v, target string) error {
+	pv, err := minorVersion(v)
+	if err != nil {
+		return fmt.Errorf("unable to determine the compatibility of proxy version %q", v)
+	}
+	pvParts := strings.Split(pv, ".")
+	targetParts := strings.Split(target, ".")
+	if pvParts[0] != targetParts[0] || parseVersion(target, 4)-parseVersion(pv, 4) > 1 {
+		return fmt.Errorf("proxy version %v is not supported by Istio %v, restart the workloads "+
+			"on a supported version before upgrading", pv, target)
+	}
+	return nil
+}
+
+// minorVersion returns the "<major>.<minor>" prefix of an Istio version or image tag.
+func minorVersion(v string) (string, error) {
+	parts := minorVersionRE.FindStringSubmatch(v)
+	if parts == nil {
+		return "", fmt.Errorf("could not parse %q as version", v)
+	}
+	return parts[1] + "." + parts[2], nil
+}
+
+// imageVersion returns the tag of a container image, or "unknown" if it has none.
+func imageVersion(image string) string {
+	// Ignore the digest and the port of the registry, if any.
+	image = strings.Split(image, "@")[0]
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[i+1:]
+	}
+	return "unknown"
+}
+
+func sortedVersions(versions map[string]int) []string {
+	keys := make([]string, 0, len(versions))
+	for k := range versions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func addRunningKubeSource(sa *local.SourceAnalyzer, restClientGetter genericclioptions.RESTClientGetter) error {
+	restConfig, err := restClientGetter.ToRESTConfig()
+	if err != nil {
+		return err
+	}
+	sa.AddRunningKubeSource(cfgKube.NewInterfaces(restConfig))
+	return nil
+}
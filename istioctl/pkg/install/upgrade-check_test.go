@@ -0,0 +1,138 @@
+// Copyright 2019 Istio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package install
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+
+	"istio.io/istio/galley/pkg/config/analysis/local"
+)
+
+func mockUpgradeCheckSource(files ...string) func(*local.SourceAnalyzer, genericclioptions.RESTClientGetter) error {
+	return func(sa *local.SourceAnalyzer, _ genericclioptions.RESTClientGetter) error {
+		return sa.AddFileKubeSource(files, "default")
+	}
+}
+
+func TestUpgradePreCheck(t *testing.T) {
+	defer func() { upgradeCheckSourceFactory = addRunningKubeSource }()
+	upgradeCheckSourceFactory = mockUpgradeCheckSource("testdata/upgrade-cluster.yaml")
+
+	cases := []struct {
+		target            string
+		expectedException bool
+		expectedOutput    []string
+		unexpectedOutput  []string
+	}{
+		{
+			target:            "1.3",
+			expectedException: false,
+			expectedOutput: []string{
+				"default: 1 proxies at version 1.3.2\n",
+				"legacy: 1 proxies at version 1.2.5\n",
+				"No removed or deprecated APIs in use.",
+				"Upgrade Pre-Check passed!",
+			},
+			unexpectedOutput: []string{"ServiceRole", "prometheus"},
+		},
+		{
+			target:            "1.4.0",
+			expectedException: true,
+			expectedOutput: []string{
+				"default: 1 proxies at version 1.3.2\n",
+				"legacy: 1 proxies at version 1.2.5 - proxy version 1.2 is not supported by Istio 1.4",
+				"ServiceRole (rbac.istio.io/v1alpha1) is deprecated since 1.4 and will be removed in 1.6",
+				"prometheus (config.istio.io/v1alpha2) is deprecated since 1.4 and will be removed in 1.5",
+			},
+			unexpectedOutput: []string{"Upgrade Pre-Check passed!", "not supported by Istio 1.4 (removed"},
+		},
+		{
+			target:            "1.5",
+			expectedException: true,
+			expectedOutput: []string{
+				"prometheus (config.istio.io/v1alpha2) is not supported by Istio 1.5 (removed in 1.5)",
+			},
+		},
+		{
+			target:            "1.6",
+			expectedException: true,
+			expectedOutput: []string{
+				"ServiceRole (rbac.istio.io/v1alpha1) is not supported by Istio 1.6 (removed in 1.6), " +
+					"migrate to AuthorizationPolicy (security.istio.io/v1beta1): default/viewer",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.target, func(t *testing.T) {
+			var out bytes.Buffer
+			err := upgradePreCheck(c.target, &genericclioptions.ConfigFlags{}, &out)
+			output := out.String()
+			if c.expectedException && err == nil {
+				t.Fatalf("wanted an error, didn't get one, output was %q", output)
+			}
+			if !c.expectedException && err != nil {
+				t.Fatalf("unwanted error: %v, output was %q", err, output)
+			}
+			for _, want := range c.expectedOutput {
+				if !strings.Contains(output, want) {
+					t.Errorf("output does not contain %q:\n%s", want, output)
+				}
+			}
+			for _, notWant := range c.unexpectedOutput {
+				if strings.Contains(output, notWant) {
+					t.Errorf("output unexpectedly contains %q:\n%s", notWant, output)
+				}
+			}
+		})
+	}
+
+	if err := upgradePreCheck("unknown", &genericclioptions.ConfigFlags{}, &bytes.Buffer{}); err == nil {
+		t.Error("expected error for an invalid target version")
+	}
+}
+
+func TestCheckProxyVersion(t *testing.T) {
+	cases := []struct {
+		image   string
+		target  string
+		version string
+		wantErr bool
+	}{
+		{image: "docker.io/istio/proxyv2:1.4.0", target: "1.4", version: "1.4.0"},
+		{image: "docker.io/istio/proxyv2:1.3.5", target: "1.4", version: "1.3.5"},
+		{image: "docker.io/istio/proxyv2:1.2.9", target: "1.4", version: "1.2.9", wantErr: true},
+		{image: "localhost:5000/istio/proxyv2:1.4-dev", target: "1.4", version: "1.4-dev"},
+		{image: "localhost:5000/istio/proxyv2", target: "1.4", version: "unknown", wantErr: true},
+		{image: "docker.io/istio/proxyv2:latest", target: "1.4", version: "latest", wantErr: true},
+		{image: "docker.io/istio/proxyv2:1.9.0", target: "2.0", version: "1.9.0", wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.image, func(t *testing.T) {
+			v := imageVersion(c.image)
+			if v != c.version {
+				t.Fatalf("imageVersion(%q) = %q, want %q", c.image, v, c.version)
+			}
+			if err := checkProxyVersion(v, c.target); (err != nil) != c.wantErr {
+				t.Errorf("checkProxyVersion(%q, %q) = %v, wantErr %v", v, c.target, err, c.wantErr)
+			}
+		})
+	}
+}
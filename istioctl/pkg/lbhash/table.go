@@ -0,0 +1,199 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lbhash reproduces the consistent hashing load balancers of Envoy, to find the endpoint the requests
+// with a given hash key are sent to.
+package lbhash
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+const (
+	// DefaultMinimumRingSize is the default minimum ring size of the ring hash load balancer of Envoy.
+	DefaultMinimumRingSize = 1024
+	// DefaultMaximumRingSize is the default maximum ring size of the ring hash load balancer of Envoy.
+	DefaultMaximumRingSize = 8 * 1024 * 1024
+	// MaglevTableSize is the table size of the Maglev load balancer of Envoy.
+	MaglevTableSize = 65537
+)
+
+// Host is an endpoint of a cluster.
+type Host struct {
+	// Address is the address of the endpoint as formatted by Envoy, e.g. 10.0.0.1:8080 or [::1]:8080.
+	Address string
+	// Weight is the load balancing weight of the endpoint, 1 if 0.
+	Weight uint32
+}
+
+// Table maps hashes to the hosts of a cluster.
+type Table interface {
+	// Pick returns the index of the host the requests with the hash are sent to.
+	Pick(hash uint64) int
+}
+
+// KeyHash returns the hash of the value of a hash policy of a route, e.g. the value of a header or a cookie,
+// or the source IP.
+func KeyHash(key string) uint64 {
+	return XXHash64([]byte(key), 0)
+}
+
+// normalizedWeights returns the weights of the hosts divided by their sum, and the smallest and largest ones.
+func normalizedWeights(hosts []Host) (weights []float64, min, max float64) {
+	var sum float64
+	for _, h := range hosts {
+		sum += float64(hostWeight(h))
+	}
+	weights = make([]float64, len(hosts))
+	min = 1
+	for i, h := range hosts {
+		weights[i] = float64(hostWeight(h)) / sum
+		min = math.Min(min, weights[i])
+		max = math.Max(max, weights[i])
+	}
+	return weights, min, max
+}
+
+func hostWeight(h Host) uint32 {
+	if h.Weight == 0 {
+		return 1
+	}
+	return h.Weight
+}
+
+type ringEntry struct {
+	hash uint64
+	host int
+}
+
+// Ring is the ring of the ring hash load balancer.
+type Ring struct {
+	entries []ringEntry
+}
+
+// NewRing returns the ring of the hosts with the ring sizes and hash function of a cluster, murmur hash 2
+// instead of xxHash if murmur is set.
+func NewRing(hosts []Host, minSize, maxSize uint64, murmur bool) (*Ring, error) {
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no hosts")
+	}
+	if minSize == 0 {
+		minSize = DefaultMinimumRingSize
+	}
+	if maxSize == 0 {
+		maxSize = DefaultMaximumRingSize
+	}
+	if minSize > maxSize {
+		return nil, fmt.Errorf("minimum ring size %d is larger than maximum ring size %d", minSize, maxSize)
+	}
+
+	weights, minWeight, _ := normalizedWeights(hosts)
+	// Each host has a number of entries proportional to its weight, the lightest one at least one.
+	scale := math.Min(math.Ceil(minWeight*float64(minSize))/minWeight, float64(maxSize))
+	r := &Ring{entries: make([]ringEntry, 0, int(math.Ceil(scale)))}
+	var current, target float64
+	for i, h := range hosts {
+		target += scale * weights[i]
+		for n := 0; current < target; n++ {
+			key := []byte(h.Address + "_" + strconv.Itoa(n))
+			var hash uint64
+			if murmur {
+				hash = MurmurHash64(key)
+			} else {
+				hash = XXHash64(key, 0)
+			}
+			r.entries = append(r.entries, ringEntry{hash: hash, host: i})
+			current++
+		}
+	}
+	sort.SliceStable(r.entries, func(i, j int) bool { return r.entries[i].hash < r.entries[j].hash })
+	return r, nil
+}
+
+// Size returns the number of entries of the ring.
+func (r *Ring) Size() int {
+	return len(r.entries)
+}
+
+// Pick returns the host of the first entry of the ring with a hash larger than or equal to the hash.
+func (r *Ring) Pick(hash uint64) int {
+	i := sort.Search(len(r.entries), func(i int) bool { return r.entries[i].hash >= hash })
+	if i == len(r.entries) {
+		return r.entries[0].host
+	}
+	return r.entries[i].host
+}
+
+// Maglev is the lookup table of the Maglev load balancer.
+type Maglev struct {
+	table []int
+}
+
+// NewMaglev returns the Maglev table of the hosts.
+func NewMaglev(hosts []Host) (*Maglev, error) {
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no hosts")
+	}
+	size := uint64(MaglevTableSize)
+
+	type buildEntry struct {
+		offset, skip, next uint64
+		weight, target     float64
+	}
+	weights, _, maxWeight := normalizedWeights(hosts)
+	entries := make([]buildEntry, len(hosts))
+	for i, h := range hosts {
+		entries[i] = buildEntry{
+			offset: XXHash64([]byte(h.Address), 0) % size,
+			skip:   XXHash64([]byte(h.Address), 1)%(size-1) + 1,
+			weight: weights[i],
+		}
+	}
+
+	m := &Maglev{table: make([]int, size)}
+	for i := range m.table {
+		m.table[i] = -1
+	}
+	// Each host fills its next preferred free slot in turn, lighter hosts skipping turns in proportion to their
+	// weight.
+	var filled uint64
+	for iteration := 1; ; iteration++ {
+		for i := range entries {
+			e := &entries[i]
+			if float64(iteration)*e.weight < e.target {
+				continue
+			}
+			e.target += maxWeight
+			c := (e.offset + e.skip*e.next) % size
+			for m.table[c] >= 0 {
+				e.next++
+				c = (e.offset + e.skip*e.next) % size
+			}
+			m.table[c] = i
+			e.next++
+			filled++
+			if filled == size {
+				return m, nil
+			}
+		}
+	}
+}
+
+// Pick returns the host of the slot of the table of the hash.
+func (m *Maglev) Pick(hash uint64) int {
+	return m.table[hash%uint64(len(m.table))]
+}
@@ -0,0 +1,138 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lbhash
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestXXHash64(t *testing.T) {
+	cases := []struct {
+		in   string
+		want uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"a", 0xd24ec4f1a98c6e5b},
+		{"abc", 0x44bc2cf5ad770999},
+		{"Nobody inspects the spammish repetition", 0xfbcea83c8a378bf1},
+	}
+	for _, c := range cases {
+		if got := XXHash64([]byte(c.in), 0); got != c.want {
+			t.Errorf("XXHash64(%q) = %x, want %x", c.in, got, c.want)
+		}
+	}
+}
+
+func TestMurmurHash64(t *testing.T) {
+	// The values of std::hash<std::string> of libstdc++, which Envoy ported.
+	cases := []struct {
+		in   string
+		want uint64
+	}{
+		{"", 0x553e93901e462a6e},
+		{"a", 0x454ddee488c1ed6b},
+		{"10.0.0.1:8080_0", 0x28125cc835986945},
+		{"Nobody inspects the spammish repetition", 0xc3b23f5033ade0d1},
+	}
+	for _, c := range cases {
+		if got := MurmurHash64([]byte(c.in)); got != c.want {
+			t.Errorf("MurmurHash64(%q) = %x, want %x", c.in, got, c.want)
+		}
+	}
+}
+
+func testHosts(n int) []Host {
+	hosts := make([]Host, 0, n)
+	for i := 0; i < n; i++ {
+		hosts = append(hosts, Host{Address: fmt.Sprintf("10.0.0.%d:8080", i+1)})
+	}
+	return hosts
+}
+
+// distribution returns the number of keys picked per host, and the keys picked per host.
+func distribution(table Table, keys int) (map[int]int, []int) {
+	counts := make(map[int]int)
+	picks := make([]int, keys)
+	for k := 0; k < keys; k++ {
+		picks[k] = table.Pick(KeyHash(fmt.Sprintf("user-%d", k)))
+		counts[picks[k]]++
+	}
+	return counts, picks
+}
+
+func TestRing(t *testing.T) {
+	hosts := testHosts(4)
+	ring, err := NewRing(hosts, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ring.Size() != DefaultMinimumRingSize {
+		t.Errorf("got ring size %d, want %d", ring.Size(), DefaultMinimumRingSize)
+	}
+
+	hosts[0].Weight = 2
+	weighted, err := NewRing(hosts, 16, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The lightest host has ceil(16 / 5) entries, the heaviest twice as many.
+	if weighted.Size() != 20 {
+		t.Errorf("got weighted ring size %d, want 20", weighted.Size())
+	}
+
+	if _, err := NewRing(hosts, 10, 5, false); err == nil {
+		t.Error("got no error for a minimum ring size above the maximum ring size")
+	}
+	if _, err := NewRing(nil, 0, 0, false); err == nil {
+		t.Error("got no error without hosts")
+	}
+}
+
+func TestMaglev(t *testing.T) {
+	maglev, err := NewMaglev(testHosts(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts, before := distribution(maglev, 10000)
+	for host, n := range counts {
+		if n < 2000 || n > 3000 {
+			t.Errorf("host %d got %d of 10000 keys", host, n)
+		}
+	}
+
+	// Adding a host mostly moves keys to the new host.
+	grown, err := NewMaglev(testHosts(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, after := distribution(grown, 10000)
+	moved, reshuffled := 0, 0
+	for k := range before {
+		switch after[k] {
+		case before[k]:
+		case 4:
+			moved++
+		default:
+			reshuffled++
+		}
+	}
+	if moved < 1500 || moved > 2500 {
+		t.Errorf("got %d of 10000 keys moved to the new host", moved)
+	}
+	if reshuffled > 200 {
+		t.Errorf("got %d of 10000 keys moved between the previous hosts", reshuffled)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2019 Istio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multicluster
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ApplyOptions controls how the remote secrets of the mesh are applied.
+type ApplyOptions struct {
+	// Rotate replaces the service account token of every cluster before distributing it.
+	Rotate bool
+	// RotateTimeout is how long to wait for a new service account token.
+	RotateTimeout time.Duration
+}
+
+// hooks for testing
+var (
+	rotatePollInterval = time.Second
+)
+
+func newApplyCommand(kubeconfig, namespace *string) *cobra.Command {
+	var (
+		filename string
+		opts     = ApplyOptions{RotateTimeout: 30 * time.Second}
+	)
+	c := &cobra.Command{
+		Use:   "apply",
+		Short: "Create or update the remote secrets of every cluster of the mesh",
+		Long: `Creates a remote secret with the credentials of each cluster of the mesh and installs it
+in every other cluster, so that pilot in each cluster discovers the endpoints of all the others.
+Existing remote secrets are updated in place. With --rotate, the service account token of each
+cluster is revoked and replaced by a new one before it is distributed.`,
+		Example: `
+# Join the clusters listed in mesh.yaml
+istioctl x multicluster apply -f mesh.yaml
+
+# Rotate the credentials used by the clusters to access each other
+istioctl x multicluster apply -f mesh.yaml --rotate
+`,
+		Args: cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			md, err := LoadMeshDesc(filename, *kubeconfig, *namespace)
+			if err != nil {
+				return err
+			}
+			return Apply(md, opts, c.OutOrStdout())
+		},
+	}
+
+	addTopologyFlag(c, &filename)
+	c.PersistentFlags().BoolVar(&opts.Rotate, "rotate", false,
+		"revoke and replace the service account token of each cluster before distributing it")
+	c.PersistentFlags().DurationVar(&opts.RotateTimeout, "rotate-timeout", opts.RotateTimeout,
+		"how long to wait for a new service account token when rotating")
+	return c
+}
+
+// Apply creates the remote secret of every cluster of the mesh and installs it in all the other clusters.
+func Apply(md *MeshDesc, opts ApplyOptions, out io.Writer) error {
+	clients := newMeshClients()
+
+	var errs error
+	for i := range md.Clusters {
+		from := &md.Clusters[i]
+		secret, err := clusterRemoteSecret(clients, from, opts)
+		if err != nil {
+			errs = multierror.Append(errs, err)
+			fmt.Fprintf(out, "%v: %v\n", from.Name, err)
+			continue
+		}
+
+		for j := range md.Clusters {
+			to := &md.Clusters[j]
+			if to.Name == from.Name {
+				continue
+			}
+			kube, err := clients.kubeClient(to)
+			if err == nil {
+				err = applySecret(kube, to.Namespace, secret)
+			}
+			if err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("could not install the remote secret of %v in %v: %v",
+					from.Name, to.Name, err))
+				fmt.Fprintf(out, "%v -> %v: %v\n", from.Name, to.Name, err)
+				continue
+			}
+			fmt.Fprintf(out, "%v -> %v: secret %v/%v applied\n", from.Name, to.Name, to.Namespace, secret.Name)
+		}
+	}
+	return errs
+}
+
+// clusterRemoteSecret creates the remote secret giving access to the cluster, rotating its token first if asked to.
+func clusterRemoteSecret(clients *meshClients, c *ClusterDesc, opts ApplyOptions) (*v1.Secret, error) {
+	kube, err := clients.kubeClient(c)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Rotate {
+		if err := rotateServiceAccountToken(kube, c.ServiceAccount, c.Namespace, opts.RotateTimeout); err != nil {
+			return nil, fmt.Errorf("could not rotate the token of %v/%v: %v", c.Namespace, c.ServiceAccount, err)
+		}
+	}
+	return createRemoteSecret(kube, c.Kubeconfig, c.Context, c.Namespace, c.ServiceAccount, c.Name)
+}
+
+// rotateServiceAccountToken deletes the token secret of the service account and waits for the token controller
+// of the cluster to create a new one. Remote secrets built from the old token stop working.
+func rotateServiceAccountToken(kube kubernetes.Interface, saName, saNamespace string, timeout time.Duration) error {
+	old, err := getServiceAccountSecretToken(kube, saName, saNamespace)
+	if err != nil {
+		return err
+	}
+	if err := kube.CoreV1().Secrets(old.Namespace).Delete(old.Name, &metav1.DeleteOptions{}); err != nil {
+		return err
+	}
+	return wait.PollImmediate(rotatePollInterval, timeout, func() (bool, error) {
+		current, err := getServiceAccountSecretToken(kube, saName, saNamespace)
+		if err != nil {
+			// The service account may briefly reference no or both secrets.
+			return false, nil
+		}
+		return current.Name != old.Name, nil
+	})
+}
+
+// applySecret creates the secret in the namespace, or updates it if it already exists.
+func applySecret(kube kubernetes.Interface, namespace string, secret *v1.Secret) error {
+	s := secret.DeepCopy()
+	s.Namespace = namespace
+	existing, err := kube.CoreV1().Secrets(namespace).Get(s.Name, metav1.GetOptions{})
+	if kerrors.IsNotFound(err) {
+		_, err = kube.CoreV1().Secrets(namespace).Create(s)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	s.ResourceVersion = existing.ResourceVersion
+	_, err = kube.CoreV1().Secrets(namespace).Update(s)
+	return err
+}
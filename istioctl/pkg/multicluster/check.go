@@ -0,0 +1,282 @@
+// Copyright 2019 Istio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multicluster
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"istio.io/istio/pkg/config/mesh"
+)
+
+const (
+	meshConfigMapName   = "istio"
+	meshNetworksKey     = "meshNetworks"
+	trustRootSecretName = "istio.default"
+	trustRootKey        = "root-cert.pem"
+)
+
+func newCheckCommand(kubeconfig, namespace *string) *cobra.Command {
+	var filename string
+	c := &cobra.Command{
+		Use:   "check",
+		Short: "Check that the clusters of the mesh are joined together",
+		Long: `Checks that every cluster of the mesh has the remote secrets of all the other clusters,
+that the mesh networks configuration of each cluster places the other clusters in their network,
+that pilot in each cluster discovers the endpoints of all the other clusters and that all the
+clusters share the same trust root.`,
+		Example: `
+istioctl x multicluster check -f mesh.yaml
+`,
+		Args: cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			md, err := LoadMeshDesc(filename, *kubeconfig, *namespace)
+			if err != nil {
+				return err
+			}
+			return Check(md, c.OutOrStdout())
+		},
+	}
+	addTopologyFlag(c, &filename)
+	return c
+}
+
+// Check verifies that the clusters of the mesh can discover and trust each other.
+func Check(md *MeshDesc, out io.Writer) error {
+	clients := newMeshClients()
+	var errs error
+	report := func(c *ClusterDesc, err error) {
+		errs = multierror.Append(errs, fmt.Errorf("%v: %v", c.Name, err))
+		fmt.Fprintf(out, "%v: %v\n", c.Name, err)
+	}
+
+	fmt.Fprintf(out, "#1. Remote-secrets\n")
+	fmt.Fprintf(out, "-----------------------\n")
+	for i := range md.Clusters {
+		c := &md.Clusters[i]
+		kube, err := clients.kubeClient(c)
+		if err != nil {
+			report(c, err)
+			continue
+		}
+		secrets, err := remoteSecretClusters(kube, c.Namespace)
+		if err != nil {
+			report(c, fmt.Errorf("could not list remote secrets: %v", err))
+			continue
+		}
+		ok := true
+		for _, other := range md.Clusters {
+			name, found := secrets[other.Name]
+			delete(secrets, other.Name)
+			switch {
+			case other.Name == c.Name && found:
+				report(c, fmt.Errorf("remote secret %v points to the cluster itself", name))
+				ok = false
+			case other.Name != c.Name && !found:
+				report(c, fmt.Errorf("missing the remote secret of %v", other.Name))
+				ok = false
+			}
+		}
+		for _, unknown := range sortedClusterNames(secrets) {
+			fmt.Fprintf(out, "%v: remote secret %v is for cluster %v, which is not part of the mesh\n",
+				c.Name, secrets[unknown], unknown)
+		}
+		if ok {
+			fmt.Fprintf(out, "%v: has the remote secrets of all the other clusters\n", c.Name)
+		}
+	}
+
+	fmt.Fprintf(out, "\n#2. Mesh-networks\n")
+	fmt.Fprintf(out, "-----------------------\n")
+	for i := range md.Clusters {
+		c := &md.Clusters[i]
+		missing, err := checkMeshNetworks(clients, md, c)
+		if err != nil {
+			report(c, err)
+			continue
+		}
+		for _, m := range missing {
+			report(c, fmt.Errorf("mesh networks do not place cluster %v in network %v", m.Name, m.Network))
+		}
+		if len(missing) == 0 {
+			fmt.Fprintf(out, "%v: mesh networks are consistent with the topology\n", c.Name)
+		}
+	}
+
+	fmt.Fprintf(out, "\n#3. Endpoint-discovery\n")
+	fmt.Fprintf(out, "-----------------------\n")
+	for i := range md.Clusters {
+		c := &md.Clusters[i]
+		shards, err := pilotEndpointShards(clients, c)
+		if err != nil {
+			report(c, fmt.Errorf("could not read the endpoints of pilot: %v", err))
+			continue
+		}
+		ok := true
+		for _, other := range md.Clusters {
+			if other.Name != c.Name && !shards[other.Name] {
+				report(c, fmt.Errorf("pilot has no endpoints from %v", other.Name))
+				ok = false
+			}
+		}
+		if ok {
+			fmt.Fprintf(out, "%v: pilot has endpoints from all the other clusters\n", c.Name)
+		}
+	}
+
+	fmt.Fprintf(out, "\n#4. Trust-roots\n")
+	fmt.Fprintf(out, "-----------------------\n")
+	roots := make(map[string][]string)
+	var fingerprints []string
+	for i := range md.Clusters {
+		c := &md.Clusters[i]
+		fp, err := trustRootFingerprint(clients, c)
+		if err != nil {
+			report(c, fmt.Errorf("could not read the trust root: %v", err))
+			continue
+		}
+		if _, ok := roots[fp]; !ok {
+			fingerprints = append(fingerprints, fp)
+		}
+		roots[fp] = append(roots[fp], c.Name)
+	}
+	if len(fingerprints) > 1 {
+		err := fmt.Errorf("clusters do not share the same trust root")
+		errs = multierror.Append(errs, err)
+		fmt.Fprintf(out, "%v:\n", err)
+		for _, fp := range fingerprints {
+			fmt.Fprintf(out, "  %v: %v\n", fp, roots[fp])
+		}
+	} else if len(fingerprints) == 1 {
+		fmt.Fprintf(out, "%v share the trust root %v\n", roots[fingerprints[0]], fingerprints[0])
+	}
+
+	fmt.Fprintf(out, "\n-----------------------\n")
+	if errs == nil {
+		fmt.Fprintf(out, "Multi-cluster check passed! The clusters are joined together.\n")
+	}
+	return errs
+}
+
+// checkMeshNetworks returns the remote clusters of the topology that the mesh networks of the cluster
+// do not place in the expected network. The local registry is not named after the cluster, so it is skipped.
+func checkMeshNetworks(clients *meshClients, md *MeshDesc, c *ClusterDesc) ([]ClusterDesc, error) {
+	kube, err := clients.kubeClient(c)
+	if err != nil {
+		return nil, err
+	}
+	cm, err := kube.CoreV1().ConfigMaps(c.Namespace).Get(meshConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("could not read the mesh configuration: %v", err)
+	}
+	networks := mesh.EmptyMeshNetworks()
+	if data := cm.Data[meshNetworksKey]; data != "" {
+		n, err := mesh.LoadMeshNetworksConfig(data)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse the mesh networks: %v", err)
+		}
+		networks = *n
+	}
+
+	var missing []ClusterDesc
+	for _, other := range md.Clusters {
+		if other.Name == c.Name || other.Network == "" {
+			continue
+		}
+		found := false
+		if n, ok := networks.Networks[other.Network]; ok {
+			for _, ep := range n.Endpoints {
+				if ep.GetFromRegistry() == other.Name {
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			missing = append(missing, other)
+		}
+	}
+	return missing, nil
+}
+
+// endpointShards is the subset of the pilot /debug/endpointShardz output used to find the registries endpoints come from.
+type endpointShards struct {
+	Shards map[string]json.RawMessage
+}
+
+// pilotEndpointShards returns the registries that pilot in the cluster has endpoints from.
+func pilotEndpointShards(clients *meshClients, c *ClusterDesc) (map[string]bool, error) {
+	exec, err := clients.execClient(c)
+	if err != nil {
+		return nil, err
+	}
+	results, err := exec.AllPilotsDiscoveryDo(c.Namespace, "GET", "/debug/endpointShardz", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// All the pilots of the cluster are expected to see the same registries.
+	var registries map[string]bool
+	for pilot, result := range results {
+		var byService map[string]map[string]*endpointShards
+		if err := json.Unmarshal(result, &byService); err != nil {
+			return nil, fmt.Errorf("could not parse the output of %v: %v", pilot, err)
+		}
+		seen := make(map[string]bool)
+		for _, byNamespace := range byService {
+			for _, shards := range byNamespace {
+				if shards == nil {
+					continue
+				}
+				for registry := range shards.Shards {
+					seen[registry] = true
+				}
+			}
+		}
+		if registries == nil {
+			registries = seen
+			continue
+		}
+		for registry := range registries {
+			if !seen[registry] {
+				delete(registries, registry)
+			}
+		}
+	}
+	return registries, nil
+}
+
+// trustRootFingerprint returns the SHA-256 fingerprint of the root certificate workloads of the cluster trust.
+func trustRootFingerprint(clients *meshClients, c *ClusterDesc) (string, error) {
+	kube, err := clients.kubeClient(c)
+	if err != nil {
+		return "", err
+	}
+	secret, err := kube.CoreV1().Secrets(c.Namespace).Get(trustRootSecretName, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	root, ok := secret.Data[trustRootKey]
+	if !ok {
+		return "", fmt.Errorf("no %q data found in secret %v/%v", trustRootKey, c.Namespace, trustRootSecretName)
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(root)), nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2019 Istio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multicluster
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"istio.io/istio/pkg/kube/secretcontroller"
+)
+
+func newDescribeCommand(kubeconfig, namespace *string) *cobra.Command {
+	var filename string
+	c := &cobra.Command{
+		Use:   "describe",
+		Short: "Describe the clusters of the mesh and the remote secrets installed in each of them",
+		Example: `
+istioctl x multicluster describe -f mesh.yaml
+`,
+		Args: cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			md, err := LoadMeshDesc(filename, *kubeconfig, *namespace)
+			if err != nil {
+				return err
+			}
+			return Describe(md, c.OutOrStdout())
+		},
+	}
+	addTopologyFlag(c, &filename)
+	return c
+}
+
+// Describe writes a table of the clusters of the mesh, with the clusters each of them has remote secrets for.
+func Describe(md *MeshDesc, out io.Writer) error {
+	clients := newMeshClients()
+
+	w := new(tabwriter.Writer).Init(out, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(w, "CLUSTER\tNETWORK\tCONTEXT\tSERVER\tREMOTE SECRETS")
+	for i := range md.Clusters {
+		c := &md.Clusters[i]
+		server, err := getClusterServerFromKubeconfig(c.Kubeconfig, c.Context)
+		if err != nil {
+			server = fmt.Sprintf("<%v>", err)
+		}
+		remotes := "<unknown>"
+		kube, err := clients.kubeClient(c)
+		if err == nil {
+			var secrets map[string]string
+			if secrets, err = remoteSecretClusters(kube, c.Namespace); err == nil {
+				remotes = strings.Join(sortedClusterNames(secrets), ",")
+			}
+		}
+		if err != nil {
+			remotes = fmt.Sprintf("<%v>", err)
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", c.Name, valueOrNone(c.Network), c.Context, server, valueOrNone(remotes))
+	}
+	return w.Flush()
+}
+
+// remoteSecretClusters returns the clusters with a remote secret in the namespace, and the name of their secret.
+func remoteSecretClusters(kube kubernetes.Interface, namespace string) (map[string]string, error) {
+	secrets, err := kube.CoreV1().Secrets(namespace).List(metav1.ListOptions{
+		LabelSelector: secretcontroller.MultiClusterSecretLabel + "=true",
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]string)
+	for _, s := range secrets.Items {
+		for cluster := range s.Data {
+			out[cluster] = s.Name
+		}
+		for cluster := range s.StringData {
+			out[cluster] = s.Name
+		}
+	}
+	return out, nil
+}
+
+func sortedClusterNames(clusters map[string]string) []string {
+	names := make([]string, 0, len(clusters))
+	for name := range clusters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func valueOrNone(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,180 @@
+// Copyright 2019 Istio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multicluster
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+
+	istioctlkube "istio.io/istio/istioctl/pkg/kubernetes"
+)
+
+// ClusterDesc describes a cluster of the mesh.
+type ClusterDesc struct {
+	// Name of the cluster. It is used as the cluster ID of the cluster's registry in the other clusters.
+	Name string `json:"name"`
+	// Network the cluster belongs to, if the mesh spans several networks.
+	Network string `json:"network,omitempty"`
+	// Context in the kubeconfig used to access the cluster.
+	Context string `json:"context"`
+	// Kubeconfig file used to access the cluster. Defaults to the --kubeconfig flag.
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+	// Namespace Istio is installed in. Defaults to the --istioNamespace flag.
+	Namespace string `json:"namespace,omitempty"`
+	// ServiceAccount whose credentials are given to the other clusters.
+	// Defaults to the service account of pilot.
+	ServiceAccount string `json:"serviceAccount,omitempty"`
+}
+
+// MeshDesc describes the topology of a multi-cluster mesh.
+type MeshDesc struct {
+	Clusters []ClusterDesc `json:"clusters"`
+}
+
+// LoadMeshDesc reads a mesh topology file, filling in the defaults of each cluster.
+func LoadMeshDesc(filename, kubeconfig, namespace string) (*MeshDesc, error) {
+	by, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	md := &MeshDesc{}
+	if err := yaml.Unmarshal(by, md); err != nil {
+		return nil, fmt.Errorf("could not parse mesh topology %v: %v", filename, err)
+	}
+	if err := md.validate(); err != nil {
+		return nil, fmt.Errorf("invalid mesh topology %v: %v", filename, err)
+	}
+	for i := range md.Clusters {
+		c := &md.Clusters[i]
+		if c.Kubeconfig == "" {
+			c.Kubeconfig = kubeconfig
+		}
+		if c.Namespace == "" {
+			c.Namespace = namespace
+		}
+		if c.ServiceAccount == "" {
+			c.ServiceAccount = DefaultServiceAccountName
+		}
+	}
+	return md, nil
+}
+
+func (md *MeshDesc) validate() error {
+	if len(md.Clusters) < 2 {
+		return errors.New("at least two clusters are required")
+	}
+	seen := make(map[string]bool, len(md.Clusters))
+	for _, c := range md.Clusters {
+		if c.Name == "" {
+			return errors.New("cluster name is required")
+		}
+		if c.Context == "" {
+			return fmt.Errorf("context of cluster %q is required", c.Name)
+		}
+		if seen[c.Name] {
+			return fmt.Errorf("duplicate cluster %q", c.Name)
+		}
+		seen[c.Name] = true
+	}
+	return nil
+}
+
+// hooks for testing
+var (
+	newExecClient = func(kubeconfig, context string) (istioctlkube.ExecClient, error) {
+		return istioctlkube.NewClient(kubeconfig, context)
+	}
+)
+
+// meshClients lazily creates and caches the clients of every cluster of the mesh.
+type meshClients struct {
+	kube map[string]kubernetes.Interface
+	exec map[string]istioctlkube.ExecClient
+}
+
+func newMeshClients() *meshClients {
+	return &meshClients{
+		kube: make(map[string]kubernetes.Interface),
+		exec: make(map[string]istioctlkube.ExecClient),
+	}
+}
+
+func (m *meshClients) kubeClient(c *ClusterDesc) (kubernetes.Interface, error) {
+	if k, ok := m.kube[c.Name]; ok {
+		return k, nil
+	}
+	k, err := newKubernetesInterface(c.Kubeconfig, c.Context)
+	if err != nil {
+		return nil, fmt.Errorf("could not access cluster %v: %v", c.Name, err)
+	}
+	m.kube[c.Name] = k
+	return k, nil
+}
+
+func (m *meshClients) execClient(c *ClusterDesc) (istioctlkube.ExecClient, error) {
+	if e, ok := m.exec[c.Name]; ok {
+		return e, nil
+	}
+	e, err := newExecClient(c.Kubeconfig, c.Context)
+	if err != nil {
+		return nil, fmt.Errorf("could not access cluster %v: %v", c.Name, err)
+	}
+	m.exec[c.Name] = e
+	return e, nil
+}
+
+// NewMulticlusterCommand creates a new command for managing a multi-cluster mesh described by a topology file.
+func NewMulticlusterCommand(kubeconfig, namespace *string) *cobra.Command {
+	c := &cobra.Command{
+		Use:   "multicluster",
+		Short: "Commands to manage a multi-cluster mesh described by a topology file",
+		Long: `Commands to manage a multi-cluster mesh described by a topology file.
+
+The topology file lists the clusters of the mesh, the network of each cluster and the
+kubeconfig context used to access it:
+
+clusters:
+- name: cluster-1
+  network: network-1
+  context: gke-us-east
+- name: cluster-2
+  network: network-2
+  context: gke-us-west
+  # Optional fields, defaulting to the --kubeconfig and --istioNamespace flags
+  # and the service account of pilot.
+  kubeconfig: west.yaml
+  namespace: istio-system
+  serviceAccount: istio-pilot-service-account
+`,
+		Aliases: []string{"mc"},
+	}
+
+	c.AddCommand(
+		newApplyCommand(kubeconfig, namespace),
+		newDescribeCommand(kubeconfig, namespace),
+		newCheckCommand(kubeconfig, namespace),
+	)
+	return c
+}
+
+func addTopologyFlag(c *cobra.Command, filename *string) {
+	c.PersistentFlags().StringVarP(filename, "filename", "f", "", "mesh topology file")
+	_ = c.MarkPersistentFlagRequired("filename")
+}
@@ -0,0 +1,398 @@
+// Copyright 2019 Istio Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multicluster
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/clientcmd/api"
+
+	istioctlkube "istio.io/istio/istioctl/pkg/kubernetes"
+	"istio.io/pkg/version"
+)
+
+const testTopology = `
+clusters:
+- name: c0
+  network: n0
+  context: ctx0
+- name: c1
+  network: n1
+  context: ctx1
+  namespace: istio-remote
+`
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "multicluster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func writeTopology(t *testing.T, dir, content string) string {
+	t.Helper()
+	filename := filepath.Join(dir, "mesh.yaml")
+	if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestLoadMeshDesc(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	md, err := LoadMeshDesc(writeTopology(t, dir, testTopology), "kubeconfig", "istio-system")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ClusterDesc{
+		{Name: "c0", Network: "n0", Context: "ctx0", Kubeconfig: "kubeconfig", Namespace: "istio-system",
+			ServiceAccount: DefaultServiceAccountName},
+		{Name: "c1", Network: "n1", Context: "ctx1", Kubeconfig: "kubeconfig", Namespace: "istio-remote",
+			ServiceAccount: DefaultServiceAccountName},
+	}
+	if fmt.Sprint(md.Clusters) != fmt.Sprint(want) {
+		t.Errorf("got %v, want %v", md.Clusters, want)
+	}
+
+	invalid := map[string]string{
+		"single cluster":    "clusters:\n- name: c0\n  context: ctx0\n",
+		"missing name":      "clusters:\n- context: ctx0\n- name: c1\n  context: ctx1\n",
+		"missing context":   "clusters:\n- name: c0\n- name: c1\n  context: ctx1\n",
+		"duplicate cluster": "clusters:\n- name: c0\n  context: ctx0\n- name: c0\n  context: ctx1\n",
+	}
+	for name, content := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if _, err := LoadMeshDesc(writeTopology(t, dir, content), "", "istio-system"); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+type fakeMesh struct {
+	kube map[string]*fake.Clientset
+	exec map[string]*fakeExecClient
+}
+
+// newFakeMesh replaces the clients of the clusters of the mesh with fakes, until the returned function is called.
+func newFakeMesh(md *MeshDesc) (*fakeMesh, func()) {
+	m := &fakeMesh{
+		kube: make(map[string]*fake.Clientset),
+		exec: make(map[string]*fakeExecClient),
+	}
+	config := &api.Config{
+		Contexts: map[string]*api.Context{},
+		Clusters: map[string]*api.Cluster{},
+	}
+	for _, c := range md.Clusters {
+		m.kube[c.Context] = fake.NewSimpleClientset(
+			makeNamespacedServiceAccount(c.ServiceAccount, c.Namespace, c.Name+"-token-0"),
+			makeNamespacedSecret(c.Name+"-token-0", c.Namespace, "ca-"+c.Name, "token-"+c.Name+"-0"),
+		)
+		m.exec[c.Context] = &fakeExecClient{}
+		config.Contexts[c.Context] = &api.Context{Cluster: c.Name}
+		config.Clusters[c.Name] = &api.Cluster{Server: "https://" + c.Name}
+	}
+
+	prevStartingConfig := newStartingConfig
+	prevKubernetesInterface := newKubernetesInterface
+	prevExecClient := newExecClient
+	newStartingConfig = func(_, _ string) (*api.Config, error) {
+		return config, nil
+	}
+	newKubernetesInterface = func(_, context string) (kubernetes.Interface, error) {
+		return m.kube[context], nil
+	}
+	newExecClient = func(_, context string) (istioctlkube.ExecClient, error) {
+		return m.exec[context], nil
+	}
+	return m, func() {
+		newStartingConfig = prevStartingConfig
+		newKubernetesInterface = prevKubernetesInterface
+		newExecClient = prevExecClient
+	}
+}
+
+func makeNamespacedServiceAccount(name, namespace string, secrets ...string) *v1.ServiceAccount {
+	sa := makeServiceAccount(name, secrets...)
+	sa.Namespace = namespace
+	for i := range sa.Secrets {
+		sa.Secrets[i].Namespace = namespace
+	}
+	return sa
+}
+
+func makeNamespacedSecret(name, namespace, caData, token string) *v1.Secret {
+	s := makeSecret(name, caData, token)
+	s.Namespace = namespace
+	return s
+}
+
+func loadTestMesh(t *testing.T) *MeshDesc {
+	t.Helper()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	md, err := LoadMeshDesc(writeTopology(t, dir, testTopology), "", "istio-system")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return md
+}
+
+func remoteSecretToken(t *testing.T, kube kubernetes.Interface, namespace, cluster string) string {
+	t.Helper()
+	s, err := kube.CoreV1().Secrets(namespace).Get(defaultSecretPrefix+cluster, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("remote secret of %v not found in %v: %v", cluster, namespace, err)
+	}
+	for _, line := range strings.Split(s.StringData[cluster], "\n") {
+		if strings.Contains(line, "token:") {
+			return strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "token:"))
+		}
+	}
+	t.Fatalf("no token in remote secret of %v: %v", cluster, s.StringData)
+	return ""
+}
+
+func TestApply(t *testing.T) {
+	md := loadTestMesh(t)
+	m, restore := newFakeMesh(md)
+	defer restore()
+
+	var out bytes.Buffer
+	if err := Apply(md, ApplyOptions{}, &out); err != nil {
+		t.Fatalf("Apply failed: %v\n%s", err, out.String())
+	}
+	if got := remoteSecretToken(t, m.kube["ctx1"], "istio-remote", "c0"); got != "token-c0-0" {
+		t.Errorf("got token %q in c1, want token-c0-0", got)
+	}
+	if got := remoteSecretToken(t, m.kube["ctx0"], "istio-system", "c1"); got != "token-c1-0" {
+		t.Errorf("got token %q in c0, want token-c1-0", got)
+	}
+	if _, err := m.kube["ctx0"].CoreV1().Secrets("istio-system").Get(defaultSecretPrefix+"c0", metav1.GetOptions{}); err == nil {
+		t.Error("remote secret of c0 unexpectedly installed in c0")
+	}
+
+	// Applying again updates the existing secrets.
+	if err := Apply(md, ApplyOptions{}, &out); err != nil {
+		t.Fatalf("second Apply failed: %v\n%s", err, out.String())
+	}
+}
+
+// simulateTokenController replaces a deleted service account token with a new one, like the token controller does.
+func simulateTokenController(kube *fake.Clientset, saName, namespace string) {
+	generation := 0
+	kube.PrependReactor("delete", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		generation++
+		name := fmt.Sprintf("%v-token-%d", saName, generation)
+		token := fmt.Sprintf("rotated-%d", generation)
+		tracker := kube.Tracker()
+		_ = tracker.Add(makeNamespacedSecret(name, namespace, "ca", token))
+		_ = tracker.Update(v1.SchemeGroupVersion.WithResource("serviceaccounts"),
+			makeNamespacedServiceAccount(saName, namespace, name), namespace)
+		return false, nil, nil
+	})
+}
+
+func TestApplyRotate(t *testing.T) {
+	prevInterval := rotatePollInterval
+	defer func() { rotatePollInterval = prevInterval }()
+	rotatePollInterval = time.Millisecond
+
+	md := loadTestMesh(t)
+	m, restore := newFakeMesh(md)
+	defer restore()
+	simulateTokenController(m.kube["ctx0"], DefaultServiceAccountName, "istio-system")
+
+	var out bytes.Buffer
+	err := Apply(md, ApplyOptions{Rotate: true, RotateTimeout: time.Second}, &out)
+	// c1 has no token controller, so its rotation times out.
+	if err == nil || !strings.Contains(err.Error(), "could not rotate the token of istio-remote") {
+		t.Fatalf("expected rotation of c1 to fail, got %v\n%s", err, out.String())
+	}
+	if got := remoteSecretToken(t, m.kube["ctx1"], "istio-remote", "c0"); got != "rotated-1" {
+		t.Errorf("got token %q in c1, want rotated-1", got)
+	}
+}
+
+type fakeExecClient struct {
+	endpointShardz string
+}
+
+func (f *fakeExecClient) AllPilotsDiscoveryDo(_, _, path string, _ []byte) (map[string][]byte, error) {
+	if path != "/debug/endpointShardz" {
+		return nil, fmt.Errorf("unexpected path %v", path)
+	}
+	return map[string][]byte{"istio-pilot-0": []byte(f.endpointShardz)}, nil
+}
+
+func (f *fakeExecClient) EnvoyDo(string, string, string, string, []byte) ([]byte, error) {
+	return nil, nil
+}
+
+func (f *fakeExecClient) GetIstioVersions(string) (*version.MeshInfo, error) {
+	return nil, nil
+}
+
+func (f *fakeExecClient) PilotDiscoveryDo(string, string, string, []byte) ([]byte, error) {
+	return nil, nil
+}
+
+func (f *fakeExecClient) PodsForSelector(string, string) (*v1.PodList, error) {
+	return nil, nil
+}
+
+func (f *fakeExecClient) BuildPortForwarder(string, string, int, int) (*istioctlkube.PortForward, error) {
+	return nil, nil
+}
+
+func endpointShardz(registries ...string) string {
+	var shards []string
+	for _, r := range registries {
+		shards = append(shards, fmt.Sprintf("%q: [{\"Address\": \"10.0.0.1\"}]", r))
+	}
+	return fmt.Sprintf(`{"reviews.default.svc.cluster.local": {"default": {"Shards": {%v}}}}`, strings.Join(shards, ","))
+}
+
+func setupJoinedMesh(t *testing.T, md *MeshDesc, m *fakeMesh) {
+	t.Helper()
+	if err := Apply(md, ApplyOptions{}, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	meshNetworks := `
+networks:
+  n0:
+    endpoints:
+    - fromRegistry: c0
+  n1:
+    endpoints:
+    - fromRegistry: c1
+`
+	for _, c := range md.Clusters {
+		kube := m.kube[c.Context]
+		if _, err := kube.CoreV1().ConfigMaps(c.Namespace).Create(&v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: meshConfigMapName, Namespace: c.Namespace},
+			Data:       map[string]string{meshNetworksKey: meshNetworks},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := kube.CoreV1().Secrets(c.Namespace).Create(&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: trustRootSecretName, Namespace: c.Namespace},
+			Data:       map[string][]byte{trustRootKey: []byte("root")},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.exec["ctx0"].endpointShardz = endpointShardz("Kubernetes", "c1")
+	m.exec["ctx1"].endpointShardz = endpointShardz("Kubernetes", "c0")
+}
+
+func TestCheck(t *testing.T) {
+	md := loadTestMesh(t)
+	m, restore := newFakeMesh(md)
+	defer restore()
+	setupJoinedMesh(t, md, m)
+
+	var out bytes.Buffer
+	if err := Check(md, &out); err != nil {
+		t.Fatalf("Check failed: %v\n%s", err, out.String())
+	}
+	if !strings.Contains(out.String(), "Multi-cluster check passed!") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+}
+
+func TestCheckFailures(t *testing.T) {
+	md := loadTestMesh(t)
+	m, restore := newFakeMesh(md)
+	defer restore()
+	setupJoinedMesh(t, md, m)
+
+	kube1 := m.kube["ctx1"]
+	if err := kube1.CoreV1().Secrets("istio-remote").Delete(defaultSecretPrefix+"c0", &metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kube1.CoreV1().Secrets("istio-remote").Update(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: trustRootSecretName, Namespace: "istio-remote"},
+		Data:       map[string][]byte{trustRootKey: []byte("other root")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kube1.CoreV1().ConfigMaps("istio-remote").Update(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: meshConfigMapName, Namespace: "istio-remote"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	m.exec["ctx1"].endpointShardz = endpointShardz("Kubernetes")
+
+	var out bytes.Buffer
+	if err := Check(md, &out); err == nil {
+		t.Fatalf("expected Check to fail:\n%s", out.String())
+	}
+	for _, want := range []string{
+		"c1: missing the remote secret of c0",
+		"c1: mesh networks do not place cluster c0 in network n0",
+		"c1: pilot has no endpoints from c0",
+		"clusters do not share the same trust root",
+		"c0: has the remote secrets of all the other clusters",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output does not contain %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	md := loadTestMesh(t)
+	m, restore := newFakeMesh(md)
+	defer restore()
+	setupJoinedMesh(t, md, m)
+
+	var out bytes.Buffer
+	if err := Describe(md, &out); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("unexpected output:\n%s", out.String())
+	}
+	for i, want := range [][]string{
+		{"CLUSTER", "NETWORK", "CONTEXT", "SERVER", "REMOTE", "SECRETS"},
+		{"c0", "n0", "ctx0", "https://c0", "c1"},
+		{"c1", "n1", "ctx1", "https://c1", "c0"},
+	} {
+		if got := strings.Fields(lines[i]); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("line %d: got %v, want %v", i, got, want)
+		}
+	}
+}
@@ -253,24 +253,30 @@ func CreateRemoteSecret(kubeconfig, context, namespace, serviceAccountName, name
 		return "", err
 	}
 
-	tokenSecret, err := getServiceAccountSecretToken(kube, serviceAccountName, namespace)
+	remoteSecret, err := createRemoteSecret(kube, kubeconfig, context, namespace, serviceAccountName, name)
 	if err != nil {
 		return "", err
 	}
 
-	server, err := getClusterServerFromKubeconfig(kubeconfig, context)
-	if err != nil {
+	w := makeOutputWriterTestHook()
+	if err := writeEncodedSecret(w, remoteSecret); err != nil {
 		return "", err
 	}
+	return w.String(), nil
+}
 
-	remoteSecret, err := createRemoteSecretFromTokenAndServer(tokenSecret, name, server)
+// createRemoteSecret creates the remote secret of the cluster accessed with kube, using the credentials of the
+// specified service account and the apiserver address found in the kubeconfig.
+func createRemoteSecret(kube kubernetes.Interface, kubeconfig, context, namespace, serviceAccountName, name string) (*v1.Secret, error) {
+	tokenSecret, err := getServiceAccountSecretToken(kube, serviceAccountName, namespace)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	w := makeOutputWriterTestHook()
-	if err := writeEncodedSecret(w, remoteSecret); err != nil {
-		return "", err
+	server, err := getClusterServerFromKubeconfig(kubeconfig, context)
+	if err != nil {
+		return nil, err
 	}
-	return w.String(), nil
+
+	return createRemoteSecretFromTokenAndServer(tokenSecret, name, server)
 }
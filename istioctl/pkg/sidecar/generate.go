@@ -0,0 +1,314 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sidecar generates Sidecar resources that limit the config of the proxies to the hosts they depend on.
+package sidecar
+
+import (
+	"fmt"
+	"sort"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/config/memory"
+	"istio.io/istio/pilot/pkg/model"
+	srmemory "istio.io/istio/pilot/pkg/serviceregistry/memory"
+	"istio.io/istio/pkg/config/constants"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/mesh"
+	"istio.io/istio/pkg/config/schemas"
+)
+
+const (
+	// NamespaceScope generates a Sidecar per namespace, importing the hosts all the workloads of the namespace
+	// depend on.
+	NamespaceScope = "namespace"
+	// WorkloadScope generates a Sidecar per workload, importing the hosts it depends on, in addition to the
+	// Sidecar per namespace used by the other workloads of the namespace.
+	WorkloadScope = "workload"
+
+	// namespaceSidecarName is the name of the Sidecar generated for a whole namespace.
+	namespaceSidecarName = "default"
+	// appLabel is the label selecting the workloads of a Sidecar generated for a workload.
+	appLabel = "app"
+)
+
+// Scopes are the supported scopes of the generated Sidecars.
+var Scopes = []string{NamespaceScope, WorkloadScope}
+
+// Dependency is a host called by the workloads of a namespace.
+type Dependency struct {
+	// Namespace is the namespace of the calling workload.
+	Namespace string
+	// Workload is the name of the calling workload, empty if the dependency applies to the whole namespace.
+	Workload string
+	// App is the value of the app label of the calling workload, if known.
+	App string
+	// Host is the host called.
+	Host host.Name
+}
+
+// Report is the size of the config of the proxies a generated Sidecar applies to, before and after
+// the Sidecar is applied.
+type Report struct {
+	Namespace      string
+	Name           string
+	Hosts          int
+	ServicesBefore int
+	ServicesAfter  int
+	// ClustersBefore and ClustersAfter are the number of outbound clusters, one per service port.
+	ClustersBefore int
+	ClustersAfter  int
+}
+
+// Generator computes the Sidecars of the dependencies, with the same service and virtual service
+// visibility rules as pilot.
+type Generator struct {
+	rootNamespace string
+	push          *model.PushContext
+	services      []*model.Service
+}
+
+// NewGenerator returns a Generator for the services and Istio configs of the mesh. The Sidecars
+// generated always import the hosts of the root namespace, which hosts the Istio control plane.
+func NewGenerator(services []*model.Service, configs []model.Config, rootNamespace, domainSuffix string) (*Generator, error) {
+	if rootNamespace == "" {
+		rootNamespace = constants.IstioSystemNamespace
+	}
+	if domainSuffix == "" {
+		domainSuffix = "cluster.local"
+	}
+
+	registry := make(map[host.Name]*model.Service, len(services))
+	for _, svc := range services {
+		registry[svc.Hostname] = svc
+	}
+
+	store := memory.Make(schemas.Istio)
+	for _, cfg := range configs {
+		// Existing Sidecars are ignored, the generated ones replace them.
+		if cfg.Type == schemas.Sidecar.Type {
+			continue
+		}
+		if cfg.Domain == "" {
+			cfg.Domain = domainSuffix
+		}
+		if _, err := store.Create(cfg); err != nil {
+			return nil, fmt.Errorf("invalid %s %s/%s: %v", cfg.Type, cfg.Namespace, cfg.Name, err)
+		}
+	}
+
+	meshConfig := mesh.DefaultMeshConfig()
+	env := &model.Environment{
+		ServiceDiscovery: srmemory.NewDiscovery(registry, 0),
+		IstioConfigStore: model.MakeIstioStore(store),
+		Mesh:             &meshConfig,
+	}
+	push := model.NewPushContext()
+	if err := push.InitContext(env, nil, nil); err != nil {
+		return nil, err
+	}
+
+	return &Generator{
+		rootNamespace: rootNamespace,
+		push:          push,
+		services:      services,
+	}, nil
+}
+
+// VirtualServiceDependencies returns the hosts of the virtual services of the mesh gateway, as
+// dependencies of the namespace declaring them.
+func (g *Generator) VirtualServiceDependencies() []Dependency {
+	var deps []Dependency
+	for _, cfg := range g.push.VirtualServices(nil, map[string]bool{constants.IstioMeshGateway: true}) {
+		for _, h := range cfg.Spec.(*networking.VirtualService).Hosts {
+			deps = append(deps, Dependency{Namespace: cfg.Namespace, Host: host.Name(h)})
+		}
+	}
+	return deps
+}
+
+// Generate returns the Sidecars importing the dependencies, sorted by namespace and name, and the
+// report of the config size of each of them. The dependencies are completed with the destinations of
+// the virtual services of their hosts.
+func (g *Generator) Generate(deps []Dependency, scope string) ([]model.Config, []Report, error) {
+	if scope != NamespaceScope && scope != WorkloadScope {
+		return nil, nil, fmt.Errorf("unknown scope %q, must be one of %v", scope, Scopes)
+	}
+
+	type workloadKey struct{ namespace, app string }
+	namespaceHosts := make(map[string]map[host.Name]struct{})
+	workloadHosts := make(map[workloadKey]map[host.Name]struct{})
+	for _, dep := range deps {
+		if namespaceHosts[dep.Namespace] == nil {
+			namespaceHosts[dep.Namespace] = make(map[host.Name]struct{})
+		}
+		namespaceHosts[dep.Namespace][dep.Host] = struct{}{}
+
+		if scope == WorkloadScope && dep.App != "" {
+			k := workloadKey{dep.Namespace, dep.App}
+			if workloadHosts[k] == nil {
+				workloadHosts[k] = make(map[host.Name]struct{})
+			}
+			workloadHosts[k][dep.Host] = struct{}{}
+		}
+	}
+
+	var sidecars []model.Config
+	for ns, hosts := range namespaceHosts {
+		sidecars = append(sidecars, g.sidecar(ns, namespaceSidecarName, nil, hosts))
+	}
+	for k, hosts := range workloadHosts {
+		sidecars = append(sidecars, g.sidecar(k.namespace, k.app, map[string]string{appLabel: k.app}, hosts))
+	}
+	sort.Slice(sidecars, func(i, j int) bool {
+		if sidecars[i].Namespace != sidecars[j].Namespace {
+			return sidecars[i].Namespace < sidecars[j].Namespace
+		}
+		return sidecars[i].Name < sidecars[j].Name
+	})
+
+	reports := make([]Report, 0, len(sidecars))
+	for i := range sidecars {
+		reports = append(reports, g.report(&sidecars[i]))
+	}
+	return sidecars, reports, nil
+}
+
+// sidecar returns the Sidecar importing the hosts, and the destinations of their virtual services.
+func (g *Generator) sidecar(namespace, name string, workloadLabels map[string]string, hosts map[host.Name]struct{}) model.Config {
+	proxy := &model.Proxy{ConfigNamespace: namespace}
+	egress := map[string]struct{}{g.rootNamespace + "/*": {}}
+	for h := range g.resolveVirtualServices(proxy, hosts) {
+		egress[g.egressHost(proxy, h)] = struct{}{}
+	}
+
+	spec := &networking.Sidecar{
+		Egress: []*networking.IstioEgressListener{{}},
+	}
+	for h := range egress {
+		spec.Egress[0].Hosts = append(spec.Egress[0].Hosts, h)
+	}
+	sort.Strings(spec.Egress[0].Hosts)
+	if workloadLabels != nil {
+		spec.WorkloadSelector = &networking.WorkloadSelector{Labels: workloadLabels}
+	}
+
+	return model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Type:      schemas.Sidecar.Type,
+			Group:     schemas.Sidecar.Group + constants.IstioAPIGroupDomain,
+			Version:   schemas.Sidecar.Version,
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: spec,
+	}
+}
+
+// resolveVirtualServices returns the hosts, and the route and mirror destinations of the virtual
+// services visible to the proxy for them, recursively.
+func (g *Generator) resolveVirtualServices(proxy *model.Proxy, hosts map[host.Name]struct{}) map[host.Name]struct{} {
+	virtualServices := g.push.VirtualServices(proxy, map[string]bool{constants.IstioMeshGateway: true})
+
+	out := make(map[host.Name]struct{}, len(hosts))
+	var queue []host.Name
+	add := func(h host.Name) {
+		if _, f := out[h]; !f {
+			out[h] = struct{}{}
+			queue = append(queue, h)
+		}
+	}
+	for h := range hosts {
+		add(h)
+	}
+
+	for len(queue) > 0 {
+		h := queue[0]
+		queue = queue[1:]
+		for _, cfg := range virtualServices {
+			vs := cfg.Spec.(*networking.VirtualService)
+			if !matchesAny(vs.Hosts, h) {
+				continue
+			}
+			for _, route := range vs.Http {
+				for _, dst := range route.Route {
+					add(host.Name(dst.Destination.Host))
+				}
+				if route.Mirror != nil {
+					add(host.Name(route.Mirror.Host))
+				}
+			}
+			for _, route := range vs.Tcp {
+				for _, dst := range route.Route {
+					add(host.Name(dst.Destination.Host))
+				}
+			}
+			for _, route := range vs.Tls {
+				for _, dst := range route.Route {
+					add(host.Name(dst.Destination.Host))
+				}
+			}
+		}
+	}
+	return out
+}
+
+func matchesAny(hosts []string, h host.Name) bool {
+	for _, vh := range hosts {
+		if host.Name(vh).Matches(h) {
+			return true
+		}
+	}
+	return false
+}
+
+// egressHost returns the egress host importing the host in the Sidecar of the proxy, in the
+// namespace/host format. Services visible to the proxy are imported from their namespace,
+// preferring the namespace of the proxy, the other hosts from any namespace.
+func (g *Generator) egressHost(proxy *model.Proxy, h host.Name) string {
+	namespace := "*"
+	for _, svc := range g.push.Services(proxy) {
+		if svc.Hostname != h {
+			continue
+		}
+		if namespace == "*" || svc.Attributes.Namespace == proxy.ConfigNamespace {
+			namespace = svc.Attributes.Namespace
+		}
+	}
+	return namespace + "/" + string(h)
+}
+
+// report compares the scope of the Sidecar to the default scope of its namespace.
+func (g *Generator) report(sidecar *model.Config) Report {
+	before := model.DefaultSidecarScopeForNamespace(g.push, sidecar.Namespace).Services()
+	after := model.ConvertToSidecarScope(g.push, sidecar, sidecar.Namespace).Services()
+	return Report{
+		Namespace:      sidecar.Namespace,
+		Name:           sidecar.Name,
+		Hosts:          len(sidecar.Spec.(*networking.Sidecar).Egress[0].Hosts),
+		ServicesBefore: len(before),
+		ServicesAfter:  len(after),
+		ClustersBefore: clusters(before),
+		ClustersAfter:  clusters(after),
+	}
+}
+
+func clusters(services []*model.Service) int {
+	n := 0
+	for _, svc := range services {
+		n += len(svc.Ports)
+	}
+	return n
+}
@@ -0,0 +1,183 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sidecar
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/protocol"
+	"istio.io/istio/pkg/config/schemas"
+)
+
+func makeService(name, namespace string, ports ...int) *model.Service {
+	svc := &model.Service{
+		Hostname: host.Name(name + "." + namespace + ".svc.cluster.local"),
+		Attributes: model.ServiceAttributes{
+			Name:      name,
+			Namespace: namespace,
+		},
+	}
+	for _, port := range ports {
+		svc.Ports = append(svc.Ports, &model.Port{Name: "http", Port: port, Protocol: protocol.HTTP})
+	}
+	return svc
+}
+
+func newTestGenerator(t *testing.T) *Generator {
+	t.Helper()
+	services := []*model.Service{
+		makeService("productpage", "default", 9080),
+		makeService("reviews", "default", 9080),
+		makeService("ratings", "default", 9080),
+		makeService("details", "default", 9080),
+		makeService("istio-telemetry", "istio-system", 9091),
+		makeService("payments", "billing", 8080, 8443),
+	}
+	configs := []model.Config{
+		{
+			ConfigMeta: model.ConfigMeta{
+				Type:      schemas.VirtualService.Type,
+				Group:     "networking.istio.io",
+				Version:   schemas.VirtualService.Version,
+				Name:      "reviews",
+				Namespace: "default",
+			},
+			Spec: &networking.VirtualService{
+				Hosts: []string{"reviews"},
+				Http: []*networking.HTTPRoute{{
+					Route:  []*networking.HTTPRouteDestination{{Destination: &networking.Destination{Host: "reviews", Subset: "v1"}}},
+					Mirror: &networking.Destination{Host: "ratings"},
+				}},
+			},
+		},
+	}
+	gen, err := NewGenerator(services, configs, "istio-system", "cluster.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gen
+}
+
+var testDependencies = []Dependency{
+	{Namespace: "default", Workload: "productpage-v1", App: "productpage", Host: "reviews.default.svc.cluster.local"},
+	{Namespace: "default", Workload: "productpage-v1", App: "productpage", Host: "details.default.svc.cluster.local"},
+	{Namespace: "default", Workload: "details-v1", Host: "api.example.com"},
+	{Namespace: "billing", Workload: "payments-v1", App: "payments", Host: "api.example.com"},
+}
+
+type sidecarSummary struct {
+	namespace, name string
+	selector        map[string]string
+	hosts           []string
+}
+
+func summarize(sidecars []model.Config) []sidecarSummary {
+	var out []sidecarSummary
+	for _, cfg := range sidecars {
+		spec := cfg.Spec.(*networking.Sidecar)
+		s := sidecarSummary{namespace: cfg.Namespace, name: cfg.Name, hosts: spec.Egress[0].Hosts}
+		if spec.WorkloadSelector != nil {
+			s.selector = spec.WorkloadSelector.Labels
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func TestGenerateNamespaceScope(t *testing.T) {
+	g := NewGomegaWithT(t)
+	gen := newTestGenerator(t)
+
+	sidecars, reports, err := gen.Generate(testDependencies, NamespaceScope)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(summarize(sidecars)).To(Equal([]sidecarSummary{
+		{
+			namespace: "billing",
+			name:      "default",
+			hosts:     []string{"*/api.example.com", "istio-system/*"},
+		},
+		{
+			namespace: "default",
+			name:      "default",
+			hosts: []string{
+				"*/api.example.com",
+				"default/details.default.svc.cluster.local",
+				// The virtual service of reviews mirrors to ratings.
+				"default/ratings.default.svc.cluster.local",
+				"default/reviews.default.svc.cluster.local",
+				"istio-system/*",
+			},
+		},
+	}))
+	for _, cfg := range sidecars {
+		g.Expect(schemas.Sidecar.Validate(cfg.Name, cfg.Namespace, cfg.Spec)).To(Succeed())
+	}
+
+	g.Expect(reports).To(Equal([]Report{
+		{Namespace: "billing", Name: "default", Hosts: 2, ServicesBefore: 6, ServicesAfter: 1, ClustersBefore: 7, ClustersAfter: 1},
+		{Namespace: "default", Name: "default", Hosts: 5, ServicesBefore: 6, ServicesAfter: 4, ClustersBefore: 7, ClustersAfter: 4},
+	}))
+}
+
+func TestGenerateWorkloadScope(t *testing.T) {
+	g := NewGomegaWithT(t)
+	gen := newTestGenerator(t)
+
+	sidecars, _, err := gen.Generate(testDependencies, WorkloadScope)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	summaries := summarize(sidecars)
+	g.Expect(summaries).To(HaveLen(4))
+	g.Expect(summaries).To(ContainElement(sidecarSummary{
+		namespace: "default",
+		name:      "productpage",
+		selector:  map[string]string{"app": "productpage"},
+		hosts: []string{
+			"default/details.default.svc.cluster.local",
+			"default/ratings.default.svc.cluster.local",
+			"default/reviews.default.svc.cluster.local",
+			"istio-system/*",
+		},
+	}))
+	g.Expect(summaries).To(ContainElement(sidecarSummary{
+		namespace: "billing",
+		name:      "payments",
+		selector:  map[string]string{"app": "payments"},
+		hosts:     []string{"*/api.example.com", "istio-system/*"},
+	}))
+}
+
+func TestGenerateUnknownScope(t *testing.T) {
+	g := NewGomegaWithT(t)
+	gen := newTestGenerator(t)
+
+	_, _, err := gen.Generate(testDependencies, "cluster")
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestVirtualServiceDependencies(t *testing.T) {
+	g := NewGomegaWithT(t)
+	gen := newTestGenerator(t)
+
+	g.Expect(gen.VirtualServiceDependencies()).To(Equal([]Dependency{
+		{Namespace: "default", Host: "reviews.default.svc.cluster.local"},
+	}))
+}
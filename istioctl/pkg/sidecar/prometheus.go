@@ -0,0 +1,98 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sidecar
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	prommodel "github.com/prometheus/common/model"
+
+	"istio.io/istio/pkg/config/host"
+)
+
+const (
+	sourceNamespaceLabel   = "source_workload_namespace"
+	sourceWorkloadLabel    = "source_workload"
+	sourceAppLabel         = "source_app"
+	destinationServiceName = "destination_service"
+
+	// unknown is the value of the labels the proxies could not determine.
+	unknown = "unknown"
+)
+
+// PrometheusQuery returns the query of the hosts called by each workload over the window, from the
+// HTTP and TCP standard metrics reported by the calling proxies.
+func PrometheusQuery(window time.Duration) string {
+	by := fmt.Sprintf("by (%s, %s, %s, %s)", sourceNamespaceLabel, sourceWorkloadLabel, sourceAppLabel, destinationServiceName)
+	w := prommodel.Duration(window).String()
+	return fmt.Sprintf(`sum(rate(istio_requests_total{reporter="source"}[%s])) %s or `+
+		`sum(rate(istio_tcp_connections_opened_total{reporter="source"}[%s])) %s`, w, by, w, by)
+}
+
+// DependenciesFromSamples returns the dependencies of the samples of the PrometheusQuery. The samples
+// of unknown workloads or hosts, such as calls from outside of the mesh, are ignored.
+func DependenciesFromSamples(samples prommodel.Vector) []Dependency {
+	var deps []Dependency
+	for _, s := range samples {
+		dep := Dependency{
+			Namespace: string(s.Metric[sourceNamespaceLabel]),
+			Workload:  string(s.Metric[sourceWorkloadLabel]),
+			App:       string(s.Metric[sourceAppLabel]),
+			Host:      host.Name(s.Metric[destinationServiceName]),
+		}
+		if dep.Namespace == "" || dep.Namespace == unknown || dep.Host == "" || dep.Host == unknown {
+			continue
+		}
+		if dep.App == unknown {
+			dep.App = ""
+		}
+		deps = append(deps, dep)
+	}
+	return deps
+}
+
+// queryResponse is a response of the Prometheus HTTP API to an instant query.
+type queryResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+// ReadPrometheusExport returns the dependencies of an export of the PrometheusQuery, which is the
+// response of the Prometheus HTTP API to the query, e.g. saved from /api/v1/query.
+func ReadPrometheusExport(r io.Reader) ([]Dependency, error) {
+	var resp queryResponse
+	if err := json.NewDecoder(r).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("invalid Prometheus export: %v", err)
+	}
+	if resp.Status != "success" {
+		return nil, fmt.Errorf("the Prometheus query failed: %s", resp.Error)
+	}
+	if resp.Data.ResultType != prommodel.ValVector.String() {
+		return nil, fmt.Errorf("the Prometheus export is a %s, not a %s", resp.Data.ResultType, prommodel.ValVector)
+	}
+
+	var samples prommodel.Vector
+	if err := json.Unmarshal(resp.Data.Result, &samples); err != nil {
+		return nil, fmt.Errorf("invalid Prometheus export: %v", err)
+	}
+	return DependenciesFromSamples(samples), nil
+}
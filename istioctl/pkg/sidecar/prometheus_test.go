@@ -0,0 +1,67 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sidecar
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestPrometheusQuery(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect(PrometheusQuery(24 * time.Hour)).To(Equal(
+		`sum(rate(istio_requests_total{reporter="source"}[1d])) ` +
+			`by (source_workload_namespace, source_workload, source_app, destination_service) or ` +
+			`sum(rate(istio_tcp_connections_opened_total{reporter="source"}[1d])) ` +
+			`by (source_workload_namespace, source_workload, source_app, destination_service)`))
+}
+
+func TestReadPrometheusExport(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	f, err := os.Open("testdata/requests.json")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer f.Close()
+
+	deps, err := ReadPrometheusExport(f)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(deps).To(Equal([]Dependency{
+		{Namespace: "default", Workload: "productpage-v1", App: "productpage", Host: "reviews.default.svc.cluster.local"},
+		{Namespace: "billing", Workload: "payments-v1", Host: "api.example.com"},
+	}))
+}
+
+func TestReadPrometheusExportErrors(t *testing.T) {
+	cases := []struct {
+		name   string
+		export string
+	}{
+		{"invalid", `{"status": "success", "data": `},
+		{"failed query", `{"status": "error", "error": "bad_data"}`},
+		{"matrix", `{"status": "success", "data": {"resultType": "matrix", "result": []}}`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := ReadPrometheusExport(strings.NewReader(tc.export)); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,409 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"istio.io/istio/pkg/adsc"
+	"istio.io/pkg/log"
+)
+
+const (
+	// ttl is the time to live of the answers for the hostnames of the name table, in seconds.
+	ttl = 30
+
+	// upstreamTimeout is the max time to wait for the answer of an upstream resolver.
+	upstreamTimeout = 5 * time.Second
+
+	// tcpIdleTimeout is the max time to wait for the next query on a TCP connection.
+	tcpIdleTimeout = 10 * time.Second
+
+	// reconnectDelay is the time to wait before reconnecting to pilot. It doubles, up to maxReconnectDelay,
+	// while the connections fail before receiving a name table.
+	reconnectDelay    = 5 * time.Second
+	maxReconnectDelay = 5 * time.Minute
+
+	// maxMessageSize is the max size of a DNS message.
+	maxMessageSize = 65535
+)
+
+// NodeIDSuffix is appended to the workload name in the node ID of the connection watching the name table, so
+// that pilot does not mistake it for the connection of Envoy.
+const NodeIDSuffix = "-dns"
+
+// Server is a DNS proxy. It answers the A and AAAA queries for the hostnames of its name table, pushed by
+// pilot, and forwards the other queries to the upstream resolvers. This allows the applications to resolve
+// the hosts of service entries without DNS records, and the services of the other clusters of the mesh.
+type Server struct {
+	udpConn     net.PacketConn
+	tcpListener net.Listener
+	upstreams   []string
+
+	mu sync.RWMutex
+	// nameTable are the addresses of the hostnames, keyed by fully qualified name.
+	nameTable map[string][]net.IP
+}
+
+// NewServer creates a DNS proxy listening on the UDP and TCP address, and forwarding the queries for the
+// hostnames not in its name table to the upstream resolvers.
+func NewServer(addr string, upstreams []string) (*Server, error) {
+	udpConn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on udp %s: %v", addr, err)
+	}
+	tcpListener, err := net.Listen("tcp", addr)
+	if err != nil {
+		_ = udpConn.Close()
+		return nil, fmt.Errorf("failed to listen on tcp %s: %v", addr, err)
+	}
+	return &Server{
+		udpConn:     udpConn,
+		tcpListener: tcpListener,
+		upstreams:   upstreams,
+		nameTable:   make(map[string][]net.IP),
+	}, nil
+}
+
+// UpstreamsFromResolvConf returns the addresses of the name servers of the resolv.conf file.
+func UpstreamsFromResolvConf(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var upstreams []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			upstreams = append(upstreams, net.JoinHostPort(fields[1], "53"))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(upstreams) == 0 {
+		return nil, fmt.Errorf("no name server in %s", path)
+	}
+	return upstreams, nil
+}
+
+// Run serves the DNS queries until the context is done.
+func (s *Server) Run(ctx context.Context) {
+	go s.serveUDP()
+	go s.serveTCP()
+	<-ctx.Done()
+	_ = s.udpConn.Close()
+	_ = s.tcpListener.Close()
+}
+
+// UpdateNameTable replaces the name table with the addresses of the hostnames, keyed by hostname.
+func (s *Server) UpdateNameTable(nameTable map[string][]string) {
+	nt := make(map[string][]net.IP, len(nameTable))
+	for hostname, addresses := range nameTable {
+		for _, address := range addresses {
+			ip := net.ParseIP(address)
+			if ip == nil {
+				log.Warnf("DNS: invalid address %q of host %s", address, hostname)
+				continue
+			}
+			name := fqdn(hostname)
+			nt[name] = append(nt[name], ip)
+		}
+	}
+
+	s.mu.Lock()
+	s.nameTable = nt
+	s.mu.Unlock()
+	log.Debugf("DNS: updated the name table, hosts:%d", len(nt))
+}
+
+// WatchNameTable connects to pilot and updates the name table with the one pushed by pilot, until the
+// context is done. The connection only watches the name table, which pilot sends again only when it changes.
+// It reconnects whenever the connection is closed, backing off while pilot is unavailable.
+func (s *Server) WatchNameTable(ctx context.Context, discoveryAddr, certDir string, config *adsc.Config) {
+	delay := reconnectDelay
+	for {
+		received, err := s.watchNameTable(ctx, discoveryAddr, certDir, config)
+		if err != nil {
+			log.Warnf("DNS: failed to watch the name table: %v", err)
+		}
+		if received {
+			delay = reconnectDelay
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if !received {
+			delay *= 2
+			if delay > maxReconnectDelay {
+				delay = maxReconnectDelay
+			}
+		}
+	}
+}
+
+// watchNameTable updates the name table until the connection is closed, and returns whether it received one.
+func (s *Server) watchNameTable(ctx context.Context, discoveryAddr, certDir string, config *adsc.Config) (bool, error) {
+	conn, err := adsc.Dial(discoveryAddr, certDir, config)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	received := false
+	conn.WatchNameTable()
+	for {
+		select {
+		case <-ctx.Done():
+			return received, nil
+		case update := <-conn.Updates:
+			switch update {
+			case "nds":
+				received = true
+				s.UpdateNameTable(conn.GetNameTable())
+			case "close":
+				return received, errors.New("connection closed")
+			}
+		}
+	}
+}
+
+func (s *Server) serveUDP() {
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, addr, err := s.udpConn.ReadFrom(buf)
+		if err != nil {
+			log.Debugf("DNS: stopped serving udp: %v", err)
+			return
+		}
+		query := make([]byte, n)
+		copy(query, buf[:n])
+		go func() {
+			if response := s.resolve(query, "udp"); response != nil {
+				if _, err := s.udpConn.WriteTo(response, addr); err != nil {
+					log.Debugf("DNS: failed to answer %s: %v", addr, err)
+				}
+			}
+		}()
+	}
+}
+
+func (s *Server) serveTCP() {
+	for {
+		conn, err := s.tcpListener.Accept()
+		if err != nil {
+			log.Debugf("DNS: stopped serving tcp: %v", err)
+			return
+		}
+		go s.serveTCPConn(conn)
+	}
+}
+
+func (s *Server) serveTCPConn(conn net.Conn) {
+	defer conn.Close()
+	for {
+		_ = conn.SetDeadline(time.Now().Add(tcpIdleTimeout))
+		query, err := readTCPMessage(conn)
+		if err != nil {
+			return
+		}
+		response := s.resolve(query, "tcp")
+		if response == nil {
+			return
+		}
+		if err := writeTCPMessage(conn, response); err != nil {
+			return
+		}
+	}
+}
+
+// resolve returns the response to the query, answered from the name table or forwarded upstream. It
+// returns nil if the query is not a valid DNS message.
+func (s *Server) resolve(query []byte, network string) []byte {
+	var p dnsmessage.Parser
+	header, err := p.Start(query)
+	if err != nil {
+		log.Debugf("DNS: invalid query: %v", err)
+		return nil
+	}
+	questions, err := p.AllQuestions()
+	if err != nil {
+		log.Debugf("DNS: invalid query: %v", err)
+		return nil
+	}
+
+	if len(questions) == 1 {
+		if addresses, f := s.lookup(questions[0]); f {
+			response, err := answer(header, questions[0], addresses)
+			if err == nil {
+				return response
+			}
+			log.Warnf("DNS: failed to answer %s: %v", questions[0].Name, err)
+		}
+	}
+
+	for _, upstream := range s.upstreams {
+		response, err := exchange(query, network, upstream)
+		if err == nil {
+			return response
+		}
+		log.Debugf("DNS: failed to forward the query to %s: %v", upstream, err)
+	}
+	response, err := serverFailure(header, questions)
+	if err != nil {
+		return nil
+	}
+	return response
+}
+
+// lookup returns the addresses of the name table for an A or AAAA question.
+func (s *Server) lookup(q dnsmessage.Question) ([]net.IP, bool) {
+	if q.Class != dnsmessage.ClassINET || (q.Type != dnsmessage.TypeA && q.Type != dnsmessage.TypeAAAA) {
+		return nil, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	addresses, f := s.nameTable[strings.ToLower(q.Name.String())]
+	return addresses, f
+}
+
+// answer builds the response to the question with the addresses of its type. The response has no answer
+// if the host only has addresses of the other type.
+func answer(query dnsmessage.Header, q dnsmessage.Question, addresses []net.IP) ([]byte, error) {
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+		ID:                 query.ID,
+		Response:           true,
+		Authoritative:      true,
+		RecursionDesired:   query.RecursionDesired,
+		RecursionAvailable: true,
+	})
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(q); err != nil {
+		return nil, err
+	}
+	if err := b.StartAnswers(); err != nil {
+		return nil, err
+	}
+	rh := dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: dnsmessage.ClassINET, TTL: ttl}
+	for _, ip := range addresses {
+		ip4 := ip.To4()
+		switch {
+		case q.Type == dnsmessage.TypeA && ip4 != nil:
+			r := dnsmessage.AResource{}
+			copy(r.A[:], ip4)
+			if err := b.AResource(rh, r); err != nil {
+				return nil, err
+			}
+		case q.Type == dnsmessage.TypeAAAA && ip4 == nil:
+			r := dnsmessage.AAAAResource{}
+			copy(r.AAAA[:], ip.To16())
+			if err := b.AAAAResource(rh, r); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return b.Finish()
+}
+
+// serverFailure builds the response to a query which could not be forwarded upstream.
+func serverFailure(query dnsmessage.Header, questions []dnsmessage.Question) ([]byte, error) {
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+		ID:               query.ID,
+		Response:         true,
+		RecursionDesired: query.RecursionDesired,
+		RCode:            dnsmessage.RCodeServerFailure,
+	})
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	for _, q := range questions {
+		if err := b.Question(q); err != nil {
+			return nil, err
+		}
+	}
+	return b.Finish()
+}
+
+// exchange forwards the query to the upstream resolver, and returns its response.
+func exchange(query []byte, network, upstream string) ([]byte, error) {
+	conn, err := net.DialTimeout(network, upstream, upstreamTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(upstreamTimeout))
+
+	if network == "tcp" {
+		if err := writeTCPMessage(conn, query); err != nil {
+			return nil, err
+		}
+		return readTCPMessage(conn)
+	}
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, maxMessageSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// readTCPMessage reads a DNS message prefixed by its length.
+func readTCPMessage(r io.Reader) ([]byte, error) {
+	var length uint16
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, length)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// writeTCPMessage writes a DNS message prefixed by its length.
+func writeTCPMessage(w io.Writer, msg []byte) error {
+	buf := make([]byte, 2+len(msg))
+	binary.BigEndian.PutUint16(buf, uint16(len(msg)))
+	copy(buf[2:], msg)
+	_, err := w.Write(buf)
+	return err
+}
+
+func fqdn(hostname string) string {
+	return strings.ToLower(strings.TrimSuffix(hostname, ".")) + "."
+}
@@ -0,0 +1,205 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func startServer(t *testing.T, upstreams []string, nameTable map[string][]string) (*Server, context.CancelFunc) {
+	t.Helper()
+	s, err := NewServer("127.0.0.1:0", upstreams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.UpdateNameTable(nameTable)
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.Run(ctx)
+	return s, cancel
+}
+
+func query(t *testing.T, network, addr, name string, qtype dnsmessage.Type) (dnsmessage.RCode, []string) {
+	t.Helper()
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: 42, RecursionDesired: true})
+	_ = b.StartQuestions()
+	_ = b.Question(dnsmessage.Question{Name: dnsmessage.MustNewName(name), Type: qtype, Class: dnsmessage.ClassINET})
+	msg, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+	var response []byte
+	if network == "tcp" {
+		if err := writeTCPMessage(conn, msg); err != nil {
+			t.Fatal(err)
+		}
+		if response, err = readTCPMessage(conn); err != nil {
+			t.Fatal(err)
+		}
+	} else {
+		if _, err := conn.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, maxMessageSize)
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response = buf[:n]
+	}
+
+	var p dnsmessage.Parser
+	header, err := p.Start(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.ID != 42 {
+		t.Fatalf("got response to query %d, want 42", header.ID)
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		t.Fatal(err)
+	}
+	answers, err := p.AllAnswers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var addresses []string
+	for _, answer := range answers {
+		switch r := answer.Body.(type) {
+		case *dnsmessage.AResource:
+			addresses = append(addresses, net.IP(r.A[:]).String())
+		case *dnsmessage.AAAAResource:
+			addresses = append(addresses, net.IP(r.AAAA[:]).String())
+		}
+	}
+	return header.RCode, addresses
+}
+
+func TestServer(t *testing.T) {
+	upstream, cancel := startServer(t, nil, map[string][]string{
+		"www.example.com": {"1.2.3.4"},
+	})
+	defer cancel()
+	s, cancel := startServer(t, []string{upstream.udpConn.LocalAddr().String()}, map[string][]string{
+		"db.internal.mesh":                  {"240.0.0.1"},
+		"reviews.default.svc.cluster.local": {"10.0.0.1", "fd00::1"},
+	})
+	defer cancel()
+
+	cases := []struct {
+		name      string
+		network   string
+		host      string
+		qtype     dnsmessage.Type
+		rcode     dnsmessage.RCode
+		addresses []string
+	}{
+		{
+			name:      "name table",
+			host:      "db.internal.mesh.",
+			qtype:     dnsmessage.TypeA,
+			addresses: []string{"240.0.0.1"},
+		},
+		{
+			name:      "name table case insensitive",
+			host:      "DB.Internal.Mesh.",
+			qtype:     dnsmessage.TypeA,
+			addresses: []string{"240.0.0.1"},
+		},
+		{
+			name:      "name table ipv6",
+			host:      "reviews.default.svc.cluster.local.",
+			qtype:     dnsmessage.TypeAAAA,
+			addresses: []string{"fd00::1"},
+		},
+		{
+			name:  "name table without address of the type",
+			host:  "db.internal.mesh.",
+			qtype: dnsmessage.TypeAAAA,
+		},
+		{
+			name:      "forwarded",
+			host:      "www.example.com.",
+			qtype:     dnsmessage.TypeA,
+			addresses: []string{"1.2.3.4"},
+		},
+		{
+			name:  "forwarded failure",
+			host:  "www.example.org.",
+			qtype: dnsmessage.TypeA,
+			rcode: dnsmessage.RCodeServerFailure,
+		},
+		{
+			name:      "tcp",
+			network:   "tcp",
+			host:      "reviews.default.svc.cluster.local.",
+			qtype:     dnsmessage.TypeA,
+			addresses: []string{"10.0.0.1"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			network, addr := "udp", s.udpConn.LocalAddr().String()
+			if tc.network == "tcp" {
+				network, addr = "tcp", s.tcpListener.Addr().String()
+			}
+			rcode, addresses := query(t, network, addr, tc.host, tc.qtype)
+			if rcode != tc.rcode {
+				t.Errorf("got rcode %v, want %v", rcode, tc.rcode)
+			}
+			if !reflect.DeepEqual(addresses, tc.addresses) {
+				t.Errorf("got addresses %v, want %v", addresses, tc.addresses)
+			}
+		})
+	}
+}
+
+func TestUpstreamsFromResolvConf(t *testing.T) {
+	f, err := ioutil.TempFile("", "resolv.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	_, _ = f.WriteString(`search default.svc.cluster.local svc.cluster.local cluster.local
+nameserver 10.96.0.10
+nameserver fd00::10
+options ndots:5
+`)
+	_ = f.Close()
+
+	upstreams, err := UpstreamsFromResolvConf(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"10.96.0.10:53", "[fd00::10]:53"}
+	if !reflect.DeepEqual(upstreams, expected) {
+		t.Errorf("got %v, want %v", upstreams, expected)
+	}
+}
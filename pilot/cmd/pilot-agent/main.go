@@ -21,6 +21,7 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -29,6 +30,7 @@ import (
 
 	"github.com/gogo/protobuf/jsonpb"
 	"github.com/gogo/protobuf/types"
+	structpb "github.com/golang/protobuf/ptypes/struct"
 	"github.com/spf13/cobra"
 	"github.com/spf13/cobra/doc"
 
@@ -39,12 +41,15 @@ import (
 	"istio.io/pkg/log"
 	"istio.io/pkg/version"
 
+	"istio.io/istio/pilot/cmd/pilot-agent/dns"
 	"istio.io/istio/pilot/cmd/pilot-agent/status"
 	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/proxy"
 	envoyDiscovery "istio.io/istio/pilot/pkg/proxy/envoy"
 	"istio.io/istio/pilot/pkg/serviceregistry"
+	"istio.io/istio/pkg/adsc"
+	"istio.io/istio/pkg/bootstrap"
 	"istio.io/istio/pkg/bootstrap/option"
 	"istio.io/istio/pkg/cmd"
 	"istio.io/istio/pkg/config/constants"
@@ -55,7 +60,10 @@ import (
 	"istio.io/istio/pkg/util/gogoprotomarshal"
 )
 
-const trustworthyJWTPath = "/var/run/secrets/tokens/istio-token"
+const (
+	trustworthyJWTPath = "/var/run/secrets/tokens/istio-token"
+	resolvConfPath     = "/etc/resolv.conf"
+)
 
 var (
 	role             = &model.Proxy{}
@@ -94,6 +102,7 @@ var (
 	concurrency              int
 	templateFile             string
 	disableInternalTelemetry bool
+	dnsProxyAddress          string
 	tlsCertsToWatch          []string
 	loggingOptions           = log.DefaultOptions()
 
@@ -411,6 +420,34 @@ var (
 				go waitForCompletion(ctx, statusServer.Run)
 			}
 
+			// If a DNS proxy address was provided, answer the DNS queries for the hostnames of the mesh.
+			if dnsProxyAddress != "" {
+				upstreams, err := dns.UpstreamsFromResolvConf(resolvConfPath)
+				if err != nil {
+					cancel()
+					return err
+				}
+				dnsServer, err := dns.NewServer(dnsProxyAddress, upstreams)
+				if err != nil {
+					cancel()
+					return err
+				}
+				go waitForCompletion(ctx, dnsServer.Run)
+
+				certDir := ""
+				if controlPlaneAuthEnabled {
+					certDir = filepath.Dir(tlsClientCertChain)
+				}
+				// The DNS proxy has a connection of its own to pilot, with a node ID distinct from the one of Envoy.
+				go dnsServer.WatchNameTable(ctx, proxyConfig.DiscoveryAddress, certDir, &adsc.Config{
+					Namespace: podNamespace,
+					Workload:  podName + dns.NodeIDSuffix,
+					NodeType:  string(role.Type),
+					IP:        role.IPAddresses[0],
+					Meta:      nameTableMetadata(),
+				})
+			}
+
 			log.Infof("PilotSAN %#v", pilotSAN)
 
 			envoyProxy := envoy.NewProxy(envoy.ProxyConfig{
@@ -688,6 +725,9 @@ func init() {
 		"Disable internal telemetry")
 	proxyCmd.PersistentFlags().BoolVar(&controlPlaneBootstrap, "controlPlaneBootstrap", true,
 		"Process bootstrap provided via templateFile to be used by control plane components.")
+	proxyCmd.PersistentFlags().StringVar(&dnsProxyAddress, "dnsProxyAddress", "",
+		"Address of the DNS proxy answering the queries for the hostnames of the mesh, and forwarding the "+
+			"other queries to the name servers of "+resolvConfPath+". Empty disables the DNS proxy.")
 
 	// Attach the Istio logging options to the command.
 	loggingOptions.AttachCobraFlags(rootCmd)
@@ -704,6 +744,22 @@ func init() {
 	}))
 }
 
+// nameTableMetadata returns the node metadata of the connection of the DNS proxy to pilot, from the same
+// ISTIO_META_* environment variables as the metadata of Envoy.
+func nameTableMetadata() *structpb.Struct {
+	meta := &structpb.Struct{Fields: make(map[string]*structpb.Value)}
+	for _, e := range os.Environ() {
+		if !strings.HasPrefix(e, bootstrap.IstioMetaPrefix) {
+			continue
+		}
+		kv := strings.SplitN(strings.TrimPrefix(e, bootstrap.IstioMetaPrefix), "=", 2)
+		if len(kv) == 2 {
+			meta.Fields[kv[0]] = &structpb.Value{Kind: &structpb.Value_StringValue{StringValue: kv[1]}}
+		}
+	}
+	return meta
+}
+
 func waitForFile(fname string, maxWait time.Duration) bool {
 	log.Infof("waiting %v for %s", maxWait, fname)
 
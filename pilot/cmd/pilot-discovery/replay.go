@@ -0,0 +1,152 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"istio.io/istio/pilot/pkg/bootstrap"
+	envoyv2 "istio.io/istio/pilot/pkg/proxy/envoy/v2"
+	"istio.io/istio/pilot/pkg/serviceregistry"
+	"istio.io/istio/pkg/cmd"
+	"istio.io/istio/pkg/config/mesh"
+	"istio.io/istio/pkg/keepalive"
+	"istio.io/istio/pkg/spiffe"
+	"istio.io/pkg/log"
+)
+
+var (
+	replayArgs = bootstrap.PilotArgs{
+		KeepaliveOptions: keepalive.DefaultOption(),
+	}
+
+	snapshotFile string
+
+	replayCmd = &cobra.Command{
+		Use:   "replay",
+		Short: "Serve xDS from a snapshot of the state of a Pilot.",
+		Long: `Loads the configs, services, mesh config and mesh networks of a snapshot downloaded from the
+/debug/snapshot endpoint of a Pilot into memory, and serves xDS from them, to reproduce the behavior of the
+Pilot locally. The snapshot is not updated: the proxies get the config of the Pilot at the time of the snapshot.`,
+		Example: `
+curl -o pilot-snapshot.json.gz http://istio-pilot.istio-system:15014/debug/snapshot
+pilot-discovery replay --snapshot pilot-snapshot.json.gz
+`,
+		Args: cobra.ExactArgs(0),
+		RunE: func(c *cobra.Command, args []string) error {
+			cmd.PrintFlags(c.Flags())
+			if err := log.Configure(loggingOptions); err != nil {
+				return err
+			}
+			if snapshotFile == "" {
+				return fmt.Errorf("replay requires a snapshot")
+			}
+
+			snap, err := readSnapshot(snapshotFile)
+			if err != nil {
+				return err
+			}
+			if err := applySnapshot(&replayArgs, snap); err != nil {
+				return err
+			}
+
+			spiffe.SetTrustDomain(spiffe.DetermineTrustDomain(replayArgs.Config.ControllerOptions.TrustDomain,
+				hasSnapshotKubeRegistry(snap)))
+
+			stop := make(chan struct{})
+			discoveryServer, err := bootstrap.NewServer(replayArgs)
+			if err != nil {
+				return fmt.Errorf("failed to create discovery service: %v", err)
+			}
+			if err := discoveryServer.Start(stop); err != nil {
+				return fmt.Errorf("failed to start discovery service: %v", err)
+			}
+
+			cmd.WaitSignal(stop)
+			return nil
+		},
+	}
+)
+
+func readSnapshot(path string) (*envoyv2.Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() // nolint: errcheck
+	snap, err := envoyv2.ReadSnapshot(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot %s: %v", path, err)
+	}
+	return snap, nil
+}
+
+// applySnapshot sets the config controller, the mesh config and the snapshot of the arguments from the snapshot.
+func applySnapshot(args *bootstrap.PilotArgs, snap *envoyv2.Snapshot) error {
+	store, err := snap.ConfigStore()
+	if err != nil {
+		return err
+	}
+	args.Config.Controller = store
+
+	meshConfig := snap.Mesh
+	if meshConfig == nil {
+		m := mesh.DefaultMeshConfig()
+		meshConfig = &m
+	}
+	// The configs come from the snapshot, and the certificates of the mesh are stored in its cluster.
+	meshConfig.ConfigSources = nil
+	meshConfig.Certificates = nil
+	args.MeshConfig = meshConfig
+
+	args.Snapshot = snap
+	return nil
+}
+
+func hasSnapshotKubeRegistry(snap *envoyv2.Snapshot) bool {
+	for _, r := range snap.Registries {
+		if r.Name == serviceregistry.KubernetesRegistry {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	replayCmd.PersistentFlags().StringVar(&snapshotFile, "snapshot", "",
+		"File name of the snapshot downloaded from the /debug/snapshot endpoint of Pilot")
+	replayCmd.PersistentFlags().StringSliceVar(&replayArgs.Plugins, "plugins", bootstrap.DefaultPlugins,
+		"comma separated list of networking plugins to enable")
+	replayCmd.PersistentFlags().StringVar(&replayArgs.Config.ControllerOptions.DomainSuffix, "domain", "cluster.local",
+		"DNS domain suffix")
+	replayCmd.PersistentFlags().StringVar(&replayArgs.Config.ControllerOptions.TrustDomain, "trust-domain", "",
+		"The domain serves to identify the system with spiffe")
+
+	replayCmd.PersistentFlags().StringVar(&replayArgs.DiscoveryOptions.HTTPAddr, "httpAddr", ":8080",
+		"Discovery service HTTP address")
+	replayCmd.PersistentFlags().StringVar(&replayArgs.DiscoveryOptions.GrpcAddr, "grpcAddr", ":15010",
+		"Discovery service grpc address")
+	replayCmd.PersistentFlags().StringVar(&replayArgs.DiscoveryOptions.MonitoringAddr, "monitoringAddr", ":15014",
+		"HTTP address to use for pilot's self-monitoring information")
+	replayCmd.PersistentFlags().BoolVar(&replayArgs.DiscoveryOptions.EnableProfiling, "profile", true,
+		"Enable profiling via web interface host:port/debug/pprof")
+	replayCmd.PersistentFlags().BoolVar(&replayArgs.DiscoveryOptions.EnableCaching, "discoveryCache", true,
+		"Enable caching discovery service responses")
+
+	rootCmd.AddCommand(replayCmd)
+}
@@ -18,6 +18,7 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -68,6 +69,7 @@ import (
 	"istio.io/istio/pilot/pkg/networking/util"
 	"istio.io/istio/pilot/pkg/proxy/envoy"
 	envoyv2 "istio.io/istio/pilot/pkg/proxy/envoy/v2"
+	"istio.io/istio/pilot/pkg/rollout"
 	"istio.io/istio/pilot/pkg/serviceregistry"
 	"istio.io/istio/pilot/pkg/serviceregistry/aggregate"
 	"istio.io/istio/pilot/pkg/serviceregistry/consul"
@@ -110,6 +112,11 @@ const (
 	// URL types supported by the config store
 	// example fs:///tmp/configroot
 	fsScheme = "fs"
+	// example https://config.example.com/istio.yaml
+	httpScheme  = "http"
+	httpsScheme = "https"
+	// example git+https://github.com/example/config.git?ref=master&path=istio
+	gitSchemePrefix = "git+"
 
 	// DefaultCertGracePeriodRatio is the default length of certificate rotation grace period,
 	// configured as the ratio of the certificate TTL.
@@ -130,6 +137,9 @@ var (
 	// FilepathWalkInterval dictates how often the file system is walked for config
 	FilepathWalkInterval = 100 * time.Millisecond
 
+	// RemoteConfigPollInterval dictates how often the Git and HTTP config sources are polled for config
+	RemoteConfigPollInterval = 30 * time.Second
+
 	// PilotCertDir is the default location for mTLS certificates used by pilot
 	// Visible for tests - at runtime can be set by PILOT_CERT_DIR environment variable.
 	PilotCertDir = "/etc/certs/"
@@ -141,6 +151,8 @@ var (
 		plugin.Authz,
 		plugin.Health,
 		plugin.Mixer,
+		plugin.RateLimit,
+		plugin.Transcoder,
 	}
 )
 
@@ -208,6 +220,9 @@ type PilotArgs struct {
 	MCPInitialWindowSize     int
 	MCPInitialConnWindowSize int
 	KeepaliveOptions         *istiokeepalive.Options
+	// Snapshot if specified, the services of its registries and its mesh networks override the service
+	// registries and the mesh networks configuration file.
+	Snapshot *envoyv2.Snapshot
 	// ForceStop is set as true when used for testing to make the server stop quickly
 	ForceStop bool
 }
@@ -239,6 +254,7 @@ type Server struct {
 	kubeRegistry     *controller2.Controller
 	fileWatcher      filewatcher.FileWatcher
 	certController   *chiron.WebhookController
+	configMonitors   []*configmonitor.Monitor
 }
 
 var podNamespaceVar = env.RegisterStringVar("POD_NAMESPACE", "", "")
@@ -282,6 +298,9 @@ func NewServer(args PilotArgs) (*Server, error) {
 	if err := s.initServiceControllers(&args); err != nil {
 		return nil, fmt.Errorf("service controllers: %v", err)
 	}
+	if err := s.initRolloutController(&args); err != nil {
+		return nil, fmt.Errorf("rollout controller: %v", err)
+	}
 	if err := s.initDiscoveryService(&args); err != nil {
 		return nil, fmt.Errorf("discovery service: %v", err)
 	}
@@ -458,6 +477,10 @@ func (s *Server) initMesh(args *PilotArgs) error {
 // initMeshNetworks loads the mesh networks configuration from the file provided
 // in the args and add a watcher for changes in this file.
 func (s *Server) initMeshNetworks(args *PilotArgs) error { //nolint: unparam
+	if args.Snapshot != nil {
+		s.meshNetworks = args.Snapshot.MeshNetworks
+		return nil
+	}
 	if args.NetworksConfigFile == "" {
 		log.Info("mesh networks configuration not provided")
 		return nil
@@ -557,6 +580,15 @@ func (s *Server) initMCPConfigController(args *PilotArgs) error {
 	reporter := monitoring.NewStatsContext("pilot")
 
 	for _, configSource := range s.mesh.ConfigSources {
+		if isRemoteConfigSource(configSource.Address) {
+			configController, err := s.makeRemoteMonitor(configSource.Address)
+			if err != nil {
+				cancel()
+				return err
+			}
+			configStores = append(configStores, configController)
+			continue
+		}
 		if strings.Contains(configSource.Address, fsScheme+"://") {
 			srcAddress, err := url.Parse(configSource.Address)
 			if err != nil {
@@ -776,6 +808,42 @@ func (s *Server) initConfigController(args *PilotArgs) error {
 	return nil
 }
 
+// initRolloutController creates the controller stepping the canary rollouts of the virtual services, when enabled.
+func (s *Server) initRolloutController(args *PilotArgs) error {
+	if !features.EnableRolloutController {
+		return nil
+	}
+	// The MCP config store is read only, and the config files overwrite the weights written to the memory store.
+	if len(s.mesh.ConfigSources) > 0 || args.Config.FileDir != "" {
+		return fmt.Errorf("the rollout controller requires the Kubernetes config store")
+	}
+	metrics, err := rollout.NewPrometheusMetrics(features.RolloutPrometheusAddress)
+	if err != nil {
+		return err
+	}
+	// Pilot instances elect the one stepping the rollouts, which writes their statuses to a config map of the
+	// namespace, when running in Kubernetes.
+	if s.kubeClient == nil {
+		rolloutController := rollout.NewController(s.configController, rollout.NewMemoryStatusStore(), metrics,
+			features.RolloutInterval)
+		s.addStartFunc(func(stop <-chan struct{}) error {
+			go rolloutController.Run(stop)
+			return nil
+		})
+		return nil
+	}
+	namespace := args.Namespace
+	if namespace == "" {
+		namespace = constants.IstioSystemNamespace
+	}
+	rolloutController := rollout.NewController(s.configController, rollout.NewConfigMapStatusStore(s.kubeClient, namespace),
+		metrics, features.RolloutInterval)
+	s.addStartFunc(func(stop <-chan struct{}) error {
+		return rolloutController.RunWithLeaderElection(s.kubeClient, namespace, stop)
+	})
+	return nil
+}
+
 func (s *Server) makeKubeConfigController(args *PilotArgs) (model.ConfigStoreCache, error) {
 	kubeCfgFile := s.getKubeCfgFile(args)
 	configClient, err := controller.NewClient(kubeCfgFile, "", schemas.Istio, args.Config.ControllerOptions.DomainSuffix)
@@ -795,6 +863,7 @@ func (s *Server) makeKubeConfigController(args *PilotArgs) (model.ConfigStoreCac
 func (s *Server) makeFileMonitor(fileDir string, configController model.ConfigStore) error {
 	fileSnapshot := configmonitor.NewFileSnapshot(fileDir, schemas.Istio)
 	fileMonitor := configmonitor.NewMonitor("file-monitor", configController, FilepathWalkInterval, fileSnapshot.ReadConfigFiles)
+	s.configMonitors = append(s.configMonitors, fileMonitor)
 
 	// Defer starting the file monitor until after the service is created.
 	s.addStartFunc(func(stop <-chan struct{}) error {
@@ -805,6 +874,76 @@ func (s *Server) makeFileMonitor(fileDir string, configController model.ConfigSt
 	return nil
 }
 
+// isRemoteConfigSource returns true if the config source address is a Git repository or an HTTP(S) URL.
+func isRemoteConfigSource(address string) bool {
+	return strings.HasPrefix(address, gitSchemePrefix) ||
+		strings.HasPrefix(address, httpScheme+"://") || strings.HasPrefix(address, httpsScheme+"://")
+}
+
+// makeRemoteMonitor creates a config store polling the configs of a Git repository or an HTTP(S) URL.
+// The branch or tag, and the directory of the configs in a Git repository are set by the ref and path
+// query parameters of its address.
+func (s *Server) makeRemoteMonitor(address string) (model.ConfigStoreCache, error) {
+	srcAddress, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config URL: %v", configmonitor.RedactURL(err.Error()))
+	}
+	// Do not expose the credentials of the address in the errors and the monitor status.
+	name := *srcAddress
+	name.User = nil
+
+	var snapshotter configmonitor.Snapshotter
+	switch {
+	case strings.HasPrefix(srcAddress.Scheme, gitSchemePrefix):
+		if err := configmonitor.CheckGit(); err != nil {
+			return nil, err
+		}
+		query := srcAddress.Query()
+		repo := *srcAddress
+		repo.Scheme = strings.TrimPrefix(srcAddress.Scheme, gitSchemePrefix)
+		repo.RawQuery = ""
+		dir, err := ioutil.TempDir("", "pilot-config-git")
+		if err != nil {
+			return nil, err
+		}
+		snapshotter = configmonitor.NewGitSnapshot(repo.String(), query.Get("ref"), query.Get("path"), dir, schemas.Istio)
+	case srcAddress.Scheme == httpScheme || srcAddress.Scheme == httpsScheme:
+		snapshotter = configmonitor.NewHTTPSnapshot(address, schemas.Istio)
+	default:
+		return nil, fmt.Errorf("unsupported config URL %s", name.String())
+	}
+
+	store := memory.Make(schemas.Istio)
+	configController := memory.NewController(store)
+	remoteMonitor := configmonitor.NewSnapshotMonitor(name.String(), configController, RemoteConfigPollInterval, snapshotter)
+	s.configMonitors = append(s.configMonitors, remoteMonitor)
+
+	// Defer starting the monitor until after the service is created.
+	s.addStartFunc(func(stop <-chan struct{}) error {
+		remoteMonitor.Start(stop)
+		return nil
+	})
+
+	return configController, nil
+}
+
+// configSources dumps the status of the config sources polled by this Pilot instance, such as the revision
+// of the configs applied from a Git repository.
+func (s *Server) configSources(w http.ResponseWriter, _ *http.Request) {
+	statuses := make([]configmonitor.Status, 0, len(s.configMonitors))
+	for _, m := range s.configMonitors {
+		statuses = append(statuses, m.Status())
+	}
+	out, err := json.MarshalIndent(statuses, "", "    ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = fmt.Fprintf(w, "unable to marshal config sources: %v", err)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	_, _ = w.Write(out)
+}
+
 // createK8sServiceControllers creates all the k8s service controllers under this pilot
 func (s *Server) createK8sServiceControllers(serviceControllers *aggregate.Controller, args *PilotArgs) (err error) {
 	clusterID := string(serviceregistry.KubernetesRegistry)
@@ -862,11 +1001,18 @@ func (s *Server) initServiceControllers(args *PilotArgs) error {
 		}
 	}
 
+	if args.Snapshot != nil {
+		for _, r := range args.Snapshot.ServiceRegistries() {
+			log.Infof("Adding %s registry adapter of cluster %s from the snapshot", r.Name, r.ClusterID)
+			serviceControllers.AddRegistry(r)
+		}
+	}
+
 	serviceEntryStore := external.NewServiceDiscovery(s.configController, s.istioConfigStore)
 
 	// add service entry registry to aggregator by default
 	serviceEntryRegistry := aggregate.Registry{
-		Name:             "ServiceEntries",
+		Name:             serviceregistry.ServiceEntryRegistry,
 		Controller:       serviceEntryStore,
 		ServiceDiscovery: serviceEntryStore,
 	}
@@ -933,6 +1079,7 @@ func (s *Server) initDiscoveryService(args *PilotArgs) error {
 		istio_networking.NewConfigGenerator(args.Plugins),
 		s.ServiceController, s.kubeRegistry, s.configController)
 	s.EnvoyXdsServer.InitDebug(s.mux, s.ServiceController)
+	s.mux.HandleFunc("/debug/config_sources", s.configSources)
 	if s.kubeRegistry != nil {
 		// kubeRegistry may use the environment for push status reporting.
 		// TODO: maybe all registries should have this as an optional field ?
@@ -47,9 +47,16 @@ type FileSnapshot struct {
 func NewFileSnapshot(root string, descriptor schema.Set) *FileSnapshot {
 	snapshot := &FileSnapshot{
 		root:             root,
-		configTypeFilter: make(map[string]bool),
+		configTypeFilter: newConfigTypeFilter(descriptor),
 	}
 
+	return snapshot
+}
+
+// newConfigTypeFilter returns the config types of the descriptor, or all the Istio types if it has none.
+func newConfigTypeFilter(descriptor schema.Set) map[string]bool {
+	configTypeFilter := make(map[string]bool)
+
 	types := descriptor.Types()
 	if len(types) == 0 {
 		types = schemas.Istio.Types()
@@ -57,11 +64,11 @@ func NewFileSnapshot(root string, descriptor schema.Set) *FileSnapshot {
 
 	for _, k := range types {
 		if s, ok := schemas.Istio.GetByType(k); ok {
-			snapshot.configTypeFilter[s.Type] = true
+			configTypeFilter[s.Type] = true
 		}
 	}
 
-	return snapshot
+	return configTypeFilter
 }
 
 // ReadConfigFiles parses files in the root directory and returns a sorted slice of
@@ -60,6 +60,18 @@ spec:
         host: some.example.internal
 `
 
+var invalidVirtualServiceYAML = `
+apiVersion: networking.istio.io/v1alpha3
+kind: VirtualService
+metadata:
+  name: route-without-hosts
+spec:
+  http:
+  - route:
+    - destination:
+        host: some.example.internal
+`
+
 func TestFileSnapshotNoFilter(t *testing.T) {
 	g := gomega.NewGomegaWithT(t)
 
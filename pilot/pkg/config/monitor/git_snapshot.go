@@ -0,0 +1,124 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/schema"
+)
+
+// GitSnapshot holds a reference to a branch or tag of a Git repository that contains crd config, and filter
+// criteria for which of those configs will be parsed. The git command is used to fetch the reference into a
+// local repository, so it must be installed: the default pilot image includes it, the distroless image does not.
+type GitSnapshot struct {
+	repo       string
+	ref        string
+	path       string
+	dir        string
+	descriptor schema.Set
+
+	// revision is the commit of the configs read last.
+	revision string
+	configs  []*model.Config
+}
+
+// NewGitSnapshot returns a snapshotter of the config files in the path of the reference of the repository.
+// The reference is fetched into the local repository in dir, created if it does not exist and removed by Close.
+// If no types are provided in the descriptor, all Istio types will be allowed.
+func NewGitSnapshot(repo, ref, path, dir string, descriptor schema.Set) *GitSnapshot {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	return &GitSnapshot{
+		repo:       repo,
+		ref:        ref,
+		path:       path,
+		dir:        dir,
+		descriptor: descriptor,
+	}
+}
+
+// ReadConfigFiles fetches the reference, and parses the files of its commit if it changed. It returns a
+// sorted slice of eligible model.Config. This can be used as a configFunc when creating a Monitor.
+func (g *GitSnapshot) ReadConfigFiles() ([]*model.Config, error) {
+	created := false
+	if _, err := os.Stat(filepath.Join(g.dir, ".git")); os.IsNotExist(err) {
+		if _, err := g.git("init", "--quiet", g.dir); err != nil {
+			_ = os.RemoveAll(g.dir)
+			return nil, err
+		}
+		created = true
+	}
+	if _, err := g.git("-C", g.dir, "fetch", "--quiet", "--depth", "1", g.repo, g.ref); err != nil {
+		// Do not keep a local repository which was never fetched into.
+		if created {
+			_ = os.RemoveAll(g.dir)
+		}
+		return nil, err
+	}
+	revision, err := g.git("-C", g.dir, "rev-parse", "FETCH_HEAD^{commit}")
+	if err != nil {
+		return nil, err
+	}
+	if revision == g.revision {
+		return g.configs, nil
+	}
+
+	if _, err := g.git("-C", g.dir, "checkout", "--quiet", "--force", "--detach", revision); err != nil {
+		return nil, err
+	}
+	configs, err := NewFileSnapshot(filepath.Join(g.dir, g.path), g.descriptor).ReadConfigFiles()
+	if err != nil {
+		return nil, err
+	}
+	g.revision = revision
+	g.configs = configs
+	return configs, nil
+}
+
+// Revision returns the commit of the configs read last.
+func (g *GitSnapshot) Revision() string {
+	return g.revision
+}
+
+// Close removes the local repository.
+func (g *GitSnapshot) Close() error {
+	return os.RemoveAll(g.dir)
+}
+
+// CheckGit returns an error if the git command used by GitSnapshot is not installed.
+func CheckGit() error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return errors.New("git config sources require the git command, which is not installed " +
+			"(it is not available in the distroless pilot image)")
+	}
+	return nil
+}
+
+// git runs the git command. Its error does not expose the credentials of the repository URL.
+func (g *GitSnapshot) git(args ...string) (string, error) {
+	out, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %v: %s", RedactURL(strings.Join(args, " ")), err, RedactURL(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
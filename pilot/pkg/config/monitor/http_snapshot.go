@@ -0,0 +1,113 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/schema"
+)
+
+const httpSnapshotTimeout = 30 * time.Second
+
+// HTTPSnapshot holds a reference to a URL serving crd config, and filter criteria for which of those configs
+// will be parsed. The configs are only parsed again when the ETag of the response changes.
+type HTTPSnapshot struct {
+	url              string
+	client           *http.Client
+	configTypeFilter map[string]bool
+
+	// etag is the ETag of the configs read last, if the server sent one.
+	etag string
+	// revision is the ETag of the configs read last, or the digest of their content.
+	revision string
+	configs  []*model.Config
+}
+
+// NewHTTPSnapshot returns a snapshotter of the configs served at the URL.
+// If no types are provided in the descriptor, all Istio types will be allowed.
+func NewHTTPSnapshot(url string, descriptor schema.Set) *HTTPSnapshot {
+	return &HTTPSnapshot{
+		url:              url,
+		client:           &http.Client{Timeout: httpSnapshotTimeout},
+		configTypeFilter: newConfigTypeFilter(descriptor),
+	}
+}
+
+// ReadConfigFiles requests the configs, and parses them if they changed. It returns a sorted slice of
+// eligible model.Config. This can be used as a configFunc when creating a Monitor.
+func (h *HTTPSnapshot) ReadConfigFiles() ([]*model.Config, error) {
+	// The errors do not expose the credentials of the URL.
+	req, err := http.NewRequest(http.MethodGet, h.url, nil)
+	if err != nil {
+		return nil, errors.New(RedactURL(err.Error()))
+	}
+	if h.etag != "" {
+		req.Header.Set("If-None-Match", h.etag)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, errors.New(RedactURL(err.Error()))
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return h.configs, nil
+	case http.StatusOK:
+	default:
+		return nil, fmt.Errorf("failed to get %s: %s", RedactURL(h.url), resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.New(RedactURL(err.Error()))
+	}
+	configs, err := parseInputs(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", RedactURL(h.url), err)
+	}
+
+	// Filter any unsupported types.
+	var result []*model.Config
+	for _, cfg := range configs {
+		if h.configTypeFilter[cfg.Type] {
+			result = append(result, cfg)
+		}
+	}
+	sort.Sort(byKey(result))
+
+	h.etag = resp.Header.Get("ETag")
+	h.revision = h.etag
+	if h.revision == "" {
+		sum := sha256.Sum256(data)
+		h.revision = hex.EncodeToString(sum[:])
+	}
+	h.configs = result
+	return result, nil
+}
+
+// Revision returns the ETag of the configs read last, or the digest of their content.
+func (h *HTTPSnapshot) Revision() string {
+	return h.revision
+}
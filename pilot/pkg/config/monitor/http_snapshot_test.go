@@ -0,0 +1,132 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/onsi/gomega"
+
+	"istio.io/istio/pilot/pkg/config/monitor"
+	"istio.io/istio/pkg/config/schema"
+	"istio.io/istio/pkg/config/schemas"
+)
+
+// configServer serves a config document with an ETag, and counts the requests answered with it.
+type configServer struct {
+	mu          sync.Mutex
+	etag        string
+	body        string
+	status      int
+	served      int
+	notModified int
+}
+
+func (c *configServer) set(etag, body string, status int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.etag, c.body, c.status = etag, body, status
+}
+
+func (c *configServer) counts() (served, notModified int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.served, c.notModified
+}
+
+func (c *configServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.status != http.StatusOK {
+		w.WriteHeader(c.status)
+		return
+	}
+	if c.etag != "" && r.Header.Get("If-None-Match") == c.etag {
+		c.notModified++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	c.served++
+	if c.etag != "" {
+		w.Header().Set("ETag", c.etag)
+	}
+	_, _ = w.Write([]byte(c.body))
+}
+
+func TestHTTPSnapshot(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	cs := &configServer{}
+	cs.set(`"v1"`, gatewayYAML, http.StatusOK)
+	server := httptest.NewServer(cs)
+	defer server.Close()
+
+	snapshot := monitor.NewHTTPSnapshot(server.URL, nil)
+	configs, err := snapshot.ReadConfigFiles()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(configs).To(gomega.HaveLen(1))
+	g.Expect(snapshot.Revision()).To(gomega.Equal(`"v1"`))
+
+	// The configs are not served again while the ETag is unchanged.
+	configs, err = snapshot.ReadConfigFiles()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(configs).To(gomega.HaveLen(1))
+	served, notModified := cs.counts()
+	g.Expect(served).To(gomega.Equal(1))
+	g.Expect(notModified).To(gomega.Equal(1))
+
+	cs.set(`"v2"`, gatewayYAML+"---"+virtualServiceYAML, http.StatusOK)
+	configs, err = snapshot.ReadConfigFiles()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(configs).To(gomega.HaveLen(2))
+	g.Expect(snapshot.Revision()).To(gomega.Equal(`"v2"`))
+
+	// Invalid configs and server errors fail the snapshot, and keep the revision of the last valid one.
+	cs.set(`"v3"`, invalidVirtualServiceYAML, http.StatusOK)
+	_, err = snapshot.ReadConfigFiles()
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(snapshot.Revision()).To(gomega.Equal(`"v2"`))
+
+	cs.set("", "", http.StatusInternalServerError)
+	_, err = snapshot.ReadConfigFiles()
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(snapshot.Revision()).To(gomega.Equal(`"v2"`))
+}
+
+func TestHTTPSnapshotWithoutETag(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	cs := &configServer{}
+	cs.set("", gatewayYAML+"---"+virtualServiceYAML, http.StatusOK)
+	server := httptest.NewServer(cs)
+	defer server.Close()
+
+	snapshot := monitor.NewHTTPSnapshot(server.URL, schema.Set{schemas.Gateway})
+	configs, err := snapshot.ReadConfigFiles()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(configs).To(gomega.HaveLen(1))
+	g.Expect(configs[0].Type).To(gomega.Equal(schemas.Gateway.Type))
+
+	// Without an ETag, the revision is the digest of the configs.
+	revision := snapshot.Revision()
+	g.Expect(revision).To(gomega.HaveLen(64))
+	_, _ = snapshot.ReadConfigFiles()
+	g.Expect(snapshot.Revision()).To(gomega.Equal(revision))
+	served, _ := cs.counts()
+	g.Expect(served).To(gomega.Equal(2))
+}
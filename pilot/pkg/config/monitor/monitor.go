@@ -15,8 +15,11 @@
 package monitor
 
 import (
+	"io"
 	"reflect"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gogo/protobuf/proto"
@@ -33,6 +36,39 @@ type Monitor struct {
 	checkDuration   time.Duration
 	configs         []*model.Config
 	getSnapshotFunc func() ([]*model.Config, error)
+	revisionFunc    func() string
+	closeFunc       func() error
+
+	statusMutex sync.RWMutex
+	status      Status
+}
+
+// urlUserinfo matches the userinfo of the URLs in a text, such as the credentials of a Git repository.
+var urlUserinfo = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://)[^/?#@\s'"]*@`)
+
+// RedactURL removes the userinfo of the URLs in the text, so that errors do not expose credentials.
+func RedactURL(text string) string {
+	return urlUserinfo.ReplaceAllString(text, "${1}")
+}
+
+// Snapshotter is a source of config snapshots identified by a revision, such as a commit of a Git repository.
+// Snapshotters which also implement io.Closer are closed when their Monitor is stopped.
+type Snapshotter interface {
+	// ReadConfigFiles returns the configs of the current snapshot.
+	ReadConfigFiles() ([]*model.Config, error)
+	// Revision returns the revision of the last snapshot read successfully.
+	Revision() string
+}
+
+// Status is the status of the snapshots polled by a Monitor.
+type Status struct {
+	Name string `json:"name"`
+	// Revision is the revision of the snapshot applied to the store, if known.
+	Revision string `json:"revision,omitempty"`
+	// LastApplied is the time the last snapshot was applied to the store.
+	LastApplied time.Time `json:"lastApplied,omitempty"`
+	// Error is the error of the last poll, if it failed. The store keeps the last snapshot applied.
+	Error string `json:"error,omitempty"`
 }
 
 // NewMonitor creates a Monitor and will delegate to a passed in controller.
@@ -45,9 +81,28 @@ func NewMonitor(name string, delegateStore model.ConfigStore, checkInterval time
 		getSnapshotFunc: getSnapshotFunc,
 		checkDuration:   checkInterval,
 	}
+	monitor.status.Name = name
 	return monitor
 }
 
+// NewSnapshotMonitor creates a Monitor polling the snapshots of the snapshotter, and recording their revision
+// in its status.
+func NewSnapshotMonitor(name string, delegateStore model.ConfigStore, checkInterval time.Duration, snapshotter Snapshotter) *Monitor {
+	monitor := NewMonitor(name, delegateStore, checkInterval, snapshotter.ReadConfigFiles)
+	monitor.revisionFunc = snapshotter.Revision
+	if closer, ok := snapshotter.(io.Closer); ok {
+		monitor.closeFunc = closer.Close
+	}
+	return monitor
+}
+
+// Status returns the status of the snapshots polled by the monitor.
+func (m *Monitor) Status() Status {
+	m.statusMutex.RLock()
+	defer m.statusMutex.RUnlock()
+	return m.status
+}
+
 // Start starts a new Monitor. Immediately checks the Monitor getSnapshotFunc
 // and updates the controller. It then kicks off an asynchronous event loop that
 // periodically polls the getSnapshotFunc for changes until a close event is sent.
@@ -61,6 +116,11 @@ func (m *Monitor) Start(stop <-chan struct{}) {
 			select {
 			case <-stop:
 				tick.Stop()
+				if m.closeFunc != nil {
+					if err := m.closeFunc(); err != nil {
+						log.Warnf("Failed to close %s: %v", m.name, err)
+					}
+				}
 				return
 			case <-tick.C:
 				m.checkAndUpdate()
@@ -76,6 +136,9 @@ func (m *Monitor) checkAndUpdate() {
 	//The error will only come from a directory read error or a gRPC connection error
 	if err != nil {
 		log.Warnf("checkAndUpdate Error Caught %s: %v\n", m.name, err)
+		m.statusMutex.Lock()
+		m.status.Error = err.Error()
+		m.statusMutex.Unlock()
 		return
 	}
 
@@ -123,6 +186,14 @@ func (m *Monitor) checkAndUpdate() {
 
 	// Save the updated list.
 	m.configs = copyConfigs
+
+	m.statusMutex.Lock()
+	if m.revisionFunc != nil {
+		m.status.Revision = m.revisionFunc()
+	}
+	m.status.LastApplied = time.Now()
+	m.status.Error = ""
+	m.statusMutex.Unlock()
 }
 
 func (m *Monitor) createConfig(c *model.Config) {
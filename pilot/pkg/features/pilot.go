@@ -48,6 +48,22 @@ var (
 		"Limits the number of concurrent pushes allowed. On larger machines this can be increased for faster pushes",
 	).Get()
 
+	PushQueueLimits = env.RegisterStringVar(
+		"PILOT_PUSH_QUEUE_LIMITS",
+		"",
+		"Limits the number of concurrent pushes of each class of the push queue, as a comma-separated list of "+
+			"<class>=<limit> with the classes new (new connections), gateway, eds and full. For example, "+
+			"full=80 keeps some of the PILOT_PUSH_THROTTLE pushes for the other classes during full pushes.",
+	).Get()
+
+	// EnableXDSCache enables the cache of the clusters and routes shared by the proxies with the same scope.
+	EnableXDSCache = env.RegisterBoolVar(
+		"PILOT_ENABLE_XDS_CACHE",
+		false,
+		"If enabled, the clusters and routes generated for a proxy are reused for the proxies with the same "+
+			"Sidecar scope, metadata and locality, until a push updates the configs they were generated from.",
+	).Get()
+
 	// DebugConfigs controls saving snapshots of configs for /debug/adsz.
 	// Defaults to false, can be enabled with PILOT_DEBUG_ADSZ_CONFIG=1
 	// For larger clusters it can increase memory use and GC - useful for small tests.
@@ -125,6 +141,40 @@ var (
 			"When REGISTRY_ONLY traffic policy is used, a 502 error is returned.",
 	)
 
+	// EnableNetworkFailover sends the endpoints of the remote networks, through their gateways, at a lower
+	// priority than the endpoints of the network of the proxy.
+	EnableNetworkFailover = env.RegisterBoolVar(
+		"PILOT_ENABLE_NETWORK_FAILOVER",
+		false,
+		"If enabled, the proxies of a network send their traffic to the gateways of the other networks only when "+
+			"the endpoints of their own network are unavailable, instead of spreading it over all the networks. "+
+			"The locality of the endpoints is honored within each network.",
+	)
+
+	// EnableRolloutController runs the controller stepping the weights of the canary rollouts of virtual services.
+	EnableRolloutController = env.RegisterBoolVar(
+		"PILOT_ENABLE_ROLLOUT_CONTROLLER",
+		false,
+		"If enabled, Pilot shifts the traffic of the virtual services with a networking.istio.io/rollout annotation "+
+			"to their canary subset step by step, and rolls it back when the canary metrics exceed their thresholds. "+
+			"It requires the Kubernetes config store, as the weights are written to the virtual services. "+
+			"The statuses of the rollouts are written to the istio-rollout-status config map of the Pilot namespace.",
+	).Get()
+
+	// RolloutPrometheusAddress is the address of the Prometheus API queried for the metrics of canary rollouts.
+	RolloutPrometheusAddress = env.RegisterStringVar(
+		"PILOT_ROLLOUT_PROMETHEUS_ADDRESS",
+		"http://prometheus.istio-system:9090",
+		"The address of the Prometheus API queried for the error rate and the latency of the canaries of rollouts.",
+	).Get()
+
+	// RolloutInterval is the interval between the evaluations of the canary rollouts.
+	RolloutInterval = env.RegisterDurationVar(
+		"PILOT_ROLLOUT_INTERVAL",
+		10*time.Second,
+		"The interval between the evaluations of the canary rollouts by the rollout controller.",
+	).Get()
+
 	// DisableXDSMarshalingToAny provides an option to disable the "xDS marshaling to Any" feature ("on" by default).
 	DisableXDSMarshalingToAny = env.RegisterBoolVar(
 		"PILOT_DISABLE_XDS_MARSHALING_TO_ANY",
@@ -148,6 +198,50 @@ var (
 		"EnableRedisFilter enables injection of `envoy.filters.network.redis_proxy` in the filter chain.",
 	)
 
+	// EnableKafkaFilter enables injection of `envoy.filters.network.kafka_broker` in the filter chain.
+	// Pilot injects this outbound filter if the service port name is `kafka`.
+	EnableKafkaFilter = env.RegisterBoolVar(
+		"PILOT_ENABLE_KAFKA_FILTER",
+		false,
+		"EnableKafkaFilter enables injection of `envoy.filters.network.kafka_broker` in the filter chain. "+
+			"The filter is only sent to proxies of Istio 1.5 or later.",
+	)
+
+	// EnablePostgresFilter enables injection of `envoy.filters.network.postgres_proxy` in the filter chain.
+	// Pilot injects this outbound filter if the service port name is `postgres`.
+	EnablePostgresFilter = env.RegisterBoolVar(
+		"PILOT_ENABLE_POSTGRES_FILTER",
+		false,
+		"EnablePostgresFilter enables injection of `envoy.filters.network.postgres_proxy` in the filter chain. "+
+			"The filter is only sent to proxies of Istio 1.7 or later.",
+	)
+
+	// EnableThriftFilter enables injection of `envoy.filters.network.thrift_proxy` in the filter chain.
+	// Pilot injects this outbound filter if the service port name is `thrift` and virtual services route its methods.
+	EnableThriftFilter = env.RegisterBoolVar(
+		"PILOT_ENABLE_THRIFT_FILTER",
+		false,
+		"EnableThriftFilter enables injection of `envoy.filters.network.thrift_proxy` in the filter chain.",
+	)
+
+	// EnableDubboFilter enables injection of `envoy.filters.network.dubbo_proxy` in the filter chain.
+	// Pilot injects this outbound filter if the service port name is `dubbo` and virtual services route its methods.
+	EnableDubboFilter = env.RegisterBoolVar(
+		"PILOT_ENABLE_DUBBO_FILTER",
+		false,
+		"EnableDubboFilter enables injection of `envoy.filters.network.dubbo_proxy` in the filter chain.",
+	)
+
+	// EnableStaticServiceEntryHealthCheck enables a TCP health check by default for the endpoints of
+	// ServiceEntries with STATIC resolution, which no registry tracks the health of. It is disabled by
+	// default as every sidecar probes every endpoint.
+	EnableStaticServiceEntryHealthCheck = env.RegisterBoolVar(
+		"PILOT_ENABLE_STATIC_SERVICE_ENTRY_HEALTH_CHECK",
+		false,
+		"If enabled, the endpoints of ServiceEntries with STATIC resolution are health checked over TCP by default. "+
+			"Every sidecar probes every endpoint of these ServiceEntries.",
+	)
+
 	// UseRemoteAddress sets useRemoteAddress to true for side car outbound listeners so that it picks up the localhost
 	// address of the sender, which is an internal address, so that trusted headers are not sanitized.
 	UseRemoteAddress = env.RegisterBoolVar(
@@ -232,6 +326,38 @@ var (
 		"If enabled, any HTTP services will be blocked on HTTPS port (443). If this is disabled, any "+
 			"HTTP service on port 443 could block all external traffic",
 	).Get()
+
+	RateLimitService = env.RegisterStringVar(
+		"PILOT_RATE_LIMIT_SERVICE",
+		"",
+		"The <host>:<port> of the gRPC rate limit service used by the Envoy global rate limit filter, "+
+			"for example ratelimit.istio-system.svc.cluster.local:8081. If empty, the filter is not configured.",
+	)
+
+	RateLimitDomain = env.RegisterStringVar(
+		"PILOT_RATE_LIMIT_DOMAIN",
+		"istio",
+		"The domain of the descriptors sent to the rate limit service.",
+	)
+
+	RateLimitTimeout = env.RegisterDurationVar(
+		"PILOT_RATE_LIMIT_TIMEOUT",
+		20*time.Millisecond,
+		"The timeout of the requests to the rate limit service.",
+	)
+
+	RateLimitFailureModeDeny = env.RegisterBoolVar(
+		"PILOT_RATE_LIMIT_FAILURE_MODE_DENY",
+		false,
+		"If enabled, requests are rejected when the rate limit service cannot be reached. By default they are allowed.",
+	)
+
+	RateLimitRequestHeaders = env.RegisterStringVar(
+		"PILOT_RATE_LIMIT_REQUEST_HEADERS",
+		"",
+		"Comma-separated names of the request headers whose values are added to the rate limit descriptors, "+
+			"so that requests can be limited per header value, for example per user or per API key.",
+	)
 )
 
 var (
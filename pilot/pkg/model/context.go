@@ -264,6 +264,30 @@ type NodeMetadata struct {
 	PolicyCheckBaseRetryWaitTime string `json:"policy.istio.io/checkBaseRetryWaitTime,omitempty"`
 	PolicyCheckMaxRetryWaitTime  string `json:"policy.istio.io/checkMaxRetryWaitTime,omitempty"`
 
+	// ExtAuthzServer is the <host>:<port> of the external authorization service of the workload.
+	// Setting it enables the ext_authz filter on the inbound path of the workload.
+	ExtAuthzServer string `json:"authz.istio.io/extAuthzServer,omitempty"`
+	// ExtAuthzProtocol is the protocol of the external authorization service, grpc (default) or http.
+	ExtAuthzProtocol string `json:"authz.istio.io/extAuthzProtocol,omitempty"`
+	// ExtAuthzTimeout is the timeout of the requests to the external authorization service.
+	ExtAuthzTimeout string `json:"authz.istio.io/extAuthzTimeout,omitempty"`
+	// ExtAuthzFailOpen allows the requests when the external authorization service fails, if "true".
+	ExtAuthzFailOpen string `json:"authz.istio.io/extAuthzFailOpen,omitempty"`
+	// ExtAuthzAllowedHeaders is the comma-separated list of request headers sent to an HTTP authorization service.
+	ExtAuthzAllowedHeaders string `json:"authz.istio.io/extAuthzAllowedHeaders,omitempty"`
+	// ExtAuthzUpstreamHeaders is the comma-separated list of headers of the response of an HTTP authorization
+	// service that are added to the request sent to the workload.
+	ExtAuthzUpstreamHeaders string `json:"authz.istio.io/extAuthzUpstreamHeaders,omitempty"`
+
+	// TranscodingDescriptorSet is the proto descriptor set of the gRPC services of the workload, either the path
+	// of a file in the proxy container or its base64 encoded content. Setting it enables the gRPC-JSON transcoder.
+	TranscodingDescriptorSet string `json:"transcoding.istio.io/descriptorSet,omitempty"`
+	// TranscodingServices is the comma-separated list of the fully qualified names of the gRPC services to transcode.
+	TranscodingServices string `json:"transcoding.istio.io/services,omitempty"`
+	// TranscodingPorts is the comma-separated list of ports on which requests are transcoded. It defaults to the
+	// gRPC and HTTP/2 ports of sidecars, and to all the HTTP ports of gateways.
+	TranscodingPorts string `json:"transcoding.istio.io/ports,omitempty"`
+
 	StatsInclusionPrefixes string `json:"sidecar.istio.io/statsInclusionPrefixes,omitempty"`
 	StatsInclusionRegexps  string `json:"sidecar.istio.io/statsInclusionRegexps,omitempty"`
 	StatsInclusionSuffixes string `json:"sidecar.istio.io/statsInclusionSuffixes,omitempty"`
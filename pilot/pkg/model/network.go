@@ -0,0 +1,132 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"net"
+
+	meshconfig "istio.io/api/mesh/v1alpha1"
+
+	"istio.io/istio/pkg/config/host"
+)
+
+// Gateway is the address and port of a gateway of a network of the mesh, used to reach the endpoints of the
+// network from the other networks.
+type Gateway struct {
+	Addr string
+	Port uint32
+}
+
+// NetworkGateways returns the gateways of each network of the mesh networks, keyed by network. The gateways
+// without instances in their own network are left out.
+func (ps *PushContext) NetworkGateways() map[string][]*Gateway {
+	return ps.networkGateways
+}
+
+// initMeshNetworks computes the gateways of the mesh networks. The health of the gateways depends on the
+// instances of their services, so it is computed when the push context is initialized, and the endpoint
+// updates of the gateway services require a full push (see IsNetworkGatewayService).
+func (ps *PushContext) initMeshNetworks(env *Environment) {
+	ps.networkGateways = map[string][]*Gateway{}
+	if env.MeshNetworks == nil {
+		return
+	}
+	for network, networkConf := range env.MeshNetworks.Networks {
+		registryName := getNetworkRegistry(networkConf)
+		var gateways []*Gateway
+		for _, gw := range networkConf.Gateways {
+			for _, addr := range getHealthyGatewayAddresses(gw, network, registryName, env) {
+				gateways = append(gateways, &Gateway{Addr: addr, Port: gw.Port})
+			}
+		}
+		if len(gateways) > 0 {
+			ps.networkGateways[network] = gateways
+		}
+	}
+}
+
+// IsNetworkGatewayService returns true if the hostname is the registry service of a gateway of the mesh
+// networks, whose health depends on the instances of the service.
+func IsNetworkGatewayService(meshNetworks *meshconfig.MeshNetworks, hostname string) bool {
+	if meshNetworks == nil {
+		return false
+	}
+	for _, networkConf := range meshNetworks.Networks {
+		for _, gw := range networkConf.Gateways {
+			if name := gw.GetRegistryServiceName(); name != "" && name == hostname {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func getNetworkRegistry(network *meshconfig.Network) string {
+	var registryName string
+	for _, eps := range network.Endpoints {
+		if eps != nil && len(eps.GetFromRegistry()) > 0 {
+			registryName = eps.GetFromRegistry()
+			break
+		}
+	}
+
+	return registryName
+}
+
+// getHealthyGatewayAddresses returns the addresses of the gateway, if it has instances in the network.
+// The gateways configured with an address are assumed to be healthy.
+func getHealthyGatewayAddresses(gw *meshconfig.Network_IstioNetworkGateway, network, registryName string,
+	env *Environment) []string {
+	addrs := getGatewayAddresses(gw, registryName, env)
+	if len(addrs) == 0 || net.ParseIP(gw.GetAddress()) != nil {
+		return addrs
+	}
+	svc, _ := env.GetService(host.Name(gw.GetRegistryServiceName()))
+	if svc == nil {
+		return addrs
+	}
+	instances, err := env.InstancesByPort(svc, int(gw.Port), nil)
+	if err != nil {
+		// Do not drop the gateway on a transient registry error.
+		log.Debugf("failed to get the instances of the gateway %s of network %s: %v", svc.Hostname, network, err)
+		return addrs
+	}
+	for _, instance := range instances {
+		if instance.Endpoint.Network == network {
+			return addrs
+		}
+	}
+	log.Debugf("the gateway %s of network %s will be ignored for no healthy instances", svc.Hostname, network)
+	return nil
+}
+
+func getGatewayAddresses(gw *meshconfig.Network_IstioNetworkGateway, registryName string, env *Environment) []string {
+	// First, if a gateway address is provided in the configuration use it. If the gateway address
+	// in the config was a hostname it got already resolved and replaced with an IP address
+	// when loading the config
+	if gwIP := net.ParseIP(gw.GetAddress()); gwIP != nil {
+		return []string{gw.GetAddress()}
+	}
+
+	// Second, try to find the gateway addresses by the provided service name
+	if gwSvcName := gw.GetRegistryServiceName(); len(gwSvcName) > 0 && len(registryName) > 0 {
+		svc, _ := env.GetService(host.Name(gwSvcName))
+		if svc != nil {
+			return svc.Attributes.ClusterExternalAddresses[registryName]
+		}
+	}
+
+	return nil
+}
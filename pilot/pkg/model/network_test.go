@@ -0,0 +1,76 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"testing"
+
+	meshconfig "istio.io/api/mesh/v1alpha1"
+)
+
+func TestIsNetworkGatewayService(t *testing.T) {
+	meshNetworks := &meshconfig.MeshNetworks{
+		Networks: map[string]*meshconfig.Network{
+			"network1": {
+				Gateways: []*meshconfig.Network_IstioNetworkGateway{{
+					Gw: &meshconfig.Network_IstioNetworkGateway_RegistryServiceName{
+						RegistryServiceName: "istio-ingressgateway.istio-system.svc.cluster.local",
+					},
+					Port: 443,
+				}},
+			},
+			"network2": {
+				Gateways: []*meshconfig.Network_IstioNetworkGateway{{
+					Gw:   &meshconfig.Network_IstioNetworkGateway_Address{Address: "1.1.1.1"},
+					Port: 443,
+				}},
+			},
+		},
+	}
+
+	cases := []struct {
+		name         string
+		meshNetworks *meshconfig.MeshNetworks
+		hostname     string
+		want         bool
+	}{
+		{
+			name:     "no mesh networks",
+			hostname: "istio-ingressgateway.istio-system.svc.cluster.local",
+		},
+		{
+			name:         "gateway service",
+			meshNetworks: meshNetworks,
+			hostname:     "istio-ingressgateway.istio-system.svc.cluster.local",
+			want:         true,
+		},
+		{
+			name:         "other service",
+			meshNetworks: meshNetworks,
+			hostname:     "productpage.default.svc.cluster.local",
+		},
+		{
+			name:         "empty hostname",
+			meshNetworks: meshNetworks,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := IsNetworkGatewayService(c.meshNetworks, c.hostname); got != c.want {
+				t.Errorf("IsNetworkGatewayService(%q) = %v, want %v", c.hostname, got, c.want)
+			}
+		})
+	}
+}
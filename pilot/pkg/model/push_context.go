@@ -87,6 +87,8 @@ type PushContext struct {
 	// gateways for each namespace
 	gatewaysByNamespace map[string][]Config
 	allGateways         []Config
+	// gateways of each network of the mesh networks
+	networkGateways map[string][]*Gateway
 	////////// END ////////
 
 	// The following data is either a global index or used in the inbound path.
@@ -181,6 +183,11 @@ type PushRequest struct {
 	// Applicable only when Full is set to true.
 	ConfigTypesUpdated map[string]struct{}
 
+	// ConfigsUpdated contains the keys of the configs that have changed. If it is empty, the configs
+	// are not known, and all the configs of ConfigTypesUpdated are considered updated.
+	// Applicable only when Full is set to true.
+	ConfigsUpdated map[ConfigKey]struct{}
+
 	// EdsUpdates keeps track of all service updated since last full push.
 	// Key is the hostname (serviceName).
 	// This is used by incremental eds.
@@ -195,6 +202,17 @@ type PushRequest struct {
 	Start time.Time
 }
 
+// ConfigKey identifies a config by its type, name and namespace.
+type ConfigKey struct {
+	Type      string
+	Name      string
+	Namespace string
+}
+
+func (key ConfigKey) String() string {
+	return key.Type + "/" + key.Namespace + "/" + key.Name
+}
+
 // Merge two update requests together
 func (first *PushRequest) Merge(other *PushRequest) *PushRequest {
 	if first == nil {
@@ -229,6 +247,23 @@ func (first *PushRequest) Merge(other *PushRequest) *PushRequest {
 		merged.EdsUpdates = nil
 	}
 
+	// Merge the updated configs. Only full pushes update configs, and the updated configs are unknown
+	// if they are unknown for one of the full pushes.
+	switch {
+	case !first.Full:
+		merged.ConfigsUpdated = other.ConfigsUpdated
+	case !other.Full:
+		merged.ConfigsUpdated = first.ConfigsUpdated
+	case len(first.ConfigsUpdated) > 0 && len(other.ConfigsUpdated) > 0:
+		merged.ConfigsUpdated = make(map[ConfigKey]struct{})
+		for key := range first.ConfigsUpdated {
+			merged.ConfigsUpdated[key] = struct{}{}
+		}
+		for key := range other.ConfigsUpdated {
+			merged.ConfigsUpdated[key] = struct{}{}
+		}
+	}
+
 	if !features.ScopePushes.Get() {
 		// If push scoping is not enabled, we do not care about target namespaces
 		return merged
@@ -758,6 +793,8 @@ func (ps *PushContext) createNewContext(env *Environment) error {
 		return err
 	}
 
+	ps.initMeshNetworks(env)
+
 	// Must be initialized in the end
 	if err := ps.initSidecarScopes(env); err != nil {
 		return err
@@ -861,6 +898,9 @@ func (ps *PushContext) updateContext(
 		ps.allGateways = oldPushContext.allGateways
 	}
 
+	// The gateways of the networks depend on the instances of their services, whose updates require a full push.
+	ps.initMeshNetworks(env)
+
 	// Must be initialized in the end
 	// Sidecars need to be updated if services, virtual services, destination rules, or the sidecar configs change
 	if servicesChanged || virtualServicesChanged || destinationRulesChanged || sidecarsChanged {
@@ -1075,7 +1115,21 @@ func (ps *PushContext) initVirtualServices(env *Environment) error {
 		}
 	}
 
+	// delegate virtual services are only used through the root virtual services delegating to them.
+	delegates := make(map[string]Config)
+	roots := make([]Config, 0, len(vservices))
 	for _, virtualService := range vservices {
+		if IsDelegate(virtualService) {
+			delegates[delegateKey(virtualService.Namespace, virtualService.Name)] = virtualService
+		} else {
+			roots = append(roots, virtualService)
+		}
+	}
+	for i := range roots {
+		mergeDelegates(&roots[i], delegates)
+	}
+
+	for _, virtualService := range roots {
 		ns := virtualService.Namespace
 		rule := virtualService.Spec.(*networking.VirtualService)
 		if len(rule.ExportTo) == 0 {
@@ -117,6 +117,24 @@ func TestMergeUpdateRequest(t *testing.T) {
 			&PushRequest{Full: true, ConfigTypesUpdated: map[string]struct{}{"cfg2": {}}},
 			PushRequest{Full: true, ConfigTypesUpdated: nil},
 		},
+		{
+			"config merge",
+			&PushRequest{Full: true, ConfigsUpdated: map[ConfigKey]struct{}{{Type: "cfg1", Name: "a"}: {}}},
+			&PushRequest{Full: true, ConfigsUpdated: map[ConfigKey]struct{}{{Type: "cfg2", Name: "b"}: {}}},
+			PushRequest{Full: true, ConfigsUpdated: map[ConfigKey]struct{}{{Type: "cfg1", Name: "a"}: {}, {Type: "cfg2", Name: "b"}: {}}},
+		},
+		{
+			"config merge: incremental push",
+			&PushRequest{Full: true, ConfigsUpdated: map[ConfigKey]struct{}{{Type: "cfg1", Name: "a"}: {}}},
+			&PushRequest{Full: false, EdsUpdates: map[string]struct{}{"svc-2": {}}},
+			PushRequest{Full: true, ConfigsUpdated: map[ConfigKey]struct{}{{Type: "cfg1", Name: "a"}: {}}},
+		},
+		{
+			"skip config merge: one empty",
+			&PushRequest{Full: true, ConfigsUpdated: nil},
+			&PushRequest{Full: true, ConfigsUpdated: map[ConfigKey]struct{}{{Type: "cfg2", Name: "b"}: {}}},
+			PushRequest{Full: true, ConfigsUpdated: nil},
+		},
 	}
 
 	for _, tt := range cases {
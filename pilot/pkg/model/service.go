@@ -345,6 +345,10 @@ type IstioEndpoint struct {
 	// Attributes contains additional attributes associated with the service
 	// used mostly by mixer and RBAC for policy enforcement purposes.
 	Attributes ServiceAttributes
+
+	// Unhealthy is set for endpoints which are not ready to receive traffic. They are not sent to the
+	// proxies, but count in the health of their locality.
+	Unhealthy bool
 }
 
 // ServiceAttributes represents a group of custom attributes of the service.
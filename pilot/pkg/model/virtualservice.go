@@ -0,0 +1,344 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/hashicorp/go-multierror"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pkg/config/labels"
+)
+
+const (
+	// DelegateAnnotation marks a virtual service as a delegate, whose HTTP routes are only used by the root
+	// virtual services delegating to it. Its value is the comma-separated list of the namespaces of the
+	// root virtual services allowed to delegate to it, or "*" for all the namespaces.
+	DelegateAnnotation = "networking.istio.io/delegate"
+
+	// DelegateRouteAnnotationPrefix is the prefix of the annotations of a root virtual service delegating the
+	// HTTP route named after the prefix to the delegate virtual service in the value, "<namespace>/<name>" or
+	// "<name>" in the namespace of the root. The route of the root virtual service is used as is when the
+	// delegation is invalid.
+	DelegateRouteAnnotationPrefix = DelegateAnnotation + "."
+)
+
+// IsDelegate returns whether the virtual service is a delegate.
+func IsDelegate(vs Config) bool {
+	_, ok := vs.Annotations[DelegateAnnotation]
+	return ok
+}
+
+// ValidateDelegateAnnotations validates the delegation annotations of a virtual service: the namespaces
+// allowed to delegate to a delegate, and the delegate of each delegating route, which must be an HTTP route
+// of the virtual service.
+func ValidateDelegateAnnotations(vs Config) error {
+	rule, ok := vs.Spec.(*networking.VirtualService)
+	if !ok {
+		return fmt.Errorf("cannot cast to virtual service")
+	}
+
+	var errs error
+	if value, ok := vs.Annotations[DelegateAnnotation]; ok && value != "" {
+		for _, ns := range strings.Split(value, ",") {
+			if ns = strings.TrimSpace(ns); ns != "*" && !labels.IsDNS1123Label(ns) {
+				errs = multierror.Append(errs, fmt.Errorf("%s: invalid namespace %q", DelegateAnnotation, ns))
+			}
+		}
+	}
+
+	routes := make(map[string]bool, len(rule.Http))
+	for _, route := range rule.Http {
+		routes[route.Name] = true
+	}
+	for key, target := range vs.Annotations {
+		if !strings.HasPrefix(key, DelegateRouteAnnotationPrefix) {
+			continue
+		}
+		route := strings.TrimPrefix(key, DelegateRouteAnnotationPrefix)
+		if route == "" || !routes[route] {
+			errs = multierror.Append(errs, fmt.Errorf("%s: no HTTP route named %q", key, route))
+		}
+		namespace, name := vs.Namespace, target
+		if parts := strings.SplitN(target, "/", 2); len(parts) == 2 {
+			namespace, name = parts[0], parts[1]
+			if !labels.IsDNS1123Label(namespace) {
+				errs = multierror.Append(errs, fmt.Errorf("%s: invalid namespace in %q", key, target))
+			}
+		}
+		if !isDNS1123Subdomain(name) {
+			errs = multierror.Append(errs, fmt.Errorf("%s: invalid virtual service name in %q", key, target))
+		} else if namespace == vs.Namespace && name == vs.Name {
+			errs = multierror.Append(errs, fmt.Errorf("%s: a virtual service cannot delegate to itself", key))
+		}
+	}
+	return errs
+}
+
+// isDNS1123Subdomain returns whether the name is a valid Kubernetes resource name.
+func isDNS1123Subdomain(name string) bool {
+	if name == "" || len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if !labels.IsDNS1123Label(label) {
+			return false
+		}
+	}
+	return true
+}
+
+// delegateKey is the namespace/name key of delegate virtual services.
+func delegateKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// delegateAllows returns whether the delegate virtual service can be delegated to from the namespace.
+func delegateAllows(delegate Config, namespace string) bool {
+	if delegate.Namespace == namespace {
+		return true
+	}
+	for _, ns := range strings.Split(delegate.Annotations[DelegateAnnotation], ",") {
+		if ns = strings.TrimSpace(ns); ns == "*" || ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeDelegates replaces the delegating HTTP routes of the root virtual service by the routes of their
+// delegates, resolved recursively.
+//
+// The routes of a delegate take the place of the delegating route, in their order. Each of their matches is
+// merged with each match of the delegating route, and must be narrower: a delegated URI must start with the
+// delegating URI prefix, and the conditions on the same attribute must agree. Delegated matches conflicting
+// with the delegating route are dropped, and the gateways of the delegating route always apply. The timeout,
+// retries, fault injection, CORS policy, headers and mirror of the delegating route are inherited by the
+// delegated routes which do not set them.
+func mergeDelegates(root *Config, delegates map[string]Config) {
+	rule := root.Spec.(*networking.VirtualService)
+	rule.Http = resolveDelegates(*root, rule.Http, delegates, map[string]bool{delegateKey(root.Namespace, root.Name): true})
+}
+
+func resolveDelegates(vs Config, routes []*networking.HTTPRoute, delegates map[string]Config,
+	visited map[string]bool) []*networking.HTTPRoute {
+	out := make([]*networking.HTTPRoute, 0, len(routes))
+	for _, route := range routes {
+		target, ok := vs.Annotations[DelegateRouteAnnotationPrefix+route.Name]
+		if route.Name == "" || !ok {
+			out = append(out, route)
+			continue
+		}
+
+		delegated, err := delegateRoutes(vs, route, target, delegates, visited)
+		if err != nil {
+			log.Warnf("virtual service %s/%s: cannot delegate route %s to %s: %v",
+				vs.Namespace, vs.Name, route.Name, target, err)
+			out = append(out, route)
+			continue
+		}
+		out = append(out, delegated...)
+	}
+	return out
+}
+
+func delegateRoutes(vs Config, route *networking.HTTPRoute, target string, delegates map[string]Config,
+	visited map[string]bool) ([]*networking.HTTPRoute, error) {
+	namespace, name := vs.Namespace, target
+	if parts := strings.SplitN(target, "/", 2); len(parts) == 2 {
+		namespace, name = parts[0], parts[1]
+	}
+	key := delegateKey(namespace, name)
+	if visited[key] {
+		return nil, fmt.Errorf("delegation cycle through %s", key)
+	}
+	delegate, ok := delegates[key]
+	if !ok {
+		return nil, fmt.Errorf("no delegate virtual service %s", key)
+	}
+	if !delegateAllows(delegate, vs.Namespace) {
+		return nil, fmt.Errorf("delegate virtual service %s does not allow namespace %s", key, vs.Namespace)
+	}
+
+	visited[key] = true
+	defer delete(visited, key)
+	delegateRule := delegate.Spec.(*networking.VirtualService)
+	resolved := resolveDelegates(delegate, delegateRule.Http, delegates, visited)
+
+	out := make([]*networking.HTTPRoute, 0, len(resolved))
+	for _, r := range resolved {
+		if merged := mergeHTTPRoute(route, r); merged != nil {
+			out = append(out, merged)
+		} else {
+			log.Warnf("virtual service %s: route %s conflicts with the match of route %s of %s/%s, ignoring it",
+				key, r.Name, route.Name, vs.Namespace, vs.Name)
+		}
+	}
+	return out, nil
+}
+
+// mergeHTTPRoute returns a copy of the delegated route narrowed to the matches of the delegating route,
+// or nil if none of its matches agree with them.
+func mergeHTTPRoute(root, delegated *networking.HTTPRoute) *networking.HTTPRoute {
+	out := proto.Clone(delegated).(*networking.HTTPRoute)
+	if len(root.Match) > 0 {
+		delegatedMatches := delegated.Match
+		if len(delegatedMatches) == 0 {
+			delegatedMatches = []*networking.HTTPMatchRequest{{}}
+		}
+		out.Match = nil
+		for _, rm := range root.Match {
+			for _, dm := range delegatedMatches {
+				if m := mergeHTTPMatch(rm, dm); m != nil {
+					out.Match = append(out.Match, m)
+				}
+			}
+		}
+		if len(out.Match) == 0 {
+			return nil
+		}
+	}
+
+	if out.Name == "" {
+		out.Name = root.Name
+	}
+	if out.Timeout == nil {
+		out.Timeout = root.Timeout
+	}
+	if out.Retries == nil {
+		out.Retries = root.Retries
+	}
+	if out.Fault == nil && out.Redirect == nil {
+		out.Fault = root.Fault
+	}
+	if out.CorsPolicy == nil {
+		out.CorsPolicy = root.CorsPolicy
+	}
+	if out.Headers == nil {
+		out.Headers = root.Headers
+	}
+	if out.Mirror == nil && out.Redirect == nil {
+		out.Mirror = root.Mirror
+		out.MirrorPercent = root.MirrorPercent
+	}
+	return out
+}
+
+// mergeHTTPMatch returns the match of both the delegating and the delegated matches, or nil if they conflict.
+func mergeHTTPMatch(root, delegated *networking.HTTPMatchRequest) *networking.HTTPMatchRequest {
+	out := proto.Clone(delegated).(*networking.HTTPMatchRequest)
+	if out.Name == "" {
+		out.Name = root.Name
+	}
+
+	uri, ok := mergeURIMatch(root.Uri, delegated.Uri)
+	if !ok {
+		return nil
+	}
+	out.Uri = uri
+	for _, m := range []struct {
+		root *networking.StringMatch
+		out  **networking.StringMatch
+	}{
+		{root.Scheme, &out.Scheme},
+		{root.Method, &out.Method},
+		{root.Authority, &out.Authority},
+	} {
+		if *m.out == nil {
+			*m.out = m.root
+		} else if m.root != nil && !proto.Equal(m.root, *m.out) {
+			return nil
+		}
+	}
+
+	if out.Port == 0 {
+		out.Port = root.Port
+	} else if root.Port != 0 && root.Port != out.Port {
+		return nil
+	}
+
+	var ok1, ok2, ok3 bool
+	out.Headers, ok1 = mergeStringMatches(root.Headers, out.Headers)
+	out.QueryParams, ok2 = mergeStringMatches(root.QueryParams, out.QueryParams)
+	out.SourceLabels, ok3 = mergeLabels(root.SourceLabels, out.SourceLabels)
+	if !ok1 || !ok2 || !ok3 {
+		return nil
+	}
+
+	// The delegating virtual service decides where the routes are bound.
+	out.Gateways = root.Gateways
+	return out
+}
+
+// mergeURIMatch returns the delegated URI match if it is narrower than the delegating one.
+func mergeURIMatch(root, delegated *networking.StringMatch) (*networking.StringMatch, bool) {
+	if root == nil {
+		return delegated, true
+	}
+	if delegated == nil || proto.Equal(root, delegated) {
+		return root, true
+	}
+
+	prefix := root.GetPrefix()
+	if prefix == "" {
+		// Only prefixes can be narrowed.
+		return nil, false
+	}
+	switch d := delegated.MatchType.(type) {
+	case *networking.StringMatch_Prefix:
+		return delegated, strings.HasPrefix(d.Prefix, prefix)
+	case *networking.StringMatch_Exact:
+		return delegated, strings.HasPrefix(d.Exact, prefix)
+	}
+	return nil, false
+}
+
+func mergeStringMatches(root, delegated map[string]*networking.StringMatch) (map[string]*networking.StringMatch, bool) {
+	if len(root) == 0 {
+		return delegated, true
+	}
+	out := make(map[string]*networking.StringMatch, len(root)+len(delegated))
+	for k, v := range delegated {
+		out[k] = v
+	}
+	for k, v := range root {
+		if d, ok := out[k]; ok && !proto.Equal(d, v) {
+			return nil, false
+		}
+		out[k] = v
+	}
+	return out, true
+}
+
+func mergeLabels(root, delegated map[string]string) (map[string]string, bool) {
+	if len(root) == 0 {
+		return delegated, true
+	}
+	out := make(map[string]string, len(root)+len(delegated))
+	for k, v := range delegated {
+		out[k] = v
+	}
+	for k, v := range root {
+		if d, ok := out[k]; ok && d != v {
+			return nil, false
+		}
+		out[k] = v
+	}
+	return out, true
+}
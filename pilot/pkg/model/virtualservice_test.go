@@ -0,0 +1,282 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gogo/protobuf/types"
+
+	meshconfig "istio.io/api/mesh/v1alpha1"
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pkg/config/schemas"
+)
+
+func prefixMatch(p string) *networking.StringMatch {
+	return &networking.StringMatch{MatchType: &networking.StringMatch_Prefix{Prefix: p}}
+}
+
+func exactMatch(e string) *networking.StringMatch {
+	return &networking.StringMatch{MatchType: &networking.StringMatch_Exact{Exact: e}}
+}
+
+func routeDestination(h string) []*networking.HTTPRouteDestination {
+	return []*networking.HTTPRouteDestination{{Destination: &networking.Destination{Host: h}}}
+}
+
+func newTestVirtualService(namespace, name string, annotations map[string]string, routes ...*networking.HTTPRoute) Config {
+	return Config{
+		ConfigMeta: ConfigMeta{
+			Type:        schemas.VirtualService.Type,
+			Group:       schemas.VirtualService.Group,
+			Version:     schemas.VirtualService.Version,
+			Name:        name,
+			Namespace:   namespace,
+			Annotations: annotations,
+		},
+		Spec: &networking.VirtualService{
+			Hosts:    []string{"api.example.com"},
+			Gateways: []string{"istio-system/api"},
+			Http:     routes,
+		},
+	}
+}
+
+func TestMergeDelegates(t *testing.T) {
+	timeout := types.DurationProto(0)
+	rootRoutes := func() []*networking.HTTPRoute {
+		return []*networking.HTTPRoute{
+			{
+				Name:    "orders",
+				Match:   []*networking.HTTPMatchRequest{{Uri: prefixMatch("/orders/"), Gateways: []string{"istio-system/api"}}},
+				Route:   routeDestination("fallback.istio-system.svc.cluster.local"),
+				Timeout: timeout,
+			},
+			{
+				Name:  "default",
+				Route: routeDestination("web.istio-system.svc.cluster.local"),
+			},
+		}
+	}
+	orders := newTestVirtualService("orders", "orders", map[string]string{DelegateAnnotation: "istio-system"},
+		&networking.HTTPRoute{
+			Name:  "v2",
+			Match: []*networking.HTTPMatchRequest{{Uri: prefixMatch("/orders/v2/")}, {Uri: prefixMatch("/payments/")}},
+			Route: routeDestination("orders-v2.orders.svc.cluster.local"),
+		},
+		&networking.HTTPRoute{
+			Match: []*networking.HTTPMatchRequest{{Uri: exactMatch("/catalog")}},
+			Route: routeDestination("catalog.orders.svc.cluster.local"),
+		},
+		&networking.HTTPRoute{
+			Route: routeDestination("orders.orders.svc.cluster.local"),
+		},
+	)
+
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		delegates   []Config
+		expected    []*networking.HTTPRoute
+	}{
+		{
+			name:      "no delegation",
+			delegates: []Config{orders},
+			expected:  rootRoutes(),
+		},
+		{
+			name:        "delegation",
+			annotations: map[string]string{DelegateRouteAnnotationPrefix + "orders": "orders/orders"},
+			delegates:   []Config{orders},
+			expected: []*networking.HTTPRoute{
+				{
+					Name:    "v2",
+					Match:   []*networking.HTTPMatchRequest{{Uri: prefixMatch("/orders/v2/"), Gateways: []string{"istio-system/api"}}},
+					Route:   routeDestination("orders-v2.orders.svc.cluster.local"),
+					Timeout: timeout,
+				},
+				{
+					Name:    "orders",
+					Match:   []*networking.HTTPMatchRequest{{Uri: prefixMatch("/orders/"), Gateways: []string{"istio-system/api"}}},
+					Route:   routeDestination("orders.orders.svc.cluster.local"),
+					Timeout: timeout,
+				},
+				rootRoutes()[1],
+			},
+		},
+		{
+			name:        "missing delegate",
+			annotations: map[string]string{DelegateRouteAnnotationPrefix + "orders": "orders/missing"},
+			delegates:   []Config{orders},
+			expected:    rootRoutes(),
+		},
+		{
+			name:        "namespace not allowed",
+			annotations: map[string]string{DelegateRouteAnnotationPrefix + "orders": "orders/orders"},
+			delegates: []Config{newTestVirtualService("orders", "orders", map[string]string{DelegateAnnotation: "gateways"},
+				orders.Spec.(*networking.VirtualService).Http...)},
+			expected: rootRoutes(),
+		},
+		{
+			name:        "cycle",
+			annotations: map[string]string{DelegateRouteAnnotationPrefix + "orders": "orders/a"},
+			delegates: []Config{
+				newTestVirtualService("orders", "a", map[string]string{
+					DelegateAnnotation:                       "*",
+					DelegateRouteAnnotationPrefix + "nested": "b",
+				}, &networking.HTTPRoute{Name: "nested", Route: routeDestination("a.orders.svc.cluster.local")}),
+				newTestVirtualService("orders", "b", map[string]string{
+					DelegateAnnotation:                       "*",
+					DelegateRouteAnnotationPrefix + "nested": "a",
+				}, &networking.HTTPRoute{Name: "nested", Route: routeDestination("b.orders.svc.cluster.local")}),
+			},
+			expected: []*networking.HTTPRoute{
+				{
+					Name:    "nested",
+					Match:   []*networking.HTTPMatchRequest{{Uri: prefixMatch("/orders/"), Gateways: []string{"istio-system/api"}}},
+					Route:   routeDestination("b.orders.svc.cluster.local"),
+					Timeout: timeout,
+				},
+				rootRoutes()[1],
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			delegates := make(map[string]Config)
+			for _, d := range tc.delegates {
+				delegates[delegateKey(d.Namespace, d.Name)] = d.DeepCopy()
+			}
+			root := newTestVirtualService("istio-system", "api", tc.annotations, rootRoutes()...)
+			mergeDelegates(&root, delegates)
+			if got := root.Spec.(*networking.VirtualService).Http; !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("got routes %v, want %v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestValidateDelegateAnnotations(t *testing.T) {
+	api := &networking.HTTPRoute{Name: "api", Route: routeDestination("api.default.svc.cluster.local")}
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		valid       bool
+	}{
+		{name: "no annotation", valid: true},
+		{name: "delegate", annotations: map[string]string{DelegateAnnotation: "team-a, team-b"}, valid: true},
+		{name: "delegate to all namespaces", annotations: map[string]string{DelegateAnnotation: "*"}, valid: true},
+		{name: "delegate to its namespace", annotations: map[string]string{DelegateAnnotation: ""}, valid: true},
+		{name: "invalid namespace", annotations: map[string]string{DelegateAnnotation: "team_a"}},
+		{name: "delegating route", annotations: map[string]string{DelegateRouteAnnotationPrefix + "api": "team-a/api"}, valid: true},
+		{name: "delegating route in namespace", annotations: map[string]string{DelegateRouteAnnotationPrefix + "api": "api-v2"}, valid: true},
+		{name: "unknown route", annotations: map[string]string{DelegateRouteAnnotationPrefix + "web": "team-a/web"}},
+		{name: "no route name", annotations: map[string]string{DelegateRouteAnnotationPrefix: "team-a/web"}},
+		{name: "invalid target namespace", annotations: map[string]string{DelegateRouteAnnotationPrefix + "api": "Team/api"}},
+		{name: "no target", annotations: map[string]string{DelegateRouteAnnotationPrefix + "api": ""}},
+		{name: "self", annotations: map[string]string{DelegateRouteAnnotationPrefix + "api": "default/root"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := ValidateDelegateAnnotations(newTestVirtualService("default", "root", c.annotations, api))
+			if c.valid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !c.valid && err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestMergeHTTPMatch(t *testing.T) {
+	cases := []struct {
+		name      string
+		root      *networking.HTTPMatchRequest
+		delegated *networking.HTTPMatchRequest
+		expected  *networking.HTTPMatchRequest
+	}{
+		{
+			name:      "headers",
+			root:      &networking.HTTPMatchRequest{Headers: map[string]*networking.StringMatch{"x-team": exactMatch("orders")}},
+			delegated: &networking.HTTPMatchRequest{Headers: map[string]*networking.StringMatch{"x-version": exactMatch("v2")}},
+			expected: &networking.HTTPMatchRequest{Headers: map[string]*networking.StringMatch{
+				"x-team":    exactMatch("orders"),
+				"x-version": exactMatch("v2"),
+			}},
+		},
+		{
+			name:      "conflicting headers",
+			root:      &networking.HTTPMatchRequest{Headers: map[string]*networking.StringMatch{"x-team": exactMatch("orders")}},
+			delegated: &networking.HTTPMatchRequest{Headers: map[string]*networking.StringMatch{"x-team": exactMatch("payments")}},
+		},
+		{
+			name:      "exact root uri",
+			root:      &networking.HTTPMatchRequest{Uri: exactMatch("/orders")},
+			delegated: &networking.HTTPMatchRequest{Uri: prefixMatch("/orders")},
+		},
+		{
+			name:      "conflicting methods",
+			root:      &networking.HTTPMatchRequest{Method: exactMatch("GET")},
+			delegated: &networking.HTTPMatchRequest{Method: exactMatch("POST")},
+		},
+		{
+			name:      "ports",
+			root:      &networking.HTTPMatchRequest{Port: 80},
+			delegated: &networking.HTTPMatchRequest{Method: exactMatch("POST")},
+			expected:  &networking.HTTPMatchRequest{Port: 80, Method: exactMatch("POST")},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := mergeHTTPMatch(tc.root, tc.delegated); !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("got %v, want %v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestInitVirtualServicesWithDelegates(t *testing.T) {
+	ps := NewPushContext()
+	env := &Environment{Mesh: &meshconfig.MeshConfig{}}
+	ps.Env = env
+	ps.initDefaultExportMaps()
+
+	configStore := newFakeStore()
+	_, _ = configStore.Create(newTestVirtualService("istio-system", "api",
+		map[string]string{DelegateRouteAnnotationPrefix + "orders": "orders/orders"},
+		&networking.HTTPRoute{Name: "orders", Match: []*networking.HTTPMatchRequest{{Uri: prefixMatch("/orders/")}},
+			Route: routeDestination("fallback")}))
+	_, _ = configStore.Create(newTestVirtualService("orders", "orders", map[string]string{DelegateAnnotation: "*"},
+		&networking.HTTPRoute{Route: routeDestination("orders")}))
+	env.IstioConfigStore = &istioConfigStore{ConfigStore: configStore}
+
+	if err := ps.initVirtualServices(env); err != nil {
+		t.Fatal(err)
+	}
+	vs := ps.VirtualServices(nil, map[string]bool{"istio-system/api": true})
+	if len(vs) != 1 || vs[0].Name != "api" {
+		t.Fatalf("got virtual services %v, want the root virtual service only", vs)
+	}
+	routes := vs[0].Spec.(*networking.VirtualService).Http
+	if len(routes) != 1 || routes[0].Route[0].Destination.Host != "orders.orders" {
+		t.Errorf("got routes %v, want the delegated route", routes)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha3
+
+import (
+	"fmt"
+	"strings"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+// destinationRuleAnnotations are the validators of the values of the destination rule annotations read by the
+// cluster builder, keyed by annotation.
+var destinationRuleAnnotations = map[string]func(value string) error{
+	healthCheckAnnotation: validateHealthCheckAnnotation,
+	consistentHashAnnotation: func(value string) error {
+		_, err := parseConsistentHashSettings(value)
+		return err
+	},
+	retryBudgetAnnotation: func(value string) error {
+		_, err := parseRetryBudgetSettings(value)
+		return err
+	},
+}
+
+// getSubsetAnnotation returns the value of the annotation of the destination rule for the subset. The
+// annotation suffixed with ".<subset name>" overrides the annotation of the host for the subset.
+func getSubsetAnnotation(destRule *model.Config, annotation, subset string) (string, bool) {
+	if destRule == nil {
+		return "", false
+	}
+	if subset != "" {
+		if value, f := destRule.Annotations[annotation+"."+subset]; f {
+			return value, true
+		}
+	}
+	value, f := destRule.Annotations[annotation]
+	return value, f
+}
+
+// ValidateDestinationRuleAnnotations validates the annotations of the destination rule configuring its clusters,
+// including the ones of its subsets.
+func ValidateDestinationRuleAnnotations(destRule *model.Config) error {
+	for key, value := range destRule.Annotations {
+		for annotation, validate := range destinationRuleAnnotations {
+			if key != annotation && !strings.HasPrefix(key, annotation+".") {
+				continue
+			}
+			if err := validate(value); err != nil {
+				return fmt.Errorf("invalid %s annotation: %v", key, err)
+			}
+		}
+	}
+	return nil
+}
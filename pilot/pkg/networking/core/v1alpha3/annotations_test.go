@@ -0,0 +1,102 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha3
+
+import (
+	"testing"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+func TestGetSubsetAnnotation(t *testing.T) {
+	destRule := &model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Annotations: map[string]string{
+				retryBudgetAnnotation:         "host",
+				retryBudgetAnnotation + ".v2": "v2",
+			},
+		},
+	}
+	cases := []struct {
+		name     string
+		destRule *model.Config
+		subset   string
+		expected string
+		found    bool
+	}{
+		{name: "no destination rule", subset: "v2"},
+		{name: "host", destRule: destRule, expected: "host", found: true},
+		{name: "subset", destRule: destRule, subset: "v2", expected: "v2", found: true},
+		{name: "subset without annotation", destRule: destRule, subset: "v1", expected: "host", found: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			value, found := getSubsetAnnotation(c.destRule, retryBudgetAnnotation, c.subset)
+			if value != c.expected || found != c.found {
+				t.Errorf("got %q, %v, want %q, %v", value, found, c.expected, c.found)
+			}
+		})
+	}
+}
+
+func TestValidateDestinationRuleAnnotations(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		valid       bool
+	}{
+		{
+			name:  "no annotation",
+			valid: true,
+		},
+		{
+			name: "valid annotations",
+			annotations: map[string]string{
+				healthCheckAnnotation:         `{"type": "HTTP", "interval": "5s", "expectedStatuses": ["200-299"]}`,
+				retryBudgetAnnotation + ".v1": `{"budgetPercent": 20}`,
+				"unrelated":                   `not json`,
+			},
+			valid: true,
+		},
+		{
+			name:        "invalid health check",
+			annotations: map[string]string{healthCheckAnnotation: `{"interval": "-5s"}`},
+		},
+		{
+			name:        "invalid health check type",
+			annotations: map[string]string{healthCheckAnnotation + ".v1": `{"type": "UDP"}`},
+		},
+		{
+			name:        "invalid retry budget of a subset",
+			annotations: map[string]string{retryBudgetAnnotation + ".v1": `{"budgetPercent": 120}`},
+		},
+		{
+			name:        "invalid consistent hash",
+			annotations: map[string]string{consistentHashAnnotation: `{"algorithm": "MAGLEV", "minimumRingSize": 10}`},
+		},
+		{
+			name:        "not json",
+			annotations: map[string]string{retryBudgetAnnotation: `20`},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := ValidateDestinationRuleAnnotations(&model.Config{ConfigMeta: model.ConfigMeta{Annotations: c.annotations}})
+			if (err == nil) != c.valid {
+				t.Errorf("got error %v, want valid %v", err, c.valid)
+			}
+		})
+	}
+}
@@ -105,6 +105,7 @@ func (configgen *ConfigGeneratorImpl) BuildClusters(env *model.Environment, prox
 		// Add a blackhole and passthrough cluster for catching traffic to unresolved routes
 		// DO NOT CALL PLUGINS for these two clusters.
 		outboundClusters = append(outboundClusters, buildBlackHoleCluster(env), buildDefaultPassthroughCluster(env, proxy))
+		outboundClusters = append(outboundClusters, configgen.buildPluginServiceClusters(env, proxy, push)...)
 		// apply load balancer setting for cluster endpoints
 		applyLocalityLBSetting(proxy.Locality, outboundClusters, env.Mesh.LocalityLbSetting)
 		outboundClusters = envoyfilter.ApplyClusterPatches(networking.EnvoyFilter_SIDECAR_OUTBOUND, proxy, push, outboundClusters)
@@ -124,6 +125,7 @@ func (configgen *ConfigGeneratorImpl) BuildClusters(env *model.Environment, prox
 	default: // Gateways
 		// Gateways do not require the default passthrough cluster as they do not have original dst listeners.
 		outboundClusters = append(outboundClusters, buildBlackHoleCluster(env))
+		outboundClusters = append(outboundClusters, configgen.buildPluginServiceClusters(env, proxy, push)...)
 		if proxy.Type == model.Router && proxy.GetRouterMode() == model.SniDnatRouter {
 			outboundClusters = append(outboundClusters, configgen.buildOutboundSniDnatClusters(env, proxy, push)...)
 		}
@@ -138,6 +140,24 @@ func (configgen *ConfigGeneratorImpl) BuildClusters(env *model.Environment, prox
 	return clusters
 }
 
+// buildPluginServiceClusters returns the clusters of the services called by the filters of the plugins, e.g. the
+// external authorization service. They do not depend on the services visible to the proxy.
+func (configgen *ConfigGeneratorImpl) buildPluginServiceClusters(env *model.Environment, proxy *model.Proxy,
+	push *model.PushContext) []*apiv2.Cluster {
+	var clusters []*apiv2.Cluster
+	in := &plugin.InputParams{
+		Env:  env,
+		Node: proxy,
+		Push: push,
+	}
+	for _, p := range configgen.Plugins {
+		if cp, ok := p.(plugin.ClusterPlugin); ok {
+			clusters = append(clusters, cp.OnServiceClusters(in)...)
+		}
+	}
+	return clusters
+}
+
 // resolves cluster name conflicts. there can be duplicate cluster names if there are conflicting service definitions.
 // for any clusters that share the same name the first cluster is kept and the others are discarded.
 func normalizeClusters(push *model.PushContext, proxy *model.Proxy, clusters []*apiv2.Cluster) []*apiv2.Cluster {
@@ -227,6 +247,10 @@ func (configgen *ConfigGeneratorImpl) buildOutboundClusters(env *model.Environme
 			}
 
 			applyTrafficPolicy(opts, proxy)
+			applyHealthCheck(defaultCluster, destRule, "", service, port)
+			applyLocalityHealthWeights(defaultCluster, destRule)
+			applyRetryBudget(defaultCluster, destRule, "")
+			applyConsistentHash(defaultCluster, destRule, "")
 			defaultCluster.Metadata = clusterMetadata
 			for _, subset := range destinationRule.Subsets {
 				subsetClusterName := model.BuildSubsetKey(model.TrafficDirectionOutbound, subset.Name, service.Hostname, port.Port)
@@ -270,6 +294,10 @@ func (configgen *ConfigGeneratorImpl) buildOutboundClusters(env *model.Environme
 					serviceMTLSMode: serviceMTLSMode,
 				}
 				applyTrafficPolicy(opts, proxy)
+				applyHealthCheck(subsetCluster, destRule, subset.Name, service, port)
+				applyLocalityHealthWeights(subsetCluster, destRule)
+				applyRetryBudget(subsetCluster, destRule, subset.Name)
+				applyConsistentHash(subsetCluster, destRule, subset.Name)
 
 				updateEds(subsetCluster)
 
@@ -1041,6 +1069,20 @@ func applyLocalityLBSetting(
 	}
 }
 
+// applyLocalityHealthWeights enables the locality weighted load balancing of the cluster if its destination
+// rule weights the localities by the health of their endpoints. The weights are set by EDS.
+func applyLocalityHealthWeights(cluster *apiv2.Cluster, destRule *model.Config) {
+	if !loadbalancer.HealthWeightsEnabled(destRule) {
+		return
+	}
+	if cluster.CommonLbConfig == nil {
+		cluster.CommonLbConfig = &apiv2.Cluster_CommonLbConfig{}
+	}
+	cluster.CommonLbConfig.LocalityConfigSpecifier = &apiv2.Cluster_CommonLbConfig_LocalityWeightedLbConfig_{
+		LocalityWeightedLbConfig: &apiv2.Cluster_CommonLbConfig_LocalityWeightedLbConfig{},
+	}
+}
+
 func applyUpstreamTLSSettings(env *model.Environment, cluster *apiv2.Cluster, tls *networking.TLSSettings, metadata *model.NodeMetadata) {
 	if tls == nil {
 		return
@@ -40,6 +40,8 @@ import (
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/core/v1alpha3/fakes"
 	"istio.io/istio/pilot/pkg/networking/plugin"
+	"istio.io/istio/pilot/pkg/networking/plugin/authz"
+	"istio.io/istio/pilot/pkg/networking/plugin/ratelimit"
 	authn_model "istio.io/istio/pilot/pkg/security/model"
 	"istio.io/istio/pilot/pkg/serviceregistry"
 	"istio.io/istio/pkg/config/constants"
@@ -1843,3 +1845,55 @@ func TestAutoMTLSClusterPerPortStrictMode(t *testing.T) {
 		g.Expect(cluster.TlsContext).To(BeNil())
 	}
 }
+
+func TestPluginServiceClustersWithRestrictiveSidecar(t *testing.T) {
+	_ = os.Setenv(features.RateLimitService.Name, "ratelimit.istio-system.svc.cluster.local:8081")
+	defer func() { _ = os.Unsetenv(features.RateLimitService.Name) }()
+
+	rateLimitService := buildServiceWithPort("ratelimit.istio-system.svc.cluster.local", 8081, protocol.GRPC, tnow)
+	rateLimitService.Attributes.Namespace = "istio-system"
+	authzService := buildServiceWithPort("authz.foo.svc.cluster.local", 9000, protocol.GRPC, tnow)
+	authzService.Attributes.Namespace = "foo"
+	env := buildListenerEnv([]*model.Service{rateLimitService, authzService})
+	if err := env.PushContext.InitContext(&env, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The Sidecar only imports the services of the namespace of the workload.
+	sidecarConfig := &model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Name:      "foo",
+			Namespace: "not-default",
+		},
+		Spec: &networking.Sidecar{
+			Egress: []*networking.IstioEgressListener{{Hosts: []string{"./*"}}},
+		},
+	}
+	p := proxy
+	meta := *proxy.Metadata
+	meta.ExtAuthzServer = "authz.foo.svc.cluster.local:9000"
+	p.Metadata = &meta
+	p.SidecarScope = model.ConvertToSidecarScope(env.PushContext, sidecarConfig, sidecarConfig.Namespace)
+
+	configgen := NewConfigGenerator([]plugin.Plugin{ratelimit.NewPlugin(), authz.NewPlugin()})
+	clusters := configgen.BuildClusters(&env, &p, env.PushContext)
+
+	names := make(map[string]bool)
+	for _, c := range clusters {
+		names[c.Name] = true
+	}
+	for _, hidden := range []string{
+		"outbound|8081||ratelimit.istio-system.svc.cluster.local",
+		"outbound|9000||authz.foo.svc.cluster.local",
+	} {
+		if names[hidden] {
+			t.Errorf("cluster %s is not hidden by the sidecar", hidden)
+		}
+	}
+	// The filters of the plugins use these clusters.
+	for _, want := range []string{ratelimit.ServiceClusterName, "ext_authz_service"} {
+		if !names[want] {
+			t.Errorf("missing cluster %s in %v", want, names)
+		}
+	}
+}
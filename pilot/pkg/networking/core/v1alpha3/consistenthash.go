@@ -0,0 +1,139 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha3
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	apiv2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/golang/protobuf/ptypes/wrappers"
+
+	"istio.io/pkg/log"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+const (
+	// consistentHashAnnotation is the annotation of a destination rule choosing between the ring hash and Maglev
+	// implementations of its consistentHash load balancer, and sizing the hash ring. It has no effect on the
+	// other load balancers.
+	consistentHashAnnotation = "networking.istio.io/consistentHash"
+
+	ringHashAlgorithm = "RING_HASH"
+	maglevAlgorithm   = "MAGLEV"
+
+	// maxRingSize is the largest ring size accepted by Envoy.
+	maxRingSize = 8 * 1024 * 1024
+)
+
+// consistentHashSettings is the JSON value of the consistent hash annotations of destination rules, e.g.
+// {"algorithm": "MAGLEV"} or {"minimumRingSize": 4096, "hashFunction": "MURMUR_HASH_2"}. The Maglev table has the
+// default size of Envoy, 65537, as the Envoy API Pilot is built with cannot configure it.
+type consistentHashSettings struct {
+	// Algorithm is RING_HASH, the default, or MAGLEV. Maglev moves fewer keys between the endpoints as they
+	// scale, and picks endpoints faster.
+	Algorithm string `json:"algorithm,omitempty"`
+	// MinimumRingSize is the minimum size of the hash ring, overriding the one of the destination rule.
+	MinimumRingSize uint64 `json:"minimumRingSize,omitempty"`
+	// MaximumRingSize is the maximum size of the hash ring, 8M by default in Envoy.
+	MaximumRingSize uint64 `json:"maximumRingSize,omitempty"`
+	// HashFunction is the hash function of the ring entries, XX_HASH by default or MURMUR_HASH_2.
+	HashFunction string `json:"hashFunction,omitempty"`
+}
+
+// getConsistentHashSettings returns the consistent hash settings of the destination rule for the subset, or nil
+// if it has none.
+func getConsistentHashSettings(destRule *model.Config, subset string) (*consistentHashSettings, error) {
+	value, ok := getSubsetAnnotation(destRule, consistentHashAnnotation, subset)
+	if !ok {
+		return nil, nil
+	}
+	return parseConsistentHashSettings(value)
+}
+
+func parseConsistentHashSettings(value string) (*consistentHashSettings, error) {
+	settings := &consistentHashSettings{}
+	decoder := json.NewDecoder(strings.NewReader(value))
+	// Reject the settings which are not supported, such as the Maglev table size, rather than ignore them.
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(settings); err != nil {
+		return nil, err
+	}
+
+	switch settings.Algorithm {
+	case "", ringHashAlgorithm:
+		if _, f := apiv2.Cluster_RingHashLbConfig_HashFunction_value[settings.HashFunction]; settings.HashFunction != "" && !f {
+			return nil, fmt.Errorf("invalid hash function %q", settings.HashFunction)
+		}
+		max := settings.MaximumRingSize
+		if max == 0 {
+			max = maxRingSize
+		}
+		if max > maxRingSize {
+			return nil, fmt.Errorf("maximum ring size %d exceeds %d", max, maxRingSize)
+		}
+		if settings.MinimumRingSize > max {
+			return nil, fmt.Errorf("minimum ring size %d exceeds maximum ring size %d", settings.MinimumRingSize, max)
+		}
+	case maglevAlgorithm:
+		if settings.MinimumRingSize != 0 || settings.MaximumRingSize != 0 || settings.HashFunction != "" {
+			return nil, fmt.Errorf("ring sizes and hash function are only supported by %s", ringHashAlgorithm)
+		}
+	default:
+		return nil, fmt.Errorf("invalid algorithm %q", settings.Algorithm)
+	}
+	return settings, nil
+}
+
+// applyConsistentHash applies the consistent hash settings of the annotations of the destination rule to the
+// ring hash load balancer of the cluster.
+func applyConsistentHash(cluster *apiv2.Cluster, destRule *model.Config, subset string) {
+	settings, err := getConsistentHashSettings(destRule, subset)
+	if err != nil {
+		log.Warnf("invalid consistent hash settings of destination rule %s.%s: %v", destRule.Name, destRule.Namespace, err)
+		return
+	}
+	if settings == nil || cluster.LbPolicy != apiv2.Cluster_RING_HASH {
+		return
+	}
+
+	if settings.Algorithm == maglevAlgorithm {
+		cluster.LbPolicy = apiv2.Cluster_MAGLEV
+		cluster.LbConfig = nil
+		return
+	}
+
+	ringHash := cluster.GetRingHashLbConfig()
+	if ringHash == nil {
+		ringHash = &apiv2.Cluster_RingHashLbConfig{}
+		cluster.LbConfig = &apiv2.Cluster_RingHashLbConfig_{RingHashLbConfig: ringHash}
+	}
+	if settings.MinimumRingSize != 0 {
+		ringHash.MinimumRingSize = &wrappers.UInt64Value{Value: settings.MinimumRingSize}
+	}
+	if settings.MaximumRingSize != 0 {
+		ringHash.MaximumRingSize = &wrappers.UInt64Value{Value: settings.MaximumRingSize}
+	}
+	// The minimum ring size of the destination rule is capped by the maximum ring size of the annotation.
+	if max := ringHash.MaximumRingSize; max != nil && ringHash.MinimumRingSize.GetValue() > max.Value {
+		ringHash.MinimumRingSize = &wrappers.UInt64Value{Value: max.Value}
+	}
+	if settings.HashFunction != "" {
+		ringHash.HashFunction = apiv2.Cluster_RingHashLbConfig_HashFunction(
+			apiv2.Cluster_RingHashLbConfig_HashFunction_value[settings.HashFunction])
+	}
+}
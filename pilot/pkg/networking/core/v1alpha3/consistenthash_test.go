@@ -0,0 +1,169 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha3
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	apiv2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/wrappers"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
+)
+
+func ringHashCluster() *apiv2.Cluster {
+	return &apiv2.Cluster{
+		LbPolicy: apiv2.Cluster_RING_HASH,
+		LbConfig: &apiv2.Cluster_RingHashLbConfig_{
+			RingHashLbConfig: &apiv2.Cluster_RingHashLbConfig{
+				MinimumRingSize: &wrappers.UInt64Value{Value: 1024},
+			},
+		},
+	}
+}
+
+func TestApplyConsistentHash(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		subset      string
+		cluster     *apiv2.Cluster
+		expected    *apiv2.Cluster
+	}{
+		{
+			name:     "no annotation",
+			cluster:  ringHashCluster(),
+			expected: ringHashCluster(),
+		},
+		{
+			name:        "maglev",
+			annotations: map[string]string{consistentHashAnnotation: `{"algorithm": "MAGLEV"}`},
+			cluster:     ringHashCluster(),
+			expected:    &apiv2.Cluster{LbPolicy: apiv2.Cluster_MAGLEV},
+		},
+		{
+			name: "subset ring sizes",
+			annotations: map[string]string{
+				consistentHashAnnotation:         `{"algorithm": "MAGLEV"}`,
+				consistentHashAnnotation + ".v1": `{"minimumRingSize": 4096, "maximumRingSize": 65536, "hashFunction": "MURMUR_HASH_2"}`,
+			},
+			subset:  "v1",
+			cluster: ringHashCluster(),
+			expected: &apiv2.Cluster{
+				LbPolicy: apiv2.Cluster_RING_HASH,
+				LbConfig: &apiv2.Cluster_RingHashLbConfig_{
+					RingHashLbConfig: &apiv2.Cluster_RingHashLbConfig{
+						MinimumRingSize: &wrappers.UInt64Value{Value: 4096},
+						MaximumRingSize: &wrappers.UInt64Value{Value: 65536},
+						HashFunction:    apiv2.Cluster_RingHashLbConfig_MURMUR_HASH_2,
+					},
+				},
+			},
+		},
+		{
+			name:        "maximum ring size below the minimum ring size of the destination rule",
+			annotations: map[string]string{consistentHashAnnotation: `{"maximumRingSize": 512}`},
+			cluster:     ringHashCluster(),
+			expected: &apiv2.Cluster{
+				LbPolicy: apiv2.Cluster_RING_HASH,
+				LbConfig: &apiv2.Cluster_RingHashLbConfig_{
+					RingHashLbConfig: &apiv2.Cluster_RingHashLbConfig{
+						MinimumRingSize: &wrappers.UInt64Value{Value: 512},
+						MaximumRingSize: &wrappers.UInt64Value{Value: 512},
+					},
+				},
+			},
+		},
+		{
+			name:        "no consistent hash load balancer",
+			annotations: map[string]string{consistentHashAnnotation: `{"algorithm": "MAGLEV"}`},
+			cluster:     &apiv2.Cluster{LbPolicy: apiv2.Cluster_ROUND_ROBIN},
+			expected:    &apiv2.Cluster{LbPolicy: apiv2.Cluster_ROUND_ROBIN},
+		},
+		{
+			name:        "table size not supported",
+			annotations: map[string]string{consistentHashAnnotation: `{"algorithm": "MAGLEV", "tableSize": 65537}`},
+			cluster:     ringHashCluster(),
+			expected:    ringHashCluster(),
+		},
+		{
+			name:        "ring sizes with maglev",
+			annotations: map[string]string{consistentHashAnnotation: `{"algorithm": "MAGLEV", "minimumRingSize": 10}`},
+			cluster:     ringHashCluster(),
+			expected:    ringHashCluster(),
+		},
+		{
+			name:        "invalid hash function",
+			annotations: map[string]string{consistentHashAnnotation: `{"hashFunction": "SHA1"}`},
+			cluster:     ringHashCluster(),
+			expected:    ringHashCluster(),
+		},
+		{
+			name:        "ring size too large",
+			annotations: map[string]string{consistentHashAnnotation: `{"maximumRingSize": 16777216}`},
+			cluster:     ringHashCluster(),
+			expected:    ringHashCluster(),
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			destRule := &model.Config{ConfigMeta: model.ConfigMeta{Name: "acme", Annotations: tt.annotations}}
+			applyConsistentHash(tt.cluster, destRule, tt.subset)
+			if !reflect.DeepEqual(tt.cluster, tt.expected) {
+				t.Errorf("got cluster %v, want %v", tt.cluster, tt.expected)
+			}
+		})
+	}
+}
+
+func TestConsistentHashClusterSerialization(t *testing.T) {
+	for _, value := range []string{
+		`{"algorithm": "MAGLEV"}`,
+		`{"minimumRingSize": 4096, "maximumRingSize": 65536, "hashFunction": "MURMUR_HASH_2"}`,
+	} {
+		t.Run(value, func(t *testing.T) {
+			cluster := ringHashCluster()
+			cluster.Name = "outbound|8080||reviews.default.svc.cluster.local"
+			cluster.ConnectTimeout = ptypes.DurationProto(time.Second)
+			destRule := &model.Config{ConfigMeta: model.ConfigMeta{
+				Name:        "acme",
+				Annotations: map[string]string{consistentHashAnnotation: value},
+			}}
+			applyConsistentHash(cluster, destRule, "")
+
+			// The cluster is sent to Envoy as an Any.
+			encoded, err := util.MessageToAnyWithError(cluster)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded := &apiv2.Cluster{}
+			if err := ptypes.UnmarshalAny(encoded, decoded); err != nil {
+				t.Fatal(err)
+			}
+			if !proto.Equal(decoded, cluster) {
+				t.Errorf("got cluster %v after serialization, want %v", decoded, cluster)
+			}
+			if err := decoded.Validate(); err != nil {
+				t.Errorf("invalid cluster: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha3
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	apiv2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	envoy_type "github.com/envoyproxy/go-control-plane/envoy/type"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/wrappers"
+
+	"istio.io/pkg/log"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/serviceregistry"
+)
+
+const (
+	// healthCheckAnnotation is the annotation of a destination rule configuring the active health checks Envoy
+	// runs against the endpoints of its host, so that failing endpoints stop receiving traffic before any
+	// request fails.
+	healthCheckAnnotation = "networking.istio.io/healthCheck"
+
+	healthCheckTypeHTTP = "HTTP"
+	healthCheckTypeGRPC = "GRPC"
+	healthCheckTypeTCP  = "TCP"
+
+	defaultHealthCheckInterval           = 10 * time.Second
+	defaultHealthCheckTimeout            = time.Second
+	defaultHealthCheckHealthyThreshold   = 2
+	defaultHealthCheckUnhealthyThreshold = 3
+)
+
+// healthCheckSettings is the JSON value of the health check annotations of destination rules, e.g.
+// {"type": "HTTP", "path": "/healthz", "interval": "5s", "expectedStatuses": ["200-299"]}.
+type healthCheckSettings struct {
+	// Type is HTTP, GRPC or TCP. It defaults to the protocol of the port.
+	Type               string `json:"type,omitempty"`
+	Interval           string `json:"interval,omitempty"`
+	Timeout            string `json:"timeout,omitempty"`
+	HealthyThreshold   uint32 `json:"healthyThreshold,omitempty"`
+	UnhealthyThreshold uint32 `json:"unhealthyThreshold,omitempty"`
+	// Path and Host are the path and the authority of HTTP health checks. The path defaults to "/".
+	Path string `json:"path,omitempty"`
+	Host string `json:"host,omitempty"`
+	// ExpectedStatuses are the HTTP statuses, or ranges of statuses such as "200-299", of healthy hosts.
+	// They default to 200.
+	ExpectedStatuses []string `json:"expectedStatuses,omitempty"`
+	// ServiceName is the service of gRPC health checks.
+	ServiceName string `json:"serviceName,omitempty"`
+	// HealthyPanicThreshold is the percentage of healthy hosts under which all the hosts receive traffic.
+	HealthyPanicThreshold *float64 `json:"healthyPanicThreshold,omitempty"`
+}
+
+// getHealthCheckSettings returns the health check settings of the destination rule for the subset, or
+// nil if it has none.
+func getHealthCheckSettings(destRule *model.Config, subset string) (*healthCheckSettings, error) {
+	value, ok := getSubsetAnnotation(destRule, healthCheckAnnotation, subset)
+	if !ok {
+		return nil, nil
+	}
+	return parseHealthCheckSettings(value)
+}
+
+func parseHealthCheckSettings(value string) (*healthCheckSettings, error) {
+	settings := &healthCheckSettings{}
+	if err := json.Unmarshal([]byte(value), settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// validateHealthCheckAnnotation validates the health check settings of an annotation. The port only selects
+// the default type of the health checks, so the settings are validated for any port.
+func validateHealthCheckAnnotation(value string) error {
+	settings, err := parseHealthCheckSettings(value)
+	if err != nil {
+		return err
+	}
+	_, err = buildHealthCheck(settings, &model.Port{})
+	return err
+}
+
+// isStaticServiceEntry returns whether the service is defined by a ServiceEntry with STATIC resolution.
+func isStaticServiceEntry(service *model.Service) bool {
+	return service.Attributes.ServiceRegistry == string(serviceregistry.MCPRegistry) &&
+		service.Resolution == model.ClientSideLB
+}
+
+// applyHealthCheck configures the active health checks of the cluster from the annotations of the
+// destination rule. If PILOT_ENABLE_STATIC_SERVICE_ENTRY_HEALTH_CHECK is set, the endpoints of STATIC
+// ServiceEntries are health checked over TCP by default. The panic threshold of Envoy is only changed when
+// the annotation configures it.
+func applyHealthCheck(cluster *apiv2.Cluster, destRule *model.Config, subset string, service *model.Service, port *model.Port) {
+	settings, err := getHealthCheckSettings(destRule, subset)
+	if err != nil {
+		log.Warnf("invalid health check of destination rule %s.%s: %v", destRule.Name, destRule.Namespace, err)
+		return
+	}
+	if settings == nil {
+		if !isStaticServiceEntry(service) || !features.EnableStaticServiceEntryHealthCheck.Get() {
+			return
+		}
+		settings = &healthCheckSettings{Type: healthCheckTypeTCP}
+	}
+
+	healthCheck, err := buildHealthCheck(settings, port)
+	if err != nil {
+		log.Warnf("invalid health check of cluster %s: %v", cluster.Name, err)
+		return
+	}
+	cluster.HealthChecks = []*core.HealthCheck{healthCheck}
+
+	if settings.HealthyPanicThreshold != nil {
+		if cluster.CommonLbConfig == nil {
+			cluster.CommonLbConfig = &apiv2.Cluster_CommonLbConfig{}
+		}
+		cluster.CommonLbConfig.HealthyPanicThreshold = &envoy_type.Percent{Value: *settings.HealthyPanicThreshold}
+	}
+}
+
+// buildHealthCheck builds the Envoy health check of the settings for the port.
+func buildHealthCheck(settings *healthCheckSettings, port *model.Port) (*core.HealthCheck, error) {
+	interval, err := parseHealthCheckDuration(settings.Interval, defaultHealthCheckInterval)
+	if err != nil {
+		return nil, fmt.Errorf("invalid interval: %v", err)
+	}
+	timeout, err := parseHealthCheckDuration(settings.Timeout, defaultHealthCheckTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timeout: %v", err)
+	}
+	if settings.HealthyPanicThreshold != nil && (*settings.HealthyPanicThreshold < 0 || *settings.HealthyPanicThreshold > 100) {
+		return nil, fmt.Errorf("invalid healthy panic threshold %v", *settings.HealthyPanicThreshold)
+	}
+
+	out := &core.HealthCheck{
+		Interval:           ptypes.DurationProto(interval),
+		Timeout:            ptypes.DurationProto(timeout),
+		HealthyThreshold:   &wrappers.UInt32Value{Value: defaultHealthCheckHealthyThreshold},
+		UnhealthyThreshold: &wrappers.UInt32Value{Value: defaultHealthCheckUnhealthyThreshold},
+	}
+	if settings.HealthyThreshold > 0 {
+		out.HealthyThreshold.Value = settings.HealthyThreshold
+	}
+	if settings.UnhealthyThreshold > 0 {
+		out.UnhealthyThreshold.Value = settings.UnhealthyThreshold
+	}
+
+	healthCheckType := strings.ToUpper(settings.Type)
+	if healthCheckType == "" {
+		switch {
+		case port.Protocol.IsGRPC():
+			healthCheckType = healthCheckTypeGRPC
+		case port.Protocol.IsHTTP():
+			healthCheckType = healthCheckTypeHTTP
+		default:
+			healthCheckType = healthCheckTypeTCP
+		}
+	}
+
+	switch healthCheckType {
+	case healthCheckTypeHTTP:
+		path := settings.Path
+		if path == "" {
+			path = "/"
+		}
+		statuses, err := parseExpectedStatuses(settings.ExpectedStatuses)
+		if err != nil {
+			return nil, err
+		}
+		out.HealthChecker = &core.HealthCheck_HttpHealthCheck_{
+			HttpHealthCheck: &core.HealthCheck_HttpHealthCheck{
+				Host:             settings.Host,
+				Path:             path,
+				ExpectedStatuses: statuses,
+			},
+		}
+	case healthCheckTypeGRPC:
+		out.HealthChecker = &core.HealthCheck_GrpcHealthCheck_{
+			GrpcHealthCheck: &core.HealthCheck_GrpcHealthCheck{
+				ServiceName: settings.ServiceName,
+				Authority:   settings.Host,
+			},
+		}
+	case healthCheckTypeTCP:
+		// Without payloads, the TCP health check only connects to the hosts.
+		out.HealthChecker = &core.HealthCheck_TcpHealthCheck_{
+			TcpHealthCheck: &core.HealthCheck_TcpHealthCheck{},
+		}
+	default:
+		return nil, fmt.Errorf("unknown health check type %q", settings.Type)
+	}
+	return out, nil
+}
+
+func parseHealthCheckDuration(value string, defaultValue time.Duration) (time.Duration, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("duration %v must be positive", d)
+	}
+	return d, nil
+}
+
+// parseExpectedStatuses parses HTTP statuses, or ranges of statuses such as "200-299", into half-open ranges.
+func parseExpectedStatuses(statuses []string) ([]*envoy_type.Int64Range, error) {
+	var out []*envoy_type.Int64Range
+	for _, s := range statuses {
+		bounds := strings.SplitN(s, "-", 2)
+		start, err := parseStatus(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		end := start
+		if len(bounds) == 2 {
+			if end, err = parseStatus(bounds[1]); err != nil {
+				return nil, err
+			}
+		}
+		if end < start {
+			return nil, fmt.Errorf("invalid status range %q", s)
+		}
+		out = append(out, &envoy_type.Int64Range{Start: start, End: end + 1})
+	}
+	return out, nil
+}
+
+func parseStatus(s string) (int64, error) {
+	status, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || status < 100 || status > 599 {
+		return 0, fmt.Errorf("invalid status %q", s)
+	}
+	return status, nil
+}
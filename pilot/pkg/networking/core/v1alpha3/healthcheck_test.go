@@ -0,0 +1,273 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha3
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	apiv2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	envoy_type "github.com/envoyproxy/go-control-plane/envoy/type"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/wrappers"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/serviceregistry"
+	"istio.io/istio/pkg/config/protocol"
+)
+
+func TestBuildHealthCheck(t *testing.T) {
+	panicThreshold := float64(120)
+	cases := []struct {
+		name     string
+		settings *healthCheckSettings
+		port     *model.Port
+		expected *core.HealthCheck
+		err      bool
+	}{
+		{
+			name:     "http defaults",
+			settings: &healthCheckSettings{},
+			port:     &model.Port{Port: 8080, Protocol: protocol.HTTP},
+			expected: &core.HealthCheck{
+				Interval:           ptypes.DurationProto(defaultHealthCheckInterval),
+				Timeout:            ptypes.DurationProto(defaultHealthCheckTimeout),
+				HealthyThreshold:   &wrappers.UInt32Value{Value: defaultHealthCheckHealthyThreshold},
+				UnhealthyThreshold: &wrappers.UInt32Value{Value: defaultHealthCheckUnhealthyThreshold},
+				HealthChecker: &core.HealthCheck_HttpHealthCheck_{
+					HttpHealthCheck: &core.HealthCheck_HttpHealthCheck{Path: "/"},
+				},
+			},
+		},
+		{
+			name: "http",
+			settings: &healthCheckSettings{
+				Interval:           "5s",
+				Timeout:            "500ms",
+				HealthyThreshold:   1,
+				UnhealthyThreshold: 5,
+				Path:               "/healthz",
+				Host:               "reviews",
+				ExpectedStatuses:   []string{"200-299", "404"},
+			},
+			port: &model.Port{Port: 8080, Protocol: protocol.HTTP},
+			expected: &core.HealthCheck{
+				Interval:           ptypes.DurationProto(5 * time.Second),
+				Timeout:            ptypes.DurationProto(500 * time.Millisecond),
+				HealthyThreshold:   &wrappers.UInt32Value{Value: 1},
+				UnhealthyThreshold: &wrappers.UInt32Value{Value: 5},
+				HealthChecker: &core.HealthCheck_HttpHealthCheck_{
+					HttpHealthCheck: &core.HealthCheck_HttpHealthCheck{
+						Host: "reviews",
+						Path: "/healthz",
+						ExpectedStatuses: []*envoy_type.Int64Range{
+							{Start: 200, End: 300},
+							{Start: 404, End: 405},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:     "grpc port",
+			settings: &healthCheckSettings{ServiceName: "reviews.Reviews"},
+			port:     &model.Port{Port: 9090, Protocol: protocol.GRPC},
+			expected: &core.HealthCheck{
+				Interval:           ptypes.DurationProto(defaultHealthCheckInterval),
+				Timeout:            ptypes.DurationProto(defaultHealthCheckTimeout),
+				HealthyThreshold:   &wrappers.UInt32Value{Value: defaultHealthCheckHealthyThreshold},
+				UnhealthyThreshold: &wrappers.UInt32Value{Value: defaultHealthCheckUnhealthyThreshold},
+				HealthChecker: &core.HealthCheck_GrpcHealthCheck_{
+					GrpcHealthCheck: &core.HealthCheck_GrpcHealthCheck{ServiceName: "reviews.Reviews"},
+				},
+			},
+		},
+		{
+			name:     "tcp on http port",
+			settings: &healthCheckSettings{Type: "tcp"},
+			port:     &model.Port{Port: 8080, Protocol: protocol.HTTP},
+			expected: &core.HealthCheck{
+				Interval:           ptypes.DurationProto(defaultHealthCheckInterval),
+				Timeout:            ptypes.DurationProto(defaultHealthCheckTimeout),
+				HealthyThreshold:   &wrappers.UInt32Value{Value: defaultHealthCheckHealthyThreshold},
+				UnhealthyThreshold: &wrappers.UInt32Value{Value: defaultHealthCheckUnhealthyThreshold},
+				HealthChecker: &core.HealthCheck_TcpHealthCheck_{
+					TcpHealthCheck: &core.HealthCheck_TcpHealthCheck{},
+				},
+			},
+		},
+		{
+			name:     "unknown type",
+			settings: &healthCheckSettings{Type: "redis"},
+			port:     &model.Port{Port: 6379, Protocol: protocol.Redis},
+			err:      true,
+		},
+		{
+			name:     "invalid interval",
+			settings: &healthCheckSettings{Interval: "-1s"},
+			port:     &model.Port{Port: 8080, Protocol: protocol.HTTP},
+			err:      true,
+		},
+		{
+			name:     "invalid status",
+			settings: &healthCheckSettings{ExpectedStatuses: []string{"299-200"}},
+			port:     &model.Port{Port: 8080, Protocol: protocol.HTTP},
+			err:      true,
+		},
+		{
+			name:     "invalid panic threshold",
+			settings: &healthCheckSettings{HealthyPanicThreshold: &panicThreshold},
+			port:     &model.Port{Port: 8080, Protocol: protocol.HTTP},
+			err:      true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := buildHealthCheck(tc.settings, tc.port)
+			if tc.err != (err != nil) {
+				t.Fatalf("got error %v, want error %v", err, tc.err)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("got %v, want %v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestApplyHealthCheck(t *testing.T) {
+	destRule := &model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Name:      "reviews",
+			Namespace: "default",
+			Annotations: map[string]string{
+				healthCheckAnnotation:         `{"type": "HTTP", "path": "/healthz", "healthyPanicThreshold": 30}`,
+				healthCheckAnnotation + ".v2": `{"type": "TCP"}`,
+			},
+		},
+	}
+	invalid := &model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Name:        "reviews",
+			Namespace:   "default",
+			Annotations: map[string]string{healthCheckAnnotation: `{"interval": 5}`},
+		},
+	}
+	kubeService := &model.Service{
+		Resolution: model.ClientSideLB,
+		Attributes: model.ServiceAttributes{ServiceRegistry: string(serviceregistry.KubernetesRegistry)},
+	}
+	staticServiceEntry := &model.Service{
+		Resolution: model.ClientSideLB,
+		Attributes: model.ServiceAttributes{ServiceRegistry: string(serviceregistry.MCPRegistry)},
+	}
+	dnsServiceEntry := &model.Service{
+		Resolution: model.DNSLB,
+		Attributes: model.ServiceAttributes{ServiceRegistry: string(serviceregistry.MCPRegistry)},
+	}
+	port := &model.Port{Port: 8080, Protocol: protocol.HTTP}
+
+	cases := []struct {
+		name           string
+		destRule       *model.Config
+		subset         string
+		service        *model.Service
+		enableStatic   bool
+		expectedType   interface{}
+		panicThreshold *envoy_type.Percent
+	}{
+		{
+			name:    "no destination rule",
+			service: kubeService,
+		},
+		{
+			name:           "destination",
+			destRule:       destRule,
+			service:        kubeService,
+			expectedType:   &core.HealthCheck_HttpHealthCheck_{},
+			panicThreshold: &envoy_type.Percent{Value: 30},
+		},
+		{
+			name:         "subset",
+			destRule:     destRule,
+			subset:       "v2",
+			service:      kubeService,
+			expectedType: &core.HealthCheck_TcpHealthCheck_{},
+		},
+		{
+			name:           "subset defaults to destination",
+			destRule:       destRule,
+			subset:         "v1",
+			service:        kubeService,
+			expectedType:   &core.HealthCheck_HttpHealthCheck_{},
+			panicThreshold: &envoy_type.Percent{Value: 30},
+		},
+		{
+			name:     "invalid annotation",
+			destRule: invalid,
+			service:  kubeService,
+		},
+		{
+			name:         "static service entry",
+			service:      staticServiceEntry,
+			enableStatic: true,
+			expectedType: &core.HealthCheck_TcpHealthCheck_{},
+		},
+		{
+			name:    "static service entry disabled",
+			service: staticServiceEntry,
+		},
+		{
+			name:         "dns service entry",
+			service:      dnsServiceEntry,
+			enableStatic: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.enableStatic {
+				_ = os.Setenv(features.EnableStaticServiceEntryHealthCheck.Name, "true")
+				defer func() { _ = os.Unsetenv(features.EnableStaticServiceEntryHealthCheck.Name) }()
+			}
+			cluster := &apiv2.Cluster{Name: "outbound|8080||reviews.default.svc.cluster.local"}
+			applyHealthCheck(cluster, tc.destRule, tc.subset, tc.service, port)
+
+			if tc.expectedType == nil {
+				if len(cluster.HealthChecks) != 0 {
+					t.Errorf("unexpected health checks %v", cluster.HealthChecks)
+				}
+				return
+			}
+			if len(cluster.HealthChecks) != 1 {
+				t.Fatalf("got %d health checks, want 1", len(cluster.HealthChecks))
+			}
+			if got := cluster.HealthChecks[0].HealthChecker; reflect.TypeOf(got) != reflect.TypeOf(tc.expectedType) {
+				t.Errorf("got health checker %T, want %T", got, tc.expectedType)
+			}
+			var got *envoy_type.Percent
+			if cluster.CommonLbConfig != nil {
+				got = cluster.CommonLbConfig.HealthyPanicThreshold
+			}
+			if !reflect.DeepEqual(got, tc.panicThreshold) {
+				t.Errorf("got healthy panic threshold %v, want %v", got, tc.panicThreshold)
+			}
+		})
+	}
+}
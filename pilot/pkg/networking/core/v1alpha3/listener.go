@@ -1557,7 +1557,8 @@ func buildSidecarInboundMgmtListeners(node *model.Proxy, env *model.Environment,
 	for _, mPort := range managementPorts {
 		switch mPort.Protocol {
 		case protocol.HTTP, protocol.HTTP2, protocol.GRPC, protocol.GRPCWeb, protocol.TCP,
-			protocol.HTTPS, protocol.TLS, protocol.Mongo, protocol.Redis, protocol.MySQL:
+			protocol.HTTPS, protocol.TLS, protocol.Mongo, protocol.Redis, protocol.MySQL,
+			protocol.Thrift, protocol.Dubbo, protocol.Kafka, protocol.Postgres:
 
 			instance := &model.ServiceInstance{
 				Endpoint: model.NetworkEndpoint{
@@ -2182,22 +2183,28 @@ func getPluginFilterChain(opts buildListenerOpts) []plugin.FilterChain {
 }
 
 // isConflictWithWellKnownPort checks conflicts between incoming protocol and existing protocol.
-// Mongo and MySQL are not allowed to co-exist with other protocols in one port.
+// Mongo, MySQL, Thrift, Dubbo, Kafka and Postgres are not allowed to co-exist with other protocols in one port.
 func isConflictWithWellKnownPort(incoming, existing protocol.Instance, conflict int) bool {
 	if conflict == NoConflict {
 		return true
 	}
 
-	if (incoming == protocol.Mongo ||
-		incoming == protocol.MySQL ||
-		existing == protocol.Mongo ||
-		existing == protocol.MySQL) && incoming != existing {
+	if (isWellKnownProtocol(incoming) || isWellKnownProtocol(existing)) && incoming != existing {
 		return false
 	}
 
 	return true
 }
 
+func isWellKnownProtocol(p protocol.Instance) bool {
+	switch p {
+	case protocol.Mongo, protocol.MySQL, protocol.Thrift, protocol.Dubbo, protocol.Kafka, protocol.Postgres:
+		return true
+	default:
+		return false
+	}
+}
+
 func appendListenerFilters(filters []*listener.ListenerFilter) []*listener.ListenerFilter {
 	hasTLSInspector := false
 	hasHTTPInspector := false
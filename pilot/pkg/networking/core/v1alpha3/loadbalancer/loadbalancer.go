@@ -24,9 +24,37 @@ import (
 	"github.com/golang/protobuf/ptypes/wrappers"
 
 	meshconfig "istio.io/api/mesh/v1alpha1"
+
+	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/util"
 )
 
+const (
+	// HealthWeightsAnnotation is the annotation of a destination rule weighting the localities of its host
+	// by the health of their endpoints, when set to "true". The localities closest to a proxy receive its
+	// traffic, which spills proportionally to the next localities as they lose healthy endpoints.
+	HealthWeightsAnnotation = "networking.istio.io/localityHealthWeights"
+
+	// overprovisioningFactor is the factor of the traffic the healthy endpoints of a group of localities can
+	// absorb, as in the priority load of Envoy: a group keeps all its traffic while at least 1/1.4 (71%) of
+	// its endpoints are healthy.
+	overprovisioningFactor = 1.4
+
+	// healthWeightsTotal is the sum of the weights of the localities receiving traffic.
+	healthWeightsTotal = 1000
+)
+
+// LocalityHealth counts the endpoints of a locality, and the healthy ones.
+type LocalityHealth struct {
+	Healthy int
+	Total   int
+}
+
+// HealthWeightsEnabled returns whether the destination rule weights localities by the health of their endpoints.
+func HealthWeightsEnabled(destRule *model.Config) bool {
+	return destRule != nil && destRule.Annotations[HealthWeightsAnnotation] == "true"
+}
+
 func ApplyLocalityLBSetting(
 	locality *core.Locality,
 	loadAssignment *apiv2.ClusterLoadAssignment,
@@ -154,3 +182,78 @@ func applyLocalityFailover(
 	}
 
 }
+
+// ApplyLocalityHealthWeights sets the weights of the localities of the load assignment from the health of their
+// endpoints, keyed by locality string. Localities without health use the endpoints of the load assignment, as
+// healthy.
+//
+// The localities are grouped by proximity with the proxy locality: same subzone, zone, region, then the
+// others. In this order, each group receives the remaining traffic up to its ratio of healthy endpoints times
+// the overprovisioning factor, shared between its localities in proportion to their healthy endpoints. The
+// weights are normalized when the groups cannot absorb all the traffic. The localities without traffic get the
+// lower priority, so that Envoy fails over to them when the others are ejected.
+func ApplyLocalityHealthWeights(
+	locality *core.Locality,
+	loadAssignment *apiv2.ClusterLoadAssignment,
+	health map[string]LocalityHealth,
+) {
+	if locality == nil || loadAssignment == nil {
+		return
+	}
+
+	// key is priority, value is the index of the LocalityLbEndpoints in ClusterLoadAssignment
+	priorityMap := map[int][]int{}
+	localityHealth := make([]LocalityHealth, len(loadAssignment.Endpoints))
+	for i, localityEndpoint := range loadAssignment.Endpoints {
+		priority := util.LbPriority(locality, localityEndpoint.Locality)
+		priorityMap[priority] = append(priorityMap[priority], i)
+
+		h, f := health[util.LocalityToString(localityEndpoint.Locality)]
+		if !f {
+			h = LocalityHealth{Healthy: len(localityEndpoint.LbEndpoints), Total: len(localityEndpoint.LbEndpoints)}
+		}
+		localityHealth[i] = h
+	}
+	priorities := []int{}
+	for priority := range priorityMap {
+		priorities = append(priorities, priority)
+	}
+	sort.Ints(priorities)
+
+	loads := make([]float64, len(loadAssignment.Endpoints))
+	remaining := 1.0
+	for _, priority := range priorities {
+		healthy, total := 0, 0
+		for _, i := range priorityMap[priority] {
+			healthy += localityHealth[i].Healthy
+			total += localityHealth[i].Total
+		}
+		if healthy == 0 || remaining <= 0 {
+			continue
+		}
+		load := math.Min(remaining, overprovisioningFactor*float64(healthy)/float64(total))
+		remaining -= load
+		for _, i := range priorityMap[priority] {
+			loads[i] = load * float64(localityHealth[i].Healthy) / float64(healthy)
+		}
+	}
+	assigned := 1 - remaining
+	if assigned <= 0 {
+		// No healthy endpoints, leave the load assignment as is.
+		return
+	}
+
+	for i, localityEndpoint := range loadAssignment.Endpoints {
+		weight := uint32(math.Round(loads[i] / assigned * healthWeightsTotal))
+		if weight > 0 {
+			localityEndpoint.Priority = 0
+		} else {
+			localityEndpoint.Priority = 1
+			weight = uint32(localityHealth[i].Healthy)
+			if weight == 0 {
+				weight = 1
+			}
+		}
+		localityEndpoint.LoadBalancingWeight = &wrappers.UInt32Value{Value: weight}
+	}
+}
@@ -22,6 +22,7 @@ import (
 	envoycore "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 	endpoint "github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint"
 	"github.com/gogo/protobuf/types"
+	"github.com/golang/protobuf/ptypes/wrappers"
 	. "github.com/onsi/gomega"
 
 	meshconfig "istio.io/api/mesh/v1alpha1"
@@ -29,6 +30,7 @@ import (
 
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/core/v1alpha3/fakes"
+	"istio.io/istio/pilot/pkg/networking/util"
 	"istio.io/istio/pkg/config/protocol"
 	"istio.io/istio/pkg/config/schemas"
 )
@@ -157,6 +159,90 @@ func TestApplyLocalitySetting(t *testing.T) {
 	})
 }
 
+func TestApplyLocalityHealthWeights(t *testing.T) {
+	locality := &envoycore.Locality{Region: "region1", Zone: "zone1", SubZone: "subzone1"}
+	localities := []string{"region1/zone1/subzone1", "region1/zone2", "region2/zone1"}
+
+	tests := []struct {
+		name       string
+		health     map[string]LocalityHealth
+		weights    []uint32
+		priorities []uint32
+	}{
+		{
+			name:       "healthy",
+			health:     map[string]LocalityHealth{},
+			weights:    []uint32{1000, 10, 10},
+			priorities: []uint32{0, 1, 1},
+		},
+		{
+			name: "local locality degraded",
+			health: map[string]LocalityHealth{
+				"region1/zone1/subzone1": {Healthy: 5, Total: 10},
+			},
+			weights:    []uint32{700, 300, 10},
+			priorities: []uint32{0, 0, 1},
+		},
+		{
+			name: "region degraded",
+			health: map[string]LocalityHealth{
+				"region1/zone1/subzone1": {Healthy: 5, Total: 10},
+				"region1/zone2":          {Healthy: 1, Total: 10},
+			},
+			weights:    []uint32{700, 140, 160},
+			priorities: []uint32{0, 0, 0},
+		},
+		{
+			name: "all degraded",
+			health: map[string]LocalityHealth{
+				"region1/zone1/subzone1": {Healthy: 2, Total: 10},
+				"region1/zone2":          {Healthy: 0, Total: 10},
+				"region2/zone1":          {Healthy: 1, Total: 10},
+			},
+			weights:    []uint32{667, 1, 333},
+			priorities: []uint32{0, 1, 0},
+		},
+		{
+			name: "no healthy endpoints",
+			health: map[string]LocalityHealth{
+				"region1/zone1/subzone1": {Healthy: 0, Total: 10},
+				"region1/zone2":          {Healthy: 0, Total: 10},
+				"region2/zone1":          {Healthy: 0, Total: 10},
+			},
+			weights:    []uint32{10, 10, 10},
+			priorities: []uint32{0, 0, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadAssignment := &apiv2.ClusterLoadAssignment{}
+			for _, l := range localities {
+				lbEndpoints := make([]*endpoint.LbEndpoint, 10)
+				for i := range lbEndpoints {
+					lbEndpoints[i] = &endpoint.LbEndpoint{}
+				}
+				loadAssignment.Endpoints = append(loadAssignment.Endpoints, &endpoint.LocalityLbEndpoints{
+					Locality:            util.ConvertLocality(l),
+					LbEndpoints:         lbEndpoints,
+					LoadBalancingWeight: &wrappers.UInt32Value{Value: 10},
+				})
+			}
+
+			ApplyLocalityHealthWeights(locality, loadAssignment, tt.health)
+
+			for i, localityEndpoints := range loadAssignment.Endpoints {
+				if got := localityEndpoints.LoadBalancingWeight.GetValue(); got != tt.weights[i] {
+					t.Errorf("locality %s: got weight %d, want %d", localities[i], got, tt.weights[i])
+				}
+				if got := localityEndpoints.Priority; got != tt.priorities[i] {
+					t.Errorf("locality %s: got priority %d, want %d", localities[i], got, tt.priorities[i])
+				}
+			}
+		})
+	}
+}
+
 func buildEnvForClustersWithDistribute(distribute []*meshconfig.LocalityLoadBalancerSetting_Distribute) *model.Environment {
 	serviceDiscovery := &fakes.ServiceDiscovery{}
 
@@ -16,26 +16,37 @@ package v1alpha3
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	listener "github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
+	route "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
 	accesslogconfig "github.com/envoyproxy/go-control-plane/envoy/config/accesslog/v2"
 	accesslog "github.com/envoyproxy/go-control-plane/envoy/config/filter/accesslog/v2"
+	dubbo_proxy "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/dubbo_proxy/v2alpha1"
+	kafka_broker "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/kafka_broker/v2alpha1"
 	mongo_proxy "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/mongo_proxy/v2"
 	mysql_proxy "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/mysql_proxy/v1alpha1"
 	redis_proxy "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/redis_proxy/v2"
 	tcp_proxy "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/tcp_proxy/v2"
+	thrift_proxy "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/thrift_proxy/v2alpha1"
+	envoy_matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher"
 	"github.com/envoyproxy/go-control-plane/pkg/conversion"
 	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
 	"github.com/golang/protobuf/ptypes"
+	pstruct "github.com/golang/protobuf/ptypes/struct"
+	"github.com/golang/protobuf/ptypes/wrappers"
 
 	networking "istio.io/api/networking/v1alpha3"
+	"istio.io/pkg/log"
 
 	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	istio_route "istio.io/istio/pilot/pkg/networking/core/v1alpha3/route"
 	"istio.io/istio/pilot/pkg/networking/util"
 	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/labels"
 	"istio.io/istio/pkg/config/protocol"
 )
 
@@ -173,7 +184,19 @@ func buildNetworkFiltersStack(node *model.Proxy, port *model.Port, tcpFilter *li
 			filterstack = append(filterstack, buildMySQLFilter(statPrefix, util.IsXDSMarshalingToAnyEnabled(node)))
 		}
 		filterstack = append(filterstack, tcpFilter)
+	case protocol.Kafka:
+		if features.EnableKafkaFilter.Get() && isIstioVersionGE(node, kafkaFilterMinVersion) {
+			filterstack = append(filterstack, buildKafkaFilter(statPrefix, util.IsXDSMarshalingToAnyEnabled(node)))
+		}
+		filterstack = append(filterstack, tcpFilter)
+	case protocol.Postgres:
+		if features.EnablePostgresFilter.Get() && isIstioVersionGE(node, postgresFilterMinVersion) {
+			filterstack = append(filterstack, buildPostgresFilter(statPrefix))
+		}
+		filterstack = append(filterstack, tcpFilter)
 	default:
+		// Thrift and Dubbo ports are proxied as TCP, unless they are routed by method by
+		// buildOutboundRPCNetworkFilters.
 		filterstack = append(filterstack, tcpFilter)
 	}
 
@@ -279,3 +302,326 @@ func buildMySQLFilter(statPrefix string, isXDSMarshalingToAnyEnabled bool) *list
 
 	return out
 }
+
+const (
+	// kafkaBrokerFilterName is the name of the Envoy Kafka broker filter.
+	kafkaBrokerFilterName = "envoy.filters.network.kafka_broker"
+	// postgresProxyFilterName is the name of the Envoy Postgres proxy filter.
+	postgresProxyFilterName = "envoy.filters.network.postgres_proxy"
+)
+
+// The Kafka broker and Postgres proxy filters are only registered by the Envoy of recent proxies (Envoy 1.13 and
+// 1.15), older proxies reject the whole listener. They are not sent to the proxies of unknown versions either.
+var (
+	kafkaFilterMinVersion    = &model.IstioVersion{Major: 1, Minor: 5, Patch: -1}
+	postgresFilterMinVersion = &model.IstioVersion{Major: 1, Minor: 7, Patch: -1}
+)
+
+// isIstioVersionGE returns true if the Istio version of the proxy is known and at least min.
+func isIstioVersionGE(node *model.Proxy, min *model.IstioVersion) bool {
+	return node.IstioVersion != nil && node.IstioVersion.Compare(min) >= 0
+}
+
+// buildKafkaFilter builds an outbound Envoy KafkaBroker filter, which collects stats per API key.
+func buildKafkaFilter(statPrefix string, isXDSMarshalingToAnyEnabled bool) *listener.Filter {
+	kafkaBroker := &kafka_broker.KafkaBroker{
+		StatPrefix: statPrefix, // Kafka stats are prefixed with kafka.<statPrefix> by Envoy.
+	}
+
+	out := &listener.Filter{
+		Name: kafkaBrokerFilterName,
+	}
+
+	if isXDSMarshalingToAnyEnabled {
+		out.ConfigType = &listener.Filter_TypedConfig{TypedConfig: util.MessageToAny(kafkaBroker)}
+	} else {
+		out.ConfigType = &listener.Filter_Config{Config: util.MessageToStruct(kafkaBroker)}
+	}
+
+	return out
+}
+
+// buildPostgresFilter builds an outbound Envoy PostgresProxy filter, which collects stats per query type.
+// There are no go-control-plane types for its configuration, which only has a stat prefix, so it is always
+// sent as a Struct.
+func buildPostgresFilter(statPrefix string) *listener.Filter {
+	return &listener.Filter{
+		Name: postgresProxyFilterName,
+		ConfigType: &listener.Filter_Config{Config: &pstruct.Struct{
+			Fields: map[string]*pstruct.Value{
+				// Postgres stats are prefixed with postgres.<statPrefix> by Envoy.
+				"stat_prefix": {Kind: &pstruct.Value_StringValue{StringValue: statPrefix}},
+			},
+		}},
+	}
+}
+
+// buildThriftFilter builds an Envoy ThriftProxy filter with the given routes. The transport and the
+// protocol of the requests are detected automatically.
+func buildThriftFilter(statPrefix string, routes []*thrift_proxy.Route, isXDSMarshalingToAnyEnabled bool) *listener.Filter {
+	thriftProxy := &thrift_proxy.ThriftProxy{
+		StatPrefix: statPrefix, // thrift stats are prefixed with thrift.<statPrefix> by Envoy.
+		RouteConfig: &thrift_proxy.RouteConfiguration{
+			Name:   statPrefix,
+			Routes: routes,
+		},
+	}
+
+	out := &listener.Filter{
+		Name: wellknown.ThriftProxy,
+	}
+	if isXDSMarshalingToAnyEnabled {
+		out.ConfigType = &listener.Filter_TypedConfig{TypedConfig: util.MessageToAny(thriftProxy)}
+	} else {
+		out.ConfigType = &listener.Filter_Config{Config: util.MessageToStruct(thriftProxy)}
+	}
+
+	return out
+}
+
+// buildDubboFilter builds an Envoy DubboProxy filter with the given route configurations, one per interface.
+func buildDubboFilter(statPrefix string, routeConfigs []*dubbo_proxy.RouteConfiguration,
+	isXDSMarshalingToAnyEnabled bool) *listener.Filter {
+	dubboProxy := &dubbo_proxy.DubboProxy{
+		StatPrefix:  statPrefix, // dubbo stats are prefixed with dubbo.<statPrefix> by Envoy.
+		RouteConfig: routeConfigs,
+	}
+
+	out := &listener.Filter{
+		Name: wellknown.DubboProxy,
+	}
+	if isXDSMarshalingToAnyEnabled {
+		out.ConfigType = &listener.Filter_TypedConfig{TypedConfig: util.MessageToAny(dubboProxy)}
+	} else {
+		out.ConfigType = &listener.Filter_Config{Config: util.MessageToStruct(dubboProxy)}
+	}
+
+	return out
+}
+
+// rpcClusterWeight is a destination cluster of a Thrift or Dubbo route.
+type rpcClusterWeight struct {
+	name   string
+	weight uint32
+}
+
+// rpcRoute is a Thrift or Dubbo route translated from an HTTP route of a virtual service. An empty
+// service or method matches any service or method.
+type rpcRoute struct {
+	service  string
+	method   string
+	headers  []*route.HeaderMatcher
+	clusters []rpcClusterWeight
+}
+
+// parseRPCMethod returns the service and the method matched by the URI of an HTTP match of a virtual service.
+// Following the gRPC convention, an exact URI /<service>/<method> or /<method> matches a method, and a URI
+// prefix /<service>/ matches all the methods of a service.
+func parseRPCMethod(uri *networking.StringMatch) (service, method string, ok bool) {
+	if uri == nil {
+		return "", "", true
+	}
+	switch m := uri.MatchType.(type) {
+	case *networking.StringMatch_Exact:
+		parts := strings.Split(strings.TrimPrefix(m.Exact, "/"), "/")
+		switch len(parts) {
+		case 1:
+			return "", parts[0], parts[0] != ""
+		case 2:
+			return parts[0], parts[1], parts[0] != "" && parts[1] != ""
+		}
+	case *networking.StringMatch_Prefix:
+		service := strings.Trim(m.Prefix, "/")
+		if service != "" && !strings.Contains(service, "/") {
+			return service, "", true
+		}
+	}
+	return "", "", false
+}
+
+// buildRPCRoutes translates the HTTP routes of the virtual services to Thrift or Dubbo routes.
+// Matches other than the URI, the headers, the port, the source labels and the gateways are not supported.
+func buildRPCRoutes(node *model.Proxy, push *model.PushContext, configs []model.Config,
+	port *model.Port, gateways map[string]bool) []rpcRoute {
+	var out []rpcRoute
+	for _, cfg := range configs {
+		virtualService := cfg.Spec.(*networking.VirtualService)
+		for _, http := range virtualService.Http {
+			var clusters []rpcClusterWeight
+			for _, dst := range http.Route {
+				service := node.SidecarScope.ServiceForHostname(host.Name(dst.Destination.Host), push.ServiceByHostnameAndNamespace)
+				clusters = append(clusters, rpcClusterWeight{
+					name:   istio_route.GetDestinationCluster(dst.Destination, service, port.Port),
+					weight: uint32(dst.Weight),
+				})
+			}
+			if len(clusters) == 0 {
+				continue
+			}
+
+			if len(http.Match) == 0 {
+				out = append(out, rpcRoute{clusters: clusters})
+				continue
+			}
+			for _, match := range http.Match {
+				if !matchRPC(match, node.WorkloadLabels, gateways, port.Port) {
+					continue
+				}
+				service, method, ok := parseRPCMethod(match.Uri)
+				if !ok {
+					log.Warnf("unsupported %s match %v in virtual service %s.%s", port.Protocol, match.Uri,
+						cfg.Name, cfg.Namespace)
+					continue
+				}
+				r := rpcRoute{service: service, method: method, clusters: clusters}
+				for name, stringMatch := range match.Headers {
+					matcher := istio_route.TranslateHeaderMatch(name, stringMatch)
+					r.headers = append(r.headers, &matcher)
+				}
+				// guarantee ordering of headers
+				sort.Slice(r.headers, func(i, j int) bool {
+					return r.headers[i].Name < r.headers[j].Name
+				})
+				out = append(out, r)
+			}
+		}
+	}
+	return out
+}
+
+// matchRPC checks the source labels, the gateways and the port of an HTTP match of a virtual service.
+func matchRPC(match *networking.HTTPMatchRequest, proxyLabels labels.Collection, gateways map[string]bool, port int) bool {
+	gatewayMatch := len(match.Gateways) == 0
+	for _, gateway := range match.Gateways {
+		gatewayMatch = gatewayMatch || gateways[gateway]
+	}
+	labelMatch := proxyLabels.IsSupersetOf(match.SourceLabels)
+	portMatch := match.Port == 0 || match.Port == uint32(port)
+	return gatewayMatch && labelMatch && portMatch
+}
+
+// buildThriftRoute builds a Thrift route. With the multiplexed protocol, the method names are prefixed
+// with the name of the service.
+func buildThriftRoute(service, method string, headers []*route.HeaderMatcher, clusters []rpcClusterWeight) *thrift_proxy.Route {
+	match := &thrift_proxy.RouteMatch{Headers: headers}
+	switch {
+	case service != "" && method != "":
+		match.MatchSpecifier = &thrift_proxy.RouteMatch_MethodName{MethodName: service + ":" + method}
+	case service != "":
+		match.MatchSpecifier = &thrift_proxy.RouteMatch_ServiceName{ServiceName: service + ":"}
+	default:
+		// An empty method name matches all the methods.
+		match.MatchSpecifier = &thrift_proxy.RouteMatch_MethodName{MethodName: method}
+	}
+
+	action := &thrift_proxy.RouteAction{}
+	if len(clusters) == 1 {
+		action.ClusterSpecifier = &thrift_proxy.RouteAction_Cluster{Cluster: clusters[0].name}
+	} else {
+		weighted := &thrift_proxy.WeightedCluster{}
+		for _, c := range clusters {
+			if c.weight > 0 {
+				weighted.Clusters = append(weighted.Clusters, &thrift_proxy.WeightedCluster_ClusterWeight{
+					Name:   c.name,
+					Weight: &wrappers.UInt32Value{Value: c.weight},
+				})
+			}
+		}
+		action.ClusterSpecifier = &thrift_proxy.RouteAction_WeightedClusters{WeightedClusters: weighted}
+	}
+	return &thrift_proxy.Route{Match: match, Route: action}
+}
+
+// buildDubboRouteConfigs builds the Dubbo route configurations of the interfaces the routes match, in the
+// order they first appear. Each interface falls back to the default cluster. Dubbo routes always match an
+// interface, so routes matching any service are ignored.
+func buildDubboRouteConfigs(statPrefix string, routes []rpcRoute, defaultCluster string) []*dubbo_proxy.RouteConfiguration {
+	var out []*dubbo_proxy.RouteConfiguration
+	byInterface := make(map[string]*dubbo_proxy.RouteConfiguration)
+	for _, r := range routes {
+		if r.service == "" {
+			log.Warnf("dubbo routes must match an interface, ignoring route of %s to %v", statPrefix, r.clusters)
+			continue
+		}
+		rc, ok := byInterface[r.service]
+		if !ok {
+			rc = &dubbo_proxy.RouteConfiguration{Name: statPrefix + "." + r.service, Interface: r.service}
+			byInterface[r.service] = rc
+			out = append(out, rc)
+		}
+		rc.Routes = append(rc.Routes, buildDubboRoute(r.method, r.headers, r.clusters))
+	}
+	for _, rc := range out {
+		rc.Routes = append(rc.Routes, buildDubboRoute("", nil, []rpcClusterWeight{{name: defaultCluster}}))
+	}
+	return out
+}
+
+func buildDubboRoute(method string, headers []*route.HeaderMatcher, clusters []rpcClusterWeight) *dubbo_proxy.Route {
+	name := &envoy_matcher.StringMatcher{MatchPattern: &envoy_matcher.StringMatcher_Exact{Exact: method}}
+	if method == "" {
+		name.MatchPattern = &envoy_matcher.StringMatcher_Regex{Regex: ".*"}
+	}
+	match := &dubbo_proxy.RouteMatch{
+		Method:  &dubbo_proxy.MethodMatch{Name: name},
+		Headers: headers,
+	}
+
+	action := &dubbo_proxy.RouteAction{}
+	if len(clusters) == 1 {
+		action.ClusterSpecifier = &dubbo_proxy.RouteAction_Cluster{Cluster: clusters[0].name}
+	} else {
+		weighted := &route.WeightedCluster{}
+		for _, c := range clusters {
+			if c.weight > 0 {
+				weighted.Clusters = append(weighted.Clusters, &route.WeightedCluster_ClusterWeight{
+					Name:   c.name,
+					Weight: &wrappers.UInt32Value{Value: c.weight},
+				})
+			}
+		}
+		action.ClusterSpecifier = &dubbo_proxy.RouteAction_WeightedClusters{WeightedClusters: weighted}
+	}
+	return &dubbo_proxy.Route{Match: match, Route: action}
+}
+
+// buildOutboundRPCNetworkFilters builds the Thrift or Dubbo proxy filter routing the requests to a service
+// with the HTTP routes of its virtual services. It returns nil when the filter of the protocol is disabled or
+// the virtual services have no route for the port, in which case the port is handled like a TCP port.
+func buildOutboundRPCNetworkFilters(node *model.Proxy, push *model.PushContext, port *model.Port,
+	gateways map[string]bool, configs []model.Config, defaultCluster string) []*listener.Filter {
+	switch port.Protocol {
+	case protocol.Thrift:
+		if !features.EnableThriftFilter.Get() {
+			return nil
+		}
+	case protocol.Dubbo:
+		if !features.EnableDubboFilter.Get() {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	routes := buildRPCRoutes(node, push, configs, port, gateways)
+	if len(routes) == 0 {
+		return nil
+	}
+
+	switch port.Protocol {
+	case protocol.Thrift:
+		thriftRoutes := make([]*thrift_proxy.Route, 0, len(routes)+1)
+		for _, r := range routes {
+			thriftRoutes = append(thriftRoutes, buildThriftRoute(r.service, r.method, r.headers, r.clusters))
+		}
+		thriftRoutes = append(thriftRoutes, buildThriftRoute("", "", nil, []rpcClusterWeight{{name: defaultCluster}}))
+		return []*listener.Filter{buildThriftFilter(defaultCluster, thriftRoutes, util.IsXDSMarshalingToAnyEnabled(node))}
+	case protocol.Dubbo:
+		routeConfigs := buildDubboRouteConfigs(defaultCluster, routes, defaultCluster)
+		if len(routeConfigs) == 0 {
+			return nil
+		}
+		return []*listener.Filter{buildDubboFilter(defaultCluster, routeConfigs, util.IsXDSMarshalingToAnyEnabled(node))}
+	}
+	return nil
+}
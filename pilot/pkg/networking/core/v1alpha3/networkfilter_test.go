@@ -15,12 +15,24 @@
 package v1alpha3
 
 import (
+	"os"
+	"reflect"
 	"testing"
 
 	listener "github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
+	dubbo_proxy "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/dubbo_proxy/v2alpha1"
+	kafka_broker "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/kafka_broker/v2alpha1"
 	redis_proxy "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/redis_proxy/v2"
+	thrift_proxy "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/thrift_proxy/v2alpha1"
 	xdsutil "github.com/envoyproxy/go-control-plane/pkg/wellknown"
 	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/wrappers"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/protocol"
 )
 
 func TestBuildRedisFilter(t *testing.T) {
@@ -54,3 +66,306 @@ func TestBuildRedisFilter(t *testing.T) {
 		t.Errorf("redis filter type is %T not listener.Filter_Config ", redisFilter.ConfigType)
 	}
 }
+
+func TestBuildThriftFilter(t *testing.T) {
+	routes := []*thrift_proxy.Route{
+		buildThriftRoute("Reviews", "get", nil, []rpcClusterWeight{{name: "reviews-v2"}}),
+		buildThriftRoute("", "", nil, []rpcClusterWeight{{name: "reviews"}}),
+	}
+	thriftFilter := buildThriftFilter("reviews", routes, true)
+	if thriftFilter.Name != xdsutil.ThriftProxy {
+		t.Errorf("thrift filter name is %s not %s", thriftFilter.Name, xdsutil.ThriftProxy)
+	}
+	if config, ok := thriftFilter.ConfigType.(*listener.Filter_TypedConfig); ok {
+		thriftProxy := thrift_proxy.ThriftProxy{}
+		if err := ptypes.UnmarshalAny(config.TypedConfig, &thriftProxy); err != nil {
+			t.Errorf("unmarshal failed: %v", err)
+		}
+		if thriftProxy.StatPrefix != "reviews" {
+			t.Errorf("thrift proxy statPrefix is %s", thriftProxy.StatPrefix)
+		}
+		if len(thriftProxy.RouteConfig.Routes) != 2 {
+			t.Errorf("thrift proxy has %d routes", len(thriftProxy.RouteConfig.Routes))
+		}
+	} else {
+		t.Errorf("thrift filter type is %T not listener.Filter_TypedConfig ", thriftFilter.ConfigType)
+	}
+
+	thriftFilter = buildThriftFilter("reviews", routes, false)
+	if _, ok := thriftFilter.ConfigType.(*listener.Filter_Config); !ok {
+		t.Errorf("thrift filter type is %T not listener.Filter_Config ", thriftFilter.ConfigType)
+	}
+}
+
+func TestBuildThriftRoute(t *testing.T) {
+	cases := []struct {
+		name     string
+		service  string
+		method   string
+		clusters []rpcClusterWeight
+		expected *thrift_proxy.Route
+	}{
+		{
+			name:     "service and method",
+			service:  "Reviews",
+			method:   "get",
+			clusters: []rpcClusterWeight{{name: "reviews-v2"}},
+			expected: &thrift_proxy.Route{
+				Match: &thrift_proxy.RouteMatch{MatchSpecifier: &thrift_proxy.RouteMatch_MethodName{MethodName: "Reviews:get"}},
+				Route: &thrift_proxy.RouteAction{ClusterSpecifier: &thrift_proxy.RouteAction_Cluster{Cluster: "reviews-v2"}},
+			},
+		},
+		{
+			name:     "service",
+			service:  "Reviews",
+			clusters: []rpcClusterWeight{{name: "reviews-v2"}},
+			expected: &thrift_proxy.Route{
+				Match: &thrift_proxy.RouteMatch{MatchSpecifier: &thrift_proxy.RouteMatch_ServiceName{ServiceName: "Reviews:"}},
+				Route: &thrift_proxy.RouteAction{ClusterSpecifier: &thrift_proxy.RouteAction_Cluster{Cluster: "reviews-v2"}},
+			},
+		},
+		{
+			name:     "catch all weighted",
+			clusters: []rpcClusterWeight{{name: "reviews-v1", weight: 80}, {name: "reviews-v2", weight: 20}},
+			expected: &thrift_proxy.Route{
+				Match: &thrift_proxy.RouteMatch{MatchSpecifier: &thrift_proxy.RouteMatch_MethodName{MethodName: ""}},
+				Route: &thrift_proxy.RouteAction{ClusterSpecifier: &thrift_proxy.RouteAction_WeightedClusters{
+					WeightedClusters: &thrift_proxy.WeightedCluster{
+						Clusters: []*thrift_proxy.WeightedCluster_ClusterWeight{
+							{Name: "reviews-v1", Weight: &wrappers.UInt32Value{Value: 80}},
+							{Name: "reviews-v2", Weight: &wrappers.UInt32Value{Value: 20}},
+						},
+					},
+				}},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := buildThriftRoute(tc.service, tc.method, nil, tc.clusters)
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("got %v, want %v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestBuildDubboRouteConfigs(t *testing.T) {
+	routes := []rpcRoute{
+		{service: "org.apache.dubbo.demo.DemoService", method: "sayHello", clusters: []rpcClusterWeight{{name: "demo-v2"}}},
+		{clusters: []rpcClusterWeight{{name: "demo-v3"}}},
+		{service: "org.apache.dubbo.demo.GreetingService", clusters: []rpcClusterWeight{{name: "greeting-v2"}}},
+	}
+	got := buildDubboRouteConfigs("demo", routes, "demo")
+	if len(got) != 2 {
+		t.Fatalf("got %d route configurations, want 2", len(got))
+	}
+	if got[0].Interface != "org.apache.dubbo.demo.DemoService" || got[1].Interface != "org.apache.dubbo.demo.GreetingService" {
+		t.Errorf("unexpected interfaces %s and %s", got[0].Interface, got[1].Interface)
+	}
+	for _, rc := range got {
+		if len(rc.Routes) != 2 {
+			t.Fatalf("interface %s has %d routes, want 2", rc.Interface, len(rc.Routes))
+		}
+		last := rc.Routes[1]
+		if last.Route.GetCluster() != "demo" || last.Match.Method.Name.GetRegex() != ".*" {
+			t.Errorf("interface %s does not fall back to the default cluster: %v", rc.Interface, last)
+		}
+	}
+	if name := got[0].Routes[0].Match.Method.Name.GetExact(); name != "sayHello" {
+		t.Errorf("got method %q, want sayHello", name)
+	}
+
+	dubboFilter := buildDubboFilter("demo", got, true)
+	if dubboFilter.Name != xdsutil.DubboProxy {
+		t.Errorf("dubbo filter name is %s not %s", dubboFilter.Name, xdsutil.DubboProxy)
+	}
+	config, ok := dubboFilter.ConfigType.(*listener.Filter_TypedConfig)
+	if !ok {
+		t.Fatalf("dubbo filter type is %T not listener.Filter_TypedConfig ", dubboFilter.ConfigType)
+	}
+	dubboProxy := dubbo_proxy.DubboProxy{}
+	if err := ptypes.UnmarshalAny(config.TypedConfig, &dubboProxy); err != nil {
+		t.Errorf("unmarshal failed: %v", err)
+	}
+	if len(dubboProxy.RouteConfig) != 2 {
+		t.Errorf("dubbo proxy has %d route configurations", len(dubboProxy.RouteConfig))
+	}
+}
+
+func TestParseRPCMethod(t *testing.T) {
+	cases := []struct {
+		name    string
+		uri     *networking.StringMatch
+		service string
+		method  string
+		ok      bool
+	}{
+		{name: "any", ok: true},
+		{
+			name:    "service and method",
+			uri:     &networking.StringMatch{MatchType: &networking.StringMatch_Exact{Exact: "/Reviews/get"}},
+			service: "Reviews",
+			method:  "get",
+			ok:      true,
+		},
+		{
+			name:   "method",
+			uri:    &networking.StringMatch{MatchType: &networking.StringMatch_Exact{Exact: "/get"}},
+			method: "get",
+			ok:     true,
+		},
+		{
+			name:    "service",
+			uri:     &networking.StringMatch{MatchType: &networking.StringMatch_Prefix{Prefix: "/Reviews/"}},
+			service: "Reviews",
+			ok:      true,
+		},
+		{
+			name: "nested prefix",
+			uri:  &networking.StringMatch{MatchType: &networking.StringMatch_Prefix{Prefix: "/Reviews/get/"}},
+		},
+		{
+			name: "regex",
+			uri:  &networking.StringMatch{MatchType: &networking.StringMatch_Regex{Regex: "/Reviews/.*"}},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			service, method, ok := parseRPCMethod(tc.uri)
+			if service != tc.service || method != tc.method || ok != tc.ok {
+				t.Errorf("got (%q, %q, %v), want (%q, %q, %v)", service, method, ok, tc.service, tc.method, tc.ok)
+			}
+		})
+	}
+}
+
+func TestBuildKafkaFilter(t *testing.T) {
+	kafkaFilter := buildKafkaFilter("kafka", true)
+	if kafkaFilter.Name != kafkaBrokerFilterName {
+		t.Errorf("kafka filter name is %s not %s", kafkaFilter.Name, kafkaBrokerFilterName)
+	}
+	if config, ok := kafkaFilter.ConfigType.(*listener.Filter_TypedConfig); ok {
+		kafkaBroker := kafka_broker.KafkaBroker{}
+		if err := ptypes.UnmarshalAny(config.TypedConfig, &kafkaBroker); err != nil {
+			t.Errorf("unmarshal failed: %v", err)
+		}
+		if kafkaBroker.StatPrefix != "kafka" {
+			t.Errorf("kafka broker statPrefix is %s", kafkaBroker.StatPrefix)
+		}
+	} else {
+		t.Errorf("kafka filter type is %T not listener.Filter_TypedConfig ", kafkaFilter.ConfigType)
+	}
+
+	kafkaFilter = buildKafkaFilter("kafka", false)
+	if _, ok := kafkaFilter.ConfigType.(*listener.Filter_Config); !ok {
+		t.Errorf("kafka filter type is %T not listener.Filter_Config ", kafkaFilter.ConfigType)
+	}
+}
+
+func TestBuildPostgresFilter(t *testing.T) {
+	postgresFilter := buildPostgresFilter("postgres")
+	if postgresFilter.Name != postgresProxyFilterName {
+		t.Errorf("postgres filter name is %s not %s", postgresFilter.Name, postgresProxyFilterName)
+	}
+	config, ok := postgresFilter.ConfigType.(*listener.Filter_Config)
+	if !ok {
+		t.Fatalf("postgres filter type is %T not listener.Filter_Config ", postgresFilter.ConfigType)
+	}
+	if statPrefix := config.Config.Fields["stat_prefix"].GetStringValue(); statPrefix != "postgres" {
+		t.Errorf("postgres proxy statPrefix is %s", statPrefix)
+	}
+}
+
+func TestBuildNetworkFiltersStackFeatureFlags(t *testing.T) {
+	tcpFilter := &listener.Filter{Name: xdsutil.TCPProxy}
+	latest := &model.IstioVersion{Major: 1, Minor: 7}
+	cases := []struct {
+		name     string
+		protocol protocol.Instance
+		env      string
+		version  *model.IstioVersion
+		expected []string
+	}{
+		{"kafka disabled", protocol.Kafka, "", latest, []string{xdsutil.TCPProxy}},
+		{"kafka enabled", protocol.Kafka, features.EnableKafkaFilter.Name, latest,
+			[]string{kafkaBrokerFilterName, xdsutil.TCPProxy}},
+		{"kafka unsupported", protocol.Kafka, features.EnableKafkaFilter.Name, &model.IstioVersion{Major: 1, Minor: 4},
+			[]string{xdsutil.TCPProxy}},
+		{"kafka unknown version", protocol.Kafka, features.EnableKafkaFilter.Name, nil, []string{xdsutil.TCPProxy}},
+		{"postgres disabled", protocol.Postgres, "", latest, []string{xdsutil.TCPProxy}},
+		{"postgres enabled", protocol.Postgres, features.EnablePostgresFilter.Name, latest,
+			[]string{postgresProxyFilterName, xdsutil.TCPProxy}},
+		{"postgres unsupported", protocol.Postgres, features.EnablePostgresFilter.Name, &model.IstioVersion{Major: 1, Minor: 6},
+			[]string{xdsutil.TCPProxy}},
+		// Thrift and Dubbo are only routed by method by buildOutboundRPCNetworkFilters.
+		{"thrift enabled", protocol.Thrift, features.EnableThriftFilter.Name, latest, []string{xdsutil.TCPProxy}},
+		{"dubbo enabled", protocol.Dubbo, features.EnableDubboFilter.Name, latest, []string{xdsutil.TCPProxy}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.env != "" {
+				_ = os.Setenv(tc.env, "true")
+				defer func() { _ = os.Unsetenv(tc.env) }()
+			}
+			filters := buildNetworkFiltersStack(&model.Proxy{IstioVersion: tc.version}, &model.Port{Port: 9092, Protocol: tc.protocol},
+				tcpFilter, "outbound|9092||backend", "outbound|9092||backend")
+			var got []string
+			for _, f := range filters {
+				got = append(got, f.Name)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("got filters %v, want %v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestBuildOutboundRPCNetworkFiltersFeatureFlags(t *testing.T) {
+	configs := []model.Config{{
+		ConfigMeta: model.ConfigMeta{Name: "reviews", Namespace: "default"},
+		Spec: &networking.VirtualService{
+			Hosts: []string{"reviews.default.svc.cluster.local"},
+			Http: []*networking.HTTPRoute{{
+				Match: []*networking.HTTPMatchRequest{{
+					Uri: &networking.StringMatch{MatchType: &networking.StringMatch_Exact{Exact: "/Reviews/get"}},
+				}},
+				Route: []*networking.HTTPRouteDestination{{
+					Destination: &networking.Destination{Host: "reviews.default.svc.cluster.local", Subset: "v2"},
+				}},
+			}},
+		},
+	}}
+	cases := []struct {
+		name     string
+		protocol protocol.Instance
+		env      string
+		expected []string
+	}{
+		{"thrift disabled", protocol.Thrift, "", nil},
+		{"thrift enabled", protocol.Thrift, features.EnableThriftFilter.Name, []string{xdsutil.ThriftProxy}},
+		{"dubbo disabled", protocol.Dubbo, "", nil},
+		{"dubbo enabled", protocol.Dubbo, features.EnableDubboFilter.Name, []string{xdsutil.DubboProxy}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.env != "" {
+				_ = os.Setenv(tc.env, "true")
+				defer func() { _ = os.Unsetenv(tc.env) }()
+			}
+			filters := buildOutboundRPCNetworkFilters(&model.Proxy{}, model.NewPushContext(),
+				&model.Port{Port: 9090, Protocol: tc.protocol}, nil, configs, "outbound|9090||reviews.default.svc.cluster.local")
+			var got []string
+			for _, f := range filters {
+				got = append(got, f.Name)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("got filters %v, want %v", got, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha3
+
+import (
+	"encoding/json"
+	"fmt"
+
+	apiv2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	v2Cluster "github.com/envoyproxy/go-control-plane/envoy/api/v2/cluster"
+	envoy_type "github.com/envoyproxy/go-control-plane/envoy/type"
+	"github.com/golang/protobuf/ptypes/wrappers"
+
+	"istio.io/pkg/log"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+// retryBudgetAnnotation is the annotation of a destination rule limiting the concurrent retries to its host to a
+// percentage of the active requests, so that the retries scale with the traffic instead of being capped by the
+// max retries of the connection pool.
+const retryBudgetAnnotation = "networking.istio.io/retryBudget"
+
+// retryBudgetSettings is the JSON value of the retry budget annotations of destination rules, e.g.
+// {"budgetPercent": 20, "minRetryConcurrency": 3}.
+type retryBudgetSettings struct {
+	// BudgetPercent is the percentage of the active requests that can be retries, 20 by default in Envoy.
+	BudgetPercent *float64 `json:"budgetPercent,omitempty"`
+	// MinRetryConcurrency is the number of retries allowed regardless of the budget, 3 by default in Envoy.
+	MinRetryConcurrency *uint32 `json:"minRetryConcurrency,omitempty"`
+}
+
+// getRetryBudgetSettings returns the retry budget of the destination rule for the subset, or nil if it has none.
+func getRetryBudgetSettings(destRule *model.Config, subset string) (*retryBudgetSettings, error) {
+	value, ok := getSubsetAnnotation(destRule, retryBudgetAnnotation, subset)
+	if !ok {
+		return nil, nil
+	}
+	return parseRetryBudgetSettings(value)
+}
+
+func parseRetryBudgetSettings(value string) (*retryBudgetSettings, error) {
+	settings := &retryBudgetSettings{}
+	if err := json.Unmarshal([]byte(value), settings); err != nil {
+		return nil, err
+	}
+	if p := settings.BudgetPercent; p != nil && (*p < 0 || *p > 100) {
+		return nil, fmt.Errorf("invalid budget percent %v", *p)
+	}
+	return settings, nil
+}
+
+// applyRetryBudget sets the retry budget of the circuit breakers of the cluster from the annotations of the
+// destination rule. Envoy ignores the max retries of the circuit breakers of a cluster with a retry budget.
+func applyRetryBudget(cluster *apiv2.Cluster, destRule *model.Config, subset string) {
+	settings, err := getRetryBudgetSettings(destRule, subset)
+	if err != nil {
+		log.Warnf("invalid retry budget of destination rule %s.%s: %v", destRule.Name, destRule.Namespace, err)
+		return
+	}
+	if settings == nil {
+		return
+	}
+
+	budget := &v2Cluster.CircuitBreakers_Thresholds_RetryBudget{}
+	if settings.BudgetPercent != nil {
+		budget.BudgetPercent = &envoy_type.Percent{Value: *settings.BudgetPercent}
+	}
+	if settings.MinRetryConcurrency != nil {
+		budget.MinRetryConcurrency = &wrappers.UInt32Value{Value: *settings.MinRetryConcurrency}
+	}
+
+	if cluster.CircuitBreakers == nil || len(cluster.CircuitBreakers.Thresholds) == 0 {
+		cluster.CircuitBreakers = &v2Cluster.CircuitBreakers{
+			Thresholds: []*v2Cluster.CircuitBreakers_Thresholds{getDefaultCircuitBreakerThresholds(model.TrafficDirectionOutbound)},
+		}
+	}
+	// Only the default priority thresholds are generated.
+	cluster.CircuitBreakers.Thresholds[0].RetryBudget = budget
+}
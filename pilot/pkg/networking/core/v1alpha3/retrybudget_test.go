@@ -0,0 +1,103 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha3
+
+import (
+	"reflect"
+	"testing"
+
+	apiv2 "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	v2Cluster "github.com/envoyproxy/go-control-plane/envoy/api/v2/cluster"
+	envoy_type "github.com/envoyproxy/go-control-plane/envoy/type"
+	"github.com/golang/protobuf/ptypes/wrappers"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+func TestApplyRetryBudget(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		subset      string
+		expected    *v2Cluster.CircuitBreakers_Thresholds_RetryBudget
+	}{
+		{
+			name: "no annotation",
+		},
+		{
+			name:        "host budget",
+			annotations: map[string]string{retryBudgetAnnotation: `{"budgetPercent": 25, "minRetryConcurrency": 5}`},
+			expected: &v2Cluster.CircuitBreakers_Thresholds_RetryBudget{
+				BudgetPercent:       &envoy_type.Percent{Value: 25},
+				MinRetryConcurrency: &wrappers.UInt32Value{Value: 5},
+			},
+		},
+		{
+			name:        "envoy defaults",
+			annotations: map[string]string{retryBudgetAnnotation: `{}`},
+			expected:    &v2Cluster.CircuitBreakers_Thresholds_RetryBudget{},
+		},
+		{
+			name: "subset budget",
+			annotations: map[string]string{
+				retryBudgetAnnotation:         `{"budgetPercent": 25}`,
+				retryBudgetAnnotation + ".v2": `{"budgetPercent": 50}`,
+			},
+			subset: "v2",
+			expected: &v2Cluster.CircuitBreakers_Thresholds_RetryBudget{
+				BudgetPercent: &envoy_type.Percent{Value: 50},
+			},
+		},
+		{
+			name: "subset without budget",
+			annotations: map[string]string{
+				retryBudgetAnnotation:         `{"budgetPercent": 25}`,
+				retryBudgetAnnotation + ".v2": `{"budgetPercent": 50}`,
+			},
+			subset: "v1",
+			expected: &v2Cluster.CircuitBreakers_Thresholds_RetryBudget{
+				BudgetPercent: &envoy_type.Percent{Value: 25},
+			},
+		},
+		{
+			name:        "invalid percent",
+			annotations: map[string]string{retryBudgetAnnotation: `{"budgetPercent": 150}`},
+		},
+		{
+			name:        "invalid json",
+			annotations: map[string]string{retryBudgetAnnotation: `20`},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := &apiv2.Cluster{}
+			destRule := &model.Config{ConfigMeta: model.ConfigMeta{Name: "acme", Annotations: tt.annotations}}
+			applyRetryBudget(cluster, destRule, tt.subset)
+			if tt.expected == nil {
+				if cluster.CircuitBreakers != nil {
+					t.Errorf("got circuit breakers %v, want none", cluster.CircuitBreakers)
+				}
+				return
+			}
+			if cluster.CircuitBreakers == nil || len(cluster.CircuitBreakers.Thresholds) != 1 {
+				t.Fatalf("got circuit breakers %v, want one threshold", cluster.CircuitBreakers)
+			}
+			if got := cluster.CircuitBreakers.Thresholds[0].RetryBudget; !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("got retry budget %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -15,17 +15,100 @@
 package retry
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	route "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	"github.com/golang/protobuf/ptypes"
 	"github.com/golang/protobuf/ptypes/wrappers"
 
 	networking "istio.io/api/networking/v1alpha3"
 	"istio.io/istio/pilot/pkg/networking/util"
 )
 
+// OptionsAnnotation is the annotation of a virtual service setting the retry options of its HTTP routes not
+// part of HTTPRetry, as a JSON Options, e.g. {"baseInterval": "25ms", "maxInterval": "1s"}.
+const OptionsAnnotation = "networking.istio.io/retryOptions"
+
+// Options are the retry options of the HTTP routes of a virtual service not part of HTTPRetry.
+type Options struct {
+	// BaseInterval is the base interval of the exponential back-off between retries, 25ms by default in Envoy.
+	BaseInterval string `json:"baseInterval,omitempty"`
+	// MaxInterval is the maximum interval between retries, 10 times the base interval by default.
+	MaxInterval string `json:"maxInterval,omitempty"`
+	// RetryPreviousHosts allows the retries to select the hosts previously attempted, which are skipped
+	// by default.
+	RetryPreviousHosts bool `json:"retryPreviousHosts,omitempty"`
+	// HostSelectionMaxAttempts is the maximum number of attempts to select a host not previously attempted,
+	// 5 by default.
+	HostSelectionMaxAttempts int64 `json:"hostSelectionMaxAttempts,omitempty"`
+}
+
+// ParseOptions returns the retry options of the annotations of a virtual service, or nil if it has none.
+func ParseOptions(annotations map[string]string) (*Options, error) {
+	value, f := annotations[OptionsAnnotation]
+	if !f {
+		return nil, nil
+	}
+	opts := &Options{}
+	if err := json.Unmarshal([]byte(value), opts); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %v", OptionsAnnotation, err)
+	}
+	if _, _, err := opts.backOff(); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %v", OptionsAnnotation, err)
+	}
+	if opts.HostSelectionMaxAttempts < 0 {
+		return nil, fmt.Errorf("invalid %s annotation: negative hostSelectionMaxAttempts", OptionsAnnotation)
+	}
+	return opts, nil
+}
+
+func (o *Options) backOff() (time.Duration, time.Duration, error) {
+	var base, max time.Duration
+	var err error
+	if o.BaseInterval != "" {
+		if base, err = time.ParseDuration(o.BaseInterval); err != nil || base <= 0 {
+			return 0, 0, fmt.Errorf("invalid baseInterval %q", o.BaseInterval)
+		}
+	}
+	if o.MaxInterval != "" {
+		if max, err = time.ParseDuration(o.MaxInterval); err != nil || max <= 0 {
+			return 0, 0, fmt.Errorf("invalid maxInterval %q", o.MaxInterval)
+		}
+		if base == 0 {
+			return 0, 0, fmt.Errorf("maxInterval requires baseInterval")
+		}
+		if max < base {
+			return 0, 0, fmt.Errorf("maxInterval %v is shorter than baseInterval %v", max, base)
+		}
+	}
+	return base, max, nil
+}
+
+// ApplyOptions sets the back-off and the host selection of the retry policy from the options.
+func ApplyOptions(policy *route.RetryPolicy, opts *Options) {
+	if policy == nil || opts == nil {
+		return
+	}
+	// The options are validated by ParseOptions.
+	if base, max, _ := opts.backOff(); base > 0 {
+		policy.RetryBackOff = &route.RetryPolicy_RetryBackOff{BaseInterval: ptypes.DurationProto(base)}
+		if max > 0 {
+			policy.RetryBackOff.MaxInterval = ptypes.DurationProto(max)
+		}
+	}
+	if opts.RetryPreviousHosts {
+		policy.RetryHostPredicate = nil
+		policy.HostSelectionRetryMaxAttempts = 0
+	} else if opts.HostSelectionMaxAttempts > 0 {
+		policy.HostSelectionRetryMaxAttempts = opts.HostSelectionMaxAttempts
+	}
+}
+
 // DefaultPolicy gets a copy of the default retry policy.
 func DefaultPolicy() *route.RetryPolicy {
 	policy := route.RetryPolicy{
@@ -39,7 +122,7 @@ func DefaultPolicy() *route.RetryPolicy {
 				Name: "envoy.retry_host_predicates.previous_hosts",
 			},
 		},
-		// TODO: allow this to be configured via API.
+		// Configured by the hostSelectionMaxAttempts of the retry options of virtual services.
 		HostSelectionRetryMaxAttempts: 5,
 	}
 	return &policy
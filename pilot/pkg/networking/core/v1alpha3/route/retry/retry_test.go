@@ -175,3 +175,68 @@ func TestMissingPerTryTimeoutShouldReturnNil(t *testing.T) {
 	g.Expect(policy).To(Not(BeNil()))
 	g.Expect(policy.PerTryTimeout).To(BeNil())
 }
+
+func TestParseOptions(t *testing.T) {
+	cases := []struct {
+		name       string
+		annotation string
+		want       *retry.Options
+		wantErr    bool
+	}{
+		{name: "no annotation"},
+		{
+			name:       "back-off",
+			annotation: `{"baseInterval": "50ms", "maxInterval": "1s"}`,
+			want:       &retry.Options{BaseInterval: "50ms", MaxInterval: "1s"},
+		},
+		{
+			name:       "host selection",
+			annotation: `{"hostSelectionMaxAttempts": 3}`,
+			want:       &retry.Options{HostSelectionMaxAttempts: 3},
+		},
+		{name: "not json", annotation: `a`, wantErr: true},
+		{name: "invalid interval", annotation: `{"baseInterval": "fast"}`, wantErr: true},
+		{name: "negative interval", annotation: `{"baseInterval": "-1s"}`, wantErr: true},
+		{name: "max without base", annotation: `{"maxInterval": "1s"}`, wantErr: true},
+		{name: "max shorter than base", annotation: `{"baseInterval": "1s", "maxInterval": "10ms"}`, wantErr: true},
+		{name: "negative attempts", annotation: `{"hostSelectionMaxAttempts": -1}`, wantErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			g := NewGomegaWithT(t)
+			annotations := map[string]string{}
+			if c.annotation != "" {
+				annotations[retry.OptionsAnnotation] = c.annotation
+			}
+			opts, err := retry.ParseOptions(annotations)
+			if c.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(opts).To(Equal(c.want))
+		})
+	}
+}
+
+func TestApplyOptions(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	policy := retry.DefaultPolicy()
+	retry.ApplyOptions(policy, &retry.Options{BaseInterval: "50ms", MaxInterval: "1s", HostSelectionMaxAttempts: 3})
+	g.Expect(policy.RetryBackOff).To(Not(BeNil()))
+	g.Expect(policy.RetryBackOff.BaseInterval).To(Equal(ptypes.DurationProto(50 * time.Millisecond)))
+	g.Expect(policy.RetryBackOff.MaxInterval).To(Equal(ptypes.DurationProto(time.Second)))
+	g.Expect(policy.RetryHostPredicate).To(HaveLen(1))
+	g.Expect(policy.HostSelectionRetryMaxAttempts).To(Equal(int64(3)))
+
+	policy = retry.DefaultPolicy()
+	retry.ApplyOptions(policy, &retry.Options{RetryPreviousHosts: true})
+	g.Expect(policy.RetryBackOff).To(BeNil())
+	g.Expect(policy.RetryHostPredicate).To(BeNil())
+	g.Expect(policy.HostSelectionRetryMaxAttempts).To(Equal(int64(0)))
+
+	policy = retry.DefaultPolicy()
+	retry.ApplyOptions(policy, nil)
+	g.Expect(policy).To(Equal(retry.DefaultPolicy()))
+}
@@ -27,6 +27,7 @@ import (
 	xdshttpfault "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/fault/v2"
 	xdstype "github.com/envoyproxy/go-control-plane/envoy/type"
 	xdsutil "github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	golangproto "github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes"
 	"github.com/golang/protobuf/ptypes/any"
 	"github.com/golang/protobuf/ptypes/duration"
@@ -257,18 +258,27 @@ func BuildHTTPRoutesForVirtualService(
 		return nil, fmt.Errorf("in not a virtual service: %#v", virtualService)
 	}
 
+	retryOptions, err := retry.ParseOptions(virtualService.Annotations)
+	if err != nil {
+		log.Warnf("ignoring the retry options of virtual service %s/%s: %v", virtualService.Namespace, virtualService.Name, err)
+	}
+	appendRoute := func(out []*route.Route, r *route.Route) []*route.Route {
+		retry.ApplyOptions(r.GetRoute().GetRetryPolicy(), retryOptions)
+		return append(out, r)
+	}
+
 	out := make([]*route.Route, 0, len(vs.Http))
 allroutes:
 	for _, http := range vs.Http {
 		if len(http.Match) == 0 {
 			if r := translateRoute(push, node, http, nil, listenPort, virtualService, serviceRegistry, gatewayNames); r != nil {
-				out = append(out, r)
+				out = appendRoute(out, r)
 			}
 			break allroutes // we have a rule with catch all match prefix: /. Other rules are of no use
 		} else {
 			for _, match := range http.Match {
 				if r := translateRoute(push, node, http, match, listenPort, virtualService, serviceRegistry, gatewayNames); r != nil {
-					out = append(out, r)
+					out = appendRoute(out, r)
 					rType, _ := getEnvoyRouteTypeAndVal(r)
 					if rType == envoyCatchAll {
 						// We have a catch all route. No point building other routes, with match conditions
@@ -483,7 +493,7 @@ func translateRoute(push *model.PushContext, node *model.Proxy, in *networking.H
 				configNamespace = serviceRegistry[hostname].Attributes.Namespace
 			}
 			hashPolicy := getHashPolicy(push, node, dst, configNamespace)
-			if hashPolicy != nil {
+			if hashPolicy != nil && !containsHashPolicy(action.HashPolicy, hashPolicy) {
 				action.HashPolicy = append(action.HashPolicy, hashPolicy)
 			}
 		}
@@ -565,7 +575,7 @@ func translateRouteMatch(in *networking.HTTPMatchRequest) *route.RouteMatch {
 	}
 
 	for name, stringMatch := range in.Headers {
-		matcher := translateHeaderMatch(name, stringMatch)
+		matcher := TranslateHeaderMatch(name, stringMatch)
 		out.Headers = append(out.Headers, &matcher)
 	}
 
@@ -588,17 +598,17 @@ func translateRouteMatch(in *networking.HTTPMatchRequest) *route.RouteMatch {
 	out.CaseSensitive = &wrappers.BoolValue{Value: !in.IgnoreUriCase}
 
 	if in.Method != nil {
-		matcher := translateHeaderMatch(HeaderMethod, in.Method)
+		matcher := TranslateHeaderMatch(HeaderMethod, in.Method)
 		out.Headers = append(out.Headers, &matcher)
 	}
 
 	if in.Authority != nil {
-		matcher := translateHeaderMatch(HeaderAuthority, in.Authority)
+		matcher := TranslateHeaderMatch(HeaderAuthority, in.Authority)
 		out.Headers = append(out.Headers, &matcher)
 	}
 
 	if in.Scheme != nil {
-		matcher := translateHeaderMatch(HeaderScheme, in.Scheme)
+		matcher := TranslateHeaderMatch(HeaderScheme, in.Scheme)
 		out.Headers = append(out.Headers, &matcher)
 	}
 
@@ -627,8 +637,8 @@ func translateQueryParamMatch(name string, in *networking.StringMatch) route.Que
 	return out
 }
 
-// translateHeaderMatch translates to HeaderMatcher
-func translateHeaderMatch(name string, in *networking.StringMatch) route.HeaderMatcher {
+// TranslateHeaderMatch translates a string match of a virtual service to a HeaderMatcher
+func TranslateHeaderMatch(name string, in *networking.StringMatch) route.HeaderMatcher {
 	out := route.HeaderMatcher{
 		Name: name,
 	}
@@ -878,7 +888,7 @@ func getHashPolicyByService(node *model.Proxy, push *model.PushContext, svc *mod
 			break
 		}
 	}
-	return consistentHashToHashPolicy(consistentHash)
+	return applyGatewayCookie(node, consistentHashToHashPolicy(consistentHash))
 }
 
 func getHashPolicy(push *model.PushContext, node *model.Proxy, dst *networking.HTTPRouteDestination,
@@ -921,7 +931,31 @@ func getHashPolicy(push *model.PushContext, node *model.Proxy, dst *networking.H
 	case plsHash != nil:
 		consistentHash = plsHash
 	}
-	return consistentHashToHashPolicy(consistentHash)
+	return applyGatewayCookie(node, consistentHashToHashPolicy(consistentHash))
+}
+
+// applyGatewayCookie scopes the cookies generated by gateways for cookie hash policies to all the paths of the
+// host. Otherwise the cookie generated for the first request of a client is scoped by the browser to the path of
+// the request, and the requests to the other paths are hashed without cookie, and get a cookie of their own.
+func applyGatewayCookie(node *model.Proxy, policy *route.RouteAction_HashPolicy) *route.RouteAction_HashPolicy {
+	cookie := policy.GetCookie()
+	// Envoy generates the cookie when a TTL is set, a session cookie for a zero TTL.
+	if node == nil || node.Type != model.Router || cookie == nil || cookie.Ttl == nil || cookie.Path != "" {
+		return policy
+	}
+	cookie.Path = "/"
+	return policy
+}
+
+// containsHashPolicy returns true if the policies contain the policy. The destinations of a route with the same
+// hash policy would otherwise generate as many cookies.
+func containsHashPolicy(policies []*route.RouteAction_HashPolicy, policy *route.RouteAction_HashPolicy) bool {
+	for _, p := range policies {
+		if golangproto.Equal(p, policy) {
+			return true
+		}
+	}
+	return false
 }
 
 type envoyRouteType int
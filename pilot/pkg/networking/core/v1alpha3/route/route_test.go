@@ -119,6 +119,86 @@ func TestBuildHTTPRoutes(t *testing.T) {
 		g.Expect(routes[0].GetRoute().GetHashPolicy()).To(gomega.ConsistOf(hashPolicy))
 	})
 
+	t.Run("for gateway with generated cookie", func(t *testing.T) {
+		g := gomega.NewGomegaWithT(t)
+
+		ttl := time.Hour
+		gateway := &model.Proxy{
+			Type:         model.Router,
+			IPAddresses:  []string{"1.1.1.1"},
+			ID:           "someID",
+			DNSDomain:    "foo.com",
+			Metadata:     &model.NodeMetadata{IstioVersion: "1.3.0"},
+			IstioVersion: &model.IstioVersion{Major: 1, Minor: 3},
+		}
+		meshConfig := mesh.DefaultMeshConfig()
+		push := &model.PushContext{
+			Env: &model.Environment{
+				Mesh: &meshConfig,
+			},
+		}
+		push.SetDestinationRules([]model.Config{
+			{
+				ConfigMeta: model.ConfigMeta{
+					Type:    schemas.DestinationRule.Type,
+					Version: schemas.DestinationRule.Version,
+					Name:    "acme",
+				},
+				Spec: &networking.DestinationRule{
+					Host: "*.example.org",
+					TrafficPolicy: &networking.TrafficPolicy{
+						LoadBalancer: &networking.LoadBalancerSettings{
+							LbPolicy: &networking.LoadBalancerSettings_ConsistentHash{
+								ConsistentHash: &networking.LoadBalancerSettings_ConsistentHashLB{
+									HashKey: &networking.LoadBalancerSettings_ConsistentHashLB_HttpCookie{
+										HttpCookie: &networking.LoadBalancerSettings_ConsistentHashLB_HTTPCookie{
+											Name: "session",
+											Ttl:  &ttl,
+										},
+									},
+								},
+							},
+						},
+					},
+					Subsets: []*networking.Subset{{Name: "v1"}, {Name: "v2"}},
+				},
+			},
+		})
+		virtualService := model.Config{
+			ConfigMeta: model.ConfigMeta{
+				Type:    schemas.VirtualService.Type,
+				Version: schemas.VirtualService.Version,
+				Name:    "acme",
+			},
+			Spec: &networking.VirtualService{
+				Hosts:    []string{},
+				Gateways: []string{"some-gateway"},
+				Http: []*networking.HTTPRoute{{
+					Route: []*networking.HTTPRouteDestination{
+						{Destination: &networking.Destination{Host: "*.example.org", Subset: "v1"}, Weight: 50},
+						{Destination: &networking.Destination{Host: "*.example.org", Subset: "v2"}, Weight: 50},
+					},
+				}},
+			},
+		}
+
+		routes, err := route.BuildHTTPRoutesForVirtualService(gateway, push, virtualService, serviceRegistry, 8080, gatewayNames)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(len(routes)).To(gomega.Equal(1))
+
+		// The destinations share a single cookie, valid for all the paths of the host.
+		hashPolicy := &envoyroute.RouteAction_HashPolicy{
+			PolicySpecifier: &envoyroute.RouteAction_HashPolicy_Cookie_{
+				Cookie: &envoyroute.RouteAction_HashPolicy_Cookie{
+					Name: "session",
+					Ttl:  ptypes.DurationProto(ttl),
+					Path: "/",
+				},
+			},
+		}
+		g.Expect(routes[0].GetRoute().GetHashPolicy()).To(gomega.ConsistOf(hashPolicy))
+	})
+
 	t.Run("for virtual service with subsets with ring hash", func(t *testing.T) {
 		g := gomega.NewGomegaWithT(t)
 
@@ -25,6 +25,7 @@ import (
 	"istio.io/istio/pilot/pkg/networking/util"
 	"istio.io/istio/pkg/config/host"
 	"istio.io/istio/pkg/config/labels"
+	"istio.io/istio/pkg/config/protocol"
 
 	"istio.io/pkg/log"
 )
@@ -202,6 +203,21 @@ func buildSidecarOutboundTCPFilterChainOpts(env *model.Environment, node *model.
 		return nil
 	}
 
+	// Thrift and Dubbo ports are routed by method with the HTTP routes of the virtual services, if any.
+	if service != nil && (listenPort.Protocol == protocol.Thrift || listenPort.Protocol == protocol.Dubbo) {
+		port := listenPort.Port
+		if len(service.Ports) == 1 {
+			port = service.Ports[0].Port
+		}
+		clusterName := model.BuildSubsetKey(model.TrafficDirectionOutbound, "", service.Hostname, port)
+		if filters := buildOutboundRPCNetworkFilters(node, push, listenPort, gateways, configs, clusterName); filters != nil {
+			return []*filterChainOpts{{
+				destinationCIDRs: []string{destinationCIDR},
+				networkFilters:   filters,
+			}}
+		}
+	}
+
 	out := make([]*filterChainOpts, 0)
 
 	// very basic TCP
@@ -19,10 +19,16 @@
 // to OFF.
 // Note: ClusterRbacConfig is not created with istio installation which means this plugin doesn't
 // generate any RBAC config by default.
+//
+// The plugin also adds the Envoy ext_authz filter, after the RBAC filter, to the workloads whose pod has the
+// authz.istio.io/extAuthzServer annotation, delegating their authorization decisions to an external service.
+// The filter calls the service through a cluster of its own, added to the clusters of these workloads.
 package authz
 
 import (
 	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	tcp_filter "github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
+	http_filter "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
 
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/plugin"
@@ -38,6 +44,8 @@ var (
 // Plugin implements Istio Authorization
 type Plugin struct{}
 
+var _ plugin.ClusterPlugin = Plugin{}
+
 // NewPlugin returns an instance of the authorization plugin
 func NewPlugin() plugin.Plugin {
 	return Plugin{}
@@ -79,65 +87,88 @@ func buildFilter(in *plugin.InputParams, mutable *plugin.MutableObjects) {
 		return
 	}
 
+	isXDSMarshalingToAnyEnabled := util.IsXDSMarshalingToAnyEnabled(in.Node)
 	builder := authz_builder.NewBuilder(in.ServiceInstance, in.Node.WorkloadLabels, in.Node.ConfigNamespace,
-		in.Push.AuthzPolicies, util.IsXDSMarshalingToAnyEnabled(in.Node))
-	if builder == nil {
+		in.Push.AuthzPolicies, isXDSMarshalingToAnyEnabled)
+	extAuthz := newExtAuthzConfig(in.Node)
+	if builder == nil && extAuthz == nil {
 		return
 	}
 
+	// The ext_authz filter is placed after the RBAC filter, so that requests denied by the
+	// authorization policies never reach the external authorization service.
+	var httpFilters []*http_filter.HttpFilter
+	var tcpFilters []*tcp_filter.Filter
+	buildHTTPFilters := func() {
+		if f := builder.BuildHTTPFilter(); f != nil {
+			httpFilters = append(httpFilters, f)
+		}
+		if f := extAuthz.buildHTTPFilter(isXDSMarshalingToAnyEnabled); f != nil {
+			httpFilters = append(httpFilters, f)
+		}
+	}
+	buildTCPFilters := func() {
+		if f := builder.BuildTCPFilter(); f != nil {
+			tcpFilters = append(tcpFilters, f)
+		}
+		if f := extAuthz.buildTCPFilter(isXDSMarshalingToAnyEnabled); f != nil {
+			tcpFilters = append(tcpFilters, f)
+		}
+	}
+
 	switch in.ListenerProtocol {
 	case plugin.ListenerProtocolTCP:
 		rbacLog.Debugf("building filter for TCP listener protocol")
-		tcpFilter := builder.BuildTCPFilter()
+		buildTCPFilters()
 		if in.Node.Type == model.Router {
 			// For gateways, due to TLS termination, a listener marked as TCP could very well
 			// be using a HTTP connection manager. So check the filterChain.listenerProtocol
 			// to decide the type of filter to attach
-			httpFilter := builder.BuildHTTPFilter()
+			buildHTTPFilters()
 			for cnum := range mutable.FilterChains {
 				if mutable.FilterChains[cnum].ListenerProtocol == plugin.ListenerProtocolHTTP {
-					if httpFilter != nil {
-						rbacLog.Debugf("added HTTP filter to gateway filter chain %d", cnum)
-						mutable.FilterChains[cnum].HTTP = append(mutable.FilterChains[cnum].HTTP, httpFilter)
+					if len(httpFilters) != 0 {
+						rbacLog.Debugf("added HTTP filters to gateway filter chain %d", cnum)
+						mutable.FilterChains[cnum].HTTP = append(mutable.FilterChains[cnum].HTTP, httpFilters...)
 					}
 				} else {
-					if tcpFilter != nil {
-						rbacLog.Debugf("added TCP filter to gateway filter chain %d", cnum)
-						mutable.FilterChains[cnum].TCP = append(mutable.FilterChains[cnum].TCP, tcpFilter)
+					if len(tcpFilters) != 0 {
+						rbacLog.Debugf("added TCP filters to gateway filter chain %d", cnum)
+						mutable.FilterChains[cnum].TCP = append(mutable.FilterChains[cnum].TCP, tcpFilters...)
 					}
 				}
 			}
-		} else {
+		} else if len(tcpFilters) != 0 {
 			for cnum := range mutable.FilterChains {
-				rbacLog.Debugf("added TCP filter to filter chain %d", cnum)
-				mutable.FilterChains[cnum].TCP = append(mutable.FilterChains[cnum].TCP, tcpFilter)
+				rbacLog.Debugf("added TCP filters to filter chain %d", cnum)
+				mutable.FilterChains[cnum].TCP = append(mutable.FilterChains[cnum].TCP, tcpFilters...)
 			}
 		}
 	case plugin.ListenerProtocolHTTP:
 		rbacLog.Debugf("building filter for HTTP listener protocol")
-		filter := builder.BuildHTTPFilter()
-		if filter != nil {
+		buildHTTPFilters()
+		if len(httpFilters) != 0 {
 			for cnum := range mutable.FilterChains {
-				rbacLog.Debugf("added HTTP filter to filter chain %d", cnum)
-				mutable.FilterChains[cnum].HTTP = append(mutable.FilterChains[cnum].HTTP, filter)
+				rbacLog.Debugf("added HTTP filters to filter chain %d", cnum)
+				mutable.FilterChains[cnum].HTTP = append(mutable.FilterChains[cnum].HTTP, httpFilters...)
 			}
 		}
 	case plugin.ListenerProtocolAuto:
 		rbacLog.Debugf("building filter for AUTO listener protocol")
-		httpFilter := builder.BuildHTTPFilter()
-		tcpFilter := builder.BuildTCPFilter()
+		buildHTTPFilters()
+		buildTCPFilters()
 
 		for cnum := range mutable.FilterChains {
 			switch mutable.FilterChains[cnum].ListenerProtocol {
 			case plugin.ListenerProtocolTCP:
-				if tcpFilter != nil {
-					rbacLog.Debugf("added TCP filter to filter chain %d", cnum)
-					mutable.FilterChains[cnum].TCP = append(mutable.FilterChains[cnum].TCP, tcpFilter)
+				if len(tcpFilters) != 0 {
+					rbacLog.Debugf("added TCP filters to filter chain %d", cnum)
+					mutable.FilterChains[cnum].TCP = append(mutable.FilterChains[cnum].TCP, tcpFilters...)
 				}
 			case plugin.ListenerProtocolHTTP:
-				if httpFilter != nil {
-					rbacLog.Debugf("added HTTP filter to filter chain %d", cnum)
-					mutable.FilterChains[cnum].HTTP = append(mutable.FilterChains[cnum].HTTP, httpFilter)
+				if len(httpFilters) != 0 {
+					rbacLog.Debugf("added HTTP filters to filter chain %d", cnum)
+					mutable.FilterChains[cnum].HTTP = append(mutable.FilterChains[cnum].HTTP, httpFilters...)
 				}
 			}
 		}
@@ -164,3 +195,12 @@ func (Plugin) OnInboundRouteConfiguration(in *plugin.InputParams, route *xdsapi.
 // OnOutboundCluster implements the Plugin interface method.
 func (Plugin) OnOutboundCluster(in *plugin.InputParams, cluster *xdsapi.Cluster) {
 }
+
+// OnServiceClusters returns the cluster of the external authorization service of the proxy, if it has one.
+func (Plugin) OnServiceClusters(in *plugin.InputParams) []*xdsapi.Cluster {
+	extAuthz := newExtAuthzConfig(in.Node)
+	if extAuthz == nil {
+		return nil
+	}
+	return []*xdsapi.Cluster{extAuthz.buildCluster(in.Env.Mesh.ConnectTimeout)}
+}
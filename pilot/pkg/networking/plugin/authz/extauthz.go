@@ -0,0 +1,221 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authz
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	tcp_filter "github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
+	ext_authz_http "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/ext_authz/v2"
+	ext_authz_tcp "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/ext_authz/v2"
+	http_filter "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	envoy_matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher"
+	"github.com/gogo/protobuf/types"
+	"github.com/golang/protobuf/ptypes"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
+)
+
+const (
+	// extAuthzFilterName is the name of both the HTTP and the network ext_authz filters.
+	extAuthzFilterName = "envoy.ext_authz"
+
+	// extAuthzClusterName is the cluster of the authorization service, built by the plugin rather than taken
+	// from the outbound clusters of the proxy.
+	extAuthzClusterName = "ext_authz_service"
+
+	extAuthzStatPrefix = "ext_authz."
+
+	extAuthzProtocolGRPC = "grpc"
+	extAuthzProtocolHTTP = "http"
+
+	// defaultExtAuthzTimeout is the default timeout of Envoy for the requests to the authorization service.
+	defaultExtAuthzTimeout = 200 * time.Millisecond
+)
+
+// extAuthzConfig is the external authorization configuration of a workload, read from the annotations
+// of its pod. The HTTP protocol is only supported on HTTP filter chains.
+type extAuthzConfig struct {
+	hostname        string
+	port            uint32
+	uri             string
+	protocol        string
+	timeout         time.Duration
+	failOpen        bool
+	allowedHeaders  []string
+	upstreamHeaders []string
+}
+
+// newExtAuthzConfig returns the external authorization configuration of the proxy, or nil if it has none.
+func newExtAuthzConfig(node *model.Proxy) *extAuthzConfig {
+	if node.Metadata == nil || node.Metadata.ExtAuthzServer == "" {
+		return nil
+	}
+	md := node.Metadata
+
+	hostname, port, err := net.SplitHostPort(md.ExtAuthzServer)
+	if err != nil {
+		rbacLog.Errorf("invalid external authorization server %q of %s: %v", md.ExtAuthzServer, node.ID, err)
+		return nil
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		rbacLog.Errorf("invalid external authorization server %q of %s: %v", md.ExtAuthzServer, node.ID, err)
+		return nil
+	}
+
+	cfg := &extAuthzConfig{
+		hostname:        hostname,
+		port:            uint32(p),
+		uri:             "http://" + md.ExtAuthzServer,
+		protocol:        extAuthzProtocolGRPC,
+		timeout:         defaultExtAuthzTimeout,
+		failOpen:        md.ExtAuthzFailOpen == "true",
+		allowedHeaders:  splitHeaders(md.ExtAuthzAllowedHeaders),
+		upstreamHeaders: splitHeaders(md.ExtAuthzUpstreamHeaders),
+	}
+
+	switch strings.ToLower(md.ExtAuthzProtocol) {
+	case "", extAuthzProtocolGRPC:
+	case extAuthzProtocolHTTP:
+		cfg.protocol = extAuthzProtocolHTTP
+	default:
+		rbacLog.Errorf("invalid external authorization protocol %q of %s", md.ExtAuthzProtocol, node.ID)
+		return nil
+	}
+
+	if md.ExtAuthzTimeout != "" {
+		timeout, err := time.ParseDuration(md.ExtAuthzTimeout)
+		if err != nil || timeout <= 0 {
+			rbacLog.Errorf("invalid external authorization timeout %q of %s, using %v",
+				md.ExtAuthzTimeout, node.ID, defaultExtAuthzTimeout)
+		} else {
+			cfg.timeout = timeout
+		}
+	}
+	return cfg
+}
+
+// buildCluster builds the cluster of the authorization service.
+func (c *extAuthzConfig) buildCluster(connectTimeout *types.Duration) *xdsapi.Cluster {
+	return util.BuildServiceCluster(extAuthzClusterName, c.hostname, c.port, connectTimeout, c.protocol == extAuthzProtocolGRPC)
+}
+
+func splitHeaders(s string) []string {
+	var out []string
+	for _, h := range strings.Split(s, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			out = append(out, strings.ToLower(h))
+		}
+	}
+	return out
+}
+
+func headerMatchers(headers []string) *envoy_matcher.ListStringMatcher {
+	if len(headers) == 0 {
+		return nil
+	}
+	out := &envoy_matcher.ListStringMatcher{}
+	for _, h := range headers {
+		out.Patterns = append(out.Patterns, &envoy_matcher.StringMatcher{
+			MatchPattern: &envoy_matcher.StringMatcher_Exact{Exact: h},
+		})
+	}
+	return out
+}
+
+func (c *extAuthzConfig) grpcService() *core.GrpcService {
+	return &core.GrpcService{
+		TargetSpecifier: &core.GrpcService_EnvoyGrpc_{
+			EnvoyGrpc: &core.GrpcService_EnvoyGrpc{ClusterName: extAuthzClusterName},
+		},
+		Timeout: ptypes.DurationProto(c.timeout),
+	}
+}
+
+// buildHTTPFilter builds the ext_authz HTTP filter.
+func (c *extAuthzConfig) buildHTTPFilter(isXDSMarshalingToAnyEnabled bool) *http_filter.HttpFilter {
+	if c == nil {
+		return nil
+	}
+
+	config := &ext_authz_http.ExtAuthz{
+		FailureModeAllow: c.failOpen,
+	}
+	if c.protocol == extAuthzProtocolHTTP {
+		config.Services = &ext_authz_http.ExtAuthz_HttpService{
+			HttpService: &ext_authz_http.HttpService{
+				ServerUri: &core.HttpUri{
+					Uri:              c.uri,
+					HttpUpstreamType: &core.HttpUri_Cluster{Cluster: extAuthzClusterName},
+					Timeout:          ptypes.DurationProto(c.timeout),
+				},
+				AuthorizationRequest: &ext_authz_http.AuthorizationRequest{
+					AllowedHeaders: headerMatchers(c.allowedHeaders),
+				},
+				AuthorizationResponse: &ext_authz_http.AuthorizationResponse{
+					AllowedUpstreamHeaders: headerMatchers(c.upstreamHeaders),
+				},
+			},
+		}
+	} else {
+		config.Services = &ext_authz_http.ExtAuthz_GrpcService{GrpcService: c.grpcService()}
+	}
+
+	out := &http_filter.HttpFilter{
+		Name: extAuthzFilterName,
+	}
+	if isXDSMarshalingToAnyEnabled {
+		out.ConfigType = &http_filter.HttpFilter_TypedConfig{TypedConfig: util.MessageToAny(config)}
+	} else {
+		out.ConfigType = &http_filter.HttpFilter_Config{Config: util.MessageToStruct(config)}
+	}
+	rbacLog.Debugf("built ext_authz http filter config: %v", out)
+	return out
+}
+
+// buildTCPFilter builds the ext_authz network filter. The network filter only supports gRPC services.
+func (c *extAuthzConfig) buildTCPFilter(isXDSMarshalingToAnyEnabled bool) *tcp_filter.Filter {
+	if c == nil {
+		return nil
+	}
+	if c.protocol != extAuthzProtocolGRPC {
+		rbacLog.Debugf("skipped ext_authz tcp filter for %s authorization service %s", c.protocol, c.hostname)
+		return nil
+	}
+
+	config := &ext_authz_tcp.ExtAuthz{
+		StatPrefix:       extAuthzStatPrefix,
+		GrpcService:      c.grpcService(),
+		FailureModeAllow: c.failOpen,
+	}
+
+	out := &tcp_filter.Filter{
+		Name: extAuthzFilterName,
+	}
+	if isXDSMarshalingToAnyEnabled {
+		out.ConfigType = &tcp_filter.Filter_TypedConfig{TypedConfig: util.MessageToAny(config)}
+	} else {
+		out.ConfigType = &tcp_filter.Filter_Config{Config: util.MessageToStruct(config)}
+	}
+	rbacLog.Debugf("built ext_authz tcp filter config: %v", out)
+	return out
+}
@@ -0,0 +1,292 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authz
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	tcp_filter "github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
+	ext_authz_http "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/ext_authz/v2"
+	ext_authz_tcp "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/ext_authz/v2"
+	http_filter "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	envoy_matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher"
+	"github.com/golang/protobuf/ptypes"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/plugin"
+	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pkg/config/mesh"
+)
+
+func TestNewExtAuthzConfig(t *testing.T) {
+	cases := []struct {
+		name     string
+		metadata *model.NodeMetadata
+		expected *extAuthzConfig
+	}{
+		{
+			name:     "no annotation",
+			metadata: &model.NodeMetadata{},
+		},
+		{
+			name:     "defaults",
+			metadata: &model.NodeMetadata{ExtAuthzServer: "authz.foo.svc.cluster.local:9000"},
+			expected: &extAuthzConfig{
+				hostname: "authz.foo.svc.cluster.local",
+				port:     9000,
+				uri:      "http://authz.foo.svc.cluster.local:9000",
+				protocol: extAuthzProtocolGRPC,
+				timeout:  defaultExtAuthzTimeout,
+			},
+		},
+		{
+			name: "http",
+			metadata: &model.NodeMetadata{
+				ExtAuthzServer:          "authz.foo.svc.cluster.local:9000",
+				ExtAuthzProtocol:        "HTTP",
+				ExtAuthzTimeout:         "1s",
+				ExtAuthzFailOpen:        "true",
+				ExtAuthzAllowedHeaders:  "Authorization, x-api-key",
+				ExtAuthzUpstreamHeaders: "x-user-id",
+			},
+			expected: &extAuthzConfig{
+				hostname:        "authz.foo.svc.cluster.local",
+				port:            9000,
+				uri:             "http://authz.foo.svc.cluster.local:9000",
+				protocol:        extAuthzProtocolHTTP,
+				timeout:         time.Second,
+				failOpen:        true,
+				allowedHeaders:  []string{"authorization", "x-api-key"},
+				upstreamHeaders: []string{"x-user-id"},
+			},
+		},
+		{
+			name: "invalid timeout",
+			metadata: &model.NodeMetadata{
+				ExtAuthzServer:  "authz.foo.svc.cluster.local:9000",
+				ExtAuthzTimeout: "soon",
+			},
+			expected: &extAuthzConfig{
+				hostname: "authz.foo.svc.cluster.local",
+				port:     9000,
+				uri:      "http://authz.foo.svc.cluster.local:9000",
+				protocol: extAuthzProtocolGRPC,
+				timeout:  defaultExtAuthzTimeout,
+			},
+		},
+		{
+			name:     "no port",
+			metadata: &model.NodeMetadata{ExtAuthzServer: "authz.foo.svc.cluster.local"},
+		},
+		{
+			name: "invalid protocol",
+			metadata: &model.NodeMetadata{
+				ExtAuthzServer:   "authz.foo.svc.cluster.local:9000",
+				ExtAuthzProtocol: "thrift",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := newExtAuthzConfig(&model.Proxy{Metadata: tc.metadata})
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("got %+v, want %+v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestBuildFilterExtAuthz(t *testing.T) {
+	grpcService := &core.GrpcService{
+		TargetSpecifier: &core.GrpcService_EnvoyGrpc_{
+			EnvoyGrpc: &core.GrpcService_EnvoyGrpc{ClusterName: extAuthzClusterName},
+		},
+		Timeout: ptypes.DurationProto(defaultExtAuthzTimeout),
+	}
+	grpcHTTPFilter := &http_filter.HttpFilter{
+		Name: extAuthzFilterName,
+		ConfigType: &http_filter.HttpFilter_TypedConfig{
+			TypedConfig: util.MessageToAny(&ext_authz_http.ExtAuthz{
+				Services: &ext_authz_http.ExtAuthz_GrpcService{GrpcService: grpcService},
+			}),
+		},
+	}
+	grpcTCPFilter := &tcp_filter.Filter{
+		Name: extAuthzFilterName,
+		ConfigType: &tcp_filter.Filter_TypedConfig{
+			TypedConfig: util.MessageToAny(&ext_authz_tcp.ExtAuthz{
+				StatPrefix:  extAuthzStatPrefix,
+				GrpcService: grpcService,
+			}),
+		},
+	}
+	httpHTTPFilter := &http_filter.HttpFilter{
+		Name: extAuthzFilterName,
+		ConfigType: &http_filter.HttpFilter_TypedConfig{
+			TypedConfig: util.MessageToAny(&ext_authz_http.ExtAuthz{
+				FailureModeAllow: true,
+				Services: &ext_authz_http.ExtAuthz_HttpService{
+					HttpService: &ext_authz_http.HttpService{
+						ServerUri: &core.HttpUri{
+							Uri:              "http://authz.foo.svc.cluster.local:9000",
+							HttpUpstreamType: &core.HttpUri_Cluster{Cluster: extAuthzClusterName},
+							Timeout:          ptypes.DurationProto(defaultExtAuthzTimeout),
+						},
+						AuthorizationRequest: &ext_authz_http.AuthorizationRequest{
+							AllowedHeaders: &envoy_matcher.ListStringMatcher{
+								Patterns: []*envoy_matcher.StringMatcher{
+									{MatchPattern: &envoy_matcher.StringMatcher_Exact{Exact: "authorization"}},
+								},
+							},
+						},
+						AuthorizationResponse: &ext_authz_http.AuthorizationResponse{},
+					},
+				},
+			}),
+		},
+	}
+
+	cases := []struct {
+		name         string
+		nodeType     model.NodeType
+		metadata     *model.NodeMetadata
+		protocol     plugin.ListenerProtocol
+		expectedHTTP []*http_filter.HttpFilter
+		expectedTCP  []*tcp_filter.Filter
+	}{
+		{
+			name:     "no ext_authz",
+			nodeType: model.SidecarProxy,
+			metadata: &model.NodeMetadata{},
+			protocol: plugin.ListenerProtocolAuto,
+		},
+		{
+			name:         "grpc sidecar",
+			nodeType:     model.SidecarProxy,
+			metadata:     &model.NodeMetadata{ExtAuthzServer: "authz.foo.svc.cluster.local:9000"},
+			protocol:     plugin.ListenerProtocolAuto,
+			expectedHTTP: []*http_filter.HttpFilter{grpcHTTPFilter},
+			expectedTCP:  []*tcp_filter.Filter{grpcTCPFilter},
+		},
+		{
+			name:     "http sidecar",
+			nodeType: model.SidecarProxy,
+			metadata: &model.NodeMetadata{
+				ExtAuthzServer:         "authz.foo.svc.cluster.local:9000",
+				ExtAuthzProtocol:       "http",
+				ExtAuthzFailOpen:       "true",
+				ExtAuthzAllowedHeaders: "Authorization",
+			},
+			protocol:     plugin.ListenerProtocolAuto,
+			expectedHTTP: []*http_filter.HttpFilter{httpHTTPFilter},
+		},
+		{
+			name:         "grpc gateway",
+			nodeType:     model.Router,
+			metadata:     &model.NodeMetadata{ExtAuthzServer: "authz.foo.svc.cluster.local:9000"},
+			protocol:     plugin.ListenerProtocolTCP,
+			expectedHTTP: []*http_filter.HttpFilter{grpcHTTPFilter},
+			expectedTCP:  []*tcp_filter.Filter{grpcTCPFilter},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			in := &plugin.InputParams{
+				ListenerProtocol: tc.protocol,
+				Node:             &model.Proxy{Type: tc.nodeType, Metadata: tc.metadata},
+				ServiceInstance: &model.ServiceInstance{
+					Service: &model.Service{
+						Hostname:   "httpbin.foo.svc.cluster.local",
+						Attributes: model.ServiceAttributes{Name: "httpbin", Namespace: "foo"},
+					},
+				},
+				Push: &model.PushContext{},
+			}
+			mutable := &plugin.MutableObjects{
+				FilterChains: []plugin.FilterChain{
+					{ListenerProtocol: plugin.ListenerProtocolHTTP},
+					{ListenerProtocol: plugin.ListenerProtocolTCP},
+				},
+			}
+			buildFilter(in, mutable)
+
+			if got := mutable.FilterChains[0].HTTP; !reflect.DeepEqual(got, tc.expectedHTTP) {
+				t.Errorf("HTTP filters: got %v, want %v", got, tc.expectedHTTP)
+			}
+			if got := mutable.FilterChains[1].TCP; !reflect.DeepEqual(got, tc.expectedTCP) {
+				t.Errorf("TCP filters: got %v, want %v", got, tc.expectedTCP)
+			}
+		})
+	}
+}
+
+func TestOnServiceClustersExtAuthz(t *testing.T) {
+	m := mesh.DefaultMeshConfig()
+	cases := []struct {
+		name     string
+		metadata *model.NodeMetadata
+		http2    bool
+	}{
+		{
+			name:     "no ext_authz",
+			metadata: &model.NodeMetadata{},
+		},
+		{
+			name:     "grpc",
+			metadata: &model.NodeMetadata{ExtAuthzServer: "authz.foo.svc.cluster.local:9000"},
+			http2:    true,
+		},
+		{
+			name:     "http",
+			metadata: &model.NodeMetadata{ExtAuthzServer: "authz.foo.svc.cluster.local:9000", ExtAuthzProtocol: "http"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			in := &plugin.InputParams{
+				Env:  &model.Environment{Mesh: &m},
+				Node: &model.Proxy{Type: model.SidecarProxy, Metadata: tc.metadata},
+			}
+			clusters := NewPlugin().(plugin.ClusterPlugin).OnServiceClusters(in)
+			if tc.metadata.ExtAuthzServer == "" {
+				if len(clusters) != 0 {
+					t.Errorf("unexpected clusters: %v", clusters)
+				}
+				return
+			}
+			if len(clusters) != 1 {
+				t.Fatalf("got %d clusters, want 1", len(clusters))
+			}
+			c := clusters[0]
+			if c.Name != extAuthzClusterName || c.GetType() != xdsapi.Cluster_STRICT_DNS {
+				t.Errorf("unexpected cluster: %v", c)
+			}
+			if got := c.Http2ProtocolOptions != nil; got != tc.http2 {
+				t.Errorf("got HTTP/2 %v, want %v", got, tc.http2)
+			}
+			address := c.LoadAssignment.Endpoints[0].LbEndpoints[0].GetEndpoint().Address.GetSocketAddress()
+			if address.Address != "authz.foo.svc.cluster.local" || address.GetPortValue() != 9000 {
+				t.Errorf("got address %v, want authz.foo.svc.cluster.local:9000", address)
+			}
+		})
+	}
+}
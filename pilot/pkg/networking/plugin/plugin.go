@@ -49,6 +49,10 @@ const (
 	Health = "health"
 	// Mixer is the name of the mixer plugin passed through the command line
 	Mixer = "mixer"
+	// RateLimit is the name of the global rate limit plugin passed through the command line
+	RateLimit = "ratelimit"
+	// Transcoder is the name of the gRPC-JSON transcoder plugin passed through the command line
+	Transcoder = "transcoder"
 )
 
 // ModelProtocolToListenerProtocol converts from a config.Protocol to its corresponding plugin.ListenerProtocol
@@ -74,7 +78,8 @@ func ModelProtocolToListenerProtocol(node *model.Proxy, p protocol.Instance,
 	case protocol.HTTP, protocol.HTTP2, protocol.GRPC, protocol.GRPCWeb:
 		return ListenerProtocolHTTP
 	case protocol.TCP, protocol.HTTPS, protocol.TLS,
-		protocol.Mongo, protocol.Redis, protocol.MySQL:
+		protocol.Mongo, protocol.Redis, protocol.MySQL, protocol.Thrift, protocol.Dubbo,
+		protocol.Kafka, protocol.Postgres:
 		return ListenerProtocolTCP
 	case protocol.UDP:
 		return ListenerProtocolUnknown
@@ -192,3 +197,12 @@ type Plugin interface {
 	// configuration, like FilterChainMatch and TLSContext.
 	OnInboundFilterChains(in *InputParams) []FilterChain
 }
+
+// ClusterPlugin is implemented by plugins whose filters call a service of their own, such as an external
+// authorization or rate limit service. The clusters of these services are added to the CDS output
+// regardless of the services visible to the proxy, so that a Sidecar resource narrowing the egress of the
+// workload does not leave the filters without a cluster.
+type ClusterPlugin interface {
+	// OnServiceClusters returns the clusters of the services called by the filters of the plugin.
+	OnServiceClusters(in *InputParams) []*xdsapi.Cluster
+}
@@ -0,0 +1,262 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ratelimit configures the Envoy global rate limit filter, which asks an external gRPC
+// rate limit service whether each request is over its limit.
+//
+// The filter is configured on the inbound path of sidecars and on gateways, where it protects the
+// destination regardless of the clients. Each virtual host sends a descriptor with the destination
+// cluster, and one more per header listed in PILOT_RATE_LIMIT_REQUEST_HEADERS. Named routes of
+// virtual services also send a descriptor with the route name, so that limits can be set per route.
+// The filter calls the service through a cluster of its own, added to the clusters of every proxy.
+package ratelimit
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	route "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	rlfilter "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/rate_limit/v2"
+	http_conn "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	rlconfig "github.com/envoyproxy/go-control-plane/envoy/config/ratelimit/v2"
+	xdsutil "github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/golang/protobuf/ptypes"
+
+	"istio.io/pkg/log"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/model"
+	istio_route "istio.io/istio/pilot/pkg/networking/core/v1alpha3/route"
+	"istio.io/istio/pilot/pkg/networking/plugin"
+	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pkg/proto"
+)
+
+// Plugin configures the Envoy global rate limit filter.
+type Plugin struct{}
+
+var _ plugin.ClusterPlugin = Plugin{}
+
+// NewPlugin returns an instance of the rate limit plugin.
+func NewPlugin() plugin.Plugin {
+	return Plugin{}
+}
+
+// ServiceClusterName is the name of the cluster of the rate limit service. The plugin adds it to the clusters of
+// the proxies itself, so that it exists even if a Sidecar resource hides the service from the proxy.
+const ServiceClusterName = "rate_limit_service"
+
+// serviceAddress returns the hostname and port of the rate limit service, or false if rate limiting is disabled.
+func serviceAddress() (string, uint32, bool) {
+	address := features.RateLimitService.Get()
+	if address == "" {
+		return "", 0, false
+	}
+	hostname, port, err := net.SplitHostPort(address)
+	if err != nil {
+		log.Warnf("invalid %s %q: %v", features.RateLimitService.Name, address, err)
+		return "", 0, false
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		log.Warnf("invalid %s %q: %v", features.RateLimitService.Name, address, err)
+		return "", 0, false
+	}
+	return hostname, uint32(p), true
+}
+
+// enabled returns true if the rate limit service is set.
+func enabled() bool {
+	_, _, ok := serviceAddress()
+	return ok
+}
+
+// buildHTTPFilter returns the rate limit HTTP filter sending requests to the cluster of the rate limit service.
+func buildHTTPFilter(node *model.Proxy) *http_conn.HttpFilter {
+	config := &rlfilter.RateLimit{
+		Domain:          features.RateLimitDomain.Get(),
+		Timeout:         ptypes.DurationProto(features.RateLimitTimeout.Get()),
+		FailureModeDeny: features.RateLimitFailureModeDeny.Get(),
+		RateLimitService: &rlconfig.RateLimitServiceConfig{
+			GrpcService: &core.GrpcService{
+				TargetSpecifier: &core.GrpcService_EnvoyGrpc_{
+					EnvoyGrpc: &core.GrpcService_EnvoyGrpc{ClusterName: ServiceClusterName},
+				},
+			},
+		},
+	}
+
+	out := &http_conn.HttpFilter{
+		Name: xdsutil.HTTPRateLimit,
+	}
+	if util.IsXDSMarshalingToAnyEnabled(node) {
+		out.ConfigType = &http_conn.HttpFilter_TypedConfig{TypedConfig: util.MessageToAny(config)}
+	} else {
+		out.ConfigType = &http_conn.HttpFilter_Config{Config: util.MessageToStruct(config)}
+	}
+	return out
+}
+
+// requestHeaders returns the names of the request headers added to the descriptors.
+func requestHeaders() []string {
+	var headers []string
+	for _, h := range strings.Split(features.RateLimitRequestHeaders.Get(), ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			headers = append(headers, strings.ToLower(h))
+		}
+	}
+	return headers
+}
+
+func destinationClusterAction() *route.RateLimit_Action {
+	return &route.RateLimit_Action{
+		ActionSpecifier: &route.RateLimit_Action_DestinationCluster_{
+			DestinationCluster: &route.RateLimit_Action_DestinationCluster{},
+		},
+	}
+}
+
+// buildVirtualHostRateLimits returns the descriptors sent for all the requests of a virtual host:
+// the destination cluster alone, and with the value of each configured request header.
+func buildVirtualHostRateLimits() []*route.RateLimit {
+	out := []*route.RateLimit{
+		{Actions: []*route.RateLimit_Action{destinationClusterAction()}},
+	}
+	for _, h := range requestHeaders() {
+		out = append(out, &route.RateLimit{
+			Actions: []*route.RateLimit_Action{
+				destinationClusterAction(),
+				{
+					ActionSpecifier: &route.RateLimit_Action_RequestHeaders_{
+						RequestHeaders: &route.RateLimit_Action_RequestHeaders{HeaderName: h, DescriptorKey: h},
+					},
+				},
+			},
+		})
+	}
+	return out
+}
+
+// buildRouteRateLimits returns the descriptors sent for the requests of a named route, in addition to the
+// descriptors of its virtual host.
+func buildRouteRateLimits(name string) []*route.RateLimit {
+	return []*route.RateLimit{
+		{
+			Actions: []*route.RateLimit_Action{
+				destinationClusterAction(),
+				{
+					ActionSpecifier: &route.RateLimit_Action_GenericKey_{
+						GenericKey: &route.RateLimit_Action_GenericKey{DescriptorValue: name},
+					},
+				},
+			},
+		},
+	}
+}
+
+// addRateLimits adds the rate limit descriptors to the virtual hosts and routes of the route configuration.
+func addRateLimits(routeConfiguration *xdsapi.RouteConfiguration) {
+	for _, virtualHost := range routeConfiguration.VirtualHosts {
+		virtualHost.RateLimits = append(virtualHost.RateLimits, buildVirtualHostRateLimits()...)
+		for _, r := range virtualHost.Routes {
+			action, ok := r.Action.(*route.Route_Route)
+			if !ok || action.Route == nil || r.Name == "" || r.Name == istio_route.DefaultRouteName {
+				continue
+			}
+			action.Route.RateLimits = append(action.Route.RateLimits, buildRouteRateLimits(r.Name)...)
+			// The descriptors of the virtual host are only sent for routes without rate limits otherwise.
+			action.Route.IncludeVhRateLimits = proto.BoolTrue
+		}
+	}
+}
+
+func addHTTPFilter(in *plugin.InputParams, mutable *plugin.MutableObjects) {
+	filter := buildHTTPFilter(in.Node)
+	for cnum := range mutable.FilterChains {
+		if mutable.FilterChains[cnum].ListenerProtocol == plugin.ListenerProtocolHTTP {
+			mutable.FilterChains[cnum].HTTP = append(mutable.FilterChains[cnum].HTTP, filter)
+		}
+	}
+}
+
+// OnOutboundListener adds the rate limit filter to the HTTP filter chains of gateways.
+func (Plugin) OnOutboundListener(in *plugin.InputParams, mutable *plugin.MutableObjects) error {
+	if in.Node.Type != model.Router {
+		return nil
+	}
+	if enabled() {
+		addHTTPFilter(in, mutable)
+	}
+	return nil
+}
+
+// OnInboundListener adds the rate limit filter to the HTTP filter chains of the inbound listeners of sidecars.
+func (Plugin) OnInboundListener(in *plugin.InputParams, mutable *plugin.MutableObjects) error {
+	if in.Node.Type != model.SidecarProxy {
+		return nil
+	}
+	if enabled() {
+		addHTTPFilter(in, mutable)
+	}
+	return nil
+}
+
+// OnVirtualListener implements the Plugin interface method.
+func (Plugin) OnVirtualListener(in *plugin.InputParams, mutable *plugin.MutableObjects) error {
+	return nil
+}
+
+// OnOutboundCluster implements the Plugin interface method.
+func (Plugin) OnOutboundCluster(in *plugin.InputParams, cluster *xdsapi.Cluster) {
+}
+
+// OnServiceClusters returns the cluster of the rate limit service for sidecars and gateways.
+func (Plugin) OnServiceClusters(in *plugin.InputParams) []*xdsapi.Cluster {
+	if in.Node.Type != model.SidecarProxy && in.Node.Type != model.Router {
+		return nil
+	}
+	hostname, port, ok := serviceAddress()
+	if !ok {
+		return nil
+	}
+	return []*xdsapi.Cluster{util.BuildServiceCluster(ServiceClusterName, hostname, port, in.Env.Mesh.ConnectTimeout, true)}
+}
+
+// OnInboundCluster implements the Plugin interface method.
+func (Plugin) OnInboundCluster(in *plugin.InputParams, cluster *xdsapi.Cluster) {
+}
+
+// OnOutboundRouteConfiguration adds the rate limit descriptors to the routes of gateways.
+func (Plugin) OnOutboundRouteConfiguration(in *plugin.InputParams, routeConfiguration *xdsapi.RouteConfiguration) {
+	if in.Node.Type != model.Router || !enabled() {
+		return
+	}
+	addRateLimits(routeConfiguration)
+}
+
+// OnInboundRouteConfiguration adds the rate limit descriptors to the inbound routes of sidecars.
+func (Plugin) OnInboundRouteConfiguration(in *plugin.InputParams, routeConfiguration *xdsapi.RouteConfiguration) {
+	if in.Node.Type != model.SidecarProxy || in.ListenerProtocol != plugin.ListenerProtocolHTTP || !enabled() {
+		return
+	}
+	addRateLimits(routeConfiguration)
+}
+
+// OnInboundFilterChains implements the Plugin interface method.
+func (Plugin) OnInboundFilterChains(in *plugin.InputParams) []plugin.FilterChain {
+	return nil
+}
@@ -0,0 +1,268 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	route "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	rlfilter "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/rate_limit/v2"
+	http_conn "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	rlconfig "github.com/envoyproxy/go-control-plane/envoy/config/ratelimit/v2"
+	"github.com/golang/protobuf/ptypes"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/plugin"
+	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pkg/config/mesh"
+)
+
+func setEnv(t *testing.T, env map[string]string) func() {
+	t.Helper()
+	for k, v := range env {
+		if err := os.Setenv(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return func() {
+		for k := range env {
+			_ = os.Unsetenv(k)
+		}
+	}
+}
+
+func TestOnListener(t *testing.T) {
+	defer setEnv(t, map[string]string{
+		features.RateLimitService.Name:         "ratelimit.istio-system.svc.cluster.local:8081",
+		features.RateLimitFailureModeDeny.Name: "true",
+	})()
+
+	expected := &http_conn.HttpFilter{
+		Name: "envoy.rate_limit",
+		ConfigType: &http_conn.HttpFilter_TypedConfig{
+			TypedConfig: util.MessageToAny(&rlfilter.RateLimit{
+				Domain:          "istio",
+				Timeout:         ptypes.DurationProto(20 * time.Millisecond),
+				FailureModeDeny: true,
+				RateLimitService: &rlconfig.RateLimitServiceConfig{
+					GrpcService: &core.GrpcService{
+						TargetSpecifier: &core.GrpcService_EnvoyGrpc_{
+							EnvoyGrpc: &core.GrpcService_EnvoyGrpc{
+								ClusterName: ServiceClusterName,
+							},
+						},
+					},
+				},
+			}),
+		},
+	}
+
+	cases := []struct {
+		name     string
+		node     model.NodeType
+		inbound  bool
+		expected bool
+	}{
+		{name: "sidecar inbound", node: model.SidecarProxy, inbound: true, expected: true},
+		{name: "sidecar outbound", node: model.SidecarProxy, inbound: false, expected: false},
+		{name: "gateway", node: model.Router, inbound: false, expected: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			in := &plugin.InputParams{Node: &model.Proxy{Type: tc.node}}
+			mutable := &plugin.MutableObjects{
+				FilterChains: []plugin.FilterChain{
+					{ListenerProtocol: plugin.ListenerProtocolHTTP},
+					{ListenerProtocol: plugin.ListenerProtocolTCP},
+				},
+			}
+			var err error
+			if tc.inbound {
+				err = NewPlugin().OnInboundListener(in, mutable)
+			} else {
+				err = NewPlugin().OnOutboundListener(in, mutable)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var want []*http_conn.HttpFilter
+			if tc.expected {
+				want = []*http_conn.HttpFilter{expected}
+			}
+			if got := mutable.FilterChains[0].HTTP; !reflect.DeepEqual(got, want) {
+				t.Errorf("HTTP filters: got %v, want %v", got, want)
+			}
+			if got := mutable.FilterChains[1].HTTP; len(got) != 0 {
+				t.Errorf("unexpected HTTP filters in a TCP filter chain: %v", got)
+			}
+		})
+	}
+}
+
+func TestOnListenerDisabled(t *testing.T) {
+	for _, address := range []string{"", "ratelimit.istio-system", "ratelimit.istio-system:grpc"} {
+		t.Run(address, func(t *testing.T) {
+			defer setEnv(t, map[string]string{features.RateLimitService.Name: address})()
+			in := &plugin.InputParams{Node: &model.Proxy{Type: model.SidecarProxy}}
+			mutable := &plugin.MutableObjects{
+				FilterChains: []plugin.FilterChain{{ListenerProtocol: plugin.ListenerProtocolHTTP}},
+			}
+			if err := NewPlugin().OnInboundListener(in, mutable); err != nil {
+				t.Fatal(err)
+			}
+			if got := mutable.FilterChains[0].HTTP; len(got) != 0 {
+				t.Errorf("unexpected HTTP filters: %v", got)
+			}
+		})
+	}
+}
+
+func TestOnServiceClusters(t *testing.T) {
+	m := mesh.DefaultMeshConfig()
+	cases := []struct {
+		name     string
+		address  string
+		node     model.NodeType
+		expected bool
+	}{
+		{name: "sidecar", address: "ratelimit.istio-system.svc.cluster.local:8081", node: model.SidecarProxy, expected: true},
+		{name: "gateway", address: "ratelimit.istio-system.svc.cluster.local:8081", node: model.Router, expected: true},
+		{name: "disabled", node: model.SidecarProxy},
+		{name: "invalid port", address: "ratelimit.istio-system:grpc", node: model.SidecarProxy},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer setEnv(t, map[string]string{features.RateLimitService.Name: tc.address})()
+			in := &plugin.InputParams{
+				Env:  &model.Environment{Mesh: &m},
+				Node: &model.Proxy{Type: tc.node},
+			}
+			clusters := NewPlugin().(plugin.ClusterPlugin).OnServiceClusters(in)
+			if !tc.expected {
+				if len(clusters) != 0 {
+					t.Errorf("unexpected clusters: %v", clusters)
+				}
+				return
+			}
+			if len(clusters) != 1 {
+				t.Fatalf("got %d clusters, want 1", len(clusters))
+			}
+			c := clusters[0]
+			if c.Name != ServiceClusterName || c.GetType() != xdsapi.Cluster_STRICT_DNS || c.Http2ProtocolOptions == nil {
+				t.Errorf("unexpected cluster: %v", c)
+			}
+			address := c.LoadAssignment.Endpoints[0].LbEndpoints[0].GetEndpoint().Address.GetSocketAddress()
+			if address.Address != "ratelimit.istio-system.svc.cluster.local" || address.GetPortValue() != 8081 {
+				t.Errorf("got address %v, want ratelimit.istio-system.svc.cluster.local:8081", address)
+			}
+		})
+	}
+}
+
+func TestOnRouteConfiguration(t *testing.T) {
+	defer setEnv(t, map[string]string{
+		features.RateLimitService.Name:        "ratelimit.istio-system.svc.cluster.local:8081",
+		features.RateLimitRequestHeaders.Name: "x-user-id, X-API-Key",
+	})()
+
+	newRoute := func(name string) *route.Route {
+		return &route.Route{
+			Name: name,
+			Action: &route.Route_Route{
+				Route: &route.RouteAction{
+					ClusterSpecifier: &route.RouteAction_Cluster{Cluster: "outbound|9080||reviews.default.svc.cluster.local"},
+				},
+			},
+		}
+	}
+	routeConfiguration := &xdsapi.RouteConfiguration{
+		VirtualHosts: []*route.VirtualHost{
+			{
+				Name:   "reviews.default.svc.cluster.local:9080",
+				Routes: []*route.Route{newRoute("reviews.v2"), newRoute("default"), newRoute("")},
+			},
+		},
+	}
+	in := &plugin.InputParams{Node: &model.Proxy{Type: model.Router}}
+	NewPlugin().OnOutboundRouteConfiguration(in, routeConfiguration)
+
+	destinationCluster := &route.RateLimit_Action{
+		ActionSpecifier: &route.RateLimit_Action_DestinationCluster_{
+			DestinationCluster: &route.RateLimit_Action_DestinationCluster{},
+		},
+	}
+	requestHeader := func(h string) *route.RateLimit_Action {
+		return &route.RateLimit_Action{
+			ActionSpecifier: &route.RateLimit_Action_RequestHeaders_{
+				RequestHeaders: &route.RateLimit_Action_RequestHeaders{HeaderName: h, DescriptorKey: h},
+			},
+		}
+	}
+	wantVirtualHost := []*route.RateLimit{
+		{Actions: []*route.RateLimit_Action{destinationCluster}},
+		{Actions: []*route.RateLimit_Action{destinationCluster, requestHeader("x-user-id")}},
+		{Actions: []*route.RateLimit_Action{destinationCluster, requestHeader("x-api-key")}},
+	}
+	virtualHost := routeConfiguration.VirtualHosts[0]
+	if !reflect.DeepEqual(virtualHost.RateLimits, wantVirtualHost) {
+		t.Errorf("virtual host rate limits: got %v, want %v", virtualHost.RateLimits, wantVirtualHost)
+	}
+
+	wantRoute := []*route.RateLimit{
+		{
+			Actions: []*route.RateLimit_Action{
+				destinationCluster,
+				{
+					ActionSpecifier: &route.RateLimit_Action_GenericKey_{
+						GenericKey: &route.RateLimit_Action_GenericKey{DescriptorValue: "reviews.v2"},
+					},
+				},
+			},
+		},
+	}
+	named := virtualHost.Routes[0].GetRoute()
+	if !reflect.DeepEqual(named.RateLimits, wantRoute) {
+		t.Errorf("route rate limits: got %v, want %v", named.RateLimits, wantRoute)
+	}
+	if !named.GetIncludeVhRateLimits().GetValue() {
+		t.Errorf("expected the rate limits of the virtual host to be included in the named route")
+	}
+	for _, r := range virtualHost.Routes[1:] {
+		if action := r.GetRoute(); len(action.RateLimits) != 0 || action.IncludeVhRateLimits != nil {
+			t.Errorf("unexpected rate limits in route %q: %v", r.Name, action)
+		}
+	}
+}
+
+func TestOnInboundRouteConfigurationTCP(t *testing.T) {
+	defer setEnv(t, map[string]string{features.RateLimitService.Name: "ratelimit.istio-system.svc.cluster.local:8081"})()
+
+	routeConfiguration := &xdsapi.RouteConfiguration{VirtualHosts: []*route.VirtualHost{{Name: "inbound|tcp|9080"}}}
+	in := &plugin.InputParams{
+		Node:             &model.Proxy{Type: model.SidecarProxy},
+		ListenerProtocol: plugin.ListenerProtocolTCP,
+	}
+	NewPlugin().OnInboundRouteConfiguration(in, routeConfiguration)
+	if got := routeConfiguration.VirtualHosts[0].RateLimits; len(got) != 0 {
+		t.Errorf("unexpected rate limits: %v", got)
+	}
+}
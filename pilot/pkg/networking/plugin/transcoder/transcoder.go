@@ -0,0 +1,194 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package transcoder configures the Envoy gRPC-JSON transcoder filter, which lets HTTP/JSON clients call
+// gRPC services through the mappings of the google.api.http annotations of their proto definitions.
+//
+// The filter is enabled by the transcoding.istio.io annotations of the pods of the gRPC workloads, on the
+// inbound path of their sidecars, or of the gateways, on their HTTP servers.
+package transcoder
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	transcoder_filter "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/transcoder/v2"
+	http_conn "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+
+	"istio.io/pkg/log"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/plugin"
+	"istio.io/istio/pilot/pkg/networking/util"
+)
+
+// grpcJSONTranscoderFilterName is the name of the Envoy gRPC-JSON transcoder filter.
+const grpcJSONTranscoderFilterName = "envoy.grpc_json_transcoder"
+
+// Plugin configures the Envoy gRPC-JSON transcoder filter.
+type Plugin struct{}
+
+// NewPlugin returns an instance of the transcoder plugin.
+func NewPlugin() plugin.Plugin {
+	return Plugin{}
+}
+
+// config is the transcoding configuration of a proxy, read from the annotations of its pod.
+type config struct {
+	// descriptorPath is the path of the descriptor set in the proxy container, if descriptor is empty.
+	descriptorPath string
+	descriptor     []byte
+	services       []string
+	// ports are the ports on which requests are transcoded, or nil for the default ports.
+	ports map[int]bool
+}
+
+// newConfig returns the transcoding configuration of the proxy, or nil if it has none.
+func newConfig(node *model.Proxy) *config {
+	if node.Metadata == nil || node.Metadata.TranscodingDescriptorSet == "" {
+		return nil
+	}
+	md := node.Metadata
+
+	cfg := &config{}
+	if strings.HasPrefix(md.TranscodingDescriptorSet, "/") {
+		cfg.descriptorPath = md.TranscodingDescriptorSet
+	} else {
+		descriptor, err := base64.StdEncoding.DecodeString(md.TranscodingDescriptorSet)
+		if err != nil {
+			log.Errorf("invalid transcoding descriptor set of %s: %v", node.ID, err)
+			return nil
+		}
+		cfg.descriptor = descriptor
+	}
+
+	for _, s := range strings.Split(md.TranscodingServices, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			cfg.services = append(cfg.services, s)
+		}
+	}
+	if len(cfg.services) == 0 {
+		log.Errorf("no transcoding services for %s", node.ID)
+		return nil
+	}
+
+	for _, p := range strings.Split(md.TranscodingPorts, ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		port, err := strconv.Atoi(p)
+		if err != nil {
+			log.Errorf("invalid transcoding port %q of %s: %v", p, node.ID, err)
+			return nil
+		}
+		if cfg.ports == nil {
+			cfg.ports = make(map[int]bool)
+		}
+		cfg.ports[port] = true
+	}
+	return cfg
+}
+
+// appliesTo returns whether the requests on the port of the listener are transcoded.
+func (c *config) appliesTo(in *plugin.InputParams) bool {
+	if in.Port == nil {
+		return false
+	}
+	if c.ports != nil {
+		return c.ports[in.Port.Port]
+	}
+	// Gateways route to any service, sidecars only transcode on the ports of their gRPC services.
+	return in.Node.Type == model.Router || in.Port.Protocol.IsHTTP2()
+}
+
+// buildHTTPFilter builds the gRPC-JSON transcoder HTTP filter.
+func (c *config) buildHTTPFilter(isXDSMarshalingToAnyEnabled bool) *http_conn.HttpFilter {
+	transcoder := &transcoder_filter.GrpcJsonTranscoder{
+		Services: c.services,
+	}
+	if c.descriptor != nil {
+		transcoder.DescriptorSet = &transcoder_filter.GrpcJsonTranscoder_ProtoDescriptorBin{ProtoDescriptorBin: c.descriptor}
+	} else {
+		transcoder.DescriptorSet = &transcoder_filter.GrpcJsonTranscoder_ProtoDescriptor{ProtoDescriptor: c.descriptorPath}
+	}
+
+	out := &http_conn.HttpFilter{
+		Name: grpcJSONTranscoderFilterName,
+	}
+	if isXDSMarshalingToAnyEnabled {
+		out.ConfigType = &http_conn.HttpFilter_TypedConfig{TypedConfig: util.MessageToAny(transcoder)}
+	} else {
+		out.ConfigType = &http_conn.HttpFilter_Config{Config: util.MessageToStruct(transcoder)}
+	}
+	return out
+}
+
+func addHTTPFilter(in *plugin.InputParams, mutable *plugin.MutableObjects) {
+	cfg := newConfig(in.Node)
+	if cfg == nil || !cfg.appliesTo(in) {
+		return
+	}
+	filter := cfg.buildHTTPFilter(util.IsXDSMarshalingToAnyEnabled(in.Node))
+	for cnum := range mutable.FilterChains {
+		if mutable.FilterChains[cnum].ListenerProtocol == plugin.ListenerProtocolHTTP {
+			mutable.FilterChains[cnum].HTTP = append(mutable.FilterChains[cnum].HTTP, filter)
+		}
+	}
+}
+
+// OnOutboundListener adds the transcoder filter to the HTTP filter chains of gateways.
+func (Plugin) OnOutboundListener(in *plugin.InputParams, mutable *plugin.MutableObjects) error {
+	if in.Node.Type != model.Router {
+		return nil
+	}
+	addHTTPFilter(in, mutable)
+	return nil
+}
+
+// OnInboundListener adds the transcoder filter to the HTTP filter chains of the inbound listeners of sidecars.
+func (Plugin) OnInboundListener(in *plugin.InputParams, mutable *plugin.MutableObjects) error {
+	if in.Node.Type != model.SidecarProxy {
+		return nil
+	}
+	addHTTPFilter(in, mutable)
+	return nil
+}
+
+// OnVirtualListener implements the Plugin interface method.
+func (Plugin) OnVirtualListener(in *plugin.InputParams, mutable *plugin.MutableObjects) error {
+	return nil
+}
+
+// OnOutboundCluster implements the Plugin interface method.
+func (Plugin) OnOutboundCluster(in *plugin.InputParams, cluster *xdsapi.Cluster) {
+}
+
+// OnInboundCluster implements the Plugin interface method.
+func (Plugin) OnInboundCluster(in *plugin.InputParams, cluster *xdsapi.Cluster) {
+}
+
+// OnOutboundRouteConfiguration implements the Plugin interface method.
+func (Plugin) OnOutboundRouteConfiguration(in *plugin.InputParams, routeConfiguration *xdsapi.RouteConfiguration) {
+}
+
+// OnInboundRouteConfiguration implements the Plugin interface method.
+func (Plugin) OnInboundRouteConfiguration(in *plugin.InputParams, routeConfiguration *xdsapi.RouteConfiguration) {
+}
+
+// OnInboundFilterChains implements the Plugin interface method.
+func (Plugin) OnInboundFilterChains(in *plugin.InputParams) []plugin.FilterChain {
+	return nil
+}
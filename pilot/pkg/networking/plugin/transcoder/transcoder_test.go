@@ -0,0 +1,209 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transcoder
+
+import (
+	"reflect"
+	"testing"
+
+	transcoder_filter "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/transcoder/v2"
+	http_conn "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/plugin"
+	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pkg/config/protocol"
+)
+
+func TestNewConfig(t *testing.T) {
+	cases := []struct {
+		name     string
+		metadata *model.NodeMetadata
+		expected *config
+	}{
+		{
+			name:     "no annotation",
+			metadata: &model.NodeMetadata{},
+		},
+		{
+			name: "descriptor file",
+			metadata: &model.NodeMetadata{
+				TranscodingDescriptorSet: "/etc/istio/descriptors/bookstore.pb",
+				TranscodingServices:      "bookstore.Bookstore, bookstore.Shelves",
+			},
+			expected: &config{
+				descriptorPath: "/etc/istio/descriptors/bookstore.pb",
+				services:       []string{"bookstore.Bookstore", "bookstore.Shelves"},
+			},
+		},
+		{
+			name: "descriptor content and ports",
+			metadata: &model.NodeMetadata{
+				TranscodingDescriptorSet: "CgVoZWxsbw==",
+				TranscodingServices:      "bookstore.Bookstore",
+				TranscodingPorts:         "8080,9090",
+			},
+			expected: &config{
+				descriptor: []byte("\n\x05hello"),
+				services:   []string{"bookstore.Bookstore"},
+				ports:      map[int]bool{8080: true, 9090: true},
+			},
+		},
+		{
+			name: "invalid descriptor content",
+			metadata: &model.NodeMetadata{
+				TranscodingDescriptorSet: "bookstore.pb",
+				TranscodingServices:      "bookstore.Bookstore",
+			},
+		},
+		{
+			name:     "no services",
+			metadata: &model.NodeMetadata{TranscodingDescriptorSet: "/etc/istio/descriptors/bookstore.pb"},
+		},
+		{
+			name: "invalid port",
+			metadata: &model.NodeMetadata{
+				TranscodingDescriptorSet: "/etc/istio/descriptors/bookstore.pb",
+				TranscodingServices:      "bookstore.Bookstore",
+				TranscodingPorts:         "http",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := newConfig(&model.Proxy{Metadata: tc.metadata})
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("got %+v, want %+v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestOnListener(t *testing.T) {
+	expected := []*http_conn.HttpFilter{{
+		Name: grpcJSONTranscoderFilterName,
+		ConfigType: &http_conn.HttpFilter_TypedConfig{
+			TypedConfig: util.MessageToAny(&transcoder_filter.GrpcJsonTranscoder{
+				DescriptorSet: &transcoder_filter.GrpcJsonTranscoder_ProtoDescriptor{
+					ProtoDescriptor: "/etc/istio/descriptors/bookstore.pb",
+				},
+				Services: []string{"bookstore.Bookstore"},
+			}),
+		},
+	}}
+	metadata := &model.NodeMetadata{
+		TranscodingDescriptorSet: "/etc/istio/descriptors/bookstore.pb",
+		TranscodingServices:      "bookstore.Bookstore",
+	}
+	withPorts := &model.NodeMetadata{
+		TranscodingDescriptorSet: "/etc/istio/descriptors/bookstore.pb",
+		TranscodingServices:      "bookstore.Bookstore",
+		TranscodingPorts:         "8080",
+	}
+
+	cases := []struct {
+		name     string
+		nodeType model.NodeType
+		metadata *model.NodeMetadata
+		port     *model.Port
+		inbound  bool
+		expected []*http_conn.HttpFilter
+	}{
+		{
+			name:     "no annotation",
+			nodeType: model.SidecarProxy,
+			metadata: &model.NodeMetadata{},
+			port:     &model.Port{Port: 9090, Protocol: protocol.GRPC},
+			inbound:  true,
+		},
+		{
+			name:     "sidecar grpc port",
+			nodeType: model.SidecarProxy,
+			metadata: metadata,
+			port:     &model.Port{Port: 9090, Protocol: protocol.GRPC},
+			inbound:  true,
+			expected: expected,
+		},
+		{
+			name:     "sidecar http port",
+			nodeType: model.SidecarProxy,
+			metadata: metadata,
+			port:     &model.Port{Port: 8080, Protocol: protocol.HTTP},
+			inbound:  true,
+		},
+		{
+			name:     "sidecar annotated port",
+			nodeType: model.SidecarProxy,
+			metadata: withPorts,
+			port:     &model.Port{Port: 8080, Protocol: protocol.HTTP},
+			inbound:  true,
+			expected: expected,
+		},
+		{
+			name:     "sidecar outbound",
+			nodeType: model.SidecarProxy,
+			metadata: metadata,
+			port:     &model.Port{Port: 9090, Protocol: protocol.GRPC},
+		},
+		{
+			name:     "gateway",
+			nodeType: model.Router,
+			metadata: metadata,
+			port:     &model.Port{Port: 80, Protocol: protocol.HTTP},
+			expected: expected,
+		},
+		{
+			name:     "gateway other port",
+			nodeType: model.Router,
+			metadata: withPorts,
+			port:     &model.Port{Port: 80, Protocol: protocol.HTTP},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			in := &plugin.InputParams{
+				ListenerProtocol: plugin.ListenerProtocolHTTP,
+				Node:             &model.Proxy{Type: tc.nodeType, Metadata: tc.metadata},
+				Port:             tc.port,
+			}
+			mutable := &plugin.MutableObjects{
+				FilterChains: []plugin.FilterChain{
+					{ListenerProtocol: plugin.ListenerProtocolHTTP},
+					{ListenerProtocol: plugin.ListenerProtocolTCP},
+				},
+			}
+
+			p := NewPlugin()
+			var err error
+			if tc.inbound {
+				err = p.OnInboundListener(in, mutable)
+			} else {
+				err = p.OnOutboundListener(in, mutable)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := mutable.FilterChains[0].HTTP; !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("got HTTP filters %v, want %v", got, tc.expected)
+			}
+			if len(mutable.FilterChains[1].HTTP) != 0 {
+				t.Errorf("unexpected HTTP filters on a TCP filter chain: %v", mutable.FilterChains[1].HTTP)
+			}
+		})
+	}
+}
@@ -418,6 +418,37 @@ func LbPriority(proxyLocality, endpointsLocality *core.Locality) int {
 	return 3
 }
 
+// BuildServiceCluster returns a cluster resolving hostname with DNS, for a service called by an Envoy filter rather
+// than by the workload. It does not depend on the services visible to the proxy. The cluster uses HTTP/2, as
+// required by gRPC services, if http2 is set.
+func BuildServiceCluster(name, hostname string, port uint32, connectTimeout *types.Duration, http2 bool) *xdsapi.Cluster {
+	cluster := &xdsapi.Cluster{
+		Name:                 name,
+		ClusterDiscoveryType: &xdsapi.Cluster_Type{Type: xdsapi.Cluster_STRICT_DNS},
+		ConnectTimeout:       GogoDurationToDuration(connectTimeout),
+		LbPolicy:             xdsapi.Cluster_ROUND_ROBIN,
+		DnsLookupFamily:      xdsapi.Cluster_V4_ONLY,
+		LoadAssignment: &xdsapi.ClusterLoadAssignment{
+			ClusterName: name,
+			Endpoints: []*endpoint.LocalityLbEndpoints{
+				{
+					LbEndpoints: []*endpoint.LbEndpoint{
+						{
+							HostIdentifier: &endpoint.LbEndpoint_Endpoint{
+								Endpoint: &endpoint.Endpoint{Address: BuildAddress(hostname, port)},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if http2 {
+		cluster.Http2ProtocolOptions = &core.Http2ProtocolOptions{}
+	}
+	return cluster
+}
+
 // return a shallow copy cluster
 func CloneCluster(cluster *xdsapi.Cluster) xdsapi.Cluster {
 	out := xdsapi.Cluster{}
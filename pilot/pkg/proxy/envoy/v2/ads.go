@@ -25,6 +25,7 @@ import (
 	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
 	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 	ads "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	structpb "github.com/golang/protobuf/ptypes/struct"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/peer"
@@ -87,6 +88,8 @@ type XdsConnection struct {
 	LDSListeners []*xdsapi.Listener                    `json:"-"`
 	RouteConfigs map[string]*xdsapi.RouteConfiguration `json:"-"`
 	CDSClusters  []*xdsapi.Cluster
+	// NameTable is the last name table sent, which is not sent again until it changes.
+	NameTable *structpb.Struct `json:"-"`
 
 	// Last nonce sent and ack'd (timestamps) used for debugging
 	ClusterNonceSent, ClusterNonceAcked   string
@@ -109,10 +112,15 @@ type XdsConnection struct {
 	LDSWatch bool
 	// CDSWatch is set if the remote server is watching Clusters
 	CDSWatch bool
+	// NDSWatch is set if the remote server is watching the name table
+	NDSWatch bool
 
 	// added will be true if at least one discovery request was received, and the connection
 	// is added to the map of active.
 	added bool
+
+	// configSizes is the size of the config last pushed, per xDS type.
+	configSizes map[string]TypeConfigSize
 }
 
 // XdsEvent represents a config or registry event that results in a push.
@@ -382,6 +390,22 @@ func (s *DiscoveryServer) StreamAggregatedResources(stream ads.AggregatedDiscove
 					return err
 				}
 
+			case NameTableType:
+				if con.NDSWatch {
+					// Already received a name table watch request, this is an ACK
+					if discReq.ErrorDetail != nil {
+						adsLog.Warnf("ADS:NDS: ACK ERROR %v %s (%s) %v", peerAddr, con.ConID, con.node.ID, discReq.String())
+					}
+					adsLog.Debugf("ADS:NDS: ACK %s %s (%s) %s %s", peerAddr, con.ConID, con.node.ID, discReq.VersionInfo, discReq.ResponseNonce)
+					continue
+				}
+				adsLog.Debugf("ADS:NDS: REQ %s %v", con.ConID, peerAddr)
+				con.NDSWatch = true
+				err := s.pushNameTable(con, s.globalPushContext(), versionInfo())
+				if err != nil {
+					return err
+				}
+
 			default:
 				adsLog.Warnf("ADS: Unknown watched resources %s", discReq.String())
 			}
@@ -496,6 +520,11 @@ func (s *DiscoveryServer) pushConnection(con *XdsConnection, pushEv *XdsEvent) e
 				return err
 			}
 		}
+		if con.NDSWatch && nameTableUsesEndpoints(pushEv.push, pushEv.edsUpdatedServices) {
+			if err := s.pushNameTable(con, pushEv.push, versionInfo()); err != nil {
+				return err
+			}
+		}
 		return nil
 	}
 
@@ -558,6 +587,12 @@ func (s *DiscoveryServer) pushConnection(con *XdsConnection, pushEv *XdsEvent) e
 			return err
 		}
 	}
+	if con.NDSWatch {
+		err := s.pushNameTable(con, pushEv.push, currentVersion)
+		if err != nil {
+			return err
+		}
+	}
 	proxiesConvergeDelay.Record(time.Since(pushEv.start).Seconds())
 	return nil
 }
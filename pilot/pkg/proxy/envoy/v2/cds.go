@@ -54,6 +54,7 @@ func (s *DiscoveryServer) pushCds(con *XdsConnection, push *model.PushContext, v
 		con.CDSClusters = rawClusters
 	}
 	response := con.clusters(rawClusters)
+	recordConfigSize(con, cdsType, response, pushStart)
 	err := con.send(response)
 	cdsPushTime.Record(time.Since(pushStart).Seconds())
 	if err != nil {
@@ -70,6 +71,15 @@ func (s *DiscoveryServer) pushCds(con *XdsConnection, push *model.PushContext, v
 }
 
 func (s *DiscoveryServer) generateRawClusters(node *model.Proxy, push *model.PushContext) []*xdsapi.Cluster {
+	var cacheKey string
+	if s.cache != nil {
+		if cacheKey = s.xdsCacheKey(ClusterType, node, nil); cacheKey != "" {
+			if entry := s.cache.get(cacheKey, push); entry != nil {
+				return entry.clusters
+			}
+		}
+	}
+
 	rawClusters := s.ConfigGenerator.BuildClusters(s.Env, node, push)
 
 	for _, c := range rawClusters {
@@ -81,5 +91,11 @@ func (s *DiscoveryServer) generateRawClusters(node *model.Proxy, push *model.Pus
 			// Instead of panic, which will break down the whole cluster. Just ignore it here, let envoy process it.
 		}
 	}
+
+	if cacheKey != "" {
+		entry := newXdsCacheEntry(ClusterType, node)
+		entry.clusters = rawClusters
+		s.cache.add(cacheKey, push, entry)
+	}
 	return rawClusters
 }
@@ -0,0 +1,369 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/golang/protobuf/proto"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pkg/config/host"
+)
+
+const (
+	cdsType = "cds"
+	ldsType = "lds"
+	rdsType = "rds"
+	edsType = "eds"
+
+	// serviceContributor is the kind of the config size contributions of the services, as opposed to
+	// the Istio configs.
+	serviceContributor = "service"
+)
+
+// TypeConfigSize is the size of the config of an xDS type last pushed to a proxy.
+type TypeConfigSize struct {
+	Resources int `json:"resources"`
+	// Bytes is the serialized size of the resources.
+	Bytes int `json:"bytes"`
+	// GenerationTime is the time spent generating and serializing the resources, without sending them.
+	GenerationTime time.Duration `json:"generationTimeNanos"`
+}
+
+func (s *TypeConfigSize) add(o TypeConfigSize) {
+	s.Resources += o.Resources
+	s.Bytes += o.Bytes
+	s.GenerationTime += o.GenerationTime
+}
+
+// ProxyConfigSize is the size of the config last pushed to a proxy, per xDS type and in total.
+type ProxyConfigSize struct {
+	ProxyID string                    `json:"proxy"`
+	Types   map[string]TypeConfigSize `json:"types"`
+	Total   TypeConfigSize            `json:"total"`
+}
+
+// ConfigContribution is the share of the config of the proxies generated from a service or an Istio config.
+type ConfigContribution struct {
+	// Kind is the type of the Istio config, e.g. virtual-service, or service.
+	Kind      string `json:"kind,omitempty"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name,omitempty"`
+	Resources int    `json:"resources"`
+	Bytes     int    `json:"bytes"`
+	// Proxies is the number of proxies whose config includes the contribution.
+	Proxies int `json:"proxies"`
+}
+
+// ConfigSizeDebug is the response of /debug/config_size.
+type ConfigSizeDebug struct {
+	Proxies    []ProxyConfigSize    `json:"proxies"`
+	Configs    []ConfigContribution `json:"configs,omitempty"`
+	Namespaces []ConfigContribution `json:"namespaces,omitempty"`
+}
+
+// recordConfigSize records the size of the response pushed to the proxy, generated in the time since
+// the push started.
+func recordConfigSize(con *XdsConnection, typ string, response *xdsapi.DiscoveryResponse, pushStart time.Time) {
+	size := TypeConfigSize{
+		Resources:      len(response.Resources),
+		GenerationTime: time.Since(pushStart),
+	}
+	for _, r := range response.Resources {
+		size.Bytes += len(r.GetValue())
+	}
+
+	configResources.With(typeTag.Value(typ)).Record(float64(size.Resources))
+	configBytes.With(typeTag.Value(typ)).Record(float64(size.Bytes))
+	configGenerationTime.With(typeTag.Value(typ)).Record(size.GenerationTime.Seconds())
+
+	con.mu.Lock()
+	if con.configSizes == nil {
+		con.configSizes = make(map[string]TypeConfigSize)
+	}
+	con.configSizes[typ] = size
+	con.mu.Unlock()
+}
+
+// configSize returns the size of the config last pushed to the proxy.
+func (conn *XdsConnection) configSize() ProxyConfigSize {
+	conn.mu.RLock()
+	defer conn.mu.RUnlock()
+	out := ProxyConfigSize{
+		ProxyID: conn.node.ID,
+		Types:   make(map[string]TypeConfigSize, len(conn.configSizes)),
+	}
+	for typ, size := range conn.configSizes {
+		out.Types[typ] = size
+		out.Total.add(size)
+	}
+	return out
+}
+
+// sortConfigSizes sorts the proxies by decreasing bytes, resources or generation time, of the type or in total.
+func sortConfigSizes(sizes []ProxyConfigSize, by, typ string) error {
+	value := func(s TypeConfigSize) int64 {
+		switch by {
+		case "resources":
+			return int64(s.Resources)
+		case "time":
+			return int64(s.GenerationTime)
+		default:
+			return int64(s.Bytes)
+		}
+	}
+	switch by {
+	case "", "bytes", "resources", "time":
+	default:
+		return fmt.Errorf("invalid sort %q, must be one of bytes, resources and time", by)
+	}
+	switch typ {
+	case "", cdsType, ldsType, rdsType, edsType:
+	default:
+		return fmt.Errorf("invalid type %q, must be one of %s, %s, %s and %s", typ, cdsType, ldsType, rdsType, edsType)
+	}
+
+	sort.SliceStable(sizes, func(i, j int) bool {
+		si, sj := sizes[i].Total, sizes[j].Total
+		if typ != "" {
+			si, sj = sizes[i].Types[typ], sizes[j].Types[typ]
+		}
+		if vi, vj := value(si), value(sj); vi != vj {
+			return vi > vj
+		}
+		return sizes[i].ProxyID < sizes[j].ProxyID
+	})
+	return nil
+}
+
+// configSizez implements a debug interface for the size of the config of the proxies.
+// It is mapped to /debug/config_size. The proxies are sorted by decreasing size, the 'sort' parameter
+// selects bytes (default), resources or time, and the 'type' parameter one of cds, lds, rds and eds
+// instead of their total. The 'limit' parameter caps the number of proxies, 20 by default, 0 for all.
+// When 'contributors' is set, the clusters, routes and endpoints of the proxies returned are
+// regenerated to return this number of configs and namespaces contributing the most to their size.
+func (s *DiscoveryServer) configSizez(w http.ResponseWriter, req *http.Request) {
+	_ = req.ParseForm()
+
+	limit := 20
+	contributors := 0
+	for param, value := range map[string]*int{"limit": &limit, "contributors": &contributors} {
+		if v := req.Form.Get(param); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = fmt.Fprintf(w, "invalid %s %q", param, v)
+				return
+			}
+			*value = n
+		}
+	}
+
+	adsClientsMutex.RLock()
+	connections := make([]*XdsConnection, 0, len(adsClients))
+	for _, con := range adsClients {
+		connections = append(connections, con)
+	}
+	adsClientsMutex.RUnlock()
+
+	out := ConfigSizeDebug{Proxies: make([]ProxyConfigSize, 0, len(connections))}
+	byProxyID := make(map[string]*XdsConnection, len(connections))
+	for _, con := range connections {
+		out.Proxies = append(out.Proxies, con.configSize())
+		byProxyID[con.node.ID] = con
+	}
+	if err := sortConfigSizes(out.Proxies, req.Form.Get("sort"), req.Form.Get("type")); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprint(w, err)
+		return
+	}
+	if limit > 0 && len(out.Proxies) > limit {
+		out.Proxies = out.Proxies[:limit]
+	}
+
+	if contributors > 0 {
+		push := s.globalPushContext()
+		c := newContributions()
+		for _, size := range out.Proxies {
+			c.addProxy(s, byProxyID[size.ProxyID], push)
+		}
+		out.Configs, out.Namespaces = c.top(contributors)
+	}
+
+	b, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = fmt.Fprintf(w, "unable to marshal config sizes: %v", err)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+type contributionKey struct {
+	kind, namespace, name string
+}
+
+// contributions accumulates the size of the config of proxies per service and Istio config.
+type contributions struct {
+	configs map[contributionKey]*ConfigContribution
+	// proxy are the contributions to the config of the current proxy, to count the proxies.
+	proxy map[contributionKey]struct{}
+}
+
+func newContributions() *contributions {
+	return &contributions{configs: make(map[contributionKey]*ConfigContribution)}
+}
+
+// addProxy regenerates the clusters, routes and endpoints of the proxy, and adds their size to the services
+// and configs they are generated from.
+func (c *contributions) addProxy(s *DiscoveryServer, con *XdsConnection, push *model.PushContext) {
+	c.proxy = make(map[contributionKey]struct{})
+
+	services := make(map[host.Name]*model.Service)
+	for _, svc := range push.Services(con.node) {
+		// Prefer the service of the namespace of the proxy, as pilot does.
+		if _, f := services[svc.Hostname]; !f || svc.Attributes.Namespace == con.node.ConfigNamespace {
+			services[svc.Hostname] = svc
+		}
+	}
+	serviceKey := func(h host.Name) contributionKey {
+		k := contributionKey{kind: serviceContributor, name: string(h)}
+		if svc := services[h]; svc != nil {
+			k.namespace = svc.Attributes.Namespace
+		}
+		return k
+	}
+
+	for _, cluster := range s.generateRawClusters(con.node, push) {
+		k, ok := contributionKeyFromMetadata(cluster.Metadata)
+		if !ok {
+			_, _, h, _ := model.ParseSubsetKey(cluster.Name)
+			if h == "" {
+				continue
+			}
+			k = serviceKey(h)
+		}
+		c.add(k, 1, proto.Size(cluster))
+	}
+
+	con.mu.RLock()
+	clusterNames := append([]string(nil), con.Clusters...)
+	con.mu.RUnlock()
+	for _, clusterName := range clusterNames {
+		if l := s.loadAssignmentsForClusterIsolated(con.node, push, clusterName); l != nil {
+			_, _, h, _ := model.ParseSubsetKey(clusterName)
+			c.add(serviceKey(h), 1, proto.Size(l))
+		}
+	}
+
+	for _, rc := range s.generateRawRoutes(con, push) {
+		for _, vh := range rc.VirtualHosts {
+			vhKey := serviceKey(host.Name(strings.Split(vh.Name, ":")[0]))
+			vhBytes := proto.Size(vh)
+			for _, r := range vh.Routes {
+				if k, ok := contributionKeyFromMetadata(r.Metadata); ok {
+					routeBytes := proto.Size(r)
+					c.add(k, 1, routeBytes)
+					vhBytes -= routeBytes
+				}
+			}
+			c.add(vhKey, 1, vhBytes)
+		}
+	}
+}
+
+func (c *contributions) add(k contributionKey, resources, bytes int) {
+	contribution := c.configs[k]
+	if contribution == nil {
+		contribution = &ConfigContribution{Kind: k.kind, Namespace: k.namespace, Name: k.name}
+		c.configs[k] = contribution
+	}
+	contribution.Resources += resources
+	contribution.Bytes += bytes
+	if _, f := c.proxy[k]; !f {
+		c.proxy[k] = struct{}{}
+		contribution.Proxies++
+	}
+}
+
+// top returns the n configs and namespaces contributing the most bytes.
+func (c *contributions) top(n int) ([]ConfigContribution, []ConfigContribution) {
+	configs := make([]ConfigContribution, 0, len(c.configs))
+	namespaces := make(map[string]*ConfigContribution)
+	for _, contribution := range c.configs {
+		configs = append(configs, *contribution)
+		ns := namespaces[contribution.Namespace]
+		if ns == nil {
+			ns = &ConfigContribution{Namespace: contribution.Namespace}
+			namespaces[contribution.Namespace] = ns
+		}
+		ns.Resources += contribution.Resources
+		ns.Bytes += contribution.Bytes
+		if contribution.Proxies > ns.Proxies {
+			// A lower bound, the proxies of the configs of the namespace may differ.
+			ns.Proxies = contribution.Proxies
+		}
+	}
+	nsContributions := make([]ConfigContribution, 0, len(namespaces))
+	for _, ns := range namespaces {
+		nsContributions = append(nsContributions, *ns)
+	}
+	return topContributions(configs, n), topContributions(nsContributions, n)
+}
+
+func topContributions(contributions []ConfigContribution, n int) []ConfigContribution {
+	sort.Slice(contributions, func(i, j int) bool {
+		ci, cj := contributions[i], contributions[j]
+		if ci.Bytes != cj.Bytes {
+			return ci.Bytes > cj.Bytes
+		}
+		if ci.Namespace != cj.Namespace {
+			return ci.Namespace < cj.Namespace
+		}
+		if ci.Kind != cj.Kind {
+			return ci.Kind < cj.Kind
+		}
+		return ci.Name < cj.Name
+	})
+	if len(contributions) > n {
+		contributions = contributions[:n]
+	}
+	return contributions
+}
+
+// contributionKeyFromMetadata returns the Istio config of the metadata built by util.BuildConfigInfoMetadata.
+func contributionKeyFromMetadata(metadata *core.Metadata) (contributionKey, bool) {
+	if metadata == nil || metadata.FilterMetadata[util.IstioMetadataKey] == nil {
+		return contributionKey{}, false
+	}
+	config := metadata.FilterMetadata[util.IstioMetadataKey].Fields["config"].GetStringValue()
+	// /apis/<group>/<version>/namespaces/<namespace>/<type>/<name>
+	parts := strings.Split(config, "/")
+	if len(parts) != 8 || parts[4] != "namespaces" {
+		return contributionKey{}, false
+	}
+	return contributionKey{kind: parts[6], namespace: parts[5], name: parts[7]}, true
+}
@@ -0,0 +1,149 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/golang/protobuf/ptypes/any"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pkg/config/schemas"
+)
+
+func TestRecordConfigSize(t *testing.T) {
+	con := &XdsConnection{node: &model.Proxy{ID: "app.default"}}
+	recordConfigSize(con, cdsType, &xdsapi.DiscoveryResponse{
+		Resources: []*any.Any{{Value: make([]byte, 100)}, {Value: make([]byte, 50)}},
+	}, time.Now())
+	recordConfigSize(con, ldsType, &xdsapi.DiscoveryResponse{
+		Resources: []*any.Any{{Value: make([]byte, 10)}},
+	}, time.Now())
+
+	size := con.configSize()
+	if size.ProxyID != "app.default" {
+		t.Errorf("got proxy %q, want app.default", size.ProxyID)
+	}
+	if got := size.Types[cdsType]; got.Resources != 2 || got.Bytes != 150 {
+		t.Errorf("got cds size %+v, want 2 resources and 150 bytes", got)
+	}
+	if got := size.Total; got.Resources != 3 || got.Bytes != 160 {
+		t.Errorf("got total size %+v, want 3 resources and 160 bytes", got)
+	}
+}
+
+func TestSortConfigSizes(t *testing.T) {
+	sizes := func() []ProxyConfigSize {
+		return []ProxyConfigSize{
+			{
+				ProxyID: "a",
+				Types:   map[string]TypeConfigSize{cdsType: {Resources: 10, Bytes: 100}, rdsType: {Resources: 1, Bytes: 500}},
+				Total:   TypeConfigSize{Resources: 11, Bytes: 600, GenerationTime: time.Millisecond},
+			},
+			{
+				ProxyID: "b",
+				Types:   map[string]TypeConfigSize{cdsType: {Resources: 20, Bytes: 1000}},
+				Total:   TypeConfigSize{Resources: 20, Bytes: 1000, GenerationTime: time.Second},
+			},
+			{
+				ProxyID: "c",
+				Types:   map[string]TypeConfigSize{cdsType: {Resources: 20, Bytes: 400}},
+				Total:   TypeConfigSize{Resources: 20, Bytes: 400, GenerationTime: time.Second},
+			},
+		}
+	}
+
+	cases := []struct {
+		by, typ string
+		want    []string
+		wantErr bool
+	}{
+		{by: "", want: []string{"b", "a", "c"}},
+		{by: "bytes", typ: rdsType, want: []string{"a", "b", "c"}},
+		{by: "resources", want: []string{"b", "c", "a"}},
+		{by: "time", typ: "", want: []string{"b", "c", "a"}},
+		{by: "size", wantErr: true},
+		{typ: "sds", wantErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.by+"/"+c.typ, func(t *testing.T) {
+			s := sizes()
+			err := sortConfigSizes(s, c.by, c.typ)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("got error %v, want error %v", err, c.wantErr)
+			}
+			if c.wantErr {
+				return
+			}
+			var got []string
+			for _, size := range s {
+				got = append(got, size.ProxyID)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestConfigContributions(t *testing.T) {
+	reviews := model.ConfigMeta{
+		Type:      schemas.VirtualService.Type,
+		Group:     "networking.istio.io",
+		Version:   schemas.VirtualService.Version,
+		Name:      "reviews",
+		Namespace: "default",
+	}
+	k, ok := contributionKeyFromMetadata(util.BuildConfigInfoMetadata(reviews))
+	if !ok || k != (contributionKey{kind: schemas.VirtualService.Type, namespace: "default", name: "reviews"}) {
+		t.Fatalf("got config key %+v, %v", k, ok)
+	}
+	if _, ok := contributionKeyFromMetadata(nil); ok {
+		t.Fatal("got config key of nil metadata")
+	}
+
+	c := newContributions()
+	svc := contributionKey{kind: serviceContributor, namespace: "default", name: "ratings.default.svc.cluster.local"}
+	other := contributionKey{kind: serviceContributor, namespace: "other", name: "db.other.svc.cluster.local"}
+
+	// Two proxies include the virtual service, one of them twice.
+	c.proxy = make(map[contributionKey]struct{})
+	c.add(k, 1, 100)
+	c.add(k, 1, 100)
+	c.add(svc, 1, 50)
+	c.proxy = make(map[contributionKey]struct{})
+	c.add(k, 1, 100)
+	c.add(other, 1, 400)
+
+	configs, namespaces := c.top(2)
+	wantConfigs := []ConfigContribution{
+		{Kind: serviceContributor, Namespace: "other", Name: "db.other.svc.cluster.local", Resources: 1, Bytes: 400, Proxies: 1},
+		{Kind: schemas.VirtualService.Type, Namespace: "default", Name: "reviews", Resources: 3, Bytes: 300, Proxies: 2},
+	}
+	if !reflect.DeepEqual(configs, wantConfigs) {
+		t.Errorf("got configs %+v, want %+v", configs, wantConfigs)
+	}
+	wantNamespaces := []ConfigContribution{
+		{Namespace: "other", Resources: 1, Bytes: 400, Proxies: 1},
+		{Namespace: "default", Resources: 4, Bytes: 350, Proxies: 2},
+	}
+	if !reflect.DeepEqual(namespaces, wantNamespaces) {
+		t.Errorf("got namespaces %+v, want %+v", namespaces, wantNamespaces)
+	}
+}
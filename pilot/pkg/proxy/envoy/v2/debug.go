@@ -74,6 +74,8 @@ func (s *DiscoveryServer) InitDebug(mux *http.ServeMux, sctl *aggregate.Controll
 	mux.HandleFunc("/debug/authenticationz", s.Authenticationz)
 	mux.HandleFunc("/debug/config_dump", s.ConfigDump)
 	mux.HandleFunc("/debug/push_status", s.PushStatusHandler)
+	mux.HandleFunc("/debug/config_size", s.configSizez)
+	mux.HandleFunc("/debug/snapshot", s.snapshotz)
 }
 
 // SyncStatus is the synchronization status between Pilot and a given Envoy
@@ -113,6 +113,10 @@ type DiscoveryServer struct {
 
 	// pushQueue is the buffer that used after debounce and before the real xds push.
 	pushQueue *PushQueue
+
+	// cache shares the clusters and routes generated for the proxies with the same scope. It is nil
+	// unless enabled with PILOT_ENABLE_XDS_CACHE.
+	cache *xdsCache
 }
 
 // EndpointShards holds the set of endpoint shards of a service. Registries update
@@ -152,6 +156,9 @@ func NewDiscoveryServer(
 		pushChannel:             make(chan *model.PushRequest, 10),
 		pushQueue:               NewPushQueue(),
 	}
+	if features.EnableXDSCache {
+		out.cache = newXdsCache()
+	}
 
 	// Flush cached discovery responses whenever services configuration change.
 	serviceHandler := func(svc *model.Service, _ model.Event) {
@@ -193,6 +200,7 @@ func NewDiscoveryServer(
 			pushReq := &model.PushRequest{
 				Full:               true,
 				ConfigTypesUpdated: map[string]struct{}{c.Type: {}},
+				ConfigsUpdated:     map[model.ConfigKey]struct{}{configKey(&c): {}},
 			}
 			out.ConfigUpdate(pushReq)
 		}
@@ -279,6 +287,10 @@ func (s *DiscoveryServer) Push(req *model.PushRequest) {
 	s.Env.PushContext = push
 	s.updateMutex.Unlock()
 
+	if s.cache != nil {
+		s.cache.clear(req, push)
+	}
+
 	versionLocal := time.Now().Format(time.RFC3339) + "/" + strconv.FormatUint(versionNum.Load(), 10)
 	versionNum.Inc()
 	initContextTime := time.Since(t0)
@@ -421,8 +433,6 @@ func doSendPushes(stopCh <-chan struct{}, semaphore chan struct{}, queue *PushQu
 				<-semaphore
 			}
 
-			proxiesQueueTime.Record(time.Since(info.Start).Seconds())
-
 			go func() {
 				edsUpdates := info.EdsUpdates
 				if info.Full {
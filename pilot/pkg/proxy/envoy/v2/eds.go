@@ -28,6 +28,7 @@ import (
 
 	networkingapi "istio.io/api/networking/v1alpha3"
 
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	networking "istio.io/istio/pilot/pkg/networking/core/v1alpha3"
 	"istio.io/istio/pilot/pkg/networking/core/v1alpha3/loadbalancer"
@@ -456,7 +457,8 @@ func (s *DiscoveryServer) edsUpdate(clusterID, serviceName string, namespace str
 
 	// To prevent memory leak.
 	// Should delete the service EndpointShards, when endpoints deleted or service deleted.
-	if len(istioEndpoints) == 0 {
+	// Endpoints which are not ready are not sent to the proxies, and do not keep the shard.
+	if !hasHealthyEndpoint(istioEndpoints) {
 		if s.EndpointShardsByService[serviceName][namespace] != nil {
 			s.EndpointShardsByService[serviceName][namespace].mutex.Lock()
 			delete(s.EndpointShardsByService[serviceName][namespace].Shards, clusterID)
@@ -499,7 +501,7 @@ func (s *DiscoveryServer) edsUpdate(clusterID, serviceName string, namespace str
 	// 2. Update data for the specific cluster. Each cluster gets independent
 	// updates containing the full list of endpoints for the service in that cluster.
 	for _, e := range istioEndpoints {
-		if e.ServiceAccount != "" {
+		if e.ServiceAccount != "" && !e.Unhealthy {
 			ep.mutex.Lock()
 			_, f = ep.ServiceAccounts[e.ServiceAccount]
 			if !f {
@@ -520,6 +522,12 @@ func (s *DiscoveryServer) edsUpdate(clusterID, serviceName string, namespace str
 	ep.Shards[clusterID] = istioEndpoints
 	ep.mutex.Unlock()
 
+	// The health of the network gateways is computed with the push context, which EDS pushes do not rebuild.
+	if !internal && !requireFull && model.IsNetworkGatewayService(s.Env.MeshNetworks, serviceName) {
+		adsLog.Infof("Full push, network gateway service %s updated", serviceName)
+		requireFull = true
+	}
+
 	// for internal update: this called by DiscoveryServer.Push --> updateServiceShards,
 	// no need to trigger push here.
 	// It is done in DiscoveryServer.Push --> AdsPushAll
@@ -677,7 +685,7 @@ func (s *DiscoveryServer) pushEds(push *model.PushContext, con *XdsConnection, v
 		// If networks are set (by default they aren't) apply the Split Horizon
 		// EDS filter on the endpoints
 		if s.Env.MeshNetworks != nil && len(s.Env.MeshNetworks.Networks) > 0 {
-			endpoints := EndpointsByNetworkFilter(l.Endpoints, con, s.Env)
+			endpoints := EndpointsByNetworkFilter(push, l.Endpoints, con)
 			endpoints = LoadBalancingWeightNormalize(endpoints)
 			filteredCLA := &xdsapi.ClusterLoadAssignment{
 				ClusterName: l.ClusterName,
@@ -687,8 +695,14 @@ func (s *DiscoveryServer) pushEds(push *model.PushContext, con *XdsConnection, v
 			l = filteredCLA
 		}
 
-		// If locality aware routing is enabled, prioritize endpoints or set their lb weight.
-		if s.Env.Mesh.LocalityLbSetting != nil {
+		// If the destination rule weights the localities by the health of their endpoints, set their lb weight
+		// relative to the calling proxy. Otherwise if locality aware routing is enabled, prioritize endpoints or
+		// set their lb weight.
+		if health := s.localityHealth(push, con.node, clusterName); health != nil {
+			clonedCLA := util.CloneClusterLoadAssignment(l)
+			l = &clonedCLA
+			loadbalancer.ApplyLocalityHealthWeights(con.node.Locality, l, health)
+		} else if s.Env.Mesh.LocalityLbSetting != nil {
 			// Make a shallow copy of the cla as we are mutating the endpoints with priorities/weights relative to the calling proxy
 			clonedCLA := util.CloneClusterLoadAssignment(l)
 			l = &clonedCLA
@@ -699,6 +713,14 @@ func (s *DiscoveryServer) pushEds(push *model.PushContext, con *XdsConnection, v
 			loadbalancer.ApplyLocalityLBSetting(con.node.Locality, l, s.Env.Mesh.LocalityLbSetting, enableFailover)
 		}
 
+		// If network failover is enabled, the remote networks come after the network of the proxy, whose
+		// endpoints must be ejected by outlier detection, or removed, to fail over.
+		if s.Env.MeshNetworks != nil && len(s.Env.MeshNetworks.Networks) > 0 && features.EnableNetworkFailover.Get() {
+			clonedCLA := util.CloneClusterLoadAssignment(l)
+			l = &clonedCLA
+			ApplyNetworkFailover(con.node.Metadata.Network, l)
+		}
+
 		for _, e := range l.Endpoints {
 			endpoints += len(e.LbEndpoints)
 		}
@@ -710,6 +732,10 @@ func (s *DiscoveryServer) pushEds(push *model.PushContext, con *XdsConnection, v
 	}
 
 	response := endpointDiscoveryResponse(loadAssignments, version)
+	if edsUpdatedServices == nil {
+		// Incremental pushes only have the updated clusters.
+		recordConfigSize(con, edsType, response, pushStart)
+	}
 	err := con.send(response)
 	edsPushTime.Record(time.Since(pushStart).Seconds())
 	if err != nil {
@@ -748,6 +774,75 @@ func getDestinationRule(push *model.PushContext, proxy *model.Proxy, hostname ho
 	return nil, nil
 }
 
+// hasHealthyEndpoint returns whether any of the endpoints is ready to receive traffic.
+func hasHealthyEndpoint(endpoints []*model.IstioEndpoint) bool {
+	for _, ep := range endpoints {
+		if !ep.Unhealthy {
+			return true
+		}
+	}
+	return false
+}
+
+// localityHealth returns the health of the localities of the endpoints of the cluster, keyed by locality, if
+// its destination rule weights the localities by the health of their endpoints.
+func (s *DiscoveryServer) localityHealth(push *model.PushContext, proxy *model.Proxy,
+	clusterName string) map[string]loadbalancer.LocalityHealth {
+	_, subsetName, hostname, port := model.ParseSubsetKey(clusterName)
+
+	// This runs for every cluster of every EDS push, check the destination rule before anything else.
+	svc := serviceForHostname(push, proxy, hostname)
+	if svc == nil || !loadbalancer.HealthWeightsEnabled(push.DestinationRule(proxy, svc)) {
+		return nil
+	}
+	svcPort, f := svc.Ports.GetByPort(port)
+	if !f {
+		return nil
+	}
+	s.mutex.RLock()
+	shards, f := s.EndpointShardsByService[string(hostname)][svc.Attributes.Namespace]
+	s.mutex.RUnlock()
+	if !f {
+		return nil
+	}
+
+	subsetLabels := push.SubsetToLabels(proxy, subsetName, hostname)
+	health := make(map[string]loadbalancer.LocalityHealth)
+	shards.mutex.Lock()
+	defer shards.mutex.Unlock()
+	for _, endpoints := range shards.Shards {
+		for _, ep := range endpoints {
+			if svcPort.Name != ep.ServicePortName || !subsetLabels.HasSubsetOf(ep.Labels) {
+				continue
+			}
+			locality := util.LocalityToString(util.ConvertLocality(ep.Locality))
+			h := health[locality]
+			h.Total++
+			if !ep.Unhealthy {
+				h.Healthy++
+			}
+			health[locality] = h
+		}
+	}
+	return health
+}
+
+// serviceForHostname returns the service with the hostname, preferring the one in the namespace of the proxy
+// when several namespaces define it.
+func serviceForHostname(push *model.PushContext, proxy *model.Proxy, hostname host.Name) *model.Service {
+	services := push.ServiceByHostnameAndNamespace[hostname]
+	if svc, f := services[proxy.ConfigNamespace]; f {
+		return svc
+	}
+	var out *model.Service
+	for ns, svc := range services {
+		if out == nil || ns < out.Attributes.Namespace {
+			out = svc
+		}
+	}
+	return out
+}
+
 func hasOutlierDetection(push *model.PushContext, proxy *model.Proxy, clusterName string) bool {
 	_, subsetName, hostname, portNumber := model.ParseSubsetKey(clusterName)
 
@@ -857,7 +952,7 @@ func buildLocalityLbEndpointsFromShards(
 	// for this cluster
 	for _, endpoints := range shards.Shards {
 		for _, ep := range endpoints {
-			if svcPort.Name != ep.ServicePortName {
+			if svcPort.Name != ep.ServicePortName || ep.Unhealthy {
 				continue
 			}
 			// Port labels
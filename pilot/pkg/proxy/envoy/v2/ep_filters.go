@@ -15,40 +15,40 @@
 package v2
 
 import (
-	"net"
+	"sort"
 
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
 	endpoint "github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint"
 	"github.com/golang/protobuf/ptypes/wrappers"
 
-	"istio.io/api/mesh/v1alpha1"
-
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/util"
-	"istio.io/istio/pkg/config/host"
 )
 
 // EndpointsFilterFunc is a function that filters data from the ClusterLoadAssignment and returns updated one
-type EndpointsFilterFunc func(endpoints []endpoint.LocalityLbEndpoints, conn *XdsConnection, env *model.Environment) []*endpoint.LocalityLbEndpoints
+type EndpointsFilterFunc func(push *model.PushContext, endpoints []*endpoint.LocalityLbEndpoints, conn *XdsConnection) []*endpoint.LocalityLbEndpoints
 
 // EndpointsByNetworkFilter is a network filter function to support Split Horizon EDS - filter the endpoints based on the network
 // of the connected sidecar. The filter will filter out all endpoints which are not present within the
 // sidecar network and add a gateway endpoint to remote networks that have endpoints (if gateway exists).
 // Information for the mesh networks is provided as a MeshNetwork config map.
-func EndpointsByNetworkFilter(endpoints []*endpoint.LocalityLbEndpoints, conn *XdsConnection, env *model.Environment) []*endpoint.LocalityLbEndpoints {
+//
+// The gateways of the networks, without the ones lacking instances in their network, are computed once per
+// push context. When network failover is enabled, the gateways of each remote network are returned in their
+// own LocalityLbEndpoints, with the locality of the endpoints they stand for, so that ApplyNetworkFailover can
+// prioritize them after the local endpoints.
+func EndpointsByNetworkFilter(push *model.PushContext, endpoints []*endpoint.LocalityLbEndpoints, conn *XdsConnection) []*endpoint.LocalityLbEndpoints {
 	// If the sidecar does not specify a network, ignore Split Horizon EDS and return all
 	network := conn.node.Metadata.Network
+	failover := features.EnableNetworkFailover.Get()
+	networkGateways := push.NetworkGateways()
 
 	// calculate the multiples of weight.
 	// It is needed to normalize the LB Weight across different networks.
 	multiples := 1
-	for _, network := range env.MeshNetworks.Networks {
-		num := 0
-		registryName := getNetworkRegistry(network)
-		for _, gw := range network.Gateways {
-			addrs := getGatewayAddresses(gw, registryName, env)
-			num += len(addrs)
-		}
-		if num > 1 {
+	for _, gateways := range networkGateways {
+		if num := len(gateways); num > 1 {
 			multiples *= num
 		}
 	}
@@ -80,65 +80,101 @@ func EndpointsByNetworkFilter(endpoints []*endpoint.LocalityLbEndpoints, conn *X
 		}
 
 		// Add endpoints to remote networks' gateways
+		var remoteNetworks []string
+		for network := range remoteEps {
+			remoteNetworks = append(remoteNetworks, network)
+		}
+		sort.Strings(remoteNetworks)
 
 		// Iterate over all networks that have the cluster endpoint (weight>0) and
 		// for each one of those add a new endpoint that points to the network's
 		// gateway with the relevant weight
-		for network, w := range remoteEps {
-			networkConf, found := env.MeshNetworks.Networks[network]
-			if !found {
-				adsLog.Debugf("the endpoints within network %s will be ignored for no network configured", network)
-				continue
-			}
-			gws := networkConf.Gateways
-			if len(gws) == 0 {
-				adsLog.Debugf("the endpoints within network %s will be ignored for no gateways configured", network)
+		var remoteLocalityEndpoints []*endpoint.LocalityLbEndpoints
+		for _, network := range remoteNetworks {
+			w := remoteEps[network]
+			gateways := networkGateways[network]
+			if len(gateways) == 0 {
+				adsLog.Debugf("the endpoints within network %s will be ignored for no healthy gateways configured", network)
 				continue
 			}
 
-			registryName := getNetworkRegistry(networkConf)
-			gwEps := make([]*endpoint.LbEndpoint, 0)
+			gwEps := make([]*endpoint.LbEndpoint, 0, len(gateways))
 			// There may be multiples gateways for the network. Add an LbEndpoint for
 			// each one of them
-			for _, gw := range gws {
-				gwAddresses := getGatewayAddresses(gw, registryName, env)
-				// If gateway addresses are found, create an endpoint for each one of them
-				if len(gwAddresses) > 0 {
-					for _, gwAddr := range gwAddresses {
-						epAddr := util.BuildAddress(gwAddr, gw.Port)
-						gwEp := &endpoint.LbEndpoint{
-							HostIdentifier: &endpoint.LbEndpoint_Endpoint{
-								Endpoint: &endpoint.Endpoint{
-									Address: epAddr,
-								},
-							},
-							LoadBalancingWeight: &wrappers.UInt32Value{
-								Value: w,
-							},
-						}
-						gwEps = append(gwEps, gwEp)
-					}
+			for _, gw := range gateways {
+				gwEp := &endpoint.LbEndpoint{
+					HostIdentifier: &endpoint.LbEndpoint_Endpoint{
+						Endpoint: &endpoint.Endpoint{
+							Address: util.BuildAddress(gw.Addr, gw.Port),
+						},
+					},
+					LoadBalancingWeight: &wrappers.UInt32Value{
+						Value: w,
+					},
+					Metadata: endpointMetadata("", network),
 				}
-			}
-			if len(gwEps) == 0 {
-				continue
+				gwEps = append(gwEps, gwEp)
 			}
 			weight := w * uint32(multiples/len(gwEps))
 			for _, gwEp := range gwEps {
 				gwEp.LoadBalancingWeight.Value = weight
-				lbEndpoints = append(lbEndpoints, gwEp)
+			}
+			if failover {
+				// Keep the gateways of each network apart from the local endpoints, to prioritize them.
+				remoteLocalityEndpoints = append(remoteLocalityEndpoints, createLocalityLbEndpoints(ep, gwEps))
+			} else {
+				lbEndpoints = append(lbEndpoints, gwEps...)
 			}
 		}
 
 		// Found local endpoint(s) so add to the result a new one LocalityLbEndpoints
 		// that holds only the local endpoints
-		newEp := createLocalityLbEndpoints(ep, lbEndpoints)
-		filtered = append(filtered, newEp)
+		if !failover || len(lbEndpoints) > 0 || len(remoteLocalityEndpoints) == 0 {
+			newEp := createLocalityLbEndpoints(ep, lbEndpoints)
+			filtered = append(filtered, newEp)
+		}
+		filtered = append(filtered, remoteLocalityEndpoints...)
 	}
 
 	return filtered
 }
 
+// ApplyNetworkFailover sets the priorities of the endpoints of the load assignment so that the endpoints of
+// the network of the proxy are preferred to the gateways of the remote networks, which receive traffic only
+// when the local endpoints are unavailable. The priorities already set, e.g. by locality, are kept within
+// each network. The load assignment is expected to be filtered by EndpointsByNetworkFilter with network
+// failover enabled.
+func ApplyNetworkFailover(network string, loadAssignment *xdsapi.ClusterLoadAssignment) {
+	var maxPriority uint32
+	for _, localityEndpoints := range loadAssignment.Endpoints {
+		if localityEndpoints.Priority > maxPriority {
+			maxPriority = localityEndpoints.Priority
+		}
+	}
+
+	// key is priority, value is the index of the LocalityLbEndpoints in ClusterLoadAssignment
+	priorityMap := map[uint32][]int{}
+	for i, localityEndpoints := range loadAssignment.Endpoints {
+		priority := localityEndpoints.Priority
+		if len(localityEndpoints.LbEndpoints) > 0 && istioMetadata(localityEndpoints.LbEndpoints[0], "network") != network {
+			priority += maxPriority + 1
+		}
+		priorityMap[priority] = append(priorityMap[priority], i)
+	}
+
+	// Priorities should range from 0 (highest) to N (lowest) without skipping.
+	priorities := make([]uint32, 0, len(priorityMap))
+	for priority := range priorityMap {
+		priorities = append(priorities, priority)
+	}
+	sort.Slice(priorities, func(i, j int) bool { return priorities[i] < priorities[j] })
+	for i, priority := range priorities {
+		for _, index := range priorityMap[priority] {
+			loadAssignment.Endpoints[index].Priority = uint32(i)
+		}
+	}
+}
+
 // TODO: remove this, filtering should be done before generating the config, and
 // network metadata should not be included in output. A node only receives endpoints
 // in the same network as itself - so passing an network meta, with exactly
@@ -179,34 +215,3 @@ func createLocalityLbEndpoints(base *endpoint.LocalityLbEndpoints, lbEndpoints [
 func LoadBalancingWeightNormalize(endpoints []*endpoint.LocalityLbEndpoints) []*endpoint.LocalityLbEndpoints {
 	return util.LocalityLbWeightNormalize(endpoints)
 }
-
-func getNetworkRegistry(network *v1alpha1.Network) string {
-	var registryName string
-	for _, eps := range network.Endpoints {
-		if eps != nil && len(eps.GetFromRegistry()) > 0 {
-			registryName = eps.GetFromRegistry()
-			break
-		}
-	}
-
-	return registryName
-}
-
-func getGatewayAddresses(gw *v1alpha1.Network_IstioNetworkGateway, registryName string, env *model.Environment) []string {
-	// First, if a gateway address is provided in the configuration use it. If the gateway address
-	// in the config was a hostname it got already resolved and replaced with an IP address
-	// when loading the config
-	if gwIP := net.ParseIP(gw.GetAddress()); gwIP != nil {
-		return []string{gw.GetAddress()}
-	}
-
-	// Second, try to find the gateway addresses by the provided service name
-	if gwSvcName := gw.GetRegistryServiceName(); len(gwSvcName) > 0 && len(registryName) > 0 {
-		svc, _ := env.GetService(host.Name(gwSvcName))
-		if svc != nil {
-			return svc.Attributes.ClusterExternalAddresses[registryName]
-		}
-	}
-
-	return nil
-}
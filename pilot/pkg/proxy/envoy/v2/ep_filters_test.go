@@ -15,9 +15,11 @@
 package v2
 
 import (
+	"os"
 	"sort"
 	"testing"
 
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
 	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 	endpoint "github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint"
 	structpb "github.com/golang/protobuf/ptypes/struct"
@@ -25,8 +27,12 @@ import (
 
 	meshconfig "istio.io/api/mesh/v1alpha1"
 
+	"istio.io/istio/pilot/pkg/config/memory"
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/protocol"
+	"istio.io/istio/pkg/config/schemas"
 )
 
 type LbEpInfo struct {
@@ -143,7 +149,7 @@ func TestEndpointsByNetworkFilter(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			filtered := EndpointsByNetworkFilter(tt.endpoints, tt.conn, tt.env)
+			filtered := EndpointsByNetworkFilter(pushContext(t, tt.env), tt.endpoints, tt.conn)
 			if len(filtered) != len(tt.want) {
 				t.Errorf("Unexpected number of filtered endpoints: got %v, want %v", len(filtered), len(tt.want))
 				return
@@ -219,6 +225,16 @@ func TestEndpointsByNetworkFilter_RegistryServiceName(t *testing.T) {
 		},
 	}, 0)
 
+	// The gateway has a healthy instance in network2.
+	serviceDiscovery.AddInstance(gwSvcName, &model.ServiceInstance{
+		Endpoint: model.NetworkEndpoint{
+			Address:     "20.0.0.100",
+			Port:        8080,
+			ServicePort: &model.Port{Name: "http", Port: 80, Protocol: protocol.HTTP},
+			Network:     "network2",
+		},
+	})
+
 	env.ServiceDiscovery = serviceDiscovery
 
 	// Test endpoints creates:
@@ -311,7 +327,7 @@ func TestEndpointsByNetworkFilter_RegistryServiceName(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			filtered := EndpointsByNetworkFilter(tt.endpoints, tt.conn, tt.env)
+			filtered := EndpointsByNetworkFilter(pushContext(t, tt.env), tt.endpoints, tt.conn)
 			if len(filtered) != len(tt.want) {
 				t.Errorf("Unexpected number of filtered endpoints: got %v, want %v", len(filtered), len(tt.want))
 				return
@@ -350,6 +366,229 @@ func TestEndpointsByNetworkFilter_RegistryServiceName(t *testing.T) {
 	}
 }
 
+func TestEndpointsByNetworkFilter_UnhealthyGateway(t *testing.T) {
+	env := environment()
+	env.MeshNetworks.Networks["network2"] = &meshconfig.Network{
+		Endpoints: []*meshconfig.Network_NetworkEndpoints{
+			{
+				Ne: &meshconfig.Network_NetworkEndpoints_FromRegistry{
+					FromRegistry: "cluster2",
+				},
+			},
+		},
+		Gateways: []*meshconfig.Network_IstioNetworkGateway{
+			{
+				Gw: &meshconfig.Network_IstioNetworkGateway_RegistryServiceName{
+					RegistryServiceName: "istio-ingressgateway.istio-system.svc.cluster.local",
+				},
+				Port: 80,
+			},
+		},
+	}
+
+	gwSvc := &model.Service{
+		Hostname: "istio-ingressgateway.istio-system.svc.cluster.local",
+		Attributes: model.ServiceAttributes{
+			ClusterExternalAddresses: map[string][]string{
+				"cluster2": {"2.2.2.2"},
+			},
+		},
+	}
+	// The only instance of the gateway is in another network, or in no network.
+	for _, network := range []string{"network1", ""} {
+		t.Run("instance network "+network, func(t *testing.T) {
+			serviceDiscovery := NewMemServiceDiscovery(map[host.Name]*model.Service{gwSvc.Hostname: gwSvc}, 0)
+			serviceDiscovery.AddInstance(gwSvc.Hostname, &model.ServiceInstance{
+				Endpoint: model.NetworkEndpoint{
+					Address:     "10.0.0.100",
+					Port:        8080,
+					ServicePort: &model.Port{Name: "http", Port: 80, Protocol: protocol.HTTP},
+					Network:     network,
+				},
+			})
+			env.ServiceDiscovery = serviceDiscovery
+
+			filtered := EndpointsByNetworkFilter(pushContext(t, env), testEndpoints(), xdsConnection("network1"))
+			verifyFilteredEndpoints(t, filtered, []LocLbEpInfo{
+				{
+					lbEps: []LbEpInfo{
+						// 2 local endpoints, the gateway of network2 is down
+						{address: "10.0.0.1", weight: 1},
+						{address: "10.0.0.2", weight: 1},
+					},
+					weight: 2,
+				},
+			})
+		})
+	}
+}
+
+func TestEndpointsByNetworkFilter_Failover(t *testing.T) {
+	_ = os.Setenv(features.EnableNetworkFailover.Name, "true")
+	defer func() { _ = os.Unsetenv(features.EnableNetworkFailover.Name) }()
+
+	env := environment()
+	testEndpoints := testEndpoints()
+
+	tests := []struct {
+		name string
+		conn *XdsConnection
+		want []LocLbEpInfo
+	}{
+		{
+			name: "from_network1",
+			conn: xdsConnection("network1"),
+			want: []LocLbEpInfo{
+				{
+					lbEps: []LbEpInfo{
+						// 2 local endpoints
+						{address: "10.0.0.1", weight: 2},
+						{address: "10.0.0.2", weight: 2},
+					},
+					weight: 4,
+				},
+				{
+					lbEps: []LbEpInfo{
+						// the gateways of network2, apart from the local endpoints
+						{address: "2.2.2.2", weight: 1},
+						{address: "2.2.2.20", weight: 1},
+					},
+					weight: 2,
+				},
+			},
+		},
+		{
+			name: "from_network3",
+			conn: xdsConnection("network3"),
+			want: []LocLbEpInfo{
+				{
+					lbEps: []LbEpInfo{
+						{address: "1.1.1.1", weight: 4},
+					},
+					weight: 4,
+				},
+				{
+					lbEps: []LbEpInfo{
+						{address: "2.2.2.2", weight: 1},
+						{address: "2.2.2.20", weight: 1},
+					},
+					weight: 2,
+				},
+			},
+		},
+	}
+	push := pushContext(t, env)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifyFilteredEndpoints(t, EndpointsByNetworkFilter(push, testEndpoints, tt.conn), tt.want)
+		})
+	}
+}
+
+func TestApplyNetworkFailover(t *testing.T) {
+	localityEndpoints := func(network string, priority uint32) *endpoint.LocalityLbEndpoints {
+		return &endpoint.LocalityLbEndpoints{
+			LbEndpoints: createLbEndpoints([]*LbEpInfo{{network: network, address: "1.1.1.1"}}),
+			Priority:    priority,
+		}
+	}
+
+	tests := []struct {
+		name      string
+		endpoints []*endpoint.LocalityLbEndpoints
+		want      []uint32
+	}{
+		{
+			name: "remote networks after the local network",
+			endpoints: []*endpoint.LocalityLbEndpoints{
+				localityEndpoints("network2", 0),
+				localityEndpoints("network1", 0),
+				localityEndpoints("network3", 0),
+			},
+			want: []uint32{1, 0, 1},
+		},
+		{
+			name: "locality priorities kept within each network",
+			endpoints: []*endpoint.LocalityLbEndpoints{
+				localityEndpoints("network1", 0),
+				localityEndpoints("network1", 1),
+				localityEndpoints("network2", 0),
+				localityEndpoints("network2", 1),
+			},
+			want: []uint32{0, 1, 2, 3},
+		},
+		{
+			name: "priorities without gaps",
+			endpoints: []*endpoint.LocalityLbEndpoints{
+				localityEndpoints("network1", 0),
+				localityEndpoints("network2", 0),
+				localityEndpoints("network2", 2),
+			},
+			want: []uint32{0, 1, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cla := &xdsapi.ClusterLoadAssignment{Endpoints: tt.endpoints}
+			ApplyNetworkFailover("network1", cla)
+			for i, ep := range cla.Endpoints {
+				if ep.Priority != tt.want[i] {
+					t.Errorf("Unexpected priority for endpoint %d: got %v, want %v", i, ep.Priority, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func verifyFilteredEndpoints(t *testing.T, filtered []*endpoint.LocalityLbEndpoints, want []LocLbEpInfo) {
+	t.Helper()
+	if len(filtered) != len(want) {
+		t.Fatalf("Unexpected number of filtered endpoints: got %v, want %v", len(filtered), len(want))
+	}
+
+	sort.Slice(filtered, func(i, j int) bool {
+		addrI := filtered[i].LbEndpoints[0].GetEndpoint().Address.GetSocketAddress().Address
+		addrJ := filtered[j].LbEndpoints[0].GetEndpoint().Address.GetSocketAddress().Address
+		return addrI < addrJ
+	})
+
+	for i, ep := range filtered {
+		if len(ep.LbEndpoints) != len(want[i].lbEps) {
+			t.Errorf("Unexpected number of LB endpoints within endpoint %d: %v, want %v", i, len(ep.LbEndpoints), len(want[i].lbEps))
+		}
+
+		if ep.LoadBalancingWeight.GetValue() != want[i].weight {
+			t.Errorf("Unexpected weight for endpoint %d: got %v, want %v", i, ep.LoadBalancingWeight.GetValue(), want[i].weight)
+		}
+
+		for _, lbEp := range ep.LbEndpoints {
+			addr := lbEp.GetEndpoint().Address.GetSocketAddress().Address
+			found := false
+			for _, wantLbEp := range want[i].lbEps {
+				if addr == wantLbEp.address {
+					found = lbEp.LoadBalancingWeight.GetValue() == wantLbEp.weight
+					break
+				}
+			}
+			if !found {
+				t.Errorf("Unexpected address or weight for endpoint %d: %v", i, addr)
+			}
+		}
+	}
+}
+
+// pushContext returns the push context of the environment, with the gateways of its mesh networks.
+func pushContext(t *testing.T, env *model.Environment) *model.PushContext {
+	t.Helper()
+	env.Mesh = &meshconfig.MeshConfig{}
+	env.IstioConfigStore = model.MakeIstioStore(memory.Make(schemas.Istio))
+	push := model.NewPushContext()
+	if err := push.InitContext(env, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	return push
+}
+
 func xdsConnection(network string) *XdsConnection {
 	return &XdsConnection{
 		node: &model.Proxy{
@@ -25,6 +25,8 @@ var (
 	clusterTag = monitoring.MustCreateLabel("cluster")
 	nodeTag    = monitoring.MustCreateLabel("node")
 	typeTag    = monitoring.MustCreateLabel("type")
+	// priorityTag is the class of the pushes in the push queue.
+	priorityTag = monitoring.MustCreateLabel("priority")
 
 	cdsReject = monitoring.NewGauge(
 		"pilot_xds_cds_reject",
@@ -101,6 +103,8 @@ var (
 	rdsPushes         = pushes.With(typeTag.Value("rds"))
 	rdsSendErrPushes  = pushes.With(typeTag.Value("rds_senderr"))
 	rdsBuildErrPushes = pushes.With(typeTag.Value("rds_builderr"))
+	ndsPushes         = pushes.With(typeTag.Value("nds"))
+	ndsSendErrPushes  = pushes.With(typeTag.Value("nds_senderr"))
 
 	pushTime = monitoring.NewDistribution(
 		"pilot_xds_push_time",
@@ -113,12 +117,14 @@ var (
 	edsPushTime = pushTime.With(typeTag.Value("eds"))
 	ldsPushTime = pushTime.With(typeTag.Value("lds"))
 	rdsPushTime = pushTime.With(typeTag.Value("rds"))
+	ndsPushTime = pushTime.With(typeTag.Value("nds"))
 
 	// only supported dimension is millis, unfortunately. default to unitdimensionless.
 	proxiesQueueTime = monitoring.NewDistribution(
 		"pilot_proxy_queue_time",
 		"Time in seconds, a proxy is in the push queue before being dequeued.",
 		[]float64{.1, 1, 3, 5, 10, 20, 30},
+		monitoring.WithLabels(priorityTag),
 	)
 
 	// only supported dimension is millis, unfortunately. default to unitdimensionless.
@@ -147,6 +153,36 @@ var (
 	inboundConfigUpdates  = inboundUpdates.With(typeTag.Value("config"))
 	inboundEDSUpdates     = inboundUpdates.With(typeTag.Value("eds"))
 	inboundServiceUpdates = inboundUpdates.With(typeTag.Value("svc"))
+
+	xdsCacheReads = monitoring.NewSum(
+		"pilot_xds_cache_reads",
+		"Total number of reads of the cache of the clusters and routes shared by the proxies.",
+		monitoring.WithLabels(typeTag),
+	)
+
+	xdsCacheHits   = xdsCacheReads.With(typeTag.Value("hit"))
+	xdsCacheMisses = xdsCacheReads.With(typeTag.Value("miss"))
+
+	configResources = monitoring.NewDistribution(
+		"pilot_xds_config_resources",
+		"Number of resources of the full lds, rds, cds and eds pushes to a proxy.",
+		[]float64{1, 10, 100, 1000, 10000, 100000},
+		monitoring.WithLabels(typeTag),
+	)
+
+	configBytes = monitoring.NewDistribution(
+		"pilot_xds_config_size_bytes",
+		"Serialized size in bytes of the full lds, rds, cds and eds pushes to a proxy.",
+		[]float64{1e3, 1e4, 1e5, 1e6, 4e6, 1e7, 4e7},
+		monitoring.WithLabels(typeTag),
+	)
+
+	configGenerationTime = monitoring.NewDistribution(
+		"pilot_xds_config_generation_time",
+		"Time in seconds Pilot takes to generate and serialize the full lds, rds, cds and eds pushes to a proxy.",
+		[]float64{.001, .01, .1, 1, 3, 10},
+		monitoring.WithLabels(typeTag),
+	)
 )
 
 func recordSendError(metric monitoring.Metric, err error) {
@@ -182,5 +218,9 @@ func init() {
 		pushContextErrors,
 		totalXDSInternalErrors,
 		inboundUpdates,
+		xdsCacheReads,
+		configResources,
+		configBytes,
+		configGenerationTime,
 	)
 }
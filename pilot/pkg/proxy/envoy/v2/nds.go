@@ -0,0 +1,151 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pkg/config/constants"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/labels"
+)
+
+// NameTableType is used for the name table discovery of the DNS proxy of the agent. It is not an Envoy
+// type: the name table is sent as a single Struct, mapping the hostnames of the services visible to the
+// proxy to their addresses.
+const NameTableType = "type.googleapis.com/istio.networking.nds.NameTable"
+
+// pushNameTable sends the name table of the proxy, unless it has not changed since the last one sent on the
+// connection.
+func (s *DiscoveryServer) pushNameTable(con *XdsConnection, push *model.PushContext, version string) error {
+	pushStart := time.Now()
+	nameTable := buildNameTable(push.Services(con.node), con.node, s.staticEndpointAddresses)
+	if con.NameTable != nil && proto.Equal(con.NameTable, nameTable) {
+		adsLog.Debugf("NDS: name table of node:%s unchanged", con.node.ID)
+		return nil
+	}
+
+	response := &xdsapi.DiscoveryResponse{
+		TypeUrl:     NameTableType,
+		VersionInfo: version,
+		Nonce:       nonce(),
+		Resources:   []*any.Any{util.MessageToAny(nameTable)},
+	}
+	err := con.send(response)
+	ndsPushTime.Record(time.Since(pushStart).Seconds())
+	if err != nil {
+		adsLog.Warnf("NDS: Send failure %s: %v", con.ConID, err)
+		recordSendError(ndsSendErrPushes, err)
+		return err
+	}
+	ndsPushes.Increment()
+	con.NameTable = nameTable
+
+	adsLog.Infof("NDS: PUSH for node:%s hosts:%d", con.node.ID, len(nameTable.Fields))
+	return nil
+}
+
+// buildNameTable returns the addresses of the services for the proxy, keyed by hostname. Services with STATIC
+// resolution and without an address, such as service entries without VIPs, resolve to the addresses of their
+// endpoints returned by endpointAddresses. Wildcard hosts and the other services without an address, such as
+// headless services and service entries resolved by DNS, are skipped.
+func buildNameTable(services []*model.Service, proxy *model.Proxy,
+	endpointAddresses func(*model.Service) []string) *structpb.Struct {
+	nameTable := &structpb.Struct{Fields: make(map[string]*structpb.Value)}
+	for _, svc := range services {
+		if strings.HasPrefix(string(svc.Hostname), "*") {
+			continue
+		}
+		var addresses []string
+		if address := svc.GetServiceAddressForProxy(proxy); address != "" && address != constants.UnspecifiedIP {
+			addresses = []string{address}
+		} else if svc.Resolution == model.ClientSideLB {
+			addresses = endpointAddresses(svc)
+		}
+		for _, address := range addresses {
+			addNameTableAddress(nameTable, string(svc.Hostname), address)
+		}
+	}
+
+	// Services with the same hostname in several namespaces add their addresses in any order.
+	for _, v := range nameTable.Fields {
+		values := v.GetListValue().Values
+		sort.Slice(values, func(i, j int) bool {
+			return values[i].GetStringValue() < values[j].GetStringValue()
+		})
+	}
+	return nameTable
+}
+
+// nameTableUsesEndpoints returns whether the name tables may contain the addresses of the endpoints of one of
+// the updated services, so that the name table has to be pushed on endpoint updates.
+func nameTableUsesEndpoints(push *model.PushContext, updatedServices map[string]struct{}) bool {
+	for hostname := range updatedServices {
+		for _, svc := range push.ServiceByHostnameAndNamespace[host.Name(hostname)] {
+			if svc.Resolution == model.ClientSideLB && (svc.Address == "" || svc.Address == constants.UnspecifiedIP) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func addNameTableAddress(nameTable *structpb.Struct, hostname, address string) {
+	addresses := nameTable.Fields[hostname].GetListValue()
+	if addresses == nil {
+		addresses = &structpb.ListValue{}
+		nameTable.Fields[hostname] = &structpb.Value{Kind: &structpb.Value_ListValue{ListValue: addresses}}
+	}
+	if !hasAddress(addresses, address) {
+		addresses.Values = append(addresses.Values, &structpb.Value{Kind: &structpb.Value_StringValue{StringValue: address}})
+	}
+}
+
+// staticEndpointAddresses returns the IP addresses of the endpoints of the service, on all its ports.
+func (s *DiscoveryServer) staticEndpointAddresses(svc *model.Service) []string {
+	var addresses []string
+	for _, port := range svc.Ports {
+		instances, err := s.Env.InstancesByPort(svc, port.Port, labels.Collection{})
+		if err != nil {
+			adsLog.Warnf("NDS: failed to get the endpoints of %s: %v", svc.Hostname, err)
+			continue
+		}
+		for _, instance := range instances {
+			if net.ParseIP(instance.Endpoint.Address) != nil {
+				addresses = append(addresses, instance.Endpoint.Address)
+			}
+		}
+	}
+	return addresses
+}
+
+func hasAddress(addresses *structpb.ListValue, address string) bool {
+	for _, v := range addresses.Values {
+		if v.GetStringValue() == address {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"reflect"
+	"testing"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/host"
+)
+
+func TestBuildNameTable(t *testing.T) {
+	services := []*model.Service{
+		{Hostname: "reviews.default.svc.cluster.local", Address: "10.0.0.1"},
+		{
+			Hostname:    "ratings.default.svc.cluster.local",
+			Address:     "10.0.0.2",
+			ClusterVIPs: map[string]string{"cluster-1": "10.0.0.2", "cluster-2": "10.1.0.2"},
+		},
+		{Hostname: "details.default.svc.cluster.local", Address: "0.0.0.0"},
+		{Hostname: "db.internal.mesh", Address: "240.0.0.1"},
+		{Hostname: "db.internal.mesh", Address: "240.0.0.0"},
+		{Hostname: "*.example.com", Address: "240.0.0.2"},
+		{Hostname: "www.example.com", Address: "0.0.0.0", Resolution: model.DNSLB},
+		{Hostname: "cache.internal.mesh", Address: "0.0.0.0", Resolution: model.ClientSideLB},
+		{Hostname: "headless.default.svc.cluster.local", Resolution: model.Passthrough},
+	}
+	endpointAddresses := func(svc *model.Service) []string {
+		return map[string][]string{
+			"cache.internal.mesh":                {"10.2.0.2", "10.2.0.1"},
+			"www.example.com":                    {"93.184.216.34"},
+			"headless.default.svc.cluster.local": {"10.3.0.1"},
+		}[string(svc.Hostname)]
+	}
+
+	cases := []struct {
+		name     string
+		proxy    *model.Proxy
+		expected map[string][]string
+	}{
+		{
+			name:  "default cluster",
+			proxy: &model.Proxy{ClusterID: "cluster-1"},
+			expected: map[string][]string{
+				"reviews.default.svc.cluster.local": {"10.0.0.1"},
+				"ratings.default.svc.cluster.local": {"10.0.0.2"},
+				"db.internal.mesh":                  {"240.0.0.0", "240.0.0.1"},
+				"cache.internal.mesh":               {"10.2.0.1", "10.2.0.2"},
+			},
+		},
+		{
+			name:  "remote cluster",
+			proxy: &model.Proxy{ClusterID: "cluster-2"},
+			expected: map[string][]string{
+				"reviews.default.svc.cluster.local": {"10.0.0.1"},
+				"ratings.default.svc.cluster.local": {"10.1.0.2"},
+				"db.internal.mesh":                  {"240.0.0.0", "240.0.0.1"},
+				"cache.internal.mesh":               {"10.2.0.1", "10.2.0.2"},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			nameTable := buildNameTable(services, tc.proxy, endpointAddresses)
+			got := make(map[string][]string)
+			for hostname, v := range nameTable.Fields {
+				for _, address := range v.GetListValue().Values {
+					got[hostname] = append(got[hostname], address.GetStringValue())
+				}
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("got %v, want %v", got, tc.expected)
+			}
+		})
+	}
+}
+
+type countingStream struct {
+	fakeStream
+	sent int
+}
+
+func (h *countingStream) Send(*xdsapi.DiscoveryResponse) error {
+	h.sent++
+	return nil
+}
+
+func TestPushNameTableUnchanged(t *testing.T) {
+	s := &DiscoveryServer{Env: &model.Environment{ServiceDiscovery: NewMemServiceDiscovery(nil, 0)}}
+	stream := &countingStream{}
+	con := &XdsConnection{ConID: "proxy-0", node: &model.Proxy{ID: "proxy-0"}, stream: stream}
+	push := model.NewPushContext()
+
+	for i := 0; i < 2; i++ {
+		if err := s.pushNameTable(con, push, versionInfo()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stream.sent != 1 {
+		t.Errorf("got %d name tables sent, want 1", stream.sent)
+	}
+
+	// A name table which differs from the last one sent is sent again.
+	con.NameTable = &structpb.Struct{Fields: map[string]*structpb.Value{
+		"db.internal.mesh": {Kind: &structpb.Value_StringValue{StringValue: "240.0.0.1"}},
+	}}
+	if err := s.pushNameTable(con, push, versionInfo()); err != nil {
+		t.Fatal(err)
+	}
+	if stream.sent != 2 {
+		t.Errorf("got %d name tables sent, want 2", stream.sent)
+	}
+}
+
+func TestNameTableUsesEndpoints(t *testing.T) {
+	push := model.NewPushContext()
+	push.ServiceByHostnameAndNamespace = map[host.Name]map[string]*model.Service{
+		"reviews.default.svc.cluster.local": {
+			"default": {Hostname: "reviews.default.svc.cluster.local", Address: "10.0.0.1"},
+		},
+		"db.internal.mesh": {
+			"default": {Hostname: "db.internal.mesh", Address: "0.0.0.0", Resolution: model.ClientSideLB},
+		},
+	}
+
+	cases := []struct {
+		name     string
+		updated  map[string]struct{}
+		expected bool
+	}{
+		{name: "service with an address", updated: map[string]struct{}{"reviews.default.svc.cluster.local": {}}},
+		{name: "service without an address", updated: map[string]struct{}{"db.internal.mesh": {}}, expected: true},
+		{name: "unknown service", updated: map[string]struct{}{"ratings.default.svc.cluster.local": {}}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := nameTableUsesEndpoints(push, tc.updated); got != tc.expected {
+				t.Errorf("got %v, want %v", got, tc.expected)
+			}
+		})
+	}
+}
@@ -15,11 +15,83 @@
 package v2
 
 import (
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 )
 
+// PushPriority is the class of a push in the queue. Pushes of a class are dequeued before the pushes of the
+// following classes, and in order within a class.
+type PushPriority int
+
+const (
+	// PriorityNewConnection is the class of the proxies connected for less than newConnectionPeriod.
+	PriorityNewConnection PushPriority = iota
+	// PriorityGateway is the class of gateways.
+	PriorityGateway
+	// PriorityEds is the class of incremental EDS pushes.
+	PriorityEds
+	// PriorityFull is the class of full pushes.
+	PriorityFull
+
+	numPushPriorities
+)
+
+// newConnectionPeriod is the time after connecting during which a proxy has the PriorityNewConnection class.
+const newConnectionPeriod = 10 * time.Second
+
+var pushPriorityNames = [numPushPriorities]string{"new", "gateway", "eds", "full"}
+
+func (p PushPriority) String() string {
+	return pushPriorityNames[p]
+}
+
+// pushPriority returns the class of the push of the request to the connection.
+func pushPriority(con *XdsConnection, req *model.PushRequest) PushPriority {
+	if !con.Connect.IsZero() && time.Since(con.Connect) < newConnectionPeriod {
+		return PriorityNewConnection
+	}
+	if con.node != nil && con.node.Type == model.Router {
+		return PriorityGateway
+	}
+	if !req.Full {
+		return PriorityEds
+	}
+	return PriorityFull
+}
+
+// parsePushQueueLimits parses the concurrency limits of the classes, in the PILOT_PUSH_QUEUE_LIMITS format.
+func parsePushQueueLimits(s string) [numPushPriorities]int {
+	var limits [numPushPriorities]int
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		limit := -1
+		if len(parts) == 2 {
+			if l, err := strconv.Atoi(strings.TrimSpace(parts[1])); err == nil {
+				limit = l
+			}
+		}
+		found := false
+		for i, name := range pushPriorityNames {
+			if name == strings.TrimSpace(parts[0]) && limit >= 0 {
+				limits[i] = limit
+				found = true
+			}
+		}
+		if !found {
+			adsLog.Warnf("ignoring invalid push queue limit %q", entry)
+		}
+	}
+	return limits
+}
+
 type PushQueue struct {
 	mu   *sync.RWMutex
 	cond *sync.Cond
@@ -28,27 +100,41 @@ type PushQueue struct {
 	// PushEvents will be merged.
 	eventsMap map[*XdsConnection]*model.PushRequest
 
-	// connections maintains ordering of the queue
-	connections []*XdsConnection
+	// priorities stores the class of the connections in the queue.
+	priorities map[*XdsConnection]PushPriority
+
+	// connections maintains ordering of the queue, for each class
+	connections [numPushPriorities][]*XdsConnection
 
 	// inProgress stores all connections that have been Dequeue(), but not MarkDone().
 	// The value stored will be initially be nil, but may be populated if the connection is Enqueue().
 	// If model.PushRequest is not nil, it will be Enqueued again once MarkDone has been called.
 	inProgress map[*XdsConnection]*model.PushRequest
+
+	// inProgressPriorities stores the class of the connections in progress, counted by running.
+	inProgressPriorities map[*XdsConnection]PushPriority
+	running              [numPushPriorities]int
+
+	// limits are the maximum number of connections in progress for each class, or 0 if unlimited.
+	limits [numPushPriorities]int
 }
 
 func NewPushQueue() *PushQueue {
 	mu := &sync.RWMutex{}
 	return &PushQueue{
-		mu:         mu,
-		eventsMap:  make(map[*XdsConnection]*model.PushRequest),
-		inProgress: make(map[*XdsConnection]*model.PushRequest),
-		cond:       sync.NewCond(mu),
+		mu:                   mu,
+		eventsMap:            make(map[*XdsConnection]*model.PushRequest),
+		priorities:           make(map[*XdsConnection]PushPriority),
+		inProgress:           make(map[*XdsConnection]*model.PushRequest),
+		inProgressPriorities: make(map[*XdsConnection]PushPriority),
+		limits:               parsePushQueueLimits(features.PushQueueLimits),
+		cond:                 sync.NewCond(mu),
 	}
 }
 
 // Add will mark a proxy as pending a push. If it is already pending, pushInfo will be merged.
-// edsUpdatedServices will be added together, and full will be set if either were full
+// edsUpdatedServices will be added together, and full will be set if either were full.
+// The proxy moves to the end of the queue of another class if the merged push has a different class.
 func (p *PushQueue) Enqueue(proxy *XdsConnection, pushInfo *model.PushRequest) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -60,14 +146,49 @@ func (p *PushQueue) Enqueue(proxy *XdsConnection, pushInfo *model.PushRequest) {
 	}
 
 	if event, f := p.eventsMap[proxy]; f {
-		p.eventsMap[proxy] = event.Merge(pushInfo)
+		merged := event.Merge(pushInfo)
+		p.eventsMap[proxy] = merged
+		if priority := pushPriority(proxy, merged); priority != p.priorities[proxy] {
+			p.remove(proxy, p.priorities[proxy])
+			p.priorities[proxy] = priority
+			p.connections[priority] = append(p.connections[priority], proxy)
+		}
 		return
 	}
 
+	priority := pushPriority(proxy, pushInfo)
 	p.eventsMap[proxy] = pushInfo
-	p.connections = append(p.connections, proxy)
-	// Signal waiters on Dequeue that a new item is available
-	p.cond.Signal()
+	p.priorities[proxy] = priority
+	p.connections[priority] = append(p.connections[priority], proxy)
+	// Signal waiters on Dequeue that a new item is available. All of them are woken up, as the
+	// connection may only be dequeued by the ones which are not blocked by the limit of its class.
+	p.cond.Broadcast()
+}
+
+// remove removes the proxy from the queue of the class.
+func (p *PushQueue) remove(proxy *XdsConnection, priority PushPriority) {
+	queue := p.connections[priority]
+	for i, con := range queue {
+		if con == proxy {
+			p.connections[priority] = append(queue[:i:i], queue[i+1:]...)
+			return
+		}
+	}
+}
+
+// next returns the class of the next proxy to dequeue: the first class with pending proxies, and
+// fewer in progress than its limit.
+func (p *PushQueue) next() (PushPriority, bool) {
+	for priority := PushPriority(0); priority < numPushPriorities; priority++ {
+		if len(p.connections[priority]) == 0 {
+			continue
+		}
+		if limit := p.limits[priority]; limit > 0 && p.running[priority] >= limit {
+			continue
+		}
+		return priority, true
+	}
+	return 0, false
 }
 
 // Remove a proxy from the queue. If there are no proxies ready to be removed, this will block
@@ -75,19 +196,26 @@ func (p *PushQueue) Dequeue() (*XdsConnection, *model.PushRequest) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	// Block until there is one to remove. Enqueue will signal when one is added.
-	for len(p.connections) == 0 {
+	// Block until there is one to remove. Enqueue and MarkDone will signal when one may be removed.
+	priority, ok := p.next()
+	for !ok {
 		p.cond.Wait()
+		priority, ok = p.next()
 	}
 
-	head := p.connections[0]
-	p.connections = p.connections[1:]
+	head := p.connections[priority][0]
+	p.connections[priority] = p.connections[priority][1:]
 
 	info := p.eventsMap[head]
 	delete(p.eventsMap, head)
+	delete(p.priorities, head)
 
 	// Mark the connection as in progress
 	p.inProgress[head] = nil
+	p.inProgressPriorities[head] = priority
+	p.running[priority]++
+
+	proxiesQueueTime.With(priorityTag.Value(priority.String())).Record(time.Since(info.Start).Seconds())
 
 	return head, info
 }
@@ -97,6 +225,12 @@ func (p *PushQueue) MarkDone(con *XdsConnection) {
 
 	info := p.inProgress[con]
 	delete(p.inProgress, con)
+	if priority, f := p.inProgressPriorities[con]; f {
+		delete(p.inProgressPriorities, con)
+		p.running[priority]--
+		// A push of the class may be dequeued if it was at its limit.
+		p.cond.Broadcast()
+	}
 	p.mu.Unlock()
 
 	// If the info is present, that means Enqueue was called while connection was not yet marked done.
@@ -110,5 +244,5 @@ func (p *PushQueue) MarkDone(con *XdsConnection) {
 func (p *PushQueue) Pending() int {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	return len(p.connections)
+	return len(p.eventsMap)
 }
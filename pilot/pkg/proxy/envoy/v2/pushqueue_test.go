@@ -243,3 +243,82 @@ func TestProxyQueue(t *testing.T) {
 		}
 	})
 }
+
+func TestProxyQueuePriorities(t *testing.T) {
+	newCon := func(id string, nodeType model.NodeType, connect time.Time) *XdsConnection {
+		return &XdsConnection{ConID: id, Connect: connect, node: &model.Proxy{Type: nodeType}}
+	}
+	old := time.Now().Add(-time.Hour)
+	full := &model.PushRequest{Full: true}
+	eds := &model.PushRequest{EdsUpdates: map[string]struct{}{"svc": {}}}
+
+	t.Run("priority order", func(t *testing.T) {
+		p := NewPushQueue()
+		fullCon := newCon("full", model.SidecarProxy, old)
+		edsCon := newCon("eds", model.SidecarProxy, old)
+		gatewayCon := newCon("gateway", model.Router, old)
+		newConnection := newCon("new", model.SidecarProxy, time.Now())
+
+		p.Enqueue(fullCon, full)
+		p.Enqueue(edsCon, eds)
+		p.Enqueue(gatewayCon, full)
+		p.Enqueue(newConnection, full)
+
+		ExpectDequeue(t, p, newConnection)
+		ExpectDequeue(t, p, gatewayCon)
+		ExpectDequeue(t, p, edsCon)
+		ExpectDequeue(t, p, fullCon)
+	})
+
+	t.Run("merge moves to the full class", func(t *testing.T) {
+		p := NewPushQueue()
+		first := newCon("first", model.SidecarProxy, old)
+		second := newCon("second", model.SidecarProxy, old)
+
+		p.Enqueue(first, eds)
+		p.Enqueue(second, eds)
+		p.Enqueue(first, full)
+
+		ExpectDequeue(t, p, second)
+		ExpectDequeue(t, p, first)
+	})
+
+	t.Run("class limit", func(t *testing.T) {
+		p := NewPushQueue()
+		p.limits[PriorityFull] = 1
+		first := newCon("first", model.SidecarProxy, old)
+		second := newCon("second", model.SidecarProxy, old)
+		edsCon := newCon("eds", model.SidecarProxy, old)
+
+		p.Enqueue(first, full)
+		p.Enqueue(second, full)
+		ExpectDequeue(t, p, first)
+
+		// The full class is at its limit, but other classes are not blocked.
+		p.Enqueue(edsCon, eds)
+		ExpectDequeue(t, p, edsCon)
+		if _, ok := p.next(); ok || p.Pending() != 1 {
+			t.Fatalf("expected the second full push to wait for the first one")
+		}
+
+		p.MarkDone(first)
+		ExpectDequeue(t, p, second)
+	})
+}
+
+func TestParsePushQueueLimits(t *testing.T) {
+	cases := []struct {
+		in       string
+		expected [numPushPriorities]int
+	}{
+		{"", [numPushPriorities]int{}},
+		{"full=80", [numPushPriorities]int{PriorityFull: 80}},
+		{"new=10, gateway=20,eds=30", [numPushPriorities]int{10, 20, 30, 0}},
+		{"full=-1,unknown=3,eds", [numPushPriorities]int{}},
+	}
+	for _, tc := range cases {
+		if got := parsePushQueueLimits(tc.in); got != tc.expected {
+			t.Errorf("parsePushQueueLimits(%q) = %v, want %v", tc.in, got, tc.expected)
+		}
+	}
+}
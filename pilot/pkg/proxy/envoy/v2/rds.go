@@ -15,6 +15,7 @@
 package v2
 
 import (
+	"sort"
 	"time"
 
 	"istio.io/istio/pkg/util/protomarshal"
@@ -39,6 +40,7 @@ func (s *DiscoveryServer) pushRoute(con *XdsConnection, push *model.PushContext,
 	}
 
 	response := routeDiscoveryResponse(rawRoutes, version)
+	recordConfigSize(con, rdsType, response, pushStart)
 	err := con.send(response)
 	rdsPushTime.Record(time.Since(pushStart).Seconds())
 	if err != nil {
@@ -53,6 +55,17 @@ func (s *DiscoveryServer) pushRoute(con *XdsConnection, push *model.PushContext,
 }
 
 func (s *DiscoveryServer) generateRawRoutes(con *XdsConnection, push *model.PushContext) []*xdsapi.RouteConfiguration {
+	var cacheKey string
+	if s.cache != nil {
+		routeNames := append([]string(nil), con.Routes...)
+		sort.Strings(routeNames)
+		if cacheKey = s.xdsCacheKey(RouteType, con.node, routeNames); cacheKey != "" {
+			if entry := s.cache.get(cacheKey, push); entry != nil {
+				return entry.routes
+			}
+		}
+	}
+
 	rawRoutes := s.ConfigGenerator.BuildHTTPRoutes(s.Env, con.node, push, con.Routes)
 	// Now validate each route
 	for _, r := range rawRoutes {
@@ -63,6 +76,12 @@ func (s *DiscoveryServer) generateRawRoutes(con *XdsConnection, push *model.Push
 			// Instead of panic, which will break down the whole cluster. Just ignore it here, let envoy process it.
 		}
 	}
+
+	if cacheKey != "" {
+		entry := newXdsCacheEntry(RouteType, con.node)
+		entry.routes = rawRoutes
+		s.cache.add(cacheKey, push, entry)
+	}
 	return rawRoutes
 }
 
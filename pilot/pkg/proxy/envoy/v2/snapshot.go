@@ -0,0 +1,294 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	meshconfig "istio.io/api/mesh/v1alpha1"
+
+	"istio.io/istio/pilot/pkg/config/memory"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/serviceregistry"
+	"istio.io/istio/pilot/pkg/serviceregistry/aggregate"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/labels"
+	"istio.io/istio/pkg/config/schemas"
+	"istio.io/istio/pkg/util/gogoprotomarshal"
+)
+
+// snapshotRegistryPrefix prefixes the names of the replayed registries. The replayed Kubernetes registries
+// must not be named Kubernetes, as their endpoints are not pushed by the Kubernetes controller.
+const snapshotRegistryPrefix = "Snapshot-"
+
+// Snapshot is the input state of Pilot: the Istio configs, the content of the service registries, the mesh
+// config and the mesh networks. It is exported by /debug/snapshot and loaded by `pilot-discovery replay`
+// to reproduce the xDS responses of a Pilot without access to its cluster.
+type Snapshot struct {
+	Mesh         *meshconfig.MeshConfig
+	MeshNetworks *meshconfig.MeshNetworks
+	Configs      []model.Config
+	Registries   []*SnapshotRegistry
+}
+
+// SnapshotRegistry is the content of a service registry, except the ServiceEntry registry which is built
+// from the configs.
+type SnapshotRegistry struct {
+	Name      serviceregistry.ServiceRegistry `json:"name"`
+	ClusterID string                          `json:"clusterID,omitempty"`
+	Services  []*SnapshotService              `json:"services"`
+}
+
+// SnapshotService is a service of a registry and its instances of all ports.
+type SnapshotService struct {
+	Service *model.Service `json:"service"`
+	// Instances do not repeat the service.
+	Instances []*model.ServiceInstance `json:"instances,omitempty"`
+}
+
+// snapshotJSON is the serialized snapshot, with the protos serialized by jsonpb.
+type snapshotJSON struct {
+	Mesh         json.RawMessage     `json:"mesh,omitempty"`
+	MeshNetworks json.RawMessage     `json:"meshNetworks,omitempty"`
+	Configs      []snapshotConfig    `json:"configs"`
+	Registries   []*SnapshotRegistry `json:"registries"`
+}
+
+type snapshotConfig struct {
+	Meta model.ConfigMeta `json:"meta"`
+	Spec json.RawMessage  `json:"spec"`
+}
+
+// Snapshot returns the current input state of the discovery server.
+func (s *DiscoveryServer) Snapshot() (*Snapshot, error) {
+	snap := &Snapshot{
+		Mesh:         s.Env.Mesh,
+		MeshNetworks: s.Env.MeshNetworks,
+	}
+
+	for _, typ := range s.Env.IstioConfigStore.ConfigDescriptor() {
+		configs, err := s.Env.IstioConfigStore.List(typ.Type, model.NamespaceAll)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %v", typ.Type, err)
+		}
+		snap.Configs = append(snap.Configs, configs...)
+	}
+
+	var registries []aggregate.Registry
+	if agg, ok := s.Env.ServiceDiscovery.(*aggregate.Controller); ok {
+		registries = agg.GetRegistries()
+	} else {
+		registries = []aggregate.Registry{
+			{
+				ServiceDiscovery: s.Env.ServiceDiscovery,
+			},
+		}
+	}
+	for _, registry := range registries {
+		// The service entries are replayed from the configs, and the debug registry is recreated empty.
+		if registry.Name == serviceregistry.ServiceEntryRegistry ||
+			(s.MemRegistry != nil && registry.ServiceDiscovery == model.ServiceDiscovery(s.MemRegistry)) {
+			continue
+		}
+		r, err := snapshotRegistry(registry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to snapshot registry %s: %v", registry.Name, err)
+		}
+		snap.Registries = append(snap.Registries, r)
+	}
+	return snap, nil
+}
+
+func snapshotRegistry(registry aggregate.Registry) (*SnapshotRegistry, error) {
+	services, err := registry.Services()
+	if err != nil {
+		return nil, err
+	}
+	out := &SnapshotRegistry{
+		Name:      registry.Name,
+		ClusterID: registry.ClusterID,
+		Services:  make([]*SnapshotService, 0, len(services)),
+	}
+	for _, svc := range services {
+		ss := &SnapshotService{Service: svc}
+		for _, port := range svc.Ports {
+			instances, err := registry.InstancesByPort(svc, port.Port, labels.Collection{})
+			if err != nil {
+				return nil, err
+			}
+			for _, instance := range instances {
+				i := *instance
+				i.Service = nil
+				ss.Instances = append(ss.Instances, &i)
+			}
+		}
+		out.Services = append(out.Services, ss)
+	}
+	return out, nil
+}
+
+// WriteSnapshot writes the gzipped JSON of the snapshot.
+func WriteSnapshot(w io.Writer, snap *Snapshot) error {
+	out := snapshotJSON{
+		Configs:    make([]snapshotConfig, 0, len(snap.Configs)),
+		Registries: snap.Registries,
+	}
+	if snap.Mesh != nil {
+		js, err := gogoprotomarshal.ToJSON(snap.Mesh)
+		if err != nil {
+			return fmt.Errorf("failed to marshal mesh config: %v", err)
+		}
+		out.Mesh = json.RawMessage(js)
+	}
+	if snap.MeshNetworks != nil {
+		js, err := gogoprotomarshal.ToJSON(snap.MeshNetworks)
+		if err != nil {
+			return fmt.Errorf("failed to marshal mesh networks: %v", err)
+		}
+		out.MeshNetworks = json.RawMessage(js)
+	}
+	for _, c := range snap.Configs {
+		js, err := gogoprotomarshal.ToJSON(c.Spec)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s %s/%s: %v", c.Type, c.Namespace, c.Name, err)
+		}
+		out.Configs = append(out.Configs, snapshotConfig{Meta: c.ConfigMeta, Spec: json.RawMessage(js)})
+	}
+
+	gz := gzip.NewWriter(w)
+	if err := json.NewEncoder(gz).Encode(&out); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// ReadSnapshot reads a snapshot written by WriteSnapshot.
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close() // nolint: errcheck
+	in := snapshotJSON{}
+	if err := json.NewDecoder(gz).Decode(&in); err != nil {
+		return nil, err
+	}
+
+	snap := &Snapshot{Registries: in.Registries}
+	if len(in.Mesh) > 0 {
+		snap.Mesh = &meshconfig.MeshConfig{}
+		if err := gogoprotomarshal.ApplyJSON(string(in.Mesh), snap.Mesh); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal mesh config: %v", err)
+		}
+	}
+	if len(in.MeshNetworks) > 0 {
+		snap.MeshNetworks = &meshconfig.MeshNetworks{}
+		if err := gogoprotomarshal.ApplyJSON(string(in.MeshNetworks), snap.MeshNetworks); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal mesh networks: %v", err)
+		}
+	}
+	for _, c := range in.Configs {
+		schema, ok := schemas.Istio.GetByType(c.Meta.Type)
+		if !ok {
+			return nil, fmt.Errorf("unknown type %q of config %s/%s", c.Meta.Type, c.Meta.Namespace, c.Meta.Name)
+		}
+		spec, err := schema.FromJSON(string(c.Spec))
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal %s %s/%s: %v", c.Meta.Type, c.Meta.Namespace, c.Meta.Name, err)
+		}
+		snap.Configs = append(snap.Configs, model.Config{ConfigMeta: c.Meta, Spec: spec})
+	}
+	return snap, nil
+}
+
+// ConfigStore returns an in-memory config store with the configs of the snapshot.
+func (snap *Snapshot) ConfigStore() (model.ConfigStoreCache, error) {
+	store := memory.NewController(memory.Make(schemas.Istio))
+	for _, c := range snap.Configs {
+		if _, err := store.Create(c); err != nil {
+			return nil, fmt.Errorf("failed to load %s %s/%s: %v", c.Type, c.Namespace, c.Name, err)
+		}
+	}
+	return store, nil
+}
+
+// ServiceRegistries returns in-memory service registries with the services and instances of the registries of
+// the snapshot.
+func (snap *Snapshot) ServiceRegistries() []aggregate.Registry {
+	out := make([]aggregate.Registry, 0, len(snap.Registries))
+	for _, r := range snap.Registries {
+		sd := NewMemServiceDiscovery(map[host.Name]*model.Service{}, 0)
+		sd.ClusterID = r.ClusterID
+		for _, ss := range r.Services {
+			sd.AddService(ss.Service.Hostname, ss.Service)
+			for _, instance := range ss.Instances {
+				sd.addSnapshotInstance(ss.Service, instance)
+			}
+		}
+		out = append(out, aggregate.Registry{
+			Name:             serviceregistry.ServiceRegistry(snapshotRegistryPrefix + string(r.Name)),
+			ClusterID:        r.ClusterID,
+			ServiceDiscovery: sd,
+			Controller:       sd.controller,
+		})
+	}
+	return out
+}
+
+// addSnapshotInstance adds an instance of a service. Unlike AddInstance it keeps all the instances of an IP,
+// one per port and service, and their labels as the labels of the workload.
+func (sd *MemServiceDiscovery) addSnapshotInstance(svc *model.Service, instance *model.ServiceInstance) {
+	sd.mutex.Lock()
+	defer sd.mutex.Unlock()
+	instance.Service = svc
+	ip := instance.Endpoint.Address
+	sd.ip2instance[ip] = append(sd.ip2instance[ip], instance)
+	if instance.Labels != nil {
+		l := instance.Labels
+		sd.ip2workloadLabels[ip] = &l
+	}
+
+	key := fmt.Sprintf("%s:%d", svc.Hostname, instance.Endpoint.ServicePort.Port)
+	sd.instancesByPortNum[key] = append(sd.instancesByPortNum[key], instance)
+	key = fmt.Sprintf("%s:%s", svc.Hostname, instance.Endpoint.ServicePort.Name)
+	sd.instancesByPortName[key] = append(sd.instancesByPortName[key], instance)
+}
+
+// snapshotz writes the snapshot of the input state of the discovery server, to be replayed by
+// `pilot-discovery replay --snapshot`.
+func (s *DiscoveryServer) snapshotz(w http.ResponseWriter, _ *http.Request) {
+	snap, err := s.Snapshot()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = fmt.Fprintf(w, "unable to snapshot: %v", err)
+		return
+	}
+	var buf bytes.Buffer
+	if err := WriteSnapshot(&buf, snap); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = fmt.Fprintf(w, "unable to write snapshot: %v", err)
+		return
+	}
+	w.Header().Add("Content-Type", "application/gzip")
+	w.Header().Add("Content-Disposition",
+		fmt.Sprintf("attachment; filename=pilot-snapshot-%s.json.gz", time.Now().UTC().Format("20060102-150405")))
+	_, _ = w.Write(buf.Bytes())
+}
@@ -0,0 +1,147 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+
+	meshconfig "istio.io/api/mesh/v1alpha1"
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/config/memory"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/serviceregistry"
+	"istio.io/istio/pilot/pkg/serviceregistry/aggregate"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/labels"
+	"istio.io/istio/pkg/config/schemas"
+)
+
+func TestSnapshotReplay(t *testing.T) {
+	virtualService := model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Type:        schemas.VirtualService.Type,
+			Group:       "networking.istio.io",
+			Version:     schemas.VirtualService.Version,
+			Name:        "reviews",
+			Namespace:   "default",
+			Annotations: map[string]string{"networking.istio.io/rollout": `{"canary": "v2"}`},
+		},
+		Spec: &networking.VirtualService{
+			Hosts: []string{"reviews.default.svc.cluster.local"},
+			Http: []*networking.HTTPRoute{{
+				Route: []*networking.HTTPRouteDestination{{
+					Destination: &networking.Destination{Host: "reviews.default.svc.cluster.local"},
+				}},
+			}},
+		},
+	}
+	store := memory.NewController(memory.Make(schemas.Istio))
+	if _, err := store.Create(virtualService); err != nil {
+		t.Fatal(err)
+	}
+
+	kube := NewMemServiceDiscovery(map[host.Name]*model.Service{}, 0)
+	kube.AddHTTPService("reviews.default.svc.cluster.local", "10.10.0.1", 9080)
+	kube.AddEndpoint("reviews.default.svc.cluster.local", "http-main", 9080, "10.1.1.1", 9080)
+	serviceEntries := NewMemServiceDiscovery(map[host.Name]*model.Service{}, 0)
+	serviceEntries.AddHTTPService("www.example.com", "", 80)
+	registries := aggregate.NewController()
+	registries.AddRegistry(aggregate.Registry{
+		Name:             serviceregistry.KubernetesRegistry,
+		ClusterID:        "cluster1",
+		ServiceDiscovery: kube,
+		Controller:       kube.controller,
+	})
+	registries.AddRegistry(aggregate.Registry{
+		Name:             serviceregistry.ServiceEntryRegistry,
+		ServiceDiscovery: serviceEntries,
+		Controller:       serviceEntries.controller,
+	})
+
+	s := &DiscoveryServer{
+		Env: &model.Environment{
+			Mesh:             &meshconfig.MeshConfig{TrustDomain: "example.com", ProxyListenPort: 15001},
+			MeshNetworks:     &meshconfig.MeshNetworks{Networks: map[string]*meshconfig.Network{"network1": {}}},
+			IstioConfigStore: model.MakeIstioStore(store),
+			ServiceDiscovery: registries,
+		},
+	}
+	snap, err := s.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteSnapshot(&buf, snap); err != nil {
+		t.Fatal(err)
+	}
+	replayed, err := ReadSnapshot(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !proto.Equal(replayed.Mesh, s.Env.Mesh) {
+		t.Errorf("got mesh config %v, want %v", replayed.Mesh, s.Env.Mesh)
+	}
+	if !proto.Equal(replayed.MeshNetworks, s.Env.MeshNetworks) {
+		t.Errorf("got mesh networks %v, want %v", replayed.MeshNetworks, s.Env.MeshNetworks)
+	}
+
+	replayedStore, err := replayed.ConfigStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := replayedStore.Get(schemas.VirtualService.Type, "reviews", "default")
+	if got == nil {
+		t.Fatal("virtual service not replayed")
+	}
+	if !proto.Equal(got.Spec, virtualService.Spec) {
+		t.Errorf("got virtual service %v, want %v", got.Spec, virtualService.Spec)
+	}
+	if !reflect.DeepEqual(got.Annotations, virtualService.Annotations) {
+		t.Errorf("got annotations %v, want %v", got.Annotations, virtualService.Annotations)
+	}
+
+	replayedRegistries := replayed.ServiceRegistries()
+	if len(replayedRegistries) != 1 {
+		t.Fatalf("got %d registries, want the Kubernetes registry only", len(replayedRegistries))
+	}
+	r := replayedRegistries[0]
+	if r.Name != snapshotRegistryPrefix+serviceregistry.KubernetesRegistry || r.ClusterID != "cluster1" {
+		t.Errorf("got registry %s of cluster %s", r.Name, r.ClusterID)
+	}
+	svc, err := r.GetService("reviews.default.svc.cluster.local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	instances, err := r.InstancesByPort(svc, 9080, labels.Collection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 1 || instances[0].Endpoint.Address != "10.1.1.1" || instances[0].Service != svc {
+		t.Errorf("got instances %v, want the endpoint 10.1.1.1 of the service", instances)
+	}
+	proxyInstances, err := r.GetProxyServiceInstances(&model.Proxy{IPAddresses: []string{"10.1.1.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proxyInstances) != 1 {
+		t.Errorf("got %d instances of the proxy, want 1", len(proxyInstances))
+	}
+}
@@ -0,0 +1,315 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"sort"
+	"sync"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/labels"
+	"istio.io/istio/pkg/config/schemas"
+)
+
+// xdsCache caches the clusters and routes generated for the proxies. The entries are content addressed:
+// they are keyed by the inputs of the generation specific to a proxy, so that the proxies with the same
+// Sidecar scope, metadata and locality share them.
+//
+// The entries are generated from the current push context. Full pushes replace the push context, and
+// remove the entries generated from the configs they update.
+type xdsCache struct {
+	mu sync.Mutex
+
+	// push is the push context the entries are generated from.
+	push    *model.PushContext
+	entries map[string]*xdsCacheEntry
+}
+
+type xdsCacheEntry struct {
+	clusters []*xdsapi.Cluster
+	routes   []*xdsapi.RouteConfiguration
+
+	// typeURL is the type of the resources of the entry.
+	typeURL string
+	// sidecar is whether the entry is generated for a sidecar, and not for a gateway.
+	sidecar bool
+	// configs are the keys of the destination rules and virtual services the entry is generated from.
+	configs map[model.ConfigKey]struct{}
+	// hosts are the hostnames of the services in the scope of the proxy.
+	hosts map[host.Name]struct{}
+}
+
+func newXdsCache() *xdsCache {
+	return &xdsCache{entries: make(map[string]*xdsCacheEntry)}
+}
+
+// get returns the entry of the key generated from the push context, or nil if there is none.
+func (c *xdsCache) get(key string, push *model.PushContext) *xdsCacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var entry *xdsCacheEntry
+	if push == c.push {
+		entry = c.entries[key]
+	}
+	if entry != nil {
+		xdsCacheHits.Increment()
+	} else {
+		xdsCacheMisses.Increment()
+	}
+	return entry
+}
+
+// add adds the entry of the key generated from the push context. Entries generated from an outdated
+// push context are dropped, as they may depend on configs updated since.
+func (c *xdsCache) add(key string, push *model.PushContext, entry *xdsCacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.push == nil {
+		// No full push happened yet, the initial push context is current.
+		c.push = push
+	}
+	if push != c.push {
+		return
+	}
+	c.entries[key] = entry
+}
+
+// clear removes the entries depending on the configs updated by the full push, and makes its push
+// context current. All the entries are removed if the updated configs are unknown.
+func (c *xdsCache) clear(req *model.PushRequest, push *model.PushContext) {
+	updates := make([]xdsCacheUpdate, 0, len(req.ConfigsUpdated))
+	for key := range req.ConfigsUpdated {
+		updates = append(updates, newXdsCacheUpdate(key, push))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.push = push
+	if len(updates) == 0 {
+		c.entries = make(map[string]*xdsCacheEntry)
+		return
+	}
+	for key, entry := range c.entries {
+		for _, update := range updates {
+			if entry.dependsOn(update) {
+				delete(c.entries, key)
+				break
+			}
+		}
+	}
+}
+
+// xdsCacheUpdate is a config updated by a push.
+type xdsCacheUpdate struct {
+	key model.ConfigKey
+	// hosts are the hostnames the config applies to after the update.
+	hosts []host.Name
+	// allHosts is set if the config applies to hostnames not known as services.
+	allHosts bool
+}
+
+func newXdsCacheUpdate(key model.ConfigKey, push *model.PushContext) xdsCacheUpdate {
+	update := xdsCacheUpdate{key: key}
+	if push.Env == nil || push.Env.IstioConfigStore == nil {
+		update.allHosts = true
+		return update
+	}
+	// The config is not found if it is deleted. The entries generated from it depend on its key.
+	config := push.Env.IstioConfigStore.Get(key.Type, key.Name, key.Namespace)
+	if config == nil {
+		return update
+	}
+
+	switch spec := config.Spec.(type) {
+	case *networking.DestinationRule:
+		update.hosts = append(update.hosts, model.ResolveShortnameToFQDN(spec.Host, config.ConfigMeta))
+	case *networking.VirtualService:
+		for _, h := range spec.Hosts {
+			hostname := model.ResolveShortnameToFQDN(h, config.ConfigMeta)
+			update.hosts = append(update.hosts, hostname)
+			if _, f := push.ServiceByHostnameAndNamespace[hostname]; !f {
+				// Routes are generated for the hosts of the virtual services without services too.
+				update.allHosts = true
+			}
+		}
+	}
+	return update
+}
+
+// dependsOn returns whether the entry may be generated from the updated config.
+func (e *xdsCacheEntry) dependsOn(update xdsCacheUpdate) bool {
+	switch update.key.Type {
+	case schemas.Gateway.Type:
+		// Gateways do not impact sidecars.
+		return !e.sidecar
+	case schemas.VirtualService.Type:
+		if e.typeURL == ClusterType {
+			// Clusters do not depend on virtual services.
+			return false
+		}
+		if !e.sidecar {
+			// Virtual services are bound to gateways by name, regardless of their hosts.
+			return true
+		}
+	case schemas.DestinationRule.Type:
+	default:
+		return true
+	}
+
+	if _, f := e.configs[update.key]; f || update.allHosts {
+		return true
+	}
+	// The config may be created, or updated to apply to the services in the scope of the entry.
+	for _, h := range update.hosts {
+		for eh := range e.hosts {
+			if h.Matches(eh) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func configKey(config *model.Config) model.ConfigKey {
+	return model.ConfigKey{Type: config.Type, Name: config.Name, Namespace: config.Namespace}
+}
+
+// newXdsCacheEntry returns an entry of the given type for the proxy, recording the services and configs
+// in its scope.
+func newXdsCacheEntry(typeURL string, node *model.Proxy) *xdsCacheEntry {
+	entry := &xdsCacheEntry{
+		typeURL: typeURL,
+		sidecar: node.Type == model.SidecarProxy,
+		configs: make(map[model.ConfigKey]struct{}),
+		hosts:   make(map[host.Name]struct{}),
+	}
+	scope := node.SidecarScope
+	for _, svc := range scope.Services() {
+		entry.hosts[svc.Hostname] = struct{}{}
+		if dr := scope.DestinationRule(svc.Hostname); dr != nil {
+			entry.configs[configKey(dr)] = struct{}{}
+		}
+	}
+	for _, instance := range node.ServiceInstances {
+		entry.hosts[instance.Service.Hostname] = struct{}{}
+	}
+	if typeURL == RouteType {
+		for _, listener := range scope.EgressListeners {
+			virtualServices := listener.VirtualServices()
+			for i := range virtualServices {
+				entry.configs[configKey(&virtualServices[i])] = struct{}{}
+			}
+		}
+	}
+	return entry
+}
+
+// xdsCacheKeyInputs are the inputs of the generation of the clusters and routes specific to a proxy.
+// Pods of the same workload differ only by their name and addresses, which are left out.
+type xdsCacheKeyInputs struct {
+	TypeURL         string
+	Type            model.NodeType
+	ClusterID       string
+	ConfigNamespace string
+	DNSDomain       string
+	IstioVersion    *model.IstioVersion
+	Sidecar         string
+	Metadata        *model.NodeMetadata
+	Locality        string
+	IPv4            bool
+	IPv6            bool
+	WorkloadLabels  labels.Collection
+	Instances       []xdsCacheKeyInstance
+	ManagementPorts []int
+	Routes          []string
+}
+
+type xdsCacheKeyInstance struct {
+	Hostname     host.Name
+	Namespace    string
+	PortName     string
+	ServicePort  int
+	EndpointPort int
+	Labels       labels.Instance
+}
+
+// xdsCacheKey returns the key of the resources of the given type for the proxy, or "" if they cannot be
+// cached. The routes are the names of the route configurations requested by the proxy.
+func (s *DiscoveryServer) xdsCacheKey(typeURL string, node *model.Proxy, routes []string) string {
+	if node.SidecarScope == nil || node.Metadata == nil {
+		return ""
+	}
+
+	metadata := *node.Metadata
+	metadata.InstanceIPs = nil
+	metadata.InstanceName = ""
+	inputs := xdsCacheKeyInputs{
+		TypeURL:         typeURL,
+		Type:            node.Type,
+		ClusterID:       node.ClusterID,
+		ConfigNamespace: node.ConfigNamespace,
+		DNSDomain:       node.DNSDomain,
+		IstioVersion:    node.IstioVersion,
+		Metadata:        &metadata,
+		Locality:        util.LocalityToString(node.Locality),
+		WorkloadLabels:  node.WorkloadLabels,
+		Routes:          routes,
+	}
+	if sidecar := node.SidecarScope.Config; sidecar != nil {
+		inputs.Sidecar = sidecar.Namespace + "/" + sidecar.Name
+	}
+	for _, ip := range node.IPAddresses {
+		if addr := net.ParseIP(ip); addr != nil && addr.To4() != nil {
+			inputs.IPv4 = true
+		} else if addr != nil {
+			inputs.IPv6 = true
+		}
+		for _, port := range s.Env.ManagementPorts(ip) {
+			inputs.ManagementPorts = append(inputs.ManagementPorts, port.Port)
+		}
+	}
+	sort.Ints(inputs.ManagementPorts)
+	for _, instance := range node.ServiceInstances {
+		inputs.Instances = append(inputs.Instances, xdsCacheKeyInstance{
+			Hostname:     instance.Service.Hostname,
+			Namespace:    instance.Service.Attributes.Namespace,
+			PortName:     instance.Endpoint.ServicePort.Name,
+			ServicePort:  instance.Endpoint.ServicePort.Port,
+			EndpointPort: instance.Endpoint.Port,
+			Labels:       instance.Labels,
+		})
+	}
+
+	b, err := json.Marshal(inputs)
+	if err != nil {
+		adsLog.Warnf("failed to compute the xds cache key of %s: %v", node.ID, err)
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
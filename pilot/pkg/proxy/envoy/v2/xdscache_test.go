@@ -0,0 +1,199 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"testing"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/config/memory"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/schemas"
+)
+
+func TestXdsCacheKey(t *testing.T) {
+	s := &DiscoveryServer{Env: &model.Environment{ServiceDiscovery: NewMemServiceDiscovery(nil, 0)}}
+	scope := &model.SidecarScope{}
+	proxy := func(id, ip string, locality *core.Locality) *model.Proxy {
+		return &model.Proxy{
+			Type:            model.SidecarProxy,
+			ID:              id + ".default",
+			IPAddresses:     []string{ip},
+			ConfigNamespace: "default",
+			Locality:        locality,
+			SidecarScope:    scope,
+			Metadata:        &model.NodeMetadata{InstanceName: id, InstanceIPs: []string{ip}},
+		}
+	}
+	zoneA := &core.Locality{Region: "region", Zone: "a"}
+	zoneB := &core.Locality{Region: "region", Zone: "b"}
+
+	key := s.xdsCacheKey(ClusterType, proxy("reviews-1", "10.0.0.1", zoneA), nil)
+	if key == "" {
+		t.Fatal("expected a cache key")
+	}
+	if got := s.xdsCacheKey(ClusterType, proxy("reviews-2", "10.0.0.2", zoneA), nil); got != key {
+		t.Errorf("expected the same key for proxies differing by their name and address")
+	}
+	if got := s.xdsCacheKey(ClusterType, proxy("reviews-2", "10.0.0.2", zoneB), nil); got == key {
+		t.Errorf("expected a different key for proxies in different localities")
+	}
+	if got := s.xdsCacheKey(ClusterType, proxy("reviews-2", "fd00::2", zoneA), nil); got == key {
+		t.Errorf("expected a different key for proxies with different IP families")
+	}
+	if got := s.xdsCacheKey(RouteType, proxy("reviews-1", "10.0.0.1", zoneA), nil); got == key {
+		t.Errorf("expected a different key for routes")
+	}
+	if got := s.xdsCacheKey(ClusterType, &model.Proxy{Metadata: &model.NodeMetadata{}}, nil); got != "" {
+		t.Errorf("expected no key for a proxy without sidecar scope, got %q", got)
+	}
+}
+
+func TestXdsCachePushContext(t *testing.T) {
+	c := newXdsCache()
+	push0 := model.NewPushContext()
+	push1 := model.NewPushContext()
+
+	c.add("key", push0, &xdsCacheEntry{typeURL: ClusterType})
+	if c.get("key", push0) == nil {
+		t.Fatal("expected an entry")
+	}
+
+	c.clear(&model.PushRequest{Full: true}, push1)
+	if c.get("key", push1) != nil {
+		t.Error("expected the entries to be removed by a push with unknown configs")
+	}
+
+	c.add("key", push0, &xdsCacheEntry{typeURL: ClusterType})
+	if c.get("key", push1) != nil || c.get("key", push0) != nil {
+		t.Error("expected entries generated from an outdated push context to be dropped")
+	}
+}
+
+func TestXdsCacheClear(t *testing.T) {
+	httpRoutes := func(h string) []*networking.HTTPRoute {
+		return []*networking.HTTPRoute{{Route: []*networking.HTTPRouteDestination{{Destination: &networking.Destination{Host: h}}}}}
+	}
+	meta := func(typ, name string) model.ConfigMeta {
+		return model.ConfigMeta{Type: typ, Name: name, Namespace: "default", Domain: "svc.cluster.local"}
+	}
+	reviews := host.Name("reviews.default.svc.cluster.local")
+	ratings := host.Name("ratings.default.svc.cluster.local")
+
+	store := memory.Make(schemas.Istio)
+	for _, config := range []model.Config{
+		{
+			ConfigMeta: meta(schemas.DestinationRule.Type, "reviews"),
+			Spec:       &networking.DestinationRule{Host: "reviews"},
+		},
+		{
+			ConfigMeta: meta(schemas.VirtualService.Type, "ratings"),
+			Spec:       &networking.VirtualService{Hosts: []string{"ratings"}, Http: httpRoutes("ratings")},
+		},
+		{
+			ConfigMeta: meta(schemas.VirtualService.Type, "external"),
+			Spec:       &networking.VirtualService{Hosts: []string{"www.example.com"}, Http: httpRoutes("ratings")},
+		},
+	} {
+		if _, err := store.Create(config); err != nil {
+			t.Fatal(err)
+		}
+	}
+	push := model.NewPushContext()
+	push.Env = &model.Environment{IstioConfigStore: model.MakeIstioStore(store)}
+	push.ServiceByHostnameAndNamespace = map[host.Name]map[string]*model.Service{
+		reviews: {"default": {Hostname: reviews}},
+		ratings: {"default": {Hostname: ratings}},
+	}
+
+	usedDestinationRule := model.ConfigKey{Type: schemas.DestinationRule.Type, Name: "used", Namespace: "default"}
+	entries := map[string]*xdsCacheEntry{
+		"reviews-clusters": {
+			typeURL: ClusterType,
+			sidecar: true,
+			configs: map[model.ConfigKey]struct{}{usedDestinationRule: {}},
+			hosts:   map[host.Name]struct{}{reviews: {}},
+		},
+		"ratings-routes": {
+			typeURL: RouteType,
+			sidecar: true,
+			hosts:   map[host.Name]struct{}{ratings: {}},
+		},
+		"gateway-routes": {
+			typeURL: RouteType,
+			hosts:   map[host.Name]struct{}{reviews: {}},
+		},
+	}
+
+	cases := []struct {
+		name     string
+		updated  model.ConfigKey
+		expected []string
+	}{
+		{
+			name:     "used destination rule deleted",
+			updated:  usedDestinationRule,
+			expected: []string{"ratings-routes", "gateway-routes"},
+		},
+		{
+			name:     "destination rule of a host in scope",
+			updated:  model.ConfigKey{Type: schemas.DestinationRule.Type, Name: "reviews", Namespace: "default"},
+			expected: []string{"ratings-routes"},
+		},
+		{
+			name:     "virtual service of a host in scope",
+			updated:  model.ConfigKey{Type: schemas.VirtualService.Type, Name: "ratings", Namespace: "default"},
+			expected: []string{"reviews-clusters"},
+		},
+		{
+			name:     "virtual service of an external host",
+			updated:  model.ConfigKey{Type: schemas.VirtualService.Type, Name: "external", Namespace: "default"},
+			expected: []string{"reviews-clusters"},
+		},
+		{
+			name:     "gateway",
+			updated:  model.ConfigKey{Type: schemas.Gateway.Type, Name: "gateway", Namespace: "default"},
+			expected: []string{"reviews-clusters", "ratings-routes"},
+		},
+		{
+			name:    "envoy filter",
+			updated: model.ConfigKey{Type: schemas.EnvoyFilter.Type, Name: "filter", Namespace: "default"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newXdsCache()
+			c.push = push
+			for key, entry := range entries {
+				c.entries[key] = entry
+			}
+			c.clear(&model.PushRequest{Full: true, ConfigsUpdated: map[model.ConfigKey]struct{}{tc.updated: {}}}, push)
+
+			if len(c.entries) != len(tc.expected) {
+				t.Errorf("got %d entries, want %v", len(c.entries), tc.expected)
+			}
+			for _, key := range tc.expected {
+				if _, f := c.entries[key]; !f {
+					t.Errorf("expected entry %s to be kept", key)
+				}
+			}
+		})
+	}
+}
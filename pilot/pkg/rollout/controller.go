@@ -0,0 +1,371 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollout
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	networking "istio.io/api/networking/v1alpha3"
+	"istio.io/pkg/log"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/schemas"
+)
+
+const (
+	// versionLabel is the label of the workloads of the subsets identifying their metrics.
+	versionLabel = "version"
+
+	electionID = "istio-rollout-controller-leader"
+)
+
+// Controller steps the rollouts of the virtual services of a config store.
+type Controller struct {
+	store    model.ConfigStoreCache
+	statuses StatusStore
+	metrics  Metrics
+	interval time.Duration
+	// now returns the current time, replaced in the tests.
+	now     func() time.Time
+	trigger chan struct{}
+}
+
+// NewController returns a controller evaluating the rollouts of the virtual services of the store on every
+// interval and virtual service change, and writing their statuses to the status store. It must be created
+// before the store runs.
+func NewController(store model.ConfigStoreCache, statuses StatusStore, metrics Metrics, interval time.Duration) *Controller {
+	c := &Controller{
+		store:    store,
+		statuses: statuses,
+		metrics:  metrics,
+		interval: interval,
+		now:      time.Now,
+		trigger:  make(chan struct{}, 1),
+	}
+	store.RegisterEventHandler(schemas.VirtualService.Type, func(model.Config, model.Event) {
+		select {
+		case c.trigger <- struct{}{}:
+		default:
+		}
+	})
+	return c
+}
+
+// Run evaluates the rollouts until the stop channel is closed.
+func (c *Controller) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case <-c.trigger:
+		}
+		if c.store.HasSynced() {
+			c.Reconcile()
+		}
+	}
+}
+
+// RunWithLeaderElection runs the controller while the Pilot instance holds the leader lock of the namespace,
+// so that the rollouts are stepped by a single instance, until the stop channel is closed.
+func (c *Controller) RunWithLeaderElection(client kubernetes.Interface, namespace string, stop <-chan struct{}) error {
+	identity, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+	ttl := 30 * time.Second
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.ConfigMapLock{
+			ConfigMapMeta: metaV1.ObjectMeta{Namespace: namespace, Name: electionID},
+			Client:        client.CoreV1(),
+			LockConfig:    resourcelock.ResourceLockConfig{Identity: identity},
+		},
+		LeaseDuration: ttl,
+		RenewDeadline: ttl / 2,
+		RetryPeriod:   ttl / 4,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				log.Infof("Started leading the rollout controller")
+				c.Run(ctx.Done())
+			},
+			OnStoppedLeading: func() {
+				log.Infof("Stopped leading the rollout controller")
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stop
+		cancel()
+	}()
+	// The elector returns when it loses the lock, compete for it again until stopped.
+	go wait.Until(func() { elector.Run(ctx) }, time.Second, stop)
+	return nil
+}
+
+// Reconcile evaluates the rollouts of all the virtual services once.
+func (c *Controller) Reconcile() {
+	configs, err := c.store.List(schemas.VirtualService.Type, model.NamespaceAll)
+	if err != nil {
+		log.Warnf("failed to list virtual services for rollouts: %v", err)
+		return
+	}
+	current, err := c.statuses.Load()
+	if err != nil {
+		log.Warnf("failed to load the statuses of the rollouts: %v", err)
+		return
+	}
+	// The statuses of the virtual services no longer rolled out are dropped.
+	next := make(map[string]Status, len(current))
+	for _, cfg := range configs {
+		if _, f := cfg.Annotations[Annotation]; !f {
+			continue
+		}
+		key := statusKey(cfg.Namespace, cfg.Name)
+		status, err := c.reconcile(cfg, current[key])
+		if err != nil {
+			log.Warnf("failed to update the rollout of virtual service %s/%s: %v", cfg.Namespace, cfg.Name, err)
+		}
+		next[key] = status
+	}
+	if reflect.DeepEqual(next, current) {
+		return
+	}
+	if err := c.statuses.Store(next); err != nil {
+		log.Warnf("failed to store the statuses of the rollouts: %v", err)
+	}
+}
+
+// reconcile returns the status following the current status of the rollout of the virtual service, and writes
+// the weights of the status to the virtual service.
+func (c *Controller) reconcile(cfg model.Config, current Status) (Status, error) {
+	value := cfg.Annotations[Annotation]
+	observed := specHash(value)
+
+	// The rollout restarts when the spec changes.
+	if current.ObservedSpec != observed {
+		current = Status{}
+	}
+	next := current
+	if !current.terminal() {
+		next = c.next(cfg, value, current)
+		next.ObservedSpec = observed
+		if !reflect.DeepEqual(next, current) {
+			log.Infof("rollout of virtual service %s/%s: %s %s", cfg.Namespace, cfg.Name, next.Phase, next.Message)
+		}
+	}
+	if next.Phase == Failed {
+		return next, nil
+	}
+	// The weights are written again when the virtual service is re-applied from its source.
+	return next, c.updateWeights(cfg, value, next.CanaryWeight)
+}
+
+// next returns the status following the current status of the rollout of the virtual service.
+func (c *Controller) next(cfg model.Config, value string, current Status) Status {
+	now := c.now()
+	failed := func(err error) Status {
+		return Status{
+			Phase:              Failed,
+			Step:               current.Step,
+			CanaryWeight:       current.CanaryWeight,
+			LastTransitionTime: now,
+			Message:            err.Error(),
+		}
+	}
+
+	spec, err := ParseSpec(value)
+	if err != nil {
+		return failed(err)
+	}
+	settings, _ := spec.settings()
+	target, err := c.canaryTarget(cfg, spec)
+	if err != nil {
+		return failed(err)
+	}
+	if _, err := findRoute(cfg, spec, target.Service); err != nil {
+		return failed(err)
+	}
+
+	if current.Phase == "" {
+		return Status{
+			Phase:              Progressing,
+			CanaryWeight:       spec.Steps[0],
+			LastTransitionTime: now,
+			Message:            fmt.Sprintf("sending %d%% of the traffic to subset %s", spec.Steps[0], spec.CanarySubset),
+		}
+	}
+	if now.Sub(current.LastTransitionTime) < settings.interval {
+		return current
+	}
+
+	reason, err := c.analyze(target, spec, settings)
+	if err != nil {
+		// The rollout waits for the metrics to be available.
+		next := current
+		next.Message = fmt.Sprintf("waiting for the metrics of subset %s: %v", spec.CanarySubset, err)
+		return next
+	}
+	if reason != "" {
+		return Status{
+			Phase:              RolledBack,
+			Step:               current.Step,
+			LastTransitionTime: now,
+			Message:            fmt.Sprintf("rolled back subset %s: %s", spec.CanarySubset, reason),
+		}
+	}
+	if current.Step == len(spec.Steps)-1 {
+		return Status{
+			Phase:              Succeeded,
+			Step:               current.Step,
+			CanaryWeight:       current.CanaryWeight,
+			LastTransitionTime: now,
+			Message:            fmt.Sprintf("sent %d%% of the traffic to subset %s", current.CanaryWeight, spec.CanarySubset),
+		}
+	}
+	step := current.Step + 1
+	return Status{
+		Phase:              Progressing,
+		Step:               step,
+		CanaryWeight:       spec.Steps[step],
+		LastTransitionTime: now,
+		Message:            fmt.Sprintf("sending %d%% of the traffic to subset %s", spec.Steps[step], spec.CanarySubset),
+	}
+}
+
+// analyze returns the threshold exceeded by the canary, if any.
+func (c *Controller) analyze(target Target, spec *Spec, settings *rolloutSettings) (string, error) {
+	if max := spec.Analysis.MaxErrorRate; max != nil {
+		rate, err := c.metrics.ErrorRate(target, settings.window)
+		if err != nil {
+			return "", err
+		}
+		if rate > *max {
+			return fmt.Sprintf("error rate %.4f exceeds %.4f", rate, *max), nil
+		}
+	}
+	if settings.maxLatency > 0 {
+		latency, err := c.metrics.Latency(target, settings.latencyPercentile, settings.window)
+		if err != nil {
+			return "", err
+		}
+		if latency > settings.maxLatency {
+			return fmt.Sprintf("p%v latency %v exceeds %v", settings.latencyPercentile*100, latency, settings.maxLatency), nil
+		}
+	}
+	return "", nil
+}
+
+// canaryTarget returns the target of the metrics of the canary subset of the destination rule of the rollout.
+func (c *Controller) canaryTarget(cfg model.Config, spec *Spec) (Target, error) {
+	dr := c.store.Get(schemas.DestinationRule.Type, spec.DestinationRule, cfg.Namespace)
+	if dr == nil {
+		return Target{}, fmt.Errorf("destination rule %s/%s not found", cfg.Namespace, spec.DestinationRule)
+	}
+	rule := dr.Spec.(*networking.DestinationRule)
+	var stable, canary *networking.Subset
+	for _, subset := range rule.Subsets {
+		switch subset.Name {
+		case spec.StableSubset:
+			stable = subset
+		case spec.CanarySubset:
+			canary = subset
+		}
+	}
+	if stable == nil || canary == nil {
+		return Target{}, fmt.Errorf("destination rule %s/%s has no subsets %s and %s",
+			cfg.Namespace, spec.DestinationRule, spec.StableSubset, spec.CanarySubset)
+	}
+	version := canary.Labels[versionLabel]
+	if version == "" {
+		return Target{}, fmt.Errorf("subset %s has no %s label", spec.CanarySubset, versionLabel)
+	}
+	return Target{Service: model.ResolveShortnameToFQDN(rule.Host, dr.ConfigMeta), Version: version}, nil
+}
+
+// findRoute returns the HTTP route of the rollout, whose destinations must all be the service.
+func findRoute(cfg model.Config, spec *Spec, service host.Name) (*networking.HTTPRoute, error) {
+	vs := cfg.Spec.(*networking.VirtualService)
+	for _, route := range vs.Http {
+		if spec.Route != "" && route.Name != spec.Route {
+			continue
+		}
+		if len(route.Route) == 0 {
+			return nil, fmt.Errorf("route %q has no destinations", route.Name)
+		}
+		for _, dest := range route.Route {
+			if model.ResolveShortnameToFQDN(dest.Destination.GetHost(), cfg.ConfigMeta) != service {
+				return nil, fmt.Errorf("route %q has destinations other than %s", route.Name, service)
+			}
+		}
+		return route, nil
+	}
+	return nil, fmt.Errorf("route %q not found", spec.Route)
+}
+
+// setWeights replaces the destinations of the route with the stable and canary subsets, weighted by the status.
+func setWeights(route *networking.HTTPRoute, spec *Spec, canaryWeight int32) {
+	template := route.Route[0]
+	stable := proto.Clone(template).(*networking.HTTPRouteDestination)
+	stable.Destination.Subset = spec.StableSubset
+	stable.Weight = 100 - canaryWeight
+	canary := proto.Clone(template).(*networking.HTTPRouteDestination)
+	canary.Destination.Subset = spec.CanarySubset
+	canary.Weight = canaryWeight
+	route.Route = []*networking.HTTPRouteDestination{stable, canary}
+}
+
+// updateWeights writes the weights of the stable and canary subsets to the route of the rollout, unless they
+// are already set.
+func (c *Controller) updateWeights(cfg model.Config, value string, canaryWeight int32) error {
+	spec, err := ParseSpec(value)
+	if err != nil {
+		return err
+	}
+	target, err := c.canaryTarget(cfg, spec)
+	if err != nil {
+		return err
+	}
+	out := cfg
+	out.Spec = proto.Clone(cfg.Spec)
+	route, err := findRoute(out, spec, target.Service)
+	if err != nil {
+		return err
+	}
+	setWeights(route, spec, canaryWeight)
+	if proto.Equal(out.Spec, cfg.Spec) {
+		return nil
+	}
+	_, err = c.store.Update(out)
+	return err
+}
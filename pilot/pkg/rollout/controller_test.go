@@ -0,0 +1,269 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollout
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	networking "istio.io/api/networking/v1alpha3"
+
+	"istio.io/istio/pilot/pkg/config/memory"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/schemas"
+)
+
+const testSpec = `{"route": "reviews", "destinationRule": "reviews", "stableSubset": "v1", "canarySubset": "v2",
+	"steps": [10, 50], "interval": "1m", "analysis": {"maxErrorRate": 0.01, "maxLatency": "500ms"}}`
+
+type fakeMetrics struct {
+	errorRate float64
+	latency   time.Duration
+	err       error
+	targets   []Target
+}
+
+func (f *fakeMetrics) ErrorRate(target Target, _ time.Duration) (float64, error) {
+	f.targets = append(f.targets, target)
+	return f.errorRate, f.err
+}
+
+func (f *fakeMetrics) Latency(target Target, _ float64, _ time.Duration) (time.Duration, error) {
+	f.targets = append(f.targets, target)
+	return f.latency, f.err
+}
+
+type testRollout struct {
+	t        *testing.T
+	store    model.ConfigStoreCache
+	statuses *MemoryStatusStore
+	metrics  *fakeMetrics
+	c        *Controller
+	now      time.Time
+}
+
+func newTestRollout(t *testing.T, spec string) *testRollout {
+	store := memory.NewController(memory.Make(schemas.Istio))
+	r := &testRollout{
+		t:        t,
+		store:    store,
+		statuses: NewMemoryStatusStore(),
+		metrics:  &fakeMetrics{},
+		now:      time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC),
+	}
+	r.c = NewController(store, r.statuses, r.metrics, time.Second)
+	r.c.now = func() time.Time { return r.now }
+
+	if _, err := store.Create(model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Type:      schemas.DestinationRule.Type,
+			Name:      "reviews",
+			Namespace: "default",
+			Domain:    "cluster.local",
+		},
+		Spec: &networking.DestinationRule{
+			Host: "reviews",
+			Subsets: []*networking.Subset{
+				{Name: "v1", Labels: map[string]string{"version": "v1"}},
+				{Name: "v2", Labels: map[string]string{"version": "v2"}},
+			},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Create(model.Config{
+		ConfigMeta: model.ConfigMeta{
+			Type:        schemas.VirtualService.Type,
+			Name:        "reviews",
+			Namespace:   "default",
+			Domain:      "cluster.local",
+			Annotations: map[string]string{Annotation: spec},
+		},
+		Spec: &networking.VirtualService{
+			Hosts: []string{"reviews"},
+			Http: []*networking.HTTPRoute{{
+				Name:  "reviews",
+				Route: []*networking.HTTPRouteDestination{{Destination: &networking.Destination{Host: "reviews", Subset: "v1"}}},
+			}},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func (r *testRollout) virtualService() *model.Config {
+	return r.store.Get(schemas.VirtualService.Type, "reviews", "default")
+}
+
+// step reconciles the rollout after the duration, and checks its phase and weights.
+func (r *testRollout) step(after time.Duration, phase Phase, weights []int32) {
+	r.t.Helper()
+	r.now = r.now.Add(after)
+	r.c.Reconcile()
+
+	cfg := r.virtualService()
+	if _, f := cfg.Annotations["networking.istio.io/rolloutStatus"]; f {
+		r.t.Fatalf("status written to the virtual service")
+	}
+	statuses, _ := r.statuses.Load()
+	status := statuses[statusKey(cfg.Namespace, cfg.Name)]
+	if status.Phase != phase {
+		r.t.Fatalf("got phase %s (%s), want %s", status.Phase, status.Message, phase)
+	}
+	var got []int32
+	for _, dest := range cfg.Spec.(*networking.VirtualService).Http[0].Route {
+		got = append(got, dest.Weight)
+	}
+	if !reflect.DeepEqual(got, weights) {
+		r.t.Fatalf("got weights %v, want %v", got, weights)
+	}
+}
+
+func TestRolloutSucceeds(t *testing.T) {
+	r := newTestRollout(t, testSpec)
+
+	r.step(0, Progressing, []int32{90, 10})
+	version := r.virtualService().ResourceVersion
+	r.step(30*time.Second, Progressing, []int32{90, 10})
+	if got := r.virtualService().ResourceVersion; got != version {
+		t.Fatalf("virtual service updated before the end of the step")
+	}
+	if len(r.metrics.targets) != 0 {
+		t.Fatalf("metrics queried before the end of the step")
+	}
+
+	r.metrics.latency = 100 * time.Millisecond
+	r.step(time.Minute, Progressing, []int32{50, 50})
+	r.step(time.Minute, Succeeded, []int32{50, 50})
+
+	want := Target{Service: "reviews.default.svc.cluster.local", Version: "v2"}
+	if r.metrics.targets[0] != want {
+		t.Errorf("got metrics target %+v, want %+v", r.metrics.targets[0], want)
+	}
+
+	// The succeeded rollout is left alone.
+	r.metrics.errorRate = 1
+	r.step(time.Minute, Succeeded, []int32{50, 50})
+}
+
+func TestRolloutRollsBack(t *testing.T) {
+	r := newTestRollout(t, testSpec)
+
+	r.step(0, Progressing, []int32{90, 10})
+	r.metrics.err = errors.New("unavailable")
+	r.step(time.Minute, Progressing, []int32{90, 10})
+	r.metrics.err = nil
+	r.metrics.latency = time.Second
+	r.step(time.Second, RolledBack, []int32{100, 0})
+}
+
+func TestRolloutRestartsOnSpecChange(t *testing.T) {
+	r := newTestRollout(t, testSpec)
+
+	r.metrics.errorRate = 0.5
+	r.step(0, Progressing, []int32{90, 10})
+	r.step(time.Minute, RolledBack, []int32{100, 0})
+
+	cfg := *r.virtualService()
+	cfg.Annotations = map[string]string{
+		Annotation: `{"route": "reviews", "destinationRule": "reviews", "stableSubset": "v1", "canarySubset": "v2", "steps": [20]}`,
+	}
+	if _, err := r.store.Update(cfg); err != nil {
+		t.Fatal(err)
+	}
+	r.step(0, Progressing, []int32{80, 20})
+	// Without thresholds, the metrics are not queried.
+	r.step(time.Minute, Succeeded, []int32{80, 20})
+}
+
+func TestRolloutRestoresWeights(t *testing.T) {
+	r := newTestRollout(t, testSpec)
+
+	r.step(0, Progressing, []int32{90, 10})
+
+	// The virtual service is re-applied from its source.
+	cfg := *r.virtualService()
+	cfg.Spec = &networking.VirtualService{
+		Hosts: []string{"reviews"},
+		Http: []*networking.HTTPRoute{{
+			Name:  "reviews",
+			Route: []*networking.HTTPRouteDestination{{Destination: &networking.Destination{Host: "reviews", Subset: "v1"}}},
+		}},
+	}
+	if _, err := r.store.Update(cfg); err != nil {
+		t.Fatal(err)
+	}
+	r.step(time.Second, Progressing, []int32{90, 10})
+}
+
+func TestRolloutDropsStatuses(t *testing.T) {
+	r := newTestRollout(t, testSpec)
+
+	r.step(0, Progressing, []int32{90, 10})
+	if err := r.store.Delete(schemas.VirtualService.Type, "reviews", "default"); err != nil {
+		t.Fatal(err)
+	}
+	r.c.Reconcile()
+	if statuses, _ := r.statuses.Load(); len(statuses) != 0 {
+		t.Fatalf("got statuses %v after the virtual service was deleted", statuses)
+	}
+}
+
+func TestRolloutFails(t *testing.T) {
+	cases := []struct {
+		name string
+		spec string
+	}{
+		{name: "invalid spec", spec: `{"destinationRule": "reviews", "stableSubset": "v1", "canarySubset": "v2"}`},
+		{name: "missing destination rule", spec: `{"destinationRule": "ratings", "stableSubset": "v1", "canarySubset": "v2", "steps": [10]}`},
+		{name: "missing subset", spec: `{"destinationRule": "reviews", "stableSubset": "v1", "canarySubset": "v3", "steps": [10]}`},
+		{name: "missing route", spec: `{"route": "ratings", "destinationRule": "reviews", "stableSubset": "v1", "canarySubset": "v2", "steps": [10]}`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := newTestRollout(t, c.spec)
+			r.step(0, Failed, []int32{0})
+		})
+	}
+}
+
+func TestParseSpec(t *testing.T) {
+	cases := []struct {
+		name    string
+		spec    string
+		wantErr bool
+	}{
+		{name: "valid", spec: testSpec},
+		{name: "not json", spec: `steps`, wantErr: true},
+		{name: "same subsets", spec: `{"destinationRule": "r", "stableSubset": "v1", "canarySubset": "v1", "steps": [10]}`, wantErr: true},
+		{name: "decreasing steps", spec: `{"destinationRule": "r", "stableSubset": "v1", "canarySubset": "v2", "steps": [50, 10]}`, wantErr: true},
+		{name: "step above 100", spec: `{"destinationRule": "r", "stableSubset": "v1", "canarySubset": "v2", "steps": [150]}`, wantErr: true},
+		{name: "invalid interval", spec: `{"destinationRule": "r", "stableSubset": "v1", "canarySubset": "v2", "steps": [10], "interval": "-1m"}`,
+			wantErr: true},
+		{name: "invalid percentile", spec: `{"destinationRule": "r", "stableSubset": "v1", "canarySubset": "v2", "steps": [10],
+			"analysis": {"latencyPercentile": 99}}`, wantErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := ParseSpec(c.spec)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("got error %v, want error %v", err, c.wantErr)
+			}
+		})
+	}
+}
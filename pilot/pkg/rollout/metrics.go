@@ -0,0 +1,109 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollout
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	prommodel "github.com/prometheus/common/model"
+
+	"istio.io/istio/pkg/config/host"
+)
+
+const queryTimeout = 10 * time.Second
+
+// Target is the version of a service whose metrics are analyzed.
+type Target struct {
+	Service host.Name
+	// Version is the version label of the workloads of the subset.
+	Version string
+}
+
+// Metrics are the metrics of the canaries of rollouts.
+type Metrics interface {
+	// ErrorRate returns the fraction of the requests to the target failing with a 5xx status code over the window,
+	// 0 without requests.
+	ErrorRate(target Target, window time.Duration) (float64, error)
+	// Latency returns the latency of the requests to the target at the percentile over the window, 0 without
+	// requests.
+	Latency(target Target, percentile float64, window time.Duration) (time.Duration, error)
+}
+
+type prometheusMetrics struct {
+	api promv1.API
+}
+
+// NewPrometheusMetrics returns the metrics reported by the proxies of the targets to the Prometheus API at the
+// address.
+func NewPrometheusMetrics(address string) (Metrics, error) {
+	client, err := api.NewClient(api.Config{Address: address})
+	if err != nil {
+		return nil, fmt.Errorf("could not build prometheus client: %v", err)
+	}
+	return &prometheusMetrics{api: promv1.NewAPI(client)}, nil
+}
+
+func (p *prometheusMetrics) ErrorRate(target Target, window time.Duration) (float64, error) {
+	selector := targetSelector(target)
+	query := fmt.Sprintf(`sum(rate(istio_requests_total{%s,response_code=~"5.*"}[%s])) / sum(rate(istio_requests_total{%s}[%s]))`,
+		selector, promDuration(window), selector, promDuration(window))
+	return p.scalar(query)
+}
+
+func (p *prometheusMetrics) Latency(target Target, percentile float64, window time.Duration) (time.Duration, error) {
+	query := fmt.Sprintf(`histogram_quantile(%f, sum(rate(istio_request_duration_seconds_bucket{%s}[%s])) by (le))`,
+		percentile, targetSelector(target), promDuration(window))
+	seconds, err := p.scalar(query)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// scalar returns the value of the query, 0 if it has none.
+func (p *prometheusMetrics) scalar(query string) (float64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	val, err := p.api.Query(ctx, query, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("query %q failed: %v", query, err)
+	}
+	v, ok := val.(prommodel.Vector)
+	if !ok {
+		return 0, fmt.Errorf("query %q returned a %v instead of a vector", query, val.Type())
+	}
+	if v.Len() == 0 {
+		return 0, nil
+	}
+	// The ratios and quantiles are NaN without requests.
+	if f := float64(v[0].Value); !math.IsNaN(f) {
+		return f, nil
+	}
+	return 0, nil
+}
+
+func targetSelector(target Target) string {
+	return fmt.Sprintf(`reporter="destination",destination_service=%q,destination_version=%q`,
+		string(target.Service), target.Version)
+}
+
+func promDuration(d time.Duration) string {
+	return fmt.Sprintf("%ds", int64(d/time.Second))
+}
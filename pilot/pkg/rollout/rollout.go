@@ -0,0 +1,194 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rollout implements canary rollouts of virtual services: the weights of the destinations of an HTTP
+// route are shifted from a stable subset to a canary subset step by step, as long as the metrics of the canary
+// stay within their thresholds, and shifted back to the stable subset otherwise.
+//
+// The spec of a rollout is an annotation of its virtual service, validated at admission. The controller writes
+// the weights of the route to the virtual service itself, so it needs a writable config store: it does not run
+// with MCP config sources or config files. The statuses of the rollouts are kept in a StatusStore rather than in
+// the virtual services, so tools re-applying the virtual services from their source, such as GitOps pipelines,
+// do not restart the rollouts: the controller writes the weights of the current step again.
+package rollout
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	// Annotation is the annotation of a virtual service holding the spec of its rollout, as a JSON Spec.
+	// The rollout restarts when its spec changes.
+	Annotation = "networking.istio.io/rollout"
+
+	defaultInterval          = time.Minute
+	defaultWindow            = time.Minute
+	defaultLatencyPercentile = 0.99
+)
+
+// Spec is the spec of the rollout of a virtual service, e.g.
+// {"route": "reviews", "destinationRule": "reviews", "stableSubset": "v1", "canarySubset": "v2",
+// "steps": [10, 50, 100], "interval": "5m", "analysis": {"maxErrorRate": 0.01, "maxLatency": "500ms"}}.
+type Spec struct {
+	// Route is the name of the HTTP route of the virtual service rolled out, the first one if empty.
+	Route string `json:"route,omitempty"`
+	// DestinationRule is the name of the destination rule defining the subsets, in the namespace of the
+	// virtual service.
+	DestinationRule string `json:"destinationRule"`
+	// StableSubset is the subset the traffic is shifted from.
+	StableSubset string `json:"stableSubset"`
+	// CanarySubset is the subset the traffic is shifted to.
+	CanarySubset string `json:"canarySubset"`
+	// Steps are the successive percentages of the traffic of the route sent to the canary subset.
+	Steps []int32 `json:"steps"`
+	// Interval is the time spent at each step before analyzing the canary, 1m by default.
+	Interval string `json:"interval,omitempty"`
+	// Analysis are the thresholds of the metrics of the canary.
+	Analysis Analysis `json:"analysis,omitempty"`
+}
+
+// Analysis are the thresholds of the metrics of the canary of a rollout, measured over a window ending at the
+// end of each step. The rollout is rolled back when a threshold is exceeded.
+type Analysis struct {
+	// MaxErrorRate is the maximum fraction of the requests to the canary failing with a 5xx status code.
+	MaxErrorRate *float64 `json:"maxErrorRate,omitempty"`
+	// MaxLatency is the maximum latency of the requests to the canary at the latency percentile.
+	MaxLatency string `json:"maxLatency,omitempty"`
+	// LatencyPercentile is the percentile of the latency compared to MaxLatency, 0.99 by default.
+	LatencyPercentile float64 `json:"latencyPercentile,omitempty"`
+	// Window is the duration the metrics are measured over, 1m by default.
+	Window string `json:"window,omitempty"`
+}
+
+// Phase is the phase of a rollout.
+type Phase string
+
+const (
+	// Progressing rollouts shift the traffic to the canary step by step.
+	Progressing Phase = "Progressing"
+	// Succeeded rollouts sent the traffic of their last step to the canary with metrics within the thresholds.
+	Succeeded Phase = "Succeeded"
+	// RolledBack rollouts sent the traffic back to the stable subset as the canary exceeded a threshold.
+	RolledBack Phase = "RolledBack"
+	// Failed rollouts have an invalid spec, or reference a route or subsets that do not exist.
+	Failed Phase = "Failed"
+)
+
+// Status is the status of the rollout of a virtual service.
+type Status struct {
+	Phase Phase `json:"phase"`
+	// Step is the index of the current step of the rollout.
+	Step int `json:"step"`
+	// CanaryWeight is the percentage of the traffic of the route sent to the canary.
+	CanaryWeight int32 `json:"canaryWeight"`
+	// LastTransitionTime is the time the rollout entered its current step or phase.
+	LastTransitionTime time.Time `json:"lastTransitionTime"`
+	Message            string    `json:"message,omitempty"`
+	// ObservedSpec is the hash of the spec the status is about.
+	ObservedSpec string `json:"observedSpec"`
+}
+
+// rolloutSettings are the parsed durations of a spec.
+type rolloutSettings struct {
+	interval          time.Duration
+	window            time.Duration
+	maxLatency        time.Duration
+	latencyPercentile float64
+}
+
+// ParseSpec parses and validates the spec of a rollout annotation.
+func ParseSpec(value string) (*Spec, error) {
+	spec := &Spec{}
+	if err := json.Unmarshal([]byte(value), spec); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %v", Annotation, err)
+	}
+	if _, err := spec.settings(); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %v", Annotation, err)
+	}
+	return spec, nil
+}
+
+func (s *Spec) settings() (*rolloutSettings, error) {
+	if s.DestinationRule == "" {
+		return nil, fmt.Errorf("no destination rule")
+	}
+	if s.StableSubset == "" || s.CanarySubset == "" || s.StableSubset == s.CanarySubset {
+		return nil, fmt.Errorf("the stable and canary subsets must be set and differ")
+	}
+	if len(s.Steps) == 0 {
+		return nil, fmt.Errorf("no steps")
+	}
+	for i, w := range s.Steps {
+		if w < 0 || w > 100 || (i > 0 && w < s.Steps[i-1]) {
+			return nil, fmt.Errorf("steps must be increasing percentages, got %v", s.Steps)
+		}
+	}
+
+	out := &rolloutSettings{
+		interval:          defaultInterval,
+		window:            defaultWindow,
+		latencyPercentile: defaultLatencyPercentile,
+	}
+	var err error
+	if s.Interval != "" {
+		if out.interval, err = parsePositiveDuration(s.Interval); err != nil {
+			return nil, fmt.Errorf("invalid interval: %v", err)
+		}
+	}
+	if s.Analysis.Window != "" {
+		if out.window, err = parsePositiveDuration(s.Analysis.Window); err != nil {
+			return nil, fmt.Errorf("invalid analysis window: %v", err)
+		}
+	}
+	if s.Analysis.MaxLatency != "" {
+		if out.maxLatency, err = parsePositiveDuration(s.Analysis.MaxLatency); err != nil {
+			return nil, fmt.Errorf("invalid max latency: %v", err)
+		}
+	}
+	if p := s.Analysis.LatencyPercentile; p != 0 {
+		if p <= 0 || p >= 1 {
+			return nil, fmt.Errorf("latency percentile %v is not between 0 and 1", p)
+		}
+		out.latencyPercentile = p
+	}
+	if r := s.Analysis.MaxErrorRate; r != nil && (*r < 0 || *r > 1) {
+		return nil, fmt.Errorf("max error rate %v is not between 0 and 1", *r)
+	}
+	return out, nil
+}
+
+func parsePositiveDuration(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%v is not positive", d)
+	}
+	return d, nil
+}
+
+// specHash returns the hash of the value of a rollout annotation, recorded in the status.
+func specHash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:8])
+}
+
+func (s *Status) terminal() bool {
+	return s.Phase == Succeeded || s.Phase == RolledBack || s.Phase == Failed
+}
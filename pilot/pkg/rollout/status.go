@@ -0,0 +1,143 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollout
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// StatusConfigMapName is the name of the config map the statuses of the rollouts are written to.
+const StatusConfigMapName = "istio-rollout-status"
+
+// StatusStore holds the statuses of the rollouts, keyed by the namespace and the name of their virtual service
+// (see statusKey).
+type StatusStore interface {
+	// Load returns the statuses of the rollouts.
+	Load() (map[string]Status, error)
+	// Store replaces the statuses of the rollouts.
+	Store(statuses map[string]Status) error
+}
+
+// statusKey returns the key of the status of the rollout of a virtual service. The namespaces do not contain
+// dots, so the keys are unique, and they are valid config map keys.
+func statusKey(namespace, name string) string {
+	return namespace + "." + name
+}
+
+// MemoryStatusStore holds the statuses of the rollouts in memory.
+type MemoryStatusStore struct {
+	mutex    sync.Mutex
+	statuses map[string]Status
+}
+
+// NewMemoryStatusStore returns an empty in-memory status store.
+func NewMemoryStatusStore() *MemoryStatusStore {
+	return &MemoryStatusStore{statuses: map[string]Status{}}
+}
+
+// Load implements StatusStore.
+func (m *MemoryStatusStore) Load() (map[string]Status, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	out := make(map[string]Status, len(m.statuses))
+	for k, v := range m.statuses {
+		out[k] = v
+	}
+	return out, nil
+}
+
+// Store implements StatusStore.
+func (m *MemoryStatusStore) Store(statuses map[string]Status) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.statuses = make(map[string]Status, len(statuses))
+	for k, v := range statuses {
+		m.statuses[k] = v
+	}
+	return nil
+}
+
+// configMapStatusStore holds the statuses of the rollouts in a config map, as JSON Status values.
+type configMapStatusStore struct {
+	client    kubernetes.Interface
+	namespace string
+}
+
+// NewConfigMapStatusStore returns a status store writing to the StatusConfigMapName config map of the namespace,
+// created when missing.
+func NewConfigMapStatusStore(client kubernetes.Interface, namespace string) StatusStore {
+	return &configMapStatusStore{client: client, namespace: namespace}
+}
+
+// Load implements StatusStore.
+func (s *configMapStatusStore) Load() (map[string]Status, error) {
+	statuses := map[string]Status{}
+	cm, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(StatusConfigMapName, metaV1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return statuses, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range cm.Data {
+		status := Status{}
+		// The rollouts of the statuses which are not readable restart.
+		if err := json.Unmarshal([]byte(v), &status); err == nil {
+			statuses[k] = status
+		}
+	}
+	return statuses, nil
+}
+
+// Store implements StatusStore.
+func (s *configMapStatusStore) Store(statuses map[string]Status) error {
+	data := make(map[string]string, len(statuses))
+	for k, v := range statuses {
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		data[k] = string(encoded)
+	}
+
+	configMaps := s.client.CoreV1().ConfigMaps(s.namespace)
+	cm, err := configMaps.Get(StatusConfigMapName, metaV1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = configMaps.Create(&v1.ConfigMap{
+			ObjectMeta: metaV1.ObjectMeta{Namespace: s.namespace, Name: StatusConfigMapName},
+			Data:       data,
+		})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if (len(cm.Data) == 0 && len(data) == 0) || reflect.DeepEqual(cm.Data, data) {
+		return nil
+	}
+	cm.Data = data
+	if _, err := configMaps.Update(cm); err != nil {
+		return fmt.Errorf("failed to update config map %s/%s: %v", s.namespace, StatusConfigMapName, err)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2019 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollout
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestConfigMapStatusStore(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	store := NewConfigMapStatusStore(client, "istio-system")
+
+	statuses, err := store.Load()
+	if err != nil || len(statuses) != 0 {
+		t.Fatalf("got statuses %v, error %v before the config map is created", statuses, err)
+	}
+
+	want := map[string]Status{
+		statusKey("default", "reviews"): {
+			Phase:              Progressing,
+			Step:               1,
+			CanaryWeight:       50,
+			LastTransitionTime: time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC),
+			ObservedSpec:       specHash(testSpec),
+		},
+	}
+	for i := 0; i < 2; i++ {
+		// The config map is created, then updated.
+		if err := store.Store(want); err != nil {
+			t.Fatal(err)
+		}
+		got, err := store.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("got statuses %v, want %v", got, want)
+		}
+		want = map[string]Status{}
+	}
+
+	cm, err := client.CoreV1().ConfigMaps("istio-system").Get(StatusConfigMapName, metaV1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cm.Data) != 0 {
+		t.Fatalf("got config map data %v, want none", cm.Data)
+	}
+}
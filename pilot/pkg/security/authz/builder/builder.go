@@ -16,6 +16,7 @@ package builder
 
 import (
 	tcp_filter "github.com/envoyproxy/go-control-plane/envoy/api/v2/listener"
+	http_config "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/rbac/v2"
 	http_filter "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
 	tcp_config "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/rbac/v2"
 
@@ -77,6 +78,16 @@ func NewBuilder(serviceInstance *model.ServiceInstance, workloadLabels labels.Co
 	}
 }
 
+// Generate returns the RBAC config used in the HTTP filter, or in the TCP filter if forTCPFilter is true.
+// It allows tools to inspect and evaluate the generated policies without a running proxy.
+func (b *Builder) Generate(forTCPFilter bool) *http_config.RBAC {
+	if b == nil {
+		return nil
+	}
+
+	return b.generator.Generate(forTCPFilter)
+}
+
 // BuildHTTPFilter builds the RBAC HTTP filter.
 func (b *Builder) BuildHTTPFilter() *http_filter.HttpFilter {
 	if b == nil {
@@ -36,7 +36,8 @@ func convertPort(port *networking.Port) *model.Port {
 	}
 }
 
-func convertServices(cfg model.Config) []*model.Service {
+// ConvertServices returns the services of the hosts of a ServiceEntry config.
+func ConvertServices(cfg model.Config) []*model.Service {
 	serviceEntry := cfg.Spec.(*networking.ServiceEntry)
 	creationTime := cfg.CreationTimestamp
 
@@ -163,7 +164,7 @@ func convertEndpoint(service *model.Service, servicePort *networking.Port,
 func convertInstances(cfg model.Config) []*model.ServiceInstance {
 	out := make([]*model.ServiceInstance, 0)
 	serviceEntry := cfg.Spec.(*networking.ServiceEntry)
-	for _, service := range convertServices(cfg) {
+	for _, service := range ConvertServices(cfg) {
 		for _, serviceEntryPort := range serviceEntry.Ports {
 			if len(serviceEntry.Endpoints) == 0 &&
 				serviceEntry.Resolution == networking.ServiceEntry_DNS {
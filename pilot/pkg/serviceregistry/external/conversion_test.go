@@ -324,7 +324,7 @@ func makeInstance(cfg *model.Config, address string, port int,
 		family = model.AddressFamilyUnix
 	}
 
-	services := convertServices(*cfg)
+	services := ConvertServices(*cfg)
 	svc := services[0] // default
 	for _, s := range services {
 		if string(s.Hostname) == address {
@@ -436,7 +436,7 @@ func TestConvertService(t *testing.T) {
 	}
 
 	for _, tt := range serviceTests {
-		services := convertServices(*tt.externalSvc)
+		services := ConvertServices(*tt.externalSvc)
 		if err := compare(t, services, tt.services); err != nil {
 			t.Error(err)
 		}
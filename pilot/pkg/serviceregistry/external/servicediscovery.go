@@ -66,7 +66,7 @@ func NewServiceDiscovery(callbacks model.ConfigStoreCache, store model.IstioConf
 			c.updateNeeded = true
 			c.changeMutex.Unlock()
 
-			services := convertServices(config)
+			services := ConvertServices(config)
 			for _, handler := range c.serviceHandlers {
 				for _, service := range services {
 					go handler(service, event)
@@ -104,7 +104,7 @@ func (d *ServiceEntryStore) Run(stop <-chan struct{}) {}
 func (d *ServiceEntryStore) Services() ([]*model.Service, error) {
 	services := make([]*model.Service, 0)
 	for _, cfg := range d.store.ServiceEntries() {
-		services = append(services, convertServices(cfg)...)
+		services = append(services, ConvertServices(cfg)...)
 	}
 
 	return services, nil
@@ -126,7 +126,7 @@ func (d *ServiceEntryStore) GetService(hostname host.Name) (*model.Service, erro
 func (d *ServiceEntryStore) getServices() []*model.Service {
 	services := make([]*model.Service, 0)
 	for _, cfg := range d.store.ServiceEntries() {
-		services = append(services, convertServices(cfg)...)
+		services = append(services, ConvertServices(cfg)...)
 	}
 	return services
 }
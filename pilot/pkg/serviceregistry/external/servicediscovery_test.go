@@ -146,7 +146,7 @@ func TestServiceDiscoveryInstances(t *testing.T) {
 		makeInstance(httpDNS, "de.google.com", 8080, httpDNS.Spec.(*networking.ServiceEntry).Ports[1], map[string]string{"foo": "bar"}),
 	}
 
-	svc := convertServices(*httpDNS)
+	svc := ConvertServices(*httpDNS)
 	instances, err := sd.InstancesByPort(svc[0], 0, nil)
 	if err != nil {
 		t.Errorf("Instances() encountered unexpected error: %v", err)
@@ -171,7 +171,7 @@ func TestServiceDiscoveryInstances1Port(t *testing.T) {
 		makeInstance(httpDNS, "de.google.com", 80, httpDNS.Spec.(*networking.ServiceEntry).Ports[0], map[string]string{"foo": "bar"}),
 	}
 
-	svc := convertServices(*httpDNS)
+	svc := ConvertServices(*httpDNS)
 	instances, err := sd.InstancesByPort(svc[0], 80, nil)
 	if err != nil {
 		t.Errorf("Instances() encountered unexpected error: %v", err)
@@ -212,7 +212,7 @@ func TestNonServiceConfig(t *testing.T) {
 		makeInstance(httpDNS, "uk.google.com", 1080, httpDNS.Spec.(*networking.ServiceEntry).Ports[0], nil),
 		makeInstance(httpDNS, "de.google.com", 80, httpDNS.Spec.(*networking.ServiceEntry).Ports[0], map[string]string{"foo": "bar"}),
 	}
-	svc := convertServices(*httpDNS)
+	svc := ConvertServices(*httpDNS)
 	instances, err := sd.InstancesByPort(svc[0], 80, nil)
 	if err != nil {
 		t.Errorf("Instances() encountered unexpected error: %v", err)
@@ -39,6 +39,7 @@ import (
 
 	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/core/v1alpha3/loadbalancer"
 	"istio.io/istio/pilot/pkg/networking/util"
 	"istio.io/istio/pilot/pkg/serviceregistry/kube"
 	"istio.io/istio/pkg/config/host"
@@ -894,54 +895,86 @@ func (c *Controller) AppendInstanceHandler(f func(*model.ServiceInstance, model.
 	return nil
 }
 
+// appendEndpoints appends the endpoints of the addresses of a subset of the Endpoints.
+func (c *Controller) appendEndpoints(endpoints []*model.IstioEndpoint, ep *v1.Endpoints, ports []v1.EndpointPort,
+	addresses []v1.EndpointAddress, unhealthy, mixerEnabled bool) []*model.IstioEndpoint {
+	hostname := kube.ServiceHostname(ep.Name, ep.Namespace, c.domainSuffix)
+	for _, ea := range addresses {
+		pod := c.pods.getPodByIP(ea.IP)
+		if pod == nil {
+			// Pods which are starting may not be in the cache yet.
+			if unhealthy {
+				continue
+			}
+			// This can not happen in usual case
+			if ea.TargetRef != nil && ea.TargetRef.Kind == "Pod" {
+				log.Warnf("Endpoint without pod %s %s.%s", ea.IP, ep.Name, ep.Namespace)
+				if c.Env != nil {
+					c.Env.PushContext.Add(model.EndpointNoPod, string(hostname), nil, ea.IP)
+				}
+				// TODO: keep them in a list, and check when pod events happen !
+				continue
+			}
+			// For service without selector, maybe there are no related pods
+		}
+
+		var labels map[string]string
+		locality, sa, uid := "", "", ""
+		if pod != nil {
+			locality = c.GetPodLocality(pod)
+			sa = kube.SecureNamingSAN(pod)
+			if mixerEnabled {
+				uid = fmt.Sprintf("kubernetes://%s.%s", pod.Name, pod.Namespace)
+			}
+			labels = map[string]string(configKube.ConvertLabels(pod.ObjectMeta))
+		}
+
+		// EDS and ServiceEntry use name for service port - ADS will need to
+		// map to numbers.
+		for _, port := range ports {
+			endpoints = append(endpoints, &model.IstioEndpoint{
+				Address:         ea.IP,
+				EndpointPort:    uint32(port.Port),
+				ServicePortName: port.Name,
+				Labels:          labels,
+				UID:             uid,
+				ServiceAccount:  sa,
+				Network:         c.endpointNetwork(ea.IP),
+				Locality:        locality,
+				Attributes:      model.ServiceAttributes{Name: ep.Name, Namespace: ep.Namespace},
+				Unhealthy:       unhealthy,
+			})
+		}
+	}
+	return endpoints
+}
+
+// notReadyEndpointsEnabled returns whether the endpoints of the service which are not ready are tracked, as its
+// exported destination rule weights its localities by the health of their endpoints. The destination rule is
+// looked up in the current push context, so enabling the annotation applies from the next update of the Endpoints.
+func (c *Controller) notReadyEndpointsEnabled(hostname host.Name, namespace string) bool {
+	if c.Env == nil || c.Env.PushContext == nil {
+		return false
+	}
+	destRule := c.Env.PushContext.DestinationRule(nil, &model.Service{
+		Hostname:   hostname,
+		Attributes: model.ServiceAttributes{Namespace: namespace},
+	})
+	return loadbalancer.HealthWeightsEnabled(destRule)
+}
+
 func (c *Controller) updateEDS(ep *v1.Endpoints, event model.Event) {
 	hostname := kube.ServiceHostname(ep.Name, ep.Namespace, c.domainSuffix)
 	mixerEnabled := c.Env != nil && c.Env.Mesh != nil && (c.Env.Mesh.MixerCheckServer != "" || c.Env.Mesh.MixerReportServer != "")
 
 	endpoints := make([]*model.IstioEndpoint, 0)
 	if event != model.EventDelete {
+		notReady := c.notReadyEndpointsEnabled(hostname, ep.Namespace)
 		for _, ss := range ep.Subsets {
-			for _, ea := range ss.Addresses {
-				pod := c.pods.getPodByIP(ea.IP)
-				if pod == nil {
-					// This can not happen in usual case
-					if ea.TargetRef != nil && ea.TargetRef.Kind == "Pod" {
-						log.Warnf("Endpoint without pod %s %s.%s", ea.IP, ep.Name, ep.Namespace)
-						if c.Env != nil {
-							c.Env.PushContext.Add(model.EndpointNoPod, string(hostname), nil, ea.IP)
-						}
-						// TODO: keep them in a list, and check when pod events happen !
-						continue
-					}
-					// For service without selector, maybe there are no related pods
-				}
-
-				var labels map[string]string
-				locality, sa, uid := "", "", ""
-				if pod != nil {
-					locality = c.GetPodLocality(pod)
-					sa = kube.SecureNamingSAN(pod)
-					if mixerEnabled {
-						uid = fmt.Sprintf("kubernetes://%s.%s", pod.Name, pod.Namespace)
-					}
-					labels = map[string]string(configKube.ConvertLabels(pod.ObjectMeta))
-				}
-
-				// EDS and ServiceEntry use name for service port - ADS will need to
-				// map to numbers.
-				for _, port := range ss.Ports {
-					endpoints = append(endpoints, &model.IstioEndpoint{
-						Address:         ea.IP,
-						EndpointPort:    uint32(port.Port),
-						ServicePortName: port.Name,
-						Labels:          labels,
-						UID:             uid,
-						ServiceAccount:  sa,
-						Network:         c.endpointNetwork(ea.IP),
-						Locality:        locality,
-						Attributes:      model.ServiceAttributes{Name: ep.Name, Namespace: ep.Namespace},
-					})
-				}
+			endpoints = c.appendEndpoints(endpoints, ep, ss.Ports, ss.Addresses, false, mixerEnabled)
+			if notReady {
+				// Endpoints which are not ready count in the health of their locality.
+				endpoints = c.appendEndpoints(endpoints, ep, ss.Ports, ss.NotReadyAddresses, true, mixerEnabled)
 			}
 		}
 	}
@@ -32,13 +32,16 @@ import (
 
 	"istio.io/api/annotation"
 	meshconfig "istio.io/api/mesh/v1alpha1"
+	networking "istio.io/api/networking/v1alpha3"
 	"istio.io/pkg/log"
 
 	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/core/v1alpha3/loadbalancer"
 	"istio.io/istio/pilot/pkg/serviceregistry"
 	"istio.io/istio/pilot/pkg/serviceregistry/kube"
 	"istio.io/istio/pkg/config/labels"
 	"istio.io/istio/pkg/config/protocol"
+	"istio.io/istio/pkg/config/schemas"
 	"istio.io/istio/pkg/spiffe"
 	"istio.io/istio/pkg/test"
 	"istio.io/istio/pkg/test/env"
@@ -95,6 +98,9 @@ type XdsEvent struct {
 
 	// The id of the event
 	ID string
+
+	// Endpoints of eds events
+	Endpoints []*model.IstioEndpoint
 }
 
 // NewFakeXDS creates a XdsUpdater reporting events via a channel.
@@ -106,7 +112,7 @@ func NewFakeXDS() *FakeXdsUpdater {
 
 func (fx *FakeXdsUpdater) EDSUpdate(shard, hostname string, namespace string, entry []*model.IstioEndpoint) error {
 	select {
-	case fx.Events <- XdsEvent{Type: "eds", ID: hostname}:
+	case fx.Events <- XdsEvent{Type: "eds", ID: hostname, Endpoints: entry}:
 	default:
 	}
 	return nil
@@ -1460,3 +1466,70 @@ func TestEndpointUpdate(t *testing.T) {
 		t.Errorf("Timeout xds push")
 	}
 }
+
+func TestUpdateEDSNotReadyAddresses(t *testing.T) {
+	controller, fx := newFakeController(t)
+	defer controller.Stop()
+
+	endpoints := &coreV1.Endpoints{
+		ObjectMeta: metaV1.ObjectMeta{Name: "svc1", Namespace: "nsa"},
+		Subsets: []coreV1.EndpointSubset{{
+			Addresses: []coreV1.EndpointAddress{{IP: "128.0.0.1"}},
+			NotReadyAddresses: []coreV1.EndpointAddress{
+				{IP: "128.0.0.2"},
+				// A starting pod which is not in the cache yet.
+				{IP: "128.0.0.3", TargetRef: &coreV1.ObjectReference{Kind: "Pod", Name: "starting", Namespace: "nsa"}},
+			},
+			Ports: []coreV1.EndpointPort{{Name: "http", Port: 8080}},
+		}},
+	}
+
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		want        map[string]bool
+	}{
+		{
+			name: "not opted in",
+			want: map[string]bool{"128.0.0.1": false},
+		},
+		{
+			name:        "opted in",
+			annotations: map[string]string{loadbalancer.HealthWeightsAnnotation: "true"},
+			want:        map[string]bool{"128.0.0.1": false, "128.0.0.2": true},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			push := model.NewPushContext()
+			push.SetDestinationRules([]model.Config{{
+				ConfigMeta: model.ConfigMeta{
+					Type:        schemas.DestinationRule.Type,
+					Name:        "svc1",
+					Namespace:   "nsa",
+					Annotations: tc.annotations,
+				},
+				Spec: &networking.DestinationRule{
+					Host:     "svc1.nsa.svc.company.com",
+					ExportTo: []string{"*"},
+				},
+			}})
+			controller.Env.PushContext = push
+			fx.Clear()
+
+			controller.updateEDS(endpoints, model.EventUpdate)
+			ev := fx.Wait("eds")
+			if ev == nil {
+				t.Fatal("Timeout incremental eds")
+			}
+			got := map[string]bool{}
+			for _, ep := range ev.Endpoints {
+				got[ep.Address] = ep.Unhealthy
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got endpoints %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -26,4 +26,6 @@ const (
 	ConsulRegistry ServiceRegistry = "Consul"
 	// MCPRegistry is a service registry backed by MCP ServiceEntries
 	MCPRegistry ServiceRegistry = "MCP"
+	// ServiceEntryRegistry is the service registry of the ServiceEntry configs
+	ServiceEntryRegistry ServiceRegistry = "ServiceEntries"
 )
@@ -95,6 +95,9 @@ type ADSC struct {
 	// All received endpoints, keyed by cluster name
 	eds map[string]*xdsapi.ClusterLoadAssignment
 
+	// The received name table, the addresses of the service hostnames, keyed by hostname
+	nameTable map[string][]string
+
 	// Metadata has the node metadata to send to pilot.
 	// If nil, the defaults will be used.
 	Metadata *pstruct.Struct
@@ -119,6 +122,8 @@ const (
 	listenerType = typePrefix + "Listener"
 	// RouteType is sent after listeners.
 	routeType = typePrefix + "RouteConfiguration"
+	// nameTableType is used for the name table discovery of the DNS proxy of the agent.
+	nameTableType = "type.googleapis.com/istio.networking.nds.NameTable"
 )
 
 var (
@@ -259,6 +264,7 @@ func (a *ADSC) handleRecv() {
 		clusters := []*xdsapi.Cluster{}
 		routes := []*xdsapi.RouteConfiguration{}
 		eds := []*xdsapi.ClusterLoadAssignment{}
+		var nameTable *pstruct.Struct
 		for _, rsc := range msg.Resources { // Any
 			a.VersionInfo[rsc.TypeUrl] = msg.VersionInfo
 			valBytes := rsc.Value
@@ -278,6 +284,9 @@ func (a *ADSC) handleRecv() {
 				ll := &xdsapi.RouteConfiguration{}
 				_ = proto.Unmarshal(valBytes, ll)
 				routes = append(routes, ll)
+			} else if msg.TypeUrl == nameTableType {
+				nameTable = &pstruct.Struct{}
+				_ = proto.Unmarshal(valBytes, nameTable)
 			}
 		}
 
@@ -298,6 +307,9 @@ func (a *ADSC) handleRecv() {
 		if len(routes) > 0 {
 			a.handleRDS(routes)
 		}
+		if nameTable != nil {
+			a.handleNDS(nameTable)
+		}
 	}
 
 }
@@ -588,6 +600,25 @@ func (a *ADSC) handleRDS(configurations []*xdsapi.RouteConfiguration) {
 
 }
 
+func (a *ADSC) handleNDS(nameTable *pstruct.Struct) {
+	nt := make(map[string][]string, len(nameTable.Fields))
+	for hostname, v := range nameTable.Fields {
+		for _, address := range v.GetListValue().GetValues() {
+			nt[hostname] = append(nt[hostname], address.GetStringValue())
+		}
+	}
+	adscLog.Infof("NDS: hosts=%d", len(nt))
+
+	a.mutex.Lock()
+	a.nameTable = nt
+	a.mutex.Unlock()
+
+	select {
+	case a.Updates <- "nds":
+	default:
+	}
+}
+
 // WaitClear will clear the waiting events, so next call to Wait will get
 // the next push type.
 func (a *ADSC) WaitClear() {
@@ -640,6 +671,15 @@ func (a *ADSC) Watch() {
 	})
 }
 
+// WatchNameTable will start watching the name table, the addresses of the service hostnames.
+func (a *ADSC) WatchNameTable() {
+	_ = a.stream.Send(&xdsapi.DiscoveryRequest{
+		ResponseNonce: time.Now().String(),
+		Node:          a.node(),
+		TypeUrl:       nameTableType,
+	})
+}
+
 func (a *ADSC) sendRsc(typeurl string, rsc []string) {
 	_ = a.stream.Send(&xdsapi.DiscoveryRequest{
 		ResponseNonce: "",
@@ -699,3 +739,10 @@ func (a *ADSC) GetEndpoints() map[string]*xdsapi.ClusterLoadAssignment {
 	defer a.mutex.Unlock()
 	return a.eds
 }
+
+// GetNameTable returns the addresses of the service hostnames, keyed by hostname.
+func (a *ADSC) GetNameTable() map[string][]string {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.nameTable
+}
@@ -55,6 +55,14 @@ func TestParse(t *testing.T) {
 		{"mysql", protocol.MySQL},
 		{"MYSQL", protocol.MySQL},
 		{"MySQL", protocol.MySQL},
+		{"thrift", protocol.Thrift},
+		{"Thrift", protocol.Thrift},
+		{"dubbo", protocol.Dubbo},
+		{"DUBBO", protocol.Dubbo},
+		{"kafka", protocol.Kafka},
+		{"Kafka", protocol.Kafka},
+		{"postgres", protocol.Postgres},
+		{"POSTGRES", protocol.Postgres},
 		{"", protocol.Unsupported},
 		{"SMTP", protocol.Unsupported},
 	}
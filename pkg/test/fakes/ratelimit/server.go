@@ -0,0 +1,205 @@
+//  Copyright 2019 Istio Authors
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package ratelimit is a reference implementation of the Envoy gRPC rate limit service, used to test
+// the global rate limiting configured by pilot. It keeps fixed-window counters in memory.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	ratelimit "github.com/envoyproxy/go-control-plane/envoy/api/v2/ratelimit"
+	rls "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v2"
+	"google.golang.org/grpc"
+
+	"istio.io/pkg/log"
+)
+
+const (
+	// DefaultPort for the rate limit service.
+	DefaultPort = 8081
+)
+
+var scope = log.RegisterScope("fakes", "Scope for all fakes", 0)
+
+// Limit is the number of requests allowed per unit of time for a descriptor.
+type Limit struct {
+	RequestsPerUnit uint32
+	Unit            rls.RateLimitResponse_RateLimit_Unit
+}
+
+type window struct {
+	start time.Time
+	hits  uint32
+}
+
+// Server is an in-memory rate limit service. It can be ran either in a cluster or locally.
+type Server struct {
+	port   int
+	domain string
+
+	listener net.Listener
+	server   *grpc.Server
+
+	// now is replaced in tests.
+	now func() time.Time
+
+	lock    sync.Mutex
+	limits  map[string]Limit
+	windows map[string]*window
+}
+
+var _ rls.RateLimitServiceServer = &Server{}
+
+// NewServer returns a new rate limit service for the domain, listening on the port once started.
+func NewServer(port int, domain string) *Server {
+	return &Server{
+		port:    port,
+		domain:  domain,
+		now:     time.Now,
+		limits:  make(map[string]Limit),
+		windows: make(map[string]*window),
+	}
+}
+
+// DescriptorKey returns the key of the descriptor used by SetLimit, in the form "key1=value1,key2=value2".
+func DescriptorKey(d *ratelimit.RateLimitDescriptor) string {
+	entries := make([]string, 0, len(d.Entries))
+	for _, e := range d.Entries {
+		entries = append(entries, e.Key+"="+e.Value)
+	}
+	return strings.Join(entries, ",")
+}
+
+// SetLimit sets the limit of the descriptor with the key, and resets its counter.
+// Descriptors without a limit are never over limit.
+func (s *Server) SetLimit(descriptor string, limit Limit) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.limits[descriptor] = limit
+	delete(s.windows, descriptor)
+}
+
+// Reset removes all the limits and counters.
+func (s *Server) Reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.limits = make(map[string]Limit)
+	s.windows = make(map[string]*window)
+}
+
+// Port returns the port number of the service.
+func (s *Server) Port() int {
+	return s.port
+}
+
+// Start the gRPC rate limit service.
+func (s *Server) Start() error {
+	scope.Info("Starting Rate Limit Service")
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
+	if err != nil {
+		return err
+	}
+	s.port = listener.Addr().(*net.TCPAddr).Port
+
+	grpcServer := grpc.NewServer()
+	rls.RegisterRateLimitServiceServer(grpcServer, s)
+
+	go func() {
+		scope.Infof("Starting the GRPC service at port: %d", s.port)
+		_ = grpcServer.Serve(listener)
+	}()
+
+	s.listener = listener
+	s.server = grpcServer
+	return nil
+}
+
+// Close closes the gRPC service and the associated listener.
+func (s *Server) Close() error {
+	scope.Info("RateLimitService.Close")
+	s.server.Stop()
+	_ = s.listener.Close()
+	return nil
+}
+
+// ShouldRateLimit is an implementation of RateLimitServiceServer.ShouldRateLimit. The request is over limit
+// if any of its descriptors is.
+func (s *Server) ShouldRateLimit(ctx context.Context, req *rls.RateLimitRequest) (*rls.RateLimitResponse, error) {
+	scope.Debugf("RateLimitService.ShouldRateLimit %v", req)
+	if req.Domain != s.domain {
+		return nil, fmt.Errorf("unknown domain %q", req.Domain)
+	}
+	hits := req.HitsAddend
+	if hits == 0 {
+		hits = 1
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	resp := &rls.RateLimitResponse{OverallCode: rls.RateLimitResponse_OK}
+	now := s.now()
+	for _, d := range req.Descriptors {
+		key := DescriptorKey(d)
+		limit, ok := s.limits[key]
+		if !ok {
+			resp.Statuses = append(resp.Statuses, &rls.RateLimitResponse_DescriptorStatus{Code: rls.RateLimitResponse_OK})
+			continue
+		}
+
+		start := now.Truncate(unitDuration(limit.Unit))
+		w, ok := s.windows[key]
+		if !ok || !w.start.Equal(start) {
+			w = &window{start: start}
+			s.windows[key] = w
+		}
+		w.hits += hits
+
+		status := &rls.RateLimitResponse_DescriptorStatus{
+			Code: rls.RateLimitResponse_OK,
+			CurrentLimit: &rls.RateLimitResponse_RateLimit{
+				RequestsPerUnit: limit.RequestsPerUnit,
+				Unit:            limit.Unit,
+			},
+		}
+		if w.hits > limit.RequestsPerUnit {
+			status.Code = rls.RateLimitResponse_OVER_LIMIT
+			resp.OverallCode = rls.RateLimitResponse_OVER_LIMIT
+		} else {
+			status.LimitRemaining = limit.RequestsPerUnit - w.hits
+		}
+		resp.Statuses = append(resp.Statuses, status)
+	}
+	return resp, nil
+}
+
+func unitDuration(unit rls.RateLimitResponse_RateLimit_Unit) time.Duration {
+	switch unit {
+	case rls.RateLimitResponse_RateLimit_SECOND:
+		return time.Second
+	case rls.RateLimitResponse_RateLimit_MINUTE:
+		return time.Minute
+	case rls.RateLimitResponse_RateLimit_HOUR:
+		return time.Hour
+	default:
+		return 24 * time.Hour
+	}
+}
@@ -0,0 +1,100 @@
+//  Copyright 2019 Istio Authors
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	ratelimit "github.com/envoyproxy/go-control-plane/envoy/api/v2/ratelimit"
+	rls "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v2"
+	"google.golang.org/grpc"
+)
+
+func descriptor(kv ...string) *ratelimit.RateLimitDescriptor {
+	d := &ratelimit.RateLimitDescriptor{}
+	for i := 0; i+1 < len(kv); i += 2 {
+		d.Entries = append(d.Entries, &ratelimit.RateLimitDescriptor_Entry{Key: kv[i], Value: kv[i+1]})
+	}
+	return d
+}
+
+func TestShouldRateLimit(t *testing.T) {
+	s := NewServer(0, "istio")
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = s.Close() }()
+
+	now := time.Date(2019, 10, 1, 10, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	reviews := descriptor("destination_cluster", "inbound|9080|http|reviews.default.svc.cluster.local")
+	user := descriptor("destination_cluster", "inbound|9080|http|reviews.default.svc.cluster.local", "x-user-id", "jason")
+	s.SetLimit(DescriptorKey(reviews), Limit{RequestsPerUnit: 2, Unit: rls.RateLimitResponse_RateLimit_SECOND})
+
+	conn, err := grpc.Dial(fmt.Sprintf("localhost:%d", s.Port()), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	client := rls.NewRateLimitServiceClient(conn)
+
+	check := func(want rls.RateLimitResponse_Code, descriptors ...*ratelimit.RateLimitDescriptor) {
+		t.Helper()
+		resp, err := client.ShouldRateLimit(context.Background(), &rls.RateLimitRequest{
+			Domain:      "istio",
+			Descriptors: descriptors,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.OverallCode != want {
+			t.Fatalf("got %v, want %v", resp.OverallCode, want)
+		}
+		if len(resp.Statuses) != len(descriptors) {
+			t.Fatalf("got %d statuses for %d descriptors", len(resp.Statuses), len(descriptors))
+		}
+	}
+
+	check(rls.RateLimitResponse_OK, reviews, user)
+	check(rls.RateLimitResponse_OK, reviews)
+	check(rls.RateLimitResponse_OVER_LIMIT, reviews, user)
+	// Descriptors without a limit are never over limit.
+	check(rls.RateLimitResponse_OK, user)
+
+	// The counters start over in the next second.
+	now = now.Add(time.Second)
+	check(rls.RateLimitResponse_OK, reviews)
+
+	s.Reset()
+	check(rls.RateLimitResponse_OK, reviews)
+	check(rls.RateLimitResponse_OK, reviews)
+	check(rls.RateLimitResponse_OK, reviews)
+
+	if _, err := client.ShouldRateLimit(context.Background(), &rls.RateLimitRequest{Domain: "other"}); err == nil {
+		t.Errorf("expected an error for an unknown domain")
+	}
+}
+
+func TestDescriptorKey(t *testing.T) {
+	got := DescriptorKey(descriptor("destination_cluster", "outbound|9080||reviews", "generic_key", "reviews.v2"))
+	want := "destination_cluster=outbound|9080||reviews,generic_key=reviews.v2"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -51,6 +51,7 @@ func constructConfig() *config.Config {
 		OutboundIPRangesInclude: viper.GetString(constants.ServiceCidr),
 		OutboundIPRangesExclude: viper.GetString(constants.ServiceExcludeCidr),
 		KubevirtInterfaces:      viper.GetString(constants.KubeVirtInterfaces),
+		DNSCapturePort:          viper.GetString(constants.DNSCapturePort),
 		DryRun:                  viper.GetBool(constants.DryRun),
 		EnableInboundIPv6s:      nil,
 		Clean:                   viper.GetBool(constants.Clean),
@@ -151,6 +152,14 @@ func init() {
 	}
 	viper.SetDefault(constants.KubeVirtInterfaces, "")
 
+	rootCmd.Flags().StringP(constants.DNSCapturePort, "s", "",
+		"Port to which all outbound DNS traffic (UDP and TCP port 53) should be redirected to (optional). "+
+			"An empty value will disable DNS redirection (default $DNS_CAPTURE_PORT)")
+	if err := viper.BindPFlag(constants.DNSCapturePort, rootCmd.Flags().Lookup(constants.DNSCapturePort)); err != nil {
+		handleError(err)
+	}
+	viper.SetDefault(constants.DNSCapturePort, "")
+
 	rootCmd.Flags().StringP(constants.InboundTProxyMark, "t", "", "")
 	if err := viper.BindPFlag(constants.InboundTProxyMark, rootCmd.Flags().Lookup(constants.InboundTProxyMark)); err != nil {
 		handleError(err)
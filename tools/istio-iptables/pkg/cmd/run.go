@@ -69,6 +69,8 @@ func removeOldChains(ext dep.Dependencies) {
 	ext.RunQuietlyAndIgnore(dep.IPTABLES, "-t", constants.NAT, "-D", constants.PREROUTING, "-p", constants.TCP, "-j", constants.ISTIOINBOUND)
 	ext.RunQuietlyAndIgnore(dep.IPTABLES, "-t", constants.MANGLE, "-D", constants.PREROUTING, "-p", constants.TCP, "-j", constants.ISTIOINBOUND)
 	ext.RunQuietlyAndIgnore(dep.IPTABLES, "-t", constants.NAT, "-D", constants.OUTPUT, "-p", constants.TCP, "-j", constants.ISTIOOUTPUT)
+	ext.RunQuietlyAndIgnore(dep.IPTABLES, "-t", constants.NAT, "-D", constants.OUTPUT, "-p", constants.UDP, "--dport", "53", "-j", constants.ISTIODNS)
+	ext.RunQuietlyAndIgnore(dep.IPTABLES, "-t", constants.NAT, "-D", constants.OUTPUT, "-p", constants.TCP, "--dport", "53", "-j", constants.ISTIODNS)
 	// Flush and delete the istio chains.
 	ext.RunQuietlyAndIgnore(dep.IPTABLES, "-t", constants.NAT, "-F", constants.ISTIOOUTPUT)
 	ext.RunQuietlyAndIgnore(dep.IPTABLES, "-t", constants.NAT, "-X", constants.ISTIOOUTPUT)
@@ -80,6 +82,8 @@ func removeOldChains(ext dep.Dependencies) {
 	ext.RunQuietlyAndIgnore(dep.IPTABLES, "-t", constants.MANGLE, "-X", constants.ISTIODIVERT)
 	ext.RunQuietlyAndIgnore(dep.IPTABLES, "-t", constants.MANGLE, "-F", constants.ISTIOTPROXY)
 	ext.RunQuietlyAndIgnore(dep.IPTABLES, "-t", constants.MANGLE, "-X", constants.ISTIOTPROXY)
+	ext.RunQuietlyAndIgnore(dep.IPTABLES, "-t", constants.NAT, "-F", constants.ISTIODNS)
+	ext.RunQuietlyAndIgnore(dep.IPTABLES, "-t", constants.NAT, "-X", constants.ISTIODNS)
 	// Must be last, the others refer to it
 	ext.RunQuietlyAndIgnore(dep.IPTABLES, "-t", constants.NAT, "-F", constants.ISTIOREDIRECT)
 	ext.RunQuietlyAndIgnore(dep.IPTABLES, "-t", constants.NAT, "-X", constants.ISTIOREDIRECT)
@@ -186,6 +190,30 @@ func handleInboundPortsInclude(ext dep.Dependencies, config *config.Config) {
 	}
 }
 
+// handleDNSRedirect redirects the DNS queries of the applications to the DNS proxy of the agent. It must be
+// applied before the outbound tcp traffic is redirected to Envoy.
+func handleDNSRedirect(ext dep.Dependencies, config *config.Config) {
+	if config.DNSCapturePort == "" {
+		return
+	}
+	ext.RunOrFail(dep.IPTABLES, "-t", constants.NAT, "-N", constants.ISTIODNS)
+	ext.RunOrFail(dep.IPTABLES, "-t", constants.NAT, "-A", constants.OUTPUT, "-p", constants.UDP, "--dport", "53", "-j", constants.ISTIODNS)
+	ext.RunOrFail(dep.IPTABLES, "-t", constants.NAT, "-A", constants.OUTPUT, "-p", constants.TCP, "--dport", "53", "-j", constants.ISTIODNS)
+
+	// Don't redirect the queries forwarded upstream by the DNS proxy.
+	for _, uid := range split(config.ProxyUID) {
+		ext.RunOrFail(dep.IPTABLES, "-t", constants.NAT, "-A", constants.ISTIODNS, "-m", "owner", "--uid-owner", uid, "-j", constants.RETURN)
+	}
+	for _, gid := range split(config.ProxyGID) {
+		ext.RunOrFail(dep.IPTABLES, "-t", constants.NAT, "-A", constants.ISTIODNS, "-m", "owner", "--gid-owner", gid, "-j", constants.RETURN)
+	}
+
+	ext.RunOrFail(dep.IPTABLES, "-t", constants.NAT, "-A", constants.ISTIODNS, "-p", constants.UDP, "-j", constants.REDIRECT,
+		"--to-port", config.DNSCapturePort)
+	ext.RunOrFail(dep.IPTABLES, "-t", constants.NAT, "-A", constants.ISTIODNS, "-p", constants.TCP, "-j", constants.REDIRECT,
+		"--to-port", config.DNSCapturePort)
+}
+
 func handleInboundIpv6Rules(ext dep.Dependencies, config *config.Config, ipv6RangesExclude NetworkRange, ipv6RangesInclude NetworkRange) {
 	// If ENABLE_INBOUND_IPV6 is unset (default unset), restrict IPv6 traffic.
 	if config.EnableInboundIPv6s != nil {
@@ -427,6 +455,7 @@ func run(config *config.Config) {
 	}
 
 	handleInboundPortsInclude(ext, config)
+	handleDNSRedirect(ext, config)
 
 	// TODO: change the default behavior to not intercept any output - user may use http_proxy or another
 	// iptablesOrFail wrapper (like ufw). Current default is similar with 0.1
@@ -39,6 +39,7 @@ type Config struct {
 	OutboundIPRangesInclude string `json:"OUTBOUND_IPRANGES_INCLUDE"`
 	OutboundIPRangesExclude string `json:"OUTBOUND_IPRANGES_EXCLUDE"`
 	KubevirtInterfaces      string `json:"KUBEVIRT_INTERFACES"`
+	DNSCapturePort          string `json:"DNS_CAPTURE_PORT"`
 	EnableInboundIPv6s      net.IP `json:"ENABLE_INBOUND_IPV6"`
 }
 
@@ -65,6 +66,7 @@ func (c *Config) Print() {
 	fmt.Println(fmt.Sprintf("OUTBOUND_IP_RANGES_EXCLUDE=%s", c.OutboundIPRangesExclude))
 	fmt.Println(fmt.Sprintf("OUTBOUND_PORTS_EXCLUDE=%s", c.OutboundPortsExclude))
 	fmt.Println(fmt.Sprintf("KUBEVIRT_INTERFACES=%s", c.KubevirtInterfaces))
+	fmt.Println(fmt.Sprintf("DNS_CAPTURE_PORT=%s", c.DNSCapturePort))
 	// Print "" instead of <nil> to produce same output as script and satisfy golden tests
 	if c.EnableInboundIPv6s == nil {
 		fmt.Println(fmt.Sprintf("ENABLE_INBOUND_IPV6=%s", ""))
@@ -20,6 +20,7 @@ const (
 	NAT    = "nat"
 
 	TCP = "tcp"
+	UDP = "udp"
 
 	TPROXY          = "TPROXY"
 	PREROUTING      = "PREROUTING"
@@ -36,6 +37,7 @@ const (
 	ISTIOTPROXY     = "ISTIO_TPROXY"
 	ISTIOREDIRECT   = "ISTIO_REDIRECT"
 	ISTIOINREDIRECT = "ISTIO_IN_REDIRECT"
+	ISTIODNS        = "ISTIO_DNS"
 )
 
 // Constants used in cobra/viper CLI
@@ -53,6 +55,7 @@ const (
 	ProxyUID                  = "proxy-uid"
 	ProxyGID                  = "proxy-gid"
 	KubeVirtInterfaces        = "kube-virt-interfaces"
+	DNSCapturePort            = "dns-capture-port"
 	DryRun                    = "dry-run"
 	Clean                     = "clean"
 )
@@ -19,7 +19,7 @@
 # Initialization script responsible for setting up port forwarding for Istio sidecar.
 
 function usage() {
-  echo "${0} -p PORT -u UID -g GID [-m mode] [-b ports] [-d ports] [-i CIDR] [-x CIDR] [-k interfaces] [-t] [-h]"
+  echo "${0} -p PORT -u UID -g GID [-m mode] [-b ports] [-d ports] [-i CIDR] [-x CIDR] [-k interfaces] [-s port] [-t] [-h]"
   echo ''
   # shellcheck disable=SC2016
   echo '  -p: Specify the envoy port to which redirect all TCP traffic (default $ENVOY_PORT = 15001)'
@@ -51,6 +51,9 @@ function usage() {
   echo '  -o: Comma separated list of outbound ports to be excluded from redirection to Envoy (optional).'
   echo '  -k: Comma separated list of virtual interfaces whose inbound traffic (from VM)'
   echo '      will be treated as outbound (optional)'
+  echo '  -s: Port to which all outbound DNS traffic (UDP and TCP port 53) should be redirected to (optional). An'
+  # shellcheck disable=SC2016
+  echo '      empty value will disable DNS redirection (default to $DNS_CAPTURE_PORT)'
   echo '  -t: Unit testing, only functions are loaded and no other instructions are executed.'
   echo '  -h: Displays usage information and exits.'
   # shellcheck disable=SC2016
@@ -137,8 +140,9 @@ OUTBOUND_IP_RANGES_INCLUDE=${ISTIO_SERVICE_CIDR-}
 OUTBOUND_IP_RANGES_EXCLUDE=${ISTIO_SERVICE_EXCLUDE_CIDR-}
 OUTBOUND_PORTS_EXCLUDE=${ISTIO_LOCAL_OUTBOUND_PORTS_EXCLUDE-}
 KUBEVIRT_INTERFACES=
+DNS_CAPTURE_PORT=${DNS_CAPTURE_PORT-}
 
-while getopts ":p:z:u:g:m:b:d:o:i:x:k:ht" opt; do
+while getopts ":p:z:u:g:m:b:d:o:i:x:k:s:ht" opt; do
   case ${opt} in
     p)
       PROXY_PORT=${OPTARG}
@@ -173,6 +177,9 @@ while getopts ":p:z:u:g:m:b:d:o:i:x:k:ht" opt; do
     k)
       KUBEVIRT_INTERFACES=${OPTARG}
       ;;
+    s)
+      DNS_CAPTURE_PORT=${OPTARG}
+      ;;
     t)
       echo "Unit testing is specified..."
       return
@@ -259,6 +266,8 @@ fi
 iptables -t nat -D PREROUTING -p tcp -j ISTIO_INBOUND 2>/dev/null
 iptables -t mangle -D PREROUTING -p tcp -j ISTIO_INBOUND 2>/dev/null
 iptables -t nat -D OUTPUT -p tcp -j ISTIO_OUTPUT 2>/dev/null
+iptables -t nat -D OUTPUT -p udp --dport 53 -j ISTIO_DNS 2>/dev/null
+iptables -t nat -D OUTPUT -p tcp --dport 53 -j ISTIO_DNS 2>/dev/null
 
 # Flush and delete the istio chains.
 iptables -t nat -F ISTIO_OUTPUT 2>/dev/null
@@ -271,6 +280,8 @@ iptables -t mangle -F ISTIO_DIVERT 2>/dev/null
 iptables -t mangle -X ISTIO_DIVERT 2>/dev/null
 iptables -t mangle -F ISTIO_TPROXY 2>/dev/null
 iptables -t mangle -X ISTIO_TPROXY 2>/dev/null
+iptables -t nat -F ISTIO_DNS 2>/dev/null
+iptables -t nat -X ISTIO_DNS 2>/dev/null
 
 # Must be last, the others refer to it
 iptables -t nat -F ISTIO_REDIRECT 2>/dev/null
@@ -310,6 +321,7 @@ echo "OUTBOUND_IP_RANGES_INCLUDE=${OUTBOUND_IP_RANGES_INCLUDE}"
 echo "OUTBOUND_IP_RANGES_EXCLUDE=${OUTBOUND_IP_RANGES_EXCLUDE}"
 echo "OUTBOUND_PORTS_EXCLUDE=${OUTBOUND_PORTS_EXCLUDE}"
 echo "KUBEVIRT_INTERFACES=${KUBEVIRT_INTERFACES}"
+echo "DNS_CAPTURE_PORT=${DNS_CAPTURE_PORT}"
 echo "ENABLE_INBOUND_IPV6=${ENABLE_INBOUND_IPV6}"
 echo
 
@@ -411,6 +423,25 @@ if [ -n "${INBOUND_PORTS_INCLUDE}" ]; then
   fi
 fi
 
+# Redirect the DNS queries of the applications to the DNS proxy of the agent. Must be applied before
+# the outbound tcp traffic is redirected to Envoy.
+if [ -n "${DNS_CAPTURE_PORT}" ]; then
+  iptables -t nat -N ISTIO_DNS
+  iptables -t nat -A OUTPUT -p udp --dport 53 -j ISTIO_DNS
+  iptables -t nat -A OUTPUT -p tcp --dport 53 -j ISTIO_DNS
+
+  # Don't redirect the queries forwarded upstream by the DNS proxy.
+  for uid in ${PROXY_UID}; do
+    iptables -t nat -A ISTIO_DNS -m owner --uid-owner "${uid}" -j RETURN
+  done
+  for gid in ${PROXY_GID}; do
+    iptables -t nat -A ISTIO_DNS -m owner --gid-owner "${gid}" -j RETURN
+  done
+
+  iptables -t nat -A ISTIO_DNS -p udp -j REDIRECT --to-port "${DNS_CAPTURE_PORT}"
+  iptables -t nat -A ISTIO_DNS -p tcp -j REDIRECT --to-port "${DNS_CAPTURE_PORT}"
+fi
+
 # TODO: change the default behavior to not intercept any output - user may use http_proxy or another
 # iptables wrapper (like ufw). Current default is similar with 0.1
 